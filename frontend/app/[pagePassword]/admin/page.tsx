@@ -1,5 +1,6 @@
 import { ClientControls } from '@/components/admin/client-controls';
 import { ConnectionsTable } from '@/components/admin/connections-table';
+import { DevicePairing } from '@/components/admin/device-pairing';
 
 interface AdminPageProps {
   params: Promise<{
@@ -20,6 +21,7 @@ export default async function AdminPage({ params }: AdminPageProps) {
         <div className="grid gap-6">
           <ClientControls password={pagePassword} />
           <ConnectionsTable password={pagePassword} />
+          <DevicePairing password={pagePassword} />
         </div>
       </div>
     </main>
@@ -0,0 +1,14 @@
+import { Metadata } from 'next';
+
+export const metadata: Metadata = {
+  title: 'Pair Display | Active911',
+  description: 'Pair a station display with the server',
+};
+
+interface PairLayoutProps {
+  children: React.ReactNode;
+}
+
+export default function PairLayout({ children }: PairLayoutProps) {
+  return <div className="min-h-screen bg-slate-900 flex flex-col p-0 m-0 overflow-hidden">{children}</div>;
+}
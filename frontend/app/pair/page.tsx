@@ -0,0 +1,45 @@
+'use client';
+
+import { MapProvider } from '@/providers/map-provider';
+import { WeatherProvider } from '@/providers/weather-provider';
+import { DashboardProvider } from '@/providers/dashboard-provider';
+import Dashboard from '@/components/dashboard';
+import { useDevicePairing } from '@/hooks/use-device-pairing';
+import { stations } from '@/lib/data';
+
+// Displays open /pair instead of a URL with the page password. Until an admin approves the
+// code shown here, the display has no credential; afterwards it shows its station's dashboard.
+export default function PairPage() {
+  const pairing = useDevicePairing();
+
+  if (pairing.status === 'paired') {
+    const { credential, device } = pairing.paired;
+    const stationData = stations[device.station as keyof typeof stations];
+    const center = stationData ? { lat: parseFloat(stationData.latitude), lng: parseFloat(stationData.longitude) } : undefined;
+
+    return (
+      <MapProvider>
+        <DashboardProvider password={credential} station={device.station} center={center} markers={center ? [center] : undefined}>
+          <WeatherProvider>
+            <Dashboard />
+          </WeatherProvider>
+        </DashboardProvider>
+      </MapProvider>
+    );
+  }
+
+  return (
+    <main className="flex flex-1 flex-col items-center justify-center gap-6 text-white text-center p-8">
+      <h1 className="text-3xl font-bold">Pair this display</h1>
+      {pairing.status === 'pending' && (
+        <>
+          <p className="text-slate-300 text-xl">In the admin page, approve this code under Device Pairing:</p>
+          <p className="font-mono text-7xl font-bold tracking-widest">{pairing.code}</p>
+          <p className="text-slate-400">A new code is shown once this one expires.</p>
+        </>
+      )}
+      {pairing.status === 'starting' && <p className="text-slate-300 text-xl">Requesting a pairing code...</p>}
+      {pairing.status === 'error' && <p className="text-red-400 text-xl">{pairing.message}</p>}
+    </main>
+  );
+}
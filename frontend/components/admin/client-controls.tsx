@@ -7,6 +7,7 @@ import { Input } from '@/components/ui/input';
 import { Card } from '@/components/ui/card';
 import { Progress } from '@/components/ui/progress';
 import { HydrantBatchUploadProgress } from '@/lib/types';
+import { authHeaders } from '@/lib/api';
 
 interface ClientControlsProps {
   password: string;
@@ -42,7 +43,9 @@ export function ClientControls({ password }: ClientControlsProps) {
   // Check upload status
   const checkUploadStatus = async () => {
     try {
-      const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/hydrants/status?password=${password}`);
+      const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/hydrants/status`, {
+        headers: authHeaders(password),
+      });
 
       if (!res.ok) {
         throw new Error('Failed to check upload status');
@@ -129,9 +132,10 @@ export function ClientControls({ password }: ClientControlsProps) {
       }
 
       // Upload to API
-      const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/hydrants?password=${password}`, {
+      const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/hydrants`, {
         method: 'POST',
         headers: {
+          ...authHeaders(password),
           'Content-Type': 'application/json',
         },
         body: JSON.stringify(hydrants)
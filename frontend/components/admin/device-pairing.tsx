@@ -0,0 +1,220 @@
+'use client';
+
+import React, { useState } from 'react';
+import { formatDistanceToNow } from 'date-fns';
+import { Check, MonitorSmartphone, RefreshCw, X } from 'lucide-react';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from '@/components/ui/table';
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select';
+import { Button } from '@/components/ui/button';
+import { Badge } from '@/components/ui/badge';
+import { Input } from '@/components/ui/input';
+import { useDevices } from '@/hooks/use-devices';
+import { stations } from '@/lib/data';
+import { DevicePairing as Pairing } from '@/lib/types';
+
+// Roles a display can be paired with
+const deviceRoles = ['display', 'viewer'];
+
+interface DevicePairingProps {
+  password: string;
+}
+
+interface PendingPairingRowProps {
+  pairing: Pairing;
+  onApprove: (name: string, station: string, role: string, group: string) => Promise<boolean>;
+  onDeny: () => Promise<boolean>;
+}
+
+// A pending code with the station, role and group it is approved with
+function PendingPairingRow({ pairing, onApprove, onDeny }: PendingPairingRowProps) {
+  const [name, setName] = useState('');
+  const [station, setStation] = useState('');
+  const [role, setRole] = useState(deviceRoles[0]);
+  const [group, setGroup] = useState('');
+  const [busy, setBusy] = useState(false);
+
+  const handle = async (action: () => Promise<boolean>) => {
+    setBusy(true);
+    await action();
+    setBusy(false);
+  };
+
+  return (
+    <TableRow>
+      <TableCell className="font-mono text-lg font-bold">{pairing.code}</TableCell>
+      <TableCell className="text-xs">
+        <div className="font-mono">{pairing.remote_addr}</div>
+        <div className="text-muted-foreground truncate max-w-[200px]" title={pairing.user_agent}>
+          {pairing.user_agent}
+        </div>
+      </TableCell>
+      <TableCell className="text-xs">{formatDistanceToNow(new Date(pairing.expires_at), { addSuffix: true })}</TableCell>
+      <TableCell>
+        <div className="flex flex-wrap gap-2">
+          <Input className="w-40" placeholder="Name" value={name} onChange={(e) => setName(e.target.value)} disabled={busy} />
+          <Select value={station} onValueChange={setStation} disabled={busy}>
+            <SelectTrigger className="w-32">
+              <SelectValue placeholder="Station" />
+            </SelectTrigger>
+            <SelectContent>
+              {Object.keys(stations).map((id) => (
+                <SelectItem key={id} value={id}>
+                  Station {id}
+                </SelectItem>
+              ))}
+            </SelectContent>
+          </Select>
+          <Select value={role} onValueChange={setRole} disabled={busy}>
+            <SelectTrigger className="w-28">
+              <SelectValue />
+            </SelectTrigger>
+            <SelectContent>
+              {deviceRoles.map((deviceRole) => (
+                <SelectItem key={deviceRole} value={deviceRole}>
+                  {deviceRole}
+                </SelectItem>
+              ))}
+            </SelectContent>
+          </Select>
+          <Input className="w-32" placeholder="Group" value={group} onChange={(e) => setGroup(e.target.value)} disabled={busy} />
+        </div>
+      </TableCell>
+      <TableCell className="text-right">
+        <div className="flex justify-end gap-2">
+          <Button size="sm" onClick={() => handle(() => onApprove(name, station, role, group))} disabled={busy || !station}>
+            <Check className="h-4 w-4 mr-1" />
+            Approve
+          </Button>
+          <Button size="sm" variant="outline" onClick={() => handle(onDeny)} disabled={busy}>
+            <X className="h-4 w-4 mr-1" />
+            Deny
+          </Button>
+        </div>
+      </TableCell>
+    </TableRow>
+  );
+}
+
+export function DevicePairing({ password }: DevicePairingProps) {
+  const { pairings, devices, error, refreshDevices, approvePairing, denyPairing, revokeDevice } = useDevices(password);
+
+  const pairedDevices = devices.filter((device) => !device.revoked_at);
+
+  const handleRevoke = (deviceId: string, name: string) => {
+    if (window.confirm(`Revoke ${name}? The display will have to be paired again.`)) {
+      revokeDevice(deviceId);
+    }
+  };
+
+  return (
+    <div className="w-full space-y-4">
+      <div className="flex items-center gap-4">
+        <MonitorSmartphone className="h-5 w-5" />
+        <h1 className="text-2xl font-bold">Device Pairing</h1>
+      </div>
+
+      <Card className="w-full shadow-sm">
+        <CardHeader className="flex flex-row items-center justify-between pb-2">
+          <div>
+            <CardTitle className="text-xl font-bold">Pending Codes</CardTitle>
+            <CardDescription>Codes shown on displays opened at /pair. Approve a code to bind the display to a station.</CardDescription>
+          </div>
+          <Button variant="outline" size="sm" onClick={refreshDevices}>
+            <RefreshCw className="h-4 w-4 mr-2" />
+            Refresh
+          </Button>
+        </CardHeader>
+        <CardContent>
+          {error && <p className="text-sm text-red-500 mb-2">{error}</p>}
+          {pairings.length === 0 ? (
+            <div className="flex justify-center items-center h-24">
+              <p className="text-muted-foreground">No displays are waiting to be paired</p>
+            </div>
+          ) : (
+            <div className="rounded-md border">
+              <Table>
+                <TableHeader>
+                  <TableRow>
+                    <TableHead>Code</TableHead>
+                    <TableHead>Display</TableHead>
+                    <TableHead>Expires</TableHead>
+                    <TableHead>Pair As</TableHead>
+                    <TableHead className="text-right">Actions</TableHead>
+                  </TableRow>
+                </TableHeader>
+                <TableBody>
+                  {pairings.map((pairing) => (
+                    <PendingPairingRow
+                      key={pairing.id}
+                      pairing={pairing}
+                      onApprove={(name, station, role, group) => approvePairing({ code: pairing.code, name, station, role, group })}
+                      onDeny={() => denyPairing(pairing.id)}
+                    />
+                  ))}
+                </TableBody>
+              </Table>
+            </div>
+          )}
+        </CardContent>
+      </Card>
+
+      <Card className="w-full shadow-sm">
+        <CardHeader className="pb-2">
+          <CardTitle className="text-xl font-bold">Paired Devices</CardTitle>
+          <CardDescription>Revoking a device closes its connections and makes it pair again</CardDescription>
+        </CardHeader>
+        <CardContent>
+          {pairedDevices.length === 0 ? (
+            <div className="flex justify-center items-center h-24">
+              <p className="text-muted-foreground">No paired devices</p>
+            </div>
+          ) : (
+            <div className="rounded-md border">
+              <Table>
+                <TableHeader>
+                  <TableRow>
+                    <TableHead>Name</TableHead>
+                    <TableHead>Station</TableHead>
+                    <TableHead>Role</TableHead>
+                    <TableHead>Last Seen</TableHead>
+                    <TableHead>Paired By</TableHead>
+                    <TableHead className="text-right">Actions</TableHead>
+                  </TableRow>
+                </TableHeader>
+                <TableBody>
+                  {pairedDevices.map((device) => (
+                    <TableRow key={device.id}>
+                      <TableCell className="font-medium">{device.name}</TableCell>
+                      <TableCell>
+                        {device.station}
+                        {device.group && (
+                          <Badge variant="secondary" className="ml-2">
+                            {device.group}
+                          </Badge>
+                        )}
+                      </TableCell>
+                      <TableCell>{device.role}</TableCell>
+                      <TableCell className="text-xs">
+                        {device.last_seen_at ? formatDistanceToNow(new Date(device.last_seen_at), { addSuffix: true }) : 'Never'}
+                        {device.last_seen_ip && <div className="font-mono text-muted-foreground">{device.last_seen_ip}</div>}
+                      </TableCell>
+                      <TableCell className="text-xs">{device.paired_by}</TableCell>
+                      <TableCell className="text-right">
+                        <Button size="sm" variant="destructive" onClick={() => handleRevoke(device.id, device.name)}>
+                          Revoke
+                        </Button>
+                      </TableCell>
+                    </TableRow>
+                  ))}
+                </TableBody>
+              </Table>
+            </div>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  );
+}
+
+export default DevicePairing;
@@ -9,6 +9,7 @@ import { Badge } from '@/components/ui/badge';
 import { ScrollArea } from '@/components/ui/scroll-area';
 import { formatDistanceToNow } from 'date-fns';
 import useSWR from 'swr';
+import { authHeaders } from '@/lib/api';
 import { Skeleton } from '../ui/skeleton';
 const methodColors = {
   GET: 'bg-blue-500',
@@ -20,9 +21,10 @@ const methodColors = {
   HEAD: 'bg-gray-400',
 };
 
-const fetcher = async (url: string) => {
+const fetcher = async ([url, password]: [string, string]) => {
   const res = await fetch(url, {
     headers: {
+      ...authHeaders(password),
       'ngrok-skip-browser-warning': '1',
     },
   });
@@ -40,7 +42,7 @@ export const LogDetailSidebar = () => {
     data: log,
     error,
     isLoading: logLoading,
-  } = useSWR<RequestLog>(selectedLog?.id ? `${process.env.NEXT_PUBLIC_API_URL}/logs/${selectedLog.id}?password=${password}` : null, fetcher);
+  } = useSWR<RequestLog>(selectedLog?.id ? [`${process.env.NEXT_PUBLIC_API_URL}/logs/${selectedLog.id}`, password] : null, fetcher);
 
   // eslint-disable-next-line @typescript-eslint/no-explicit-any
   const formatJSON = (data: any) => {
@@ -1,5 +1,6 @@
 'use client';
 
+import { authHeaders, websocketUrl } from '@/lib/api';
 import type { Alert } from '@/lib/types';
 import EventEmitter from 'events';
 import { useEffect, useState, useRef, useCallback } from 'react';
@@ -81,12 +82,10 @@ export function useAlerts({ password, limit = 10 }: UseAlertsOptions = {}) {
       const queryParams = new URLSearchParams();
       queryParams.set('limit', limit.toString());
       queryParams.set('offset', ((page - 1) * limit).toString());
-      if (password) {
-        queryParams.set('password', password);
-      }
 
       const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/alerts?${queryParams.toString()}`, {
         headers: {
+          ...authHeaders(password),
           'ngrok-skip-browser-warning': 'true',
         },
       });
@@ -113,7 +112,7 @@ export function useAlerts({ password, limit = 10 }: UseAlertsOptions = {}) {
         setLoading(false);
       }
     }
-  }, [page, limit]);
+  }, [page, limit, password]);
 
   useEffect(() => {
     fetchAlerts();
@@ -141,14 +140,14 @@ export function useAlerts({ password, limit = 10 }: UseAlertsOptions = {}) {
     // Reset attempts when explicitly connecting (not reconnecting)
     reconnectAttemptsRef.current = 0;
 
-    const attemptConnect = () => {
+    const attemptConnect = async () => {
       if (!isMountedRef.current) return;
 
-      // Build WebSocket URL with current password
-      const queryParams = password ? `?password=${password}` : '';
-      const wsUrl = `${process.env.NEXT_PUBLIC_WEBSOCKET_URL}/ws/dashboard${queryParams}`;
-
       try {
+        // Exchange the password for a single-use ticket, it is never put in the URL
+        const wsUrl = await websocketUrl('dashboard', password);
+        if (!isMountedRef.current) return;
+
         const websocket = new WebSocket(wsUrl);
 
         // Register this connection and get a unique ID
@@ -1,5 +1,6 @@
 'use client';
 
+import { websocketUrl } from '@/lib/api';
 import { useCallback, useEffect, useRef, useState } from 'react';
 
 // Create a global connection tracker to prevent multiple connections
@@ -120,7 +121,7 @@ export function useClientControls({ password }: UseClientControlsOptions) {
     // Reset attempts when explicitly connecting (not reconnecting)
     reconnectAttemptsRef.current = 0;
 
-    const attemptConnect = () => {
+    const attemptConnect = async () => {
       if (!isMountedRef.current) return;
 
       // Client control WebSocket requires authentication
@@ -129,11 +130,11 @@ export function useClientControls({ password }: UseClientControlsOptions) {
         return;
       }
 
-      // Build WebSocket URL with required password
-      const queryParams = `?password=${password}`;
-      const wsUrl = `${process.env.NEXT_PUBLIC_WEBSOCKET_URL}/ws/client${queryParams}`;
-
       try {
+        // Exchange the password for a single-use ticket, it is never put in the URL
+        const wsUrl = await websocketUrl('client', password);
+        if (!isMountedRef.current) return;
+
         const websocket = new WebSocket(wsUrl);
 
         // Register this connection and get a unique ID
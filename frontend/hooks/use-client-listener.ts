@@ -1,5 +1,6 @@
 'use client';
 
+import { websocketUrl } from '@/lib/api';
 import { useCallback, useEffect, useRef, useState } from 'react';
 
 // Create singleton EventEmitter outside the hook to prevent multiple instances
@@ -103,18 +104,14 @@ export function useClientListener({ password, station }: UseClientListenerOption
     // Reset attempts when explicitly connecting (not reconnecting)
     reconnectAttemptsRef.current = 0;
 
-    const attemptConnect = () => {
+    const attemptConnect = async () => {
       if (!isMountedRef.current) return;
-      const searchParams = new URLSearchParams();
-      if (password) {
-        searchParams.set('password', password);
-      }
-      if (station) {
-        searchParams.set('station', station);
-      }
-      const wsUrl = `${process.env.NEXT_PUBLIC_WEBSOCKET_URL}/ws/client?${searchParams.toString()}`;
 
       try {
+        // Exchange the password for a single-use ticket bound to the station
+        const wsUrl = await websocketUrl('client', password, station);
+        if (!isMountedRef.current) return;
+
         const websocket = new WebSocket(wsUrl);
 
         // Register this connection and get a unique ID
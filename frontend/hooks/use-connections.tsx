@@ -1,5 +1,6 @@
 
 
+import { authHeaders } from '@/lib/api';
 import { useState, useEffect, useCallback } from 'react';
 
 export interface ConnectionDetail {
@@ -28,7 +29,9 @@ export function useConnections(password: string) {
   });
 
   const fetchConnections = useCallback(async (key: 'dashboard' | 'client') => {
-    const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/connections/${key}?password=${password}`);
+    const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/connections/${key}`, {
+      headers: authHeaders(password),
+    });
     if (!response.ok) {
       console.error(`Failed to fetch ${key} connections`);
       return;
@@ -1,5 +1,6 @@
 'use client';
 
+import { authHeaders, websocketUrl } from '@/lib/api';
 import type { Alert } from '@/lib/types';
 import EventEmitter from 'events';
 import { useEffect, useState, useRef, useCallback } from 'react';
@@ -86,13 +87,13 @@ export function useDashboardSocket({ password, limit = 10, station }: UseDashboa
       const queryParams = new URLSearchParams();
       queryParams.set('limit', limit.toString());
       queryParams.set('offset', ((page - 1) * limit).toString());
-      if (password) {
-        queryParams.set('password', password);
-      }
       const abortController = new AbortController();
       const timeout = setTimeout(() => abortController.abort(), 10000);
 
-      const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/alerts?${queryParams.toString()}`, { signal: abortController.signal });
+      const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/alerts?${queryParams.toString()}`, {
+        headers: authHeaders(password),
+        signal: abortController.signal,
+      });
 
 
       if (!isMountedRef.current) return;
@@ -165,21 +166,14 @@ export function useDashboardSocket({ password, limit = 10, station }: UseDashboa
     // Reset attempts when explicitly connecting (not reconnecting)
     reconnectAttemptsRef.current = 0;
 
-    const attemptConnect = () => {
+    const attemptConnect = async () => {
       if (!isMountedRef.current) return;
 
-      // Build WebSocket URL with current password and station
-      const queryParams = new URLSearchParams();
-      if (password) {
-        queryParams.set('password', password);
-      }
-      if (station) {
-        queryParams.set('station', station);
-      }
-
-      const wsUrl = `${process.env.NEXT_PUBLIC_WEBSOCKET_URL}/ws/dashboard?${queryParams.toString()}`;
-
       try {
+        // Exchange the password for a single-use ticket bound to the station
+        const wsUrl = await websocketUrl('dashboard', password, station);
+        if (!isMountedRef.current) return;
+
         const websocket = new WebSocket(wsUrl);
 
         // Register this connection and get a unique ID
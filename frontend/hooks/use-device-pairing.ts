@@ -0,0 +1,138 @@
+'use client';
+
+import { authHeaders } from '@/lib/api';
+import { Device } from '@/lib/types';
+import { useEffect, useState } from 'react';
+
+// The device credential is kept in local storage, so the display stays paired across reloads
+const DEVICE_STORAGE_KEY = 'paired_device';
+
+// Claims share the login rate limit of 10 requests a minute per address
+const CLAIM_POLL_INTERVAL = 10000;
+
+export interface PairedDevice {
+  credential: string;
+  device: Device;
+}
+
+export type DevicePairingState =
+  | { status: 'starting' }
+  | { status: 'pending'; code: string; expiresAt: string }
+  | { status: 'paired'; paired: PairedDevice }
+  | { status: 'error'; message: string };
+
+// Loads the stored device, or null when the display isn't paired
+function loadPairedDevice(): PairedDevice | null {
+  try {
+    const stored = localStorage.getItem(DEVICE_STORAGE_KEY);
+    return stored ? (JSON.parse(stored) as PairedDevice) : null;
+  } catch {
+    return null;
+  }
+}
+
+// Checks a stored credential with GET /auth/me, which reports a revoked one as unauthenticated.
+// An unreachable or rate limited server keeps the display paired.
+async function isRevoked(credential: string): Promise<boolean> {
+  try {
+    const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/auth/me`, {
+      headers: authHeaders(credential),
+    });
+    if (!response.ok) {
+      return false;
+    }
+    const data = await response.json();
+    return data.data?.authenticated === false;
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Pairs the display with the server. The display shows the code returned by POST /devices/pair
+ * and polls the claim endpoint until an admin approves or denies it. A denied or expired code
+ * starts over with a new one. Once approved, the device credential is stored and used as the
+ * dashboard's credential.
+ */
+export function useDevicePairing(): DevicePairingState {
+  const [state, setState] = useState<DevicePairingState>({ status: 'starting' });
+
+  useEffect(() => {
+    let cancelled = false;
+    let timeout: NodeJS.Timeout | null = null;
+
+    const wait = (callback: () => void) => {
+      if (!cancelled) {
+        timeout = setTimeout(callback, CLAIM_POLL_INTERVAL);
+      }
+    };
+
+    const claim = async (pairingId: string, pollToken: string) => {
+      try {
+        const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/devices/pair/${pairingId}/claim`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ poll_token: pollToken }),
+        });
+        if (cancelled) return;
+
+        if (response.status === 404) {
+          // Denied or expired, show a new code
+          startPairing();
+          return;
+        }
+        if (response.status === 200) {
+          const data = await response.json();
+          const paired: PairedDevice = { credential: data.data.credential, device: data.data.device };
+          localStorage.setItem(DEVICE_STORAGE_KEY, JSON.stringify(paired));
+          setState({ status: 'paired', paired });
+          return;
+        }
+      } catch (err) {
+        console.error('Error claiming device pairing:', err);
+      }
+
+      // Still pending, rate limited or unreachable
+      wait(() => claim(pairingId, pollToken));
+    };
+
+    const startPairing = async () => {
+      try {
+        const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/devices/pair`, { method: 'POST' });
+        if (!response.ok) {
+          throw new Error(`Failed to start pairing: ${response.status}`);
+        }
+        const data = await response.json();
+        if (cancelled) return;
+
+        setState({ status: 'pending', code: data.data.code, expiresAt: data.data.expires_at });
+        wait(() => claim(data.data.pairing_id, data.data.poll_token));
+      } catch (err) {
+        console.error('Error starting device pairing:', err);
+        if (cancelled) return;
+        setState({ status: 'error', message: 'Unable to reach the server, retrying...' });
+        wait(startPairing);
+      }
+    };
+
+    const start = async () => {
+      const paired = loadPairedDevice();
+      if (paired && !(await isRevoked(paired.credential))) {
+        if (!cancelled) setState({ status: 'paired', paired });
+        return;
+      }
+
+      localStorage.removeItem(DEVICE_STORAGE_KEY);
+      startPairing();
+    };
+
+    start();
+
+    return () => {
+      cancelled = true;
+      if (timeout) clearTimeout(timeout);
+    };
+  }, []);
+
+  return state;
+}
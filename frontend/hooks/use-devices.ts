@@ -0,0 +1,88 @@
+'use client';
+
+import { authHeaders } from '@/lib/api';
+import { Device, DevicePairing } from '@/lib/types';
+import { useCallback, useEffect, useState } from 'react';
+
+// Pairing codes expire after 10 minutes, so pending codes are refreshed while the page is open
+const PAIRINGS_REFRESH_INTERVAL = 10000;
+
+export interface ApprovePairingRequest {
+  code: string;
+  name: string;
+  station: string;
+  role: string;
+  group: string;
+}
+
+export function useDevices(password: string) {
+  const [pairings, setPairings] = useState<DevicePairing[]>([]);
+  const [devices, setDevices] = useState<Device[]>([]);
+  const [error, setError] = useState<string | null>(null);
+
+  // Sends a request to the devices API and returns the response data, or throws the server's error
+  const request = useCallback(
+    async (path: string, init?: RequestInit) => {
+      const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}${path}`, {
+        ...init,
+        headers: {
+          ...authHeaders(password),
+          'Content-Type': 'application/json',
+        },
+      });
+      const data = await response.json().catch(() => null);
+      if (!response.ok) {
+        throw new Error(data?.error || `Request to ${path} failed: ${response.status}`);
+      }
+      return data?.data;
+    },
+    [password]
+  );
+
+  const refreshDevices = useCallback(async () => {
+    try {
+      const [pendingPairings, pairedDevices] = await Promise.all([request('/devices/pairings'), request('/devices')]);
+      setPairings(pendingPairings ?? []);
+      setDevices(pairedDevices ?? []);
+      setError(null);
+    } catch (err) {
+      console.error('Error fetching devices:', err);
+      setError(err instanceof Error ? err.message : 'Failed to fetch devices');
+    }
+  }, [request]);
+
+  useEffect(() => {
+    refreshDevices();
+    const interval = setInterval(refreshDevices, PAIRINGS_REFRESH_INTERVAL);
+    return () => clearInterval(interval);
+  }, [refreshDevices]);
+
+  // Runs a change and refreshes the lists, reporting whether it succeeded
+  const change = useCallback(
+    async (path: string, init: RequestInit) => {
+      try {
+        await request(path, init);
+        setError(null);
+        return true;
+      } catch (err) {
+        console.error(`Error sending ${init.method} ${path}:`, err);
+        setError(err instanceof Error ? err.message : `Failed to send ${init.method} ${path}`);
+        return false;
+      } finally {
+        refreshDevices();
+      }
+    },
+    [request, refreshDevices]
+  );
+
+  const approvePairing = useCallback(
+    (approval: ApprovePairingRequest) => change('/devices/pairings/approve', { method: 'POST', body: JSON.stringify(approval) }),
+    [change]
+  );
+
+  const denyPairing = useCallback((pairingId: string) => change(`/devices/pairings/${pairingId}`, { method: 'DELETE' }), [change]);
+
+  const revokeDevice = useCallback((deviceId: string) => change(`/devices/${deviceId}`, { method: 'DELETE' }), [change]);
+
+  return { pairings, devices, error, refreshDevices, approvePairing, denyPairing, revokeDevice };
+}
@@ -0,0 +1,51 @@
+const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
+const WEBSOCKET_URL = process.env.NEXT_PUBLIC_WEBSOCKET_URL || 'ws://localhost:8080';
+
+// The password segment of public pages, which connect without a credential
+const PUBLIC_CREDENTIAL = 'public';
+
+export type WebSocketHub = 'dashboard' | 'client' | 'logs';
+
+/**
+ * Returns the Authorization header for the credential in the page URL.
+ * The credential is a login session token, or the deprecated shared API password.
+ * Credentials are never put in query strings, because those end up in proxy and access logs.
+ */
+export function authHeaders(credential?: string): Record<string, string> {
+  if (!credential || credential === PUBLIC_CREDENTIAL) {
+    return {};
+  }
+  return { Authorization: `Bearer ${credential}` };
+}
+
+/**
+ * Builds the URL of a WebSocket endpoint. With a credential, a single-use ticket bound to the
+ * station is requested from POST /ws/ticket first and passed instead of the credential.
+ * Without one the connection is anonymous, receives redacted data and has no station.
+ * A ticket can only be used once, so call this again for every reconnect.
+ */
+export async function websocketUrl(hub: WebSocketHub, credential?: string, station?: string): Promise<string> {
+  const searchParams = new URLSearchParams();
+
+  const headers = authHeaders(credential);
+  if (headers.Authorization) {
+    const response = await fetch(`${API_URL}/ws/ticket`, {
+      method: 'POST',
+      headers: {
+        ...headers,
+        'Content-Type': 'application/json',
+        'ngrok-skip-browser-warning': '1',
+      },
+      body: JSON.stringify({ hub, station: station ?? '' }),
+    });
+    if (!response.ok) {
+      throw new Error(`Failed to get a ${hub} WebSocket ticket: ${response.status}`);
+    }
+
+    const data = await response.json();
+    searchParams.set('ticket', data.data.ticket);
+  }
+
+  const query = searchParams.toString();
+  return `${WEBSOCKET_URL}/ws/${hub}${query ? `?${query}` : ''}`;
+}
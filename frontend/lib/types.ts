@@ -112,3 +112,26 @@ export interface HydrantBatchUploadProgress {
     error: string;
   }[];
 }
+
+export interface Device {
+  id: string;
+  name: string;
+  station: string;
+  role: string;
+  group?: string;
+  paired_by?: string;
+  last_seen_at?: string;
+  last_seen_ip?: string;
+  revoked_at?: string;
+  created_at: string;
+}
+
+export interface DevicePairing {
+  id: string;
+  code: string; // Short code shown on the display
+  status: 'pending' | 'approved' | 'claimed';
+  remote_addr: string;
+  user_agent: string;
+  expires_at: string;
+  created_at: string;
+}
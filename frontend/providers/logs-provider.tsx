@@ -2,6 +2,7 @@
 
 import React, { createContext, useContext, useState, useEffect, useCallback, useRef } from 'react';
 import EventEmitter from 'events';
+import { authHeaders, websocketUrl } from '@/lib/api';
 
 // Create singleton EventEmitter for logs
 export const logEmitter = new EventEmitter();
@@ -125,8 +126,8 @@ export const LogsProvider: React.FC<LogsProviderProps> = ({ children, password }
       // Get the API URL from environment or default to localhost
       const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
 
-      // Build the URL with filters and sorting - this password must match API_PASSWORD
-      let url = `${API_URL}/logs?password=${password}&limit=${LIMIT}&offset=${currentOffsetRef.current}`;
+      // Build the URL with filters and sorting, the password is sent in the Authorization header
+      let url = `${API_URL}/logs?limit=${LIMIT}&offset=${currentOffsetRef.current}`;
 
       // Add filters if present
       if (filterType) {
@@ -165,6 +166,7 @@ export const LogsProvider: React.FC<LogsProviderProps> = ({ children, password }
 
       const response = await fetch(url, {
         headers: {
+          ...authHeaders(password),
           Accept: 'application/json',
           'ngrok-skip-browser-warning': '1',
         },
@@ -213,12 +215,21 @@ export const LogsProvider: React.FC<LogsProviderProps> = ({ children, password }
     }
   };
 
-  const connectWebSocket = () => {
+  const connectWebSocket = async () => {
     // First clean up any existing connection
     cleanupWebSocket();
 
-    const API_URL = process.env.NEXT_PUBLIC_WEBSOCKET_URL || 'ws://localhost:8080';
-    const websocket = new WebSocket(`${API_URL}/ws/logs?password=${password}`);
+    // The logs hub requires a ticket, the password is exchanged for one and never put in the URL
+    let wsUrl: string;
+    try {
+      wsUrl = await websocketUrl('logs', password);
+    } catch (error) {
+      console.error('Logs WebSocket ticket error:', error);
+      return null;
+    }
+    if (!isMounted.current) return null;
+
+    const websocket = new WebSocket(wsUrl);
 
     websocket.onopen = () => {
       if (isMounted.current) {
@@ -0,0 +1,397 @@
+package active911
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Mode decides how fields of the wrong type are handled
+type Mode string
+
+const (
+	// ModeStrict rejects a payload with any field of the wrong type or value
+	ModeStrict Mode = "strict"
+	// ModeLenient converts fields where the meaning is clear, such as a number sent as a string,
+	// and drops fields that can't be used with a warning. Missing required fields are still rejected.
+	ModeLenient Mode = "lenient"
+)
+
+// ParseMode validates a mode name
+func ParseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case ModeStrict, ModeLenient:
+		return Mode(name), nil
+	default:
+		return "", fmt.Errorf("unknown Active911 parse mode %q, expected strict or lenient", name)
+	}
+}
+
+// FieldError describes a problem with one field of the payload
+type FieldError struct {
+	Field   string `json:"field"` // Dotted path such as "alert.normalized_message.lat", empty for the whole body
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem that made a payload unusable
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error summarizes the field errors
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return "invalid Active911 payload: " + formatFieldError(e.Errors[0])
+	}
+	return fmt.Sprintf("invalid Active911 payload: %s (and %d more)", formatFieldError(e.Errors[0]), len(e.Errors)-1)
+}
+
+// formatFieldError formats a field error as "field: message"
+func formatFieldError(e FieldError) string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// stringFields maps the normalized message keys to the fields they set
+var stringFields = []struct {
+	key   string
+	field func(*NormalizedMessage) **string
+}{
+	{"city", func(m *NormalizedMessage) **string { return &m.City }},
+	{"coordinate_source", func(m *NormalizedMessage) **string { return &m.CoordinateSource }},
+	{"cross_street", func(m *NormalizedMessage) **string { return &m.CrossStreet }},
+	{"custom_identifiers", func(m *NormalizedMessage) **string { return &m.CustomIdentifiers }},
+	{"description", func(m *NormalizedMessage) **string { return &m.Description }},
+	{"details", func(m *NormalizedMessage) **string { return &m.Details }},
+	{"dispatch_coords", func(m *NormalizedMessage) **string { return &m.DispatchCoords }},
+	{"map_address", func(m *NormalizedMessage) **string { return &m.MapAddress }},
+	{"map_code", func(m *NormalizedMessage) **string { return &m.MapCode }},
+	{"place", func(m *NormalizedMessage) **string { return &m.Place }},
+	{"priority", func(m *NormalizedMessage) **string { return &m.Priority }},
+	{"received", func(m *NormalizedMessage) **string { return &m.Received }},
+	{"source", func(m *NormalizedMessage) **string { return &m.Source }},
+	{"state", func(m *NormalizedMessage) **string { return &m.State }},
+	{"unit", func(m *NormalizedMessage) **string { return &m.Unit }},
+	{"units", func(m *NormalizedMessage) **string { return &m.Units }},
+}
+
+// parser collects the problems found while reading a payload
+type parser struct {
+	mode     Mode
+	errors   []FieldError
+	warnings []FieldError
+}
+
+// Parse reads an Active911 webhook body. It returns a *ValidationError listing every field
+// error when the payload can't be used. In lenient mode the fields that were converted
+// or dropped are returned as warnings. Fields the parser doesn't know are ignored.
+func Parse(body []byte, mode Mode) (Payload, []FieldError, error) {
+	p := &parser{mode: mode}
+	var payload Payload
+
+	if !json.Valid(body) {
+		p.fail("", "body is not valid JSON")
+	} else if kind(body) != kindObject {
+		p.fail("", "body must be a JSON object")
+	} else if root, ok := p.object("", body, true); ok {
+		if agency, ok := p.object("agency", root["agency"], true); ok {
+			payload.Agency = p.agency(agency)
+		}
+		if alert, ok := p.object("alert", root["alert"], true); ok {
+			payload.Alert = p.alert(alert)
+		}
+	}
+
+	if len(p.errors) > 0 {
+		return Payload{}, p.warnings, &ValidationError{Errors: p.errors}
+	}
+	return payload, p.warnings, nil
+}
+
+// agency reads the agency object
+func (p *parser) agency(fields map[string]json.RawMessage) Agency {
+	agency := Agency{
+		ID:       p.integer("agency.id", fields["id"]),
+		Timezone: deref(p.str("agency.timezone", fields["timezone"])),
+	}
+
+	name := p.str("agency.name", fields["name"])
+	if name == nil || strings.TrimSpace(*name) == "" {
+		p.fail("agency.name", "is required")
+	} else {
+		agency.Name = *name
+	}
+
+	return agency
+}
+
+// alert reads the alert object
+func (p *parser) alert(fields map[string]json.RawMessage) Alert {
+	alert := Alert{
+		ID:         deref(p.str("alert.id", fields["id"])),
+		PageGroups: p.strings("alert.pagegroups", fields["pagegroups"]),
+	}
+	if stamp := p.number("alert.stamp", fields["stamp"]); stamp != nil {
+		if *stamp < 0 {
+			p.problem("alert.stamp", "must not be negative")
+		} else {
+			alert.Stamp = *stamp
+		}
+	}
+
+	if msg, ok := p.object("alert.normalized_message", fields["normalized_message"], false); ok {
+		alert.NormalizedMessage = p.normalizedMessage(msg)
+	}
+
+	return alert
+}
+
+// normalizedMessage reads the normalized_message object
+func (p *parser) normalizedMessage(fields map[string]json.RawMessage) NormalizedMessage {
+	var msg NormalizedMessage
+	for _, f := range stringFields {
+		*f.field(&msg) = p.str("alert.normalized_message."+f.key, fields[f.key])
+	}
+	msg.Lat = p.coordinate("alert.normalized_message.lat", fields["lat"], 90)
+	msg.Lon = p.coordinate("alert.normalized_message.lon", fields["lon"], 180)
+	return msg
+}
+
+// object decodes a JSON object into its raw fields. A missing object is an error when it is required.
+func (p *parser) object(path string, raw json.RawMessage, required bool) (map[string]json.RawMessage, bool) {
+	switch kind(raw) {
+	case kindMissing:
+		if required {
+			p.fail(path, "is required")
+		}
+		return nil, false
+	case kindObject:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			p.fail(path, "must be an object")
+			return nil, false
+		}
+		return fields, true
+	default:
+		p.fail(path, "must be an object")
+		return nil, false
+	}
+}
+
+// str reads a string field. In lenient mode numbers and booleans are converted to their text.
+func (p *parser) str(path string, raw json.RawMessage) *string {
+	switch kind(raw) {
+	case kindMissing:
+		return nil
+	case kindString:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			p.problem(path, "is not a valid string")
+			return nil
+		}
+		return &s
+	case kindNumber, kindBool:
+		if p.mode == ModeLenient {
+			s := string(raw)
+			p.warn(path, "converted "+s+" to a string")
+			return &s
+		}
+		p.problem(path, "must be a string")
+		return nil
+	default:
+		p.problem(path, "must be a string")
+		return nil
+	}
+}
+
+// number reads a number field. In lenient mode a string holding a number is accepted.
+func (p *parser) number(path string, raw json.RawMessage) *float64 {
+	var text string
+	switch kind(raw) {
+	case kindMissing:
+		return nil
+	case kindNumber:
+		text = string(raw)
+	case kindString:
+		if err := json.Unmarshal(raw, &text); err != nil || strings.TrimSpace(text) == "" {
+			if p.mode == ModeLenient && err == nil {
+				return nil
+			}
+			p.problem(path, "must be a number")
+			return nil
+		}
+		if p.mode != ModeLenient {
+			p.problem(path, "must be a number, not a string")
+			return nil
+		}
+	default:
+		p.problem(path, "must be a number")
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		p.problem(path, fmt.Sprintf("%q is not a number", text))
+		return nil
+	}
+	if kind(raw) == kindString {
+		p.warn(path, fmt.Sprintf("converted %q to a number", text))
+	}
+	return &value
+}
+
+// integer reads a whole number field, zero when it is missing or unusable
+func (p *parser) integer(path string, raw json.RawMessage) int {
+	value := p.number(path, raw)
+	if value == nil {
+		return 0
+	}
+	if *value != math.Trunc(*value) || math.Abs(*value) > math.MaxInt32 {
+		p.problem(path, "must be a whole number")
+		return 0
+	}
+	return int(*value)
+}
+
+// coordinate reads a latitude or longitude. Active911 sends them as strings, so strings are
+// accepted in both modes. An empty string means the alert has no coordinates.
+func (p *parser) coordinate(path string, raw json.RawMessage, limit float64) *float64 {
+	var text string
+	switch kind(raw) {
+	case kindMissing:
+		return nil
+	case kindNumber:
+		text = string(raw)
+	case kindString:
+		if err := json.Unmarshal(raw, &text); err != nil {
+			p.problem(path, "is not a valid string")
+			return nil
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+	default:
+		p.problem(path, "must be a number or a string holding one")
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		p.problem(path, fmt.Sprintf("%q is not a number", text))
+		return nil
+	}
+	if math.Abs(value) > limit {
+		p.problem(path, fmt.Sprintf("%g is outside -%g to %g", value, limit, limit))
+		return nil
+	}
+	return &value
+}
+
+// strings reads a list of strings. In lenient mode a single string is read as a list
+// of one, and entries that aren't strings are dropped.
+func (p *parser) strings(path string, raw json.RawMessage) []string {
+	switch kind(raw) {
+	case kindMissing:
+		return nil
+	case kindString:
+		if p.mode == ModeLenient {
+			if s := p.str(path, raw); s != nil && *s != "" {
+				p.warn(path, "read a single string as a list")
+				return []string{*s}
+			}
+			return nil
+		}
+		p.problem(path, "must be a list of strings")
+		return nil
+	case kindArray:
+	default:
+		p.problem(path, "must be a list of strings")
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		p.problem(path, "must be a list of strings")
+		return nil
+	}
+
+	values := make([]string, 0, len(items))
+	for i, item := range items {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if kind(item) != kindString {
+			p.problem(itemPath, "must be a string")
+			continue
+		}
+		if s := p.str(itemPath, item); s != nil {
+			values = append(values, *s)
+		}
+	}
+	return values
+}
+
+// problem records a field of the wrong type or value: an error in strict mode,
+// and in lenient mode a warning that the field was dropped
+func (p *parser) problem(path, message string) {
+	if p.mode == ModeLenient {
+		p.warn(path, message+", ignored")
+		return
+	}
+	p.fail(path, message)
+}
+
+// fail records an error that makes the payload unusable in any mode
+func (p *parser) fail(path, message string) {
+	p.errors = append(p.errors, FieldError{Field: path, Message: message})
+}
+
+// warn records a field that was converted or dropped
+func (p *parser) warn(path, message string) {
+	p.warnings = append(p.warnings, FieldError{Field: path, Message: message})
+}
+
+// JSON value kinds, told apart by their first character
+const (
+	kindMissing = iota
+	kindObject
+	kindArray
+	kindString
+	kindNumber
+	kindBool
+	kindInvalid
+)
+
+// kind returns the kind of a raw JSON value. Null counts as missing.
+func kind(raw json.RawMessage) int {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return kindMissing
+	}
+
+	switch c := raw[0]; {
+	case c == '{':
+		return kindObject
+	case c == '[':
+		return kindArray
+	case c == '"':
+		return kindString
+	case c == 't' || c == 'f':
+		return kindBool
+	case c == '-' || (c >= '0' && c <= '9'):
+		return kindNumber
+	default:
+		return kindInvalid
+	}
+}
+
+// deref returns the string a pointer points to, or "" for nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
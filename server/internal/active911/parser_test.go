@@ -0,0 +1,183 @@
+package active911
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fields returns the sorted field paths of a list of field errors
+func fields(errs []FieldError) []string {
+	paths := make([]string, 0, len(errs))
+	for _, e := range errs {
+		paths = append(paths, e.Field)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		mode     Mode
+		errors   []string // Fields expected to be rejected, nil when the payload parses
+		warnings []string
+	}{
+		{fixture: "standard.json", mode: ModeStrict},
+		{fixture: "standard.json", mode: ModeLenient},
+		{fixture: "missing_id.json", mode: ModeStrict},
+		{fixture: "missing_id.json", mode: ModeLenient},
+		{
+			fixture: "numeric_fields.json",
+			mode:    ModeStrict,
+			errors:  []string{"agency.id", "alert.id", "alert.normalized_message.priority", "alert.pagegroups", "alert.stamp"},
+		},
+		{
+			fixture:  "numeric_fields.json",
+			mode:     ModeLenient,
+			warnings: []string{"agency.id", "alert.id", "alert.normalized_message.priority", "alert.pagegroups", "alert.stamp"},
+		},
+		{
+			fixture: "malformed_fields.json",
+			mode:    ModeStrict,
+			errors: []string{"alert.normalized_message.details", "alert.normalized_message.lat",
+				"alert.normalized_message.lon", "alert.normalized_message.units", "alert.pagegroups[1]"},
+		},
+		{
+			fixture: "malformed_fields.json",
+			mode:    ModeLenient,
+			warnings: []string{"alert.normalized_message.details", "alert.normalized_message.lat",
+				"alert.normalized_message.lon", "alert.normalized_message.units", "alert.pagegroups[1]"},
+		},
+		{fixture: "missing_agency_name.json", mode: ModeStrict, errors: []string{"agency.name"}},
+		{fixture: "missing_agency_name.json", mode: ModeLenient, errors: []string{"agency.name"}},
+		{fixture: "truncated.json", mode: ModeStrict, errors: []string{""}},
+		{fixture: "truncated.json", mode: ModeLenient, errors: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture+"/"+string(tt.mode), func(t *testing.T) {
+			_, warnings, err := Parse(readFixture(t, tt.fixture), tt.mode)
+
+			if tt.errors == nil {
+				if err != nil {
+					t.Fatalf("Expected the payload to parse, got %v", err)
+				}
+			} else {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("Expected a validation error, got %v", err)
+				}
+				if got := fields(validationErr.Errors); !reflect.DeepEqual(got, tt.errors) {
+					t.Errorf("Expected errors for %v, got %+v", tt.errors, validationErr.Errors)
+				}
+			}
+
+			if got := fields(warnings); len(got) != len(tt.warnings) || (len(got) > 0 && !reflect.DeepEqual(got, tt.warnings)) {
+				t.Errorf("Expected warnings for %v, got %+v", tt.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestParseStandardPayload(t *testing.T) {
+	payload, _, err := Parse(readFixture(t, "standard.json"), ModeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := payload.ToAlert()
+	if alert.Agency.Name != "Example County Fire District" || alert.Agency.ID != 21418 || alert.Agency.Timezone != "America/Los_Angeles" {
+		t.Errorf("Unexpected agency: %+v", alert.Agency)
+	}
+	details := alert.Alert
+	if details.ID != "419536780" || details.Stamp != 1717006713.2834 || details.Status != "new" {
+		t.Errorf("Unexpected alert: %+v", details)
+	}
+	if details.Lat != 44.052069 || details.Lon != -123.086754 {
+		t.Errorf("Expected coordinates 44.052069,-123.086754, got %v,%v", details.Lat, details.Lon)
+	}
+	if !reflect.DeepEqual(details.PageGroups, []string{"STA1", "FIRE"}) {
+		t.Errorf("Unexpected page groups: %v", details.PageGroups)
+	}
+	if details.Description == nil || *details.Description != "STRUCTURE FIRE - RESIDENTIAL" {
+		t.Errorf("Unexpected description: %v", details.Description)
+	}
+	if details.Place == nil || *details.Place != "" {
+		t.Errorf("Expected an empty place to be kept, got %v", details.Place)
+	}
+}
+
+func TestParseLenientConversions(t *testing.T) {
+	payload, _, err := Parse(readFixture(t, "numeric_fields.json"), ModeLenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Agency.ID != 3302 || payload.Alert.ID != "418002215" || payload.Alert.Stamp != 1716900012.5 {
+		t.Errorf("Expected numbers and numeric strings to be converted, got %+v", payload)
+	}
+	if !reflect.DeepEqual(payload.Alert.PageGroups, []string{"ALL"}) {
+		t.Errorf("Expected a single page group to be read as a list, got %v", payload.Alert.PageGroups)
+	}
+	msg := payload.Alert.NormalizedMessage
+	if msg.Priority == nil || *msg.Priority != "2" || msg.Lat == nil || *msg.Lat != 43.0245 {
+		t.Errorf("Unexpected normalized message: %+v", msg)
+	}
+}
+
+func TestParseLenientDropsMalformedFields(t *testing.T) {
+	payload, _, err := Parse(readFixture(t, "malformed_fields.json"), ModeLenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := payload.Alert.NormalizedMessage
+	if msg.Details != nil || msg.Units != nil || msg.Lat != nil || msg.Lon != nil {
+		t.Errorf("Expected malformed fields to be dropped rather than stringified, got %+v", msg)
+	}
+	if msg.Description == nil || *msg.Description != "VEHICLE ACCIDENT - INJURIES" {
+		t.Errorf("Expected valid fields to be kept, got %v", msg.Description)
+	}
+	if !reflect.DeepEqual(payload.Alert.PageGroups, []string{"STA2"}) {
+		t.Errorf("Expected only the string page group to be kept, got %v", payload.Alert.PageGroups)
+	}
+}
+
+func TestParseMissingID(t *testing.T) {
+	payload, _, err := Parse(readFixture(t, "missing_id.json"), ModeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := payload.ToAlert()
+	if alert.Alert.ID != "" {
+		t.Errorf("Expected no alert ID, got %q", alert.Alert.ID)
+	}
+	if alert.Alert.Lat != 0 || alert.Alert.Lon != 0 || alert.Alert.DispatchCoords != nil {
+		t.Errorf("Expected empty coordinates to be left unset, got %+v", alert.Alert)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, name := range []string{"strict", "lenient"} {
+		if mode, err := ParseMode(name); err != nil || string(mode) != name {
+			t.Errorf("Expected %s to be accepted, got %q, %v", name, mode, err)
+		}
+	}
+	if _, err := ParseMode("loose"); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
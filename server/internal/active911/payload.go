@@ -0,0 +1,90 @@
+package active911
+
+import "github.com/user/alerting/server/internal/models"
+
+// Payload is the body of an Active911 webhook
+type Payload struct {
+	Agency Agency `json:"agency"`
+	Alert  Alert  `json:"alert"`
+}
+
+// Agency identifies the Active911 agency that sent the alert
+type Agency struct {
+	Name     string `json:"name"`
+	ID       int    `json:"id"`
+	Timezone string `json:"timezone"`
+}
+
+// Alert is the alert of an Active911 webhook
+type Alert struct {
+	ID                string            `json:"id"`
+	Stamp             float64           `json:"stamp"` // Unix time the alert was created, with fractional seconds
+	PageGroups        []string          `json:"pagegroups"`
+	NormalizedMessage NormalizedMessage `json:"normalized_message"`
+}
+
+// NormalizedMessage holds the dispatch fields Active911 parsed from the CAD message.
+// Fields missing from the payload are nil.
+type NormalizedMessage struct {
+	City              *string  `json:"city"`
+	CoordinateSource  *string  `json:"coordinate_source"`
+	CrossStreet       *string  `json:"cross_street"`
+	CustomIdentifiers *string  `json:"custom_identifiers"`
+	Description       *string  `json:"description"`
+	Details           *string  `json:"details"`
+	DispatchCoords    *string  `json:"dispatch_coords"`
+	Lat               *float64 `json:"lat"` // Sent as a string by Active911
+	Lon               *float64 `json:"lon"` // Sent as a string by Active911
+	MapAddress        *string  `json:"map_address"`
+	MapCode           *string  `json:"map_code"`
+	Place             *string  `json:"place"`
+	Priority          *string  `json:"priority"`
+	Received          *string  `json:"received"`
+	Source            *string  `json:"source"`
+	State             *string  `json:"state"`
+	Unit              *string  `json:"unit"`
+	Units             *string  `json:"units"`
+}
+
+// ToAlert converts the payload to a new alert. The alert ID is empty when the payload has none.
+func (p Payload) ToAlert() models.Alert {
+	msg := p.Alert.NormalizedMessage
+
+	details := models.AlertDetails{
+		ID:                p.Alert.ID,
+		City:              msg.City,
+		CoordinateSource:  msg.CoordinateSource,
+		CrossStreet:       msg.CrossStreet,
+		CustomIdentifiers: msg.CustomIdentifiers,
+		Description:       msg.Description,
+		Details:           msg.Details,
+		DispatchCoords:    msg.DispatchCoords,
+		MapAddress:        msg.MapAddress,
+		MapCode:           msg.MapCode,
+		Place:             msg.Place,
+		Priority:          msg.Priority,
+		Received:          msg.Received,
+		Source:            msg.Source,
+		State:             msg.State,
+		Unit:              msg.Unit,
+		Units:             msg.Units,
+		PageGroups:        p.Alert.PageGroups,
+		Stamp:             p.Alert.Stamp,
+		Status:            "new",
+	}
+	if msg.Lat != nil {
+		details.Lat = *msg.Lat
+	}
+	if msg.Lon != nil {
+		details.Lon = *msg.Lon
+	}
+
+	return models.Alert{
+		Agency: models.Agency{
+			Name:     p.Agency.Name,
+			ID:       p.Agency.ID,
+			Timezone: p.Agency.Timezone,
+		},
+		Alert: details,
+	}
+}
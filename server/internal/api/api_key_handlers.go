@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// APIKeyHandler handles API key management requests
+type APIKeyHandler struct {
+	store         *storage.Storage
+	authenticator *auth.Authenticator
+	logger        *logging.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(store *storage.Storage, authenticator *auth.Authenticator, logger *logging.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		store:         store,
+		authenticator: authenticator,
+		logger:        logger,
+	}
+}
+
+// RegisterRoutes registers API routes for API keys
+func (h *APIKeyHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api-keys", auth.Require(auth.PermAPIKeysManage, h.GetAPIKeys)).Methods("GET")
+	r.HandleFunc("/api-keys", auth.Require(auth.PermAPIKeysManage, h.CreateAPIKey)).Methods("POST")
+	r.HandleFunc("/api-keys/{id}", auth.Require(auth.PermAPIKeysManage, h.RevokeAPIKey)).Methods("DELETE")
+}
+
+// apiKeyRequest is the body of POST /api-keys
+type apiKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// GetAPIKeys handles GET /api-keys requests
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	keys, err := h.store.ListAPIKeys(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve API keys")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve API keys")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    keys,
+	})
+}
+
+// CreateAPIKey handles POST /api-keys requests.
+// The key itself is only included in this response.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Missing required field: name")
+		return
+	}
+
+	createdBy := authInfo.Username
+	if createdBy == "" {
+		createdBy = string(authInfo.Method)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	plaintext, key, err := h.authenticator.CreateAPIKey(ctx, models.APIKey{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  createdBy,
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			h.logger.Error(err, "Failed to create API key")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to create API key")
+		}
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"key":     plaintext,
+			"api_key": key,
+		},
+	})
+}
+
+// RevokeAPIKey handles DELETE /api-keys/{id} requests
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Get API key ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.authenticator.RevokeAPIKey(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "API key not found or already revoked")
+		} else {
+			h.logger.Error(err, "Failed to revoke API key")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		}
+		return
+	}
+
+	h.logger.Infof("API key %s revoked", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "API key revoked successfully",
+	})
+}
+
+// respondWithError sends an error response
+func (h *APIKeyHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *APIKeyHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// AuthHandler handles login, logout and user management requests
+type AuthHandler struct {
+	store         *storage.Storage
+	authenticator *auth.Authenticator
+	logger        *logging.Logger
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(store *storage.Storage, authenticator *auth.Authenticator, logger *logging.Logger) *AuthHandler {
+	return &AuthHandler{
+		store:         store,
+		authenticator: authenticator,
+		logger:        logger,
+	}
+}
+
+// RegisterRoutes registers API routes for authentication and users
+func (h *AuthHandler) RegisterRoutes(r *mux.Router) {
+	// Session endpoints
+	r.HandleFunc("/auth/login", h.Login).Methods("POST")
+	r.HandleFunc("/auth/logout", h.Logout).Methods("POST")
+	r.HandleFunc("/auth/me", h.Me).Methods("GET")
+
+	// User management endpoints
+	r.HandleFunc("/users", auth.Require(auth.PermUsersManage, h.GetUsers)).Methods("GET")
+	r.HandleFunc("/users", auth.Require(auth.PermUsersManage, h.CreateUser)).Methods("POST")
+	r.HandleFunc("/users/{id}", auth.Require(auth.PermUsersManage, h.UpdateUser)).Methods("PUT")
+	r.HandleFunc("/users/{id}", auth.Require(auth.PermUsersManage, h.DeleteUser)).Methods("DELETE")
+}
+
+// loginRequest is the body of POST /auth/login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// userRequest is the body of POST /users and PUT /users/{id}
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	Disabled *bool  `json:"disabled"`
+}
+
+// Login handles POST /auth/login requests
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Missing required fields: username and password")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clientIP := h.authenticator.ClientIP(r)
+	token, session, user, err := h.authenticator.Login(ctx, req.Username, req.Password, clientIP, r.UserAgent())
+	if err != nil {
+		var lockoutErr *auth.LockoutError
+		if errors.As(err, &lockoutErr) {
+			h.logger.Warnf("Login for user %s from %s refused: %v", req.Username, clientIP, err)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockoutErr.RetryAfter.Seconds()))))
+			h.respondWithError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		} else if err == auth.ErrInvalidCredentials || err == auth.ErrUserDisabled {
+			h.logger.Warnf("Failed login attempt for user %s from %s", req.Username, clientIP)
+			h.respondWithError(w, http.StatusUnauthorized, "Invalid username or password")
+		} else {
+			h.logger.Error(err, "Failed to log in user")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		}
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"token":      token,
+			"expires_at": session.ExpiresAt,
+			"user":       user,
+		},
+	})
+}
+
+// Logout handles POST /auth/logout requests
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+	if authInfo.Method != auth.AuthMethodSession {
+		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: No active session")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.authenticator.Logout(ctx, authInfo.SessionID); err != nil {
+		h.logger.Error(err, "Failed to log out user")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	h.logger.Infof("User %s logged out", authInfo.Username)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+	})
+}
+
+// Me handles GET /auth/me requests
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"authenticated": authInfo.Authenticated,
+			"method":        authInfo.Method,
+			"role":          authInfo.Role,
+			"user_id":       authInfo.UserID,
+			"username":      authInfo.Username,
+		},
+	})
+}
+
+// GetUsers handles GET /users requests
+func (h *AuthHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	users, err := h.store.ListUsers(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve users")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    users,
+	})
+}
+
+// CreateUser handles POST /users requests
+func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" || req.Role == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Missing required fields: username, password and role")
+		return
+	}
+
+	if !auth.IsValidRole(auth.Role(req.Role)) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid role: "+req.Role)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := models.User{
+		Username:     req.Username,
+		PasswordHash: hash,
+		Role:         req.Role,
+	}
+	if req.Disabled != nil {
+		user.Disabled = *req.Disabled
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err = h.store.CreateUser(ctx, user)
+	if err != nil {
+		if err == storage.ErrConflict {
+			h.respondWithError(w, http.StatusConflict, "Username already exists")
+		} else {
+			h.logger.Error(err, "Failed to create user")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		}
+		return
+	}
+
+	h.logger.Infof("User %s created with role %s", user.Username, user.Role)
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// UpdateUser handles PUT /users/{id} requests
+func (h *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.store.GetUserByID(ctx, id)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "User not found")
+		} else {
+			h.logger.Error(err, "Failed to retrieve user")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		}
+		return
+	}
+
+	// Changing the password, role or disabled flag invalidates existing sessions
+	revokeSessions := false
+
+	if req.Role != "" && req.Role != user.Role {
+		if !auth.IsValidRole(auth.Role(req.Role)) {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid role: "+req.Role)
+			return
+		}
+		user.Role = req.Role
+		revokeSessions = true
+	}
+
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		user.PasswordHash = hash
+		revokeSessions = true
+	}
+
+	if req.Disabled != nil && *req.Disabled != user.Disabled {
+		user.Disabled = *req.Disabled
+		revokeSessions = true
+	}
+
+	if revokeSessions && !h.keepsEnabledAdmin(w, ctx, user.ID, &user) {
+		return
+	}
+
+	if err := h.store.UpdateUser(ctx, user); err != nil {
+		h.logger.Error(err, "Failed to update user")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+
+	if revokeSessions {
+		if err := h.authenticator.RevokeUserSessions(ctx, user.ID); err != nil {
+			h.logger.Error(err, "Failed to revoke user sessions")
+		}
+	}
+
+	h.logger.Infof("User %s updated", user.Username)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// DeleteUser handles DELETE /users/{id} requests
+func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	// Get user ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == authInfo.UserID {
+		h.respondWithError(w, http.StatusBadRequest, "Cannot delete your own account")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !h.keepsEnabledAdmin(w, ctx, id, nil) {
+		return
+	}
+
+	// Close the user's websocket connections, deleting the user would only drop their sessions
+	if err := h.authenticator.RevokeUserSessions(ctx, id); err != nil {
+		h.logger.Error(err, "Failed to revoke user sessions")
+	}
+
+	if err := h.store.DeleteUser(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "User not found")
+		} else {
+			h.logger.Error(err, "Failed to delete user")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to delete user")
+		}
+		return
+	}
+
+	h.logger.Infof("User %s deleted", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "User deleted successfully",
+	})
+}
+
+// keepsEnabledAdmin responds with an error and returns false when replacing the user with updated,
+// or deleting it when updated is nil, would leave no enabled admin to manage users
+func (h *AuthHandler) keepsEnabledAdmin(w http.ResponseWriter, ctx context.Context, id string, updated *models.User) bool {
+	users, err := h.store.ListUsers(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve users")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return false
+	}
+
+	if !hasEnabledAdmin(users, id, updated) {
+		h.respondWithError(w, http.StatusConflict, "At least one enabled admin is required")
+		return false
+	}
+	return true
+}
+
+// hasEnabledAdmin reports whether an enabled admin remains once the user with the given ID
+// is replaced by updated, or deleted when updated is nil. Only changes that take away
+// the last enabled admin are refused, so setups that have none can still be repaired.
+func hasEnabledAdmin(users []models.User, id string, updated *models.User) bool {
+	isEnabledAdmin := func(u models.User) bool {
+		return u.Role == string(auth.RoleAdmin) && !u.Disabled
+	}
+
+	before, after := 0, 0
+	for _, u := range users {
+		if isEnabledAdmin(u) {
+			before++
+		}
+		if u.ID == id {
+			if updated == nil {
+				continue
+			}
+			u = *updated
+		}
+		if isEnabledAdmin(u) {
+			after++
+		}
+	}
+	return after > 0 || before == 0
+}
+
+// respondWithError sends an error response
+func (h *AuthHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *AuthHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
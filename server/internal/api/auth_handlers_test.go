@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+func TestHasEnabledAdmin(t *testing.T) {
+	users := []models.User{
+		{ID: "1", Username: "chief", Role: "admin"},
+		{ID: "2", Username: "captain", Role: "admin", Disabled: true},
+		{ID: "3", Username: "operator", Role: "operator"},
+	}
+
+	tests := []struct {
+		name    string
+		users   []models.User
+		id      string
+		updated *models.User
+		want    bool
+	}{
+		{name: "demote last admin", users: users, id: "1", updated: &models.User{ID: "1", Role: "viewer"}, want: false},
+		{name: "disable last admin", users: users, id: "1", updated: &models.User{ID: "1", Role: "admin", Disabled: true}, want: false},
+		{name: "delete last admin", users: users, id: "1", want: false},
+		{name: "change last admin password", users: users, id: "1", updated: &models.User{ID: "1", Role: "admin"}, want: true},
+		{name: "demote other user", users: users, id: "3", updated: &models.User{ID: "3", Role: "viewer"}, want: true},
+		{name: "delete disabled admin", users: users, id: "2", want: true},
+		{name: "enable another admin", users: users, id: "2", updated: &models.User{ID: "2", Role: "admin"}, want: true},
+		{
+			name:    "demote one of two admins",
+			users:   append([]models.User{{ID: "4", Username: "deputy", Role: "admin"}}, users...),
+			id:      "1",
+			updated: &models.User{ID: "1", Role: "viewer"},
+			want:    true,
+		},
+		{
+			name:    "no admin to begin with",
+			users:   []models.User{{ID: "3", Role: "operator"}},
+			id:      "3",
+			updated: &models.User{ID: "3", Role: "viewer"},
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasEnabledAdmin(tt.users, tt.id, tt.updated); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
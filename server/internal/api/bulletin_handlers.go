@@ -0,0 +1,333 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/bulletin"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// maxBulletinLength bounds the length of a bulletin message, which has to fit on a display
+const maxBulletinLength = 500
+
+// BulletinHandler handles requests for bulletins shown on station displays
+type BulletinHandler struct {
+	store     *storage.Storage
+	bulletins *bulletin.Service
+	logger    *logging.Logger
+}
+
+// NewBulletinHandler creates a new bulletin handler
+func NewBulletinHandler(store *storage.Storage, bulletins *bulletin.Service, logger *logging.Logger) *BulletinHandler {
+	return &BulletinHandler{
+		store:     store,
+		bulletins: bulletins,
+		logger:    logger,
+	}
+}
+
+// RegisterRoutes registers API routes for bulletins
+func (h *BulletinHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/bulletins", auth.Require(auth.PermClientControl, h.GetBulletins)).Methods("GET")
+	r.HandleFunc("/bulletins", auth.Require(auth.PermClientControl, h.CreateBulletin)).Methods("POST")
+	r.HandleFunc("/bulletins/active", auth.Require(auth.PermClientControl, h.GetActiveBulletins)).Methods("GET")
+	r.HandleFunc("/bulletins/{id}", auth.Require(auth.PermClientControl, h.GetBulletin)).Methods("GET")
+	r.HandleFunc("/bulletins/{id}", auth.Require(auth.PermClientControl, h.UpdateBulletin)).Methods("PUT")
+	r.HandleFunc("/bulletins/{id}", auth.Require(auth.PermClientControl, h.DeleteBulletin)).Methods("DELETE")
+	r.HandleFunc("/bulletins/{id}/expire", auth.Require(auth.PermClientControl, h.ExpireBulletin)).Methods("POST")
+}
+
+// bulletinRequest is the body of POST /bulletins and PUT /bulletins/{id}
+type bulletinRequest struct {
+	Message  string     `json:"message"`
+	Priority string     `json:"priority"`
+	Stations []string   `json:"stations"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// apply validates the request and copies it onto a bulletin. A bulletin without
+// a start time starts now, one without a priority has normal priority.
+func (req bulletinRequest) apply(b *models.Bulletin, now time.Time) error {
+	b.Message = strings.TrimSpace(req.Message)
+	if b.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if len(b.Message) > maxBulletinLength {
+		return fmt.Errorf("message must be at most %d characters", maxBulletinLength)
+	}
+
+	b.Priority = req.Priority
+	if b.Priority == "" {
+		b.Priority = models.BulletinPriorityNormal
+	}
+	if !slices.Contains(models.BulletinPriorities, b.Priority) {
+		return fmt.Errorf("invalid priority %q, expected one of %s", b.Priority, strings.Join(models.BulletinPriorities, ", "))
+	}
+
+	b.Stations = make([]string, 0, len(req.Stations))
+	for _, station := range req.Stations {
+		if station = strings.TrimSpace(station); station != "" {
+			b.Stations = append(b.Stations, station)
+		}
+	}
+
+	b.StartsAt = now
+	if req.StartsAt != nil {
+		b.StartsAt = *req.StartsAt
+	}
+	b.EndsAt = req.EndsAt
+	if b.EndsAt != nil && !b.EndsAt.After(b.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	return nil
+}
+
+// GetBulletins handles GET /bulletins requests. Bulletins that ended are only
+// included with all=true.
+func (h *BulletinHandler) GetBulletins(w http.ResponseWriter, r *http.Request) {
+	includeExpired := r.URL.Query().Get("all") == "true"
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	bulletins, err := h.store.ListBulletins(ctx, time.Now(), includeExpired)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve bulletins")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve bulletins")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    bulletins,
+	})
+}
+
+// GetActiveBulletins handles GET /bulletins/active requests, optionally for one station
+func (h *BulletinHandler) GetActiveBulletins(w http.ResponseWriter, r *http.Request) {
+	station := r.URL.Query().Get("station")
+
+	bulletins := make([]models.Bulletin, 0)
+	for _, b := range h.bulletins.Active() {
+		if b.AppliesTo(station) {
+			bulletins = append(bulletins, b)
+		}
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    bulletins,
+	})
+}
+
+// CreateBulletin handles POST /bulletins requests
+func (h *BulletinHandler) CreateBulletin(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	var req bulletinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var b models.Bulletin
+	if err := req.apply(&b, time.Now()); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b.CreatedBy = authInfo.Username
+	if b.CreatedBy == "" {
+		b.CreatedBy = string(authInfo.Method)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	b, err := h.store.CreateBulletin(ctx, b)
+	if err != nil {
+		h.logger.Error(err, "Failed to create bulletin")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to create bulletin")
+		return
+	}
+
+	h.bulletins.Wake()
+	h.logger.Infof("Bulletin %s created by %s with %s priority", b.ID, b.CreatedBy, b.Priority)
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    b,
+	})
+}
+
+// GetBulletin handles GET /bulletins/{id} requests
+func (h *BulletinHandler) GetBulletin(w http.ResponseWriter, r *http.Request) {
+	b, ok := h.getBulletin(w, r)
+	if !ok {
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    b,
+	})
+}
+
+// UpdateBulletin handles PUT /bulletins/{id} requests. Displays are sent the changed bulletin.
+func (h *BulletinHandler) UpdateBulletin(w http.ResponseWriter, r *http.Request) {
+	var req bulletinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	b, ok := h.getBulletin(w, r)
+	if !ok {
+		return
+	}
+
+	// An update without a start time keeps the original one
+	if req.StartsAt == nil {
+		req.StartsAt = &b.StartsAt
+	}
+	if err := req.apply(&b, time.Now()); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	b, err := h.store.UpdateBulletin(ctx, b)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Bulletin not found")
+		} else {
+			h.logger.Error(err, "Failed to update bulletin")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to update bulletin")
+		}
+		return
+	}
+
+	h.bulletins.Wake()
+	h.logger.Infof("Bulletin %s updated", b.ID)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    b,
+	})
+}
+
+// ExpireBulletin handles POST /bulletins/{id}/expire requests. The bulletin ends now
+// and is removed from displays, but is kept in the bulletin history.
+func (h *BulletinHandler) ExpireBulletin(w http.ResponseWriter, r *http.Request) {
+	// Get bulletin ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	b, err := h.store.ExpireBulletin(ctx, id, time.Now())
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Bulletin not found")
+		} else {
+			h.logger.Error(err, "Failed to expire bulletin")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to expire bulletin")
+		}
+		return
+	}
+
+	h.bulletins.Wake()
+	h.logger.Infof("Bulletin %s expired", id)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    b,
+	})
+}
+
+// DeleteBulletin handles DELETE /bulletins/{id} requests
+func (h *BulletinHandler) DeleteBulletin(w http.ResponseWriter, r *http.Request) {
+	// Get bulletin ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.store.DeleteBulletin(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Bulletin not found")
+		} else {
+			h.logger.Error(err, "Failed to delete bulletin")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to delete bulletin")
+		}
+		return
+	}
+
+	h.bulletins.Wake()
+	h.logger.Infof("Bulletin %s deleted", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Bulletin deleted successfully",
+	})
+}
+
+// getBulletin loads the bulletin named in the URL, responding with an error if it can't
+func (h *BulletinHandler) getBulletin(w http.ResponseWriter, r *http.Request) (models.Bulletin, bool) {
+	// Get bulletin ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	b, err := h.store.GetBulletin(ctx, id)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Bulletin not found")
+		} else {
+			h.logger.Error(err, "Failed to retrieve bulletin")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve bulletin")
+		}
+		return models.Bulletin{}, false
+	}
+
+	return b, true
+}
+
+// respondWithError sends an error response
+func (h *BulletinHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *BulletinHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
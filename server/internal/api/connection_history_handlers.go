@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	"github.com/user/alerting/server/internal/uptime"
+	"github.com/user/alerting/server/internal/websocket"
+)
+
+// maxUptimeWindow bounds the window of an uptime report
+const maxUptimeWindow = 93 * 24 * time.Hour
+
+// ConnectionHistoryHandler handles connection history and display uptime requests
+type ConnectionHistoryHandler struct {
+	store    *storage.Storage
+	stations []string // Stations expected to have a dashboard display
+	logger   *logging.Logger
+}
+
+// NewConnectionHistoryHandler creates a new connection history handler.
+// Stations without any connection in a report window are reported as dark for the whole window.
+func NewConnectionHistoryHandler(store *storage.Storage, stations []string, logger *logging.Logger) *ConnectionHistoryHandler {
+	sorted := append([]string(nil), stations...)
+	sort.Strings(sorted)
+
+	return &ConnectionHistoryHandler{
+		store:    store,
+		stations: sorted,
+		logger:   logger,
+	}
+}
+
+// RegisterRoutes registers API routes for connection history
+func (h *ConnectionHistoryHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/connections/history", auth.Require(auth.PermConnectionsRead, h.GetConnectionHistory)).Methods("GET")
+	r.HandleFunc("/connections/uptime", auth.Require(auth.PermConnectionsRead, h.GetUptime)).Methods("GET")
+	r.HandleFunc("/connections/uptime/weekly", auth.Require(auth.PermConnectionsRead, h.GetWeeklyUptimeReport)).Methods("GET")
+}
+
+// GetConnectionHistory handles GET /connections/history requests.
+// Sessions are filtered by hub, station and a from/to window, newest first.
+func (h *ConnectionHistoryHandler) GetConnectionHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Parse pagination parameters
+	limit := parseIntParam(query.Get("limit"), 50)
+	if limit == 0 || limit > 500 {
+		limit = 50
+	}
+	offset := parseIntParam(query.Get("offset"), 0)
+
+	from, err := parseTimeParam(query.Get("from"), time.Time{})
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), time.Time{})
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := storage.ConnectionSessionFilter{
+		Hub:     query.Get("hub"),
+		Station: query.Get("station"),
+		From:    from,
+		To:      to,
+		Limit:   limit,
+		Offset:  offset,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessions, total, err := h.store.ListConnectionSessions(ctx, filter)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve connection history")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve connection history")
+		return
+	}
+
+	// Calculate next/prev pagination offsets
+	var nextOffset, prevOffset *int
+	if offset+limit < total {
+		next := offset + limit
+		nextOffset = &next
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		prevOffset = &prev
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.PaginatedResponse{
+		Data:   sessions,
+		Count:  len(sessions),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Filters: map[string]interface{}{
+			"hub":     filter.Hub,
+			"station": filter.Station,
+			"from":    query.Get("from"),
+			"to":      query.Get("to"),
+		},
+		Sorting: map[string]string{
+			"field": "connected_at",
+			"order": "desc",
+		},
+		NextOffset: nextOffset,
+		PrevOffset: prevOffset,
+	})
+}
+
+// GetUptime handles GET /connections/uptime requests.
+// It reports per-station display uptime between from and to, by default over the last 24 hours.
+func (h *ConnectionHistoryHandler) GetUptime(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now()
+
+	to, err := parseTimeParam(query.Get("to"), now)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, err := parseTimeParam(query.Get("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, ok := h.buildReport(w, r, query.Get("hub"), from, to, now)
+	if !ok {
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// GetWeeklyUptimeReport handles GET /connections/uptime/weekly requests.
+// The report covers the seven days from week_start (YYYY-MM-DD, server local time),
+// by default the last full week from Monday to Sunday. format=csv returns a CSV file.
+func (h *ConnectionHistoryHandler) GetWeeklyUptimeReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now()
+
+	var from time.Time
+	if weekStart := query.Get("week_start"); weekStart != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", weekStart, time.Local)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid week_start, expected YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	} else {
+		// Monday of the previous week
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		from = today.AddDate(0, 0, -daysSinceMonday-7)
+	}
+	to := from.AddDate(0, 0, 7)
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid format, expected json or csv")
+		return
+	}
+
+	report, ok := h.buildReport(w, r, query.Get("hub"), from, to, now)
+	if !ok {
+		return
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		if err := uptime.WriteCSV(&buf, report); err != nil {
+			h.logger.Error(err, "Failed to write uptime report")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to write uptime report")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="display-uptime-%s.csv"`, from.Format("2006-01-02")))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			h.logger.Error(err, "Failed to write response")
+		}
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// buildReport loads the sessions of a window and computes station uptime, responding with an error if it can't
+func (h *ConnectionHistoryHandler) buildReport(w http.ResponseWriter, r *http.Request, hub string, from, to, now time.Time) (models.UptimeReport, bool) {
+	if hub == "" {
+		hub = string(websocket.HubTypeDashboard)
+	}
+	if !to.After(from) {
+		h.respondWithError(w, http.StatusBadRequest, "from must be before to")
+		return models.UptimeReport{}, false
+	}
+	if to.Sub(from) > maxUptimeWindow {
+		h.respondWithError(w, http.StatusBadRequest, "The report window can be at most 93 days")
+		return models.UptimeReport{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := h.store.ListStationSessions(ctx, hub, from, to)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve connection sessions")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve connection sessions")
+		return models.UptimeReport{}, false
+	}
+
+	return uptime.Compute(hub, sessions, h.stations, from, to, now), true
+}
+
+// parseTimeParam parses an RFC 3339 query parameter, returning the default when it is empty
+func parseTimeParam(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339", value)
+	}
+	return t, nil
+}
+
+// respondWithError sends an error response
+func (h *ConnectionHistoryHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *ConnectionHistoryHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
@@ -0,0 +1,392 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	"github.com/user/alerting/server/internal/websocket"
+)
+
+// DeviceHandler handles device pairing and paired device requests
+type DeviceHandler struct {
+	store            *storage.Storage
+	authenticator    *auth.Authenticator
+	websocketHandler *websocket.Handler
+	logger           *logging.Logger
+}
+
+// NewDeviceHandler creates a new device handler
+func NewDeviceHandler(store *storage.Storage, authenticator *auth.Authenticator, wsHandler *websocket.Handler, logger *logging.Logger) *DeviceHandler {
+	return &DeviceHandler{
+		store:            store,
+		authenticator:    authenticator,
+		websocketHandler: wsHandler,
+		logger:           logger,
+	}
+}
+
+// RegisterRoutes registers API routes for devices
+func (h *DeviceHandler) RegisterRoutes(r *mux.Router) {
+	// Pairing endpoints used by the display itself
+	r.HandleFunc("/devices/pair", h.StartPairing).Methods("POST")
+	r.HandleFunc("/devices/pair/{id}/claim", h.ClaimPairing).Methods("POST")
+
+	// Admin endpoints
+	r.HandleFunc("/devices/pairings", auth.Require(auth.PermDevicesManage, h.GetPendingPairings)).Methods("GET")
+	r.HandleFunc("/devices/pairings/approve", auth.Require(auth.PermDevicesManage, h.ApprovePairing)).Methods("POST")
+	r.HandleFunc("/devices/pairings/{id}", auth.Require(auth.PermDevicesManage, h.DenyPairing)).Methods("DELETE")
+	r.HandleFunc("/devices", auth.Require(auth.PermDevicesManage, h.GetDevices)).Methods("GET")
+	r.HandleFunc("/devices/{id}", auth.Require(auth.PermDevicesManage, h.UpdateDevice)).Methods("PUT")
+	r.HandleFunc("/devices/{id}", auth.Require(auth.PermDevicesManage, h.RevokeDevice)).Methods("DELETE")
+
+	// Connections endpoint
+	r.HandleFunc("/connections/devices", auth.Require(auth.PermConnectionsRead, h.GetDeviceConnections)).Methods("GET")
+}
+
+// claimRequest is the body of POST /devices/pair/{id}/claim
+type claimRequest struct {
+	PollToken string `json:"poll_token"`
+}
+
+// approveRequest is the body of POST /devices/pairings/approve
+type approveRequest struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Station string `json:"station"`
+	Role    string `json:"role"`
+	Group   string `json:"group"`
+}
+
+// updateDeviceRequest is the body of PUT /devices/{id}. Omitted fields are left unchanged.
+type updateDeviceRequest struct {
+	Name    *string `json:"name"`
+	Station *string `json:"station"`
+	Group   *string `json:"group"`
+}
+
+// StartPairing handles POST /devices/pair requests.
+// The display shows the returned code and polls the claim endpoint with the poll token.
+func (h *DeviceHandler) StartPairing(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pollToken, pairing, err := h.authenticator.StartPairing(ctx, h.authenticator.ClientIP(r), r.UserAgent())
+	if err != nil {
+		h.logger.Error(err, "Failed to start device pairing")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to start device pairing")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"pairing_id": pairing.ID,
+			"code":       pairing.Code,
+			"poll_token": pollToken,
+			"expires_at": pairing.ExpiresAt,
+		},
+	})
+}
+
+// ClaimPairing handles POST /devices/pair/{id}/claim requests.
+// It returns 202 until an admin approves the pairing, then the device credential exactly once.
+func (h *DeviceHandler) ClaimPairing(w http.ResponseWriter, r *http.Request) {
+	// Get pairing ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req claimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if req.PollToken == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Missing required field: poll_token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	credential, device, err := h.authenticator.ClaimPairing(ctx, id, req.PollToken)
+	if err != nil {
+		switch err {
+		case auth.ErrPairingPending:
+			h.respondWithJSON(w, http.StatusAccepted, models.APIResponse{
+				Success: true,
+				Data: map[string]string{
+					"status": models.PairingStatusPending,
+				},
+			})
+		case auth.ErrPairingNotFound:
+			h.respondWithError(w, http.StatusNotFound, "Pairing not found or expired")
+		default:
+			h.logger.Error(err, "Failed to claim device pairing")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to claim device pairing")
+		}
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"status":     models.PairingStatusClaimed,
+			"credential": credential,
+			"device":     device,
+		},
+	})
+}
+
+// GetPendingPairings handles GET /devices/pairings requests
+func (h *DeviceHandler) GetPendingPairings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pairings, err := h.store.ListPendingPairings(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve device pairings")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve device pairings")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    pairings,
+	})
+}
+
+// ApprovePairing handles POST /devices/pairings/approve requests
+func (h *DeviceHandler) ApprovePairing(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	var req approveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	req.Station = strings.TrimSpace(req.Station)
+	if req.Code == "" || req.Station == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Missing required fields: code and station")
+		return
+	}
+
+	pairedBy := authInfo.Username
+	if pairedBy == "" {
+		pairedBy = string(authInfo.Method)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	device, err := h.authenticator.ApprovePairing(ctx, req.Code, models.Device{
+		Name:     strings.TrimSpace(req.Name),
+		Station:  req.Station,
+		Role:     req.Role,
+		Group:    strings.TrimSpace(req.Group),
+		PairedBy: pairedBy,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidDevice):
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+		case err == auth.ErrPairingNotFound:
+			h.respondWithError(w, http.StatusNotFound, "Pairing code not found or expired")
+		default:
+			h.logger.Error(err, "Failed to approve device pairing")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to approve device pairing")
+		}
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    device,
+	})
+}
+
+// DenyPairing handles DELETE /devices/pairings/{id} requests.
+// The display's next claim fails, so it starts over with a new code.
+func (h *DeviceHandler) DenyPairing(w http.ResponseWriter, r *http.Request) {
+	// Get pairing ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.store.DeletePendingPairing(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Pairing not found or no longer pending")
+		} else {
+			h.logger.Error(err, "Failed to deny device pairing")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to deny device pairing")
+		}
+		return
+	}
+
+	h.logger.Infof("Device pairing %s denied", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Device pairing denied",
+	})
+}
+
+// GetDevices handles GET /devices requests
+func (h *DeviceHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	devices, err := h.store.ListDevices(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve devices")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve devices")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    devices,
+	})
+}
+
+// UpdateDevice handles PUT /devices/{id} requests.
+// Open connections keep their station and group until the device reconnects.
+func (h *DeviceHandler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	// Get device ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req updateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	for _, field := range []*string{req.Name, req.Station, req.Group} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if req.Station != nil && *req.Station == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Station cannot be empty")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	device, err := h.store.UpdateDevice(ctx, id, req.Name, req.Station, req.Group)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Device not found")
+		} else {
+			h.logger.Error(err, "Failed to update device")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to update device")
+		}
+		return
+	}
+
+	h.logger.Infof("Device %s updated", device.ID)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    device,
+	})
+}
+
+// RevokeDevice handles DELETE /devices/{id} requests
+func (h *DeviceHandler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	// Get device ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.authenticator.RevokeDevice(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Device not found or already revoked")
+		} else {
+			h.logger.Error(err, "Failed to revoke device")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to revoke device")
+		}
+		return
+	}
+
+	h.logger.Infof("Device %s revoked", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Device revoked successfully",
+	})
+}
+
+// GetDeviceConnections handles GET /connections/devices requests
+// It returns the paired devices together with their live websocket connections
+func (h *DeviceHandler) GetDeviceConnections(w http.ResponseWriter, r *http.Request) {
+	// Check if websocket handler is set
+	if h.websocketHandler == nil {
+		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	devices, err := h.store.ListDevices(ctx)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve devices")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve devices")
+		return
+	}
+
+	counts := h.websocketHandler.GetDeviceConnectionCounts()
+
+	connections := make([]models.DeviceConnection, 0, len(devices))
+	for _, device := range devices {
+		connections = append(connections, models.DeviceConnection{
+			Device:      device,
+			Online:      counts[device.ID] > 0,
+			Connections: counts[device.ID],
+		})
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    connections,
+	})
+}
+
+// respondWithError sends an error response
+func (h *DeviceHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *DeviceHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
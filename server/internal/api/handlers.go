@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,19 +13,28 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/active911"
 	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/ingest"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
 	"github.com/user/alerting/server/internal/storage"
 	"github.com/user/alerting/server/internal/websocket"
 )
 
 // Handler handles API requests
 type Handler struct {
-	store          *storage.Storage
-	logger         *logging.Logger
-	eventEmitter   func(string, any)
+	store            *storage.Storage
+	logger           *logging.Logger
+	eventEmitter     func(string, any)
 	websocketHandler *websocket.Handler
+	dedupWindow      time.Duration  // How long ingested alerts are remembered to deduplicate retries
+	ingestQueue      *ingest.Queue  // Holds alerts on disk until they are stored, nil stores them directly
+	ingestKeys       ingestKeyStore // Dedup keys of alerts stored directly, the store outside of tests
+	now              func() time.Time
+	parseMode        active911.Mode     // How alert payloads with fields of the wrong type are handled
+	onAlertStored    func(models.Alert) // Called with alerts stored directly, queued alerts are reported by the queue
 }
 
 // New creates a new API handler
@@ -34,26 +44,35 @@ func New(store *storage.Storage, logger *logging.Logger, eventEmitter func(strin
 		logger:           logger,
 		eventEmitter:     eventEmitter,
 		websocketHandler: wsHandler,
+		parseMode:        active911.ModeLenient,
+		ingestKeys:       store,
+		now:              time.Now,
 	}
 }
 
+// SetAlertStoredCallback sets the callback invoked with each alert the handler stores directly
+func (h *Handler) SetAlertStoredCallback(callback func(models.Alert)) {
+	h.onAlertStored = callback
+}
+
 // RegisterRoutes registers API routes
 func (h *Handler) RegisterRoutes(r *mux.Router) {
 	// Alerts endpoints
 	r.HandleFunc("/alerts", h.GetAlerts).Methods("GET")
-	r.HandleFunc("/alerts", h.CreateAlert).Methods("POST")
+	r.HandleFunc("/alerts", auth.Require(auth.PermAlertsWrite, h.CreateAlert)).Methods("POST")
 	r.HandleFunc("/alerts/{id}", h.GetAlert).Methods("GET")
-	r.HandleFunc("/alerts/{id}", h.DeleteAlert).Methods("DELETE")
+	r.HandleFunc("/alerts/{id}", auth.Require(auth.PermAlertsWrite, h.DeleteAlert)).Methods("DELETE")
+	r.HandleFunc("/alerts/{id}/deliveries", auth.Require(auth.PermConnectionsRead, h.GetAlertDeliveries)).Methods("GET")
 
 	// Logs endpoints
-	r.HandleFunc("/logs", h.GetLogs).Methods("GET")
-	r.HandleFunc("/logs/{id}", h.GetLogByID).Methods("GET")
-	
+	r.HandleFunc("/logs", auth.Require(auth.PermLogsRead, h.GetLogs)).Methods("GET")
+	r.HandleFunc("/logs/{id}", auth.Require(auth.PermLogsRead, h.GetLogByID)).Methods("GET")
+
 	// WebSocket stats endpoints
-	r.HandleFunc("/connections", h.GetConnectionStats).Methods("GET")
-	r.HandleFunc("/connections/logs", h.GetLogConnectionDetails).Methods("GET")
-	r.HandleFunc("/connections/dashboard", h.GetDashboardConnectionDetails).Methods("GET")
-	r.HandleFunc("/connections/client", h.GetClientConnectionDetails).Methods("GET")
+	r.HandleFunc("/connections", auth.Require(auth.PermConnectionsRead, h.GetConnectionStats)).Methods("GET")
+	r.HandleFunc("/connections/logs", auth.Require(auth.PermConnectionsRead, h.GetLogConnectionDetails)).Methods("GET")
+	r.HandleFunc("/connections/dashboard", auth.Require(auth.PermConnectionsRead, h.GetDashboardConnectionDetails)).Methods("GET")
+	r.HandleFunc("/connections/client", auth.Require(auth.PermConnectionsRead, h.GetClientConnectionDetails)).Methods("GET")
 }
 
 // GetAlerts handles GET /alerts requests
@@ -99,9 +118,9 @@ func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
 		total = len(alerts) // Fallback to result count
 	}
 
-	// Redact sensitive information if not authenticated
+	// Redact sensitive information if the caller can't read full alerts
 	redactedAlerts := make([]models.Alert, len(alerts))
-	if !authInfo.Authenticated {
+	if !authInfo.Can(auth.PermAlertsRead) {
 		for i := range alerts {
 			redactedAlert := auth.RedactAlertData(&alerts[i])
 			redactedAlerts[i] = *redactedAlert
@@ -145,15 +164,6 @@ func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
 
 // CreateAlert handles POST /alerts requests
 func (h *Handler) CreateAlert(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	h.logger.Infof("Authentication info: %+v", authInfo)
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to create alert")
-		return
-	}
-
 	// Check if the content is gzipped
 	var reader io.Reader
 
@@ -174,128 +184,94 @@ func (h *Handler) CreateAlert(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	var rawData map[string]interface{}
-	if err := json.NewDecoder(reader).Decode(&rawData); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Failed to read request body: "+err.Error())
 		return
 	}
 
-	// Extract agency data
-	agencyData, ok := rawData["agency"].(map[string]interface{})
-	if !ok {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid agency data format")
+	payload, warnings, err := active911.Parse(body, h.parseMode)
+	if err != nil {
+		var validationErr *active911.ValidationError
+		if errors.As(err, &validationErr) {
+			h.respondWithJSON(w, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   validationErr.Error(),
+				Meta:    map[string]interface{}{"errors": validationErr.Errors},
+			})
+			return
+		}
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	for _, warning := range warnings {
+		h.logger.Warnf("Alert payload field %s: %s", warning.Field, warning.Message)
+	}
 
-	agency := models.Agency{
-		Name:     getString(agencyData, "name"),
-		ID:       getInt(agencyData, "id"),
-		Timezone: getString(agencyData, "timezone"),
+	alert := payload.ToAlert()
+	// Deduplicate on the alert as sent, before a missing ID is generated
+	requestAlert := alert
+	if alert.Alert.ID == "" {
+		alert.Alert.ID = fmt.Sprintf("A%d", time.Now().UnixNano())
 	}
 
-	// Extract alert data
-	alertData, ok := rawData["alert"].(map[string]interface{})
-	if !ok {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid alert data format")
+	// Retries of an alert ingested within the dedup window get the original response
+	ingestKey, proceed := h.beginIngest(w, r, requestAlert, alert.Alert.ID)
+	if !proceed {
 		return
 	}
 
-	// Extract pagegroups
-	var pageGroups []string
-	if pg, pgOk := alertData["pagegroups"].([]interface{}); pgOk {
-		for _, p := range pg {
-			if str, strOk := p.(string); strOk {
-				pageGroups = append(pageGroups, str)
-			}
+	// Queue the alert on disk so it is broadcast and kept while the database is unavailable.
+	// The alert is stored directly when there is no queue or it can't be written to disk.
+	queued := false
+	if h.ingestQueue != nil {
+		// An alert ID that is already queued gets 409. The database isn't asked whether the ID is
+		// stored, so an outage can't delay the alert; the queue compares the alerts when it stores it.
+		if _, err := h.ingestQueue.Enqueue(alert); err == ingest.ErrDuplicate {
+			h.abortIngest(ingestKey)
+			h.respondWithError(w, http.StatusConflict, "Alert "+alert.Alert.ID+" already exists")
+			return
+		} else if err != nil {
+			h.logger.Error(err, "Failed to queue alert, storing it directly")
+		} else {
+			queued = true
 		}
 	}
 
-	// Extract normalized message
-	normalizedMsg, ok := alertData["normalized_message"].(map[string]interface{})
-	if !ok {
-		normalizedMsg = make(map[string]interface{})
-	}
-
-	// Parse fields for AlertDetails
-	alertID := getString(alertData, "id")
-	if alertID == "" {
-		alertID = fmt.Sprintf("A%d", time.Now().UnixNano())
-	}
-
-	// Extract coordinates
-	lat, err := strconv.ParseFloat(getString(normalizedMsg, "lat"), 64)
-	if err != nil && getString(normalizedMsg, "lat") != "" {
-		h.logger.Error(err, "Failed to parse latitude")
-		lat = 0
-	}
-
-	lon, err := strconv.ParseFloat(getString(normalizedMsg, "lon"), 64)
-	if err != nil && getString(normalizedMsg, "lon") != "" {
-		h.logger.Error(err, "Failed to parse longitude")
-		lon = 0
-	}
-
-	// Extract timestamp
-	stamp := getFloat(alertData, "stamp")
-
-	// Create AlertDetails
-	alertDetails := models.AlertDetails{
-		ID:                alertID,
-		City:              getStringPtr(normalizedMsg, "city"),
-		CoordinateSource:  getStringPtr(normalizedMsg, "coordinate_source"),
-		CrossStreet:       getStringPtr(normalizedMsg, "cross_street"),
-		CustomIdentifiers: getStringPtr(normalizedMsg, "custom_identifiers"),
-		Description:       getStringPtr(normalizedMsg, "description"),
-		Details:           getStringPtr(normalizedMsg, "details"),
-		DispatchCoords:    getStringPtr(normalizedMsg, "dispatch_coords"),
-		Lat:               lat,
-		Lon:               lon,
-		MapAddress:        getStringPtr(normalizedMsg, "map_address"),
-		MapCode:           getStringPtr(normalizedMsg, "map_code"),
-		Place:             getStringPtr(normalizedMsg, "place"),
-		Priority:          getStringPtr(normalizedMsg, "priority"),
-		Received:          getStringPtr(normalizedMsg, "received"),
-		Source:            getStringPtr(normalizedMsg, "source"),
-		State:             getStringPtr(normalizedMsg, "state"),
-		Unit:              getStringPtr(normalizedMsg, "unit"),
-		Units:             getStringPtr(normalizedMsg, "units"),
-		PageGroups:        pageGroups,
-		Stamp:             stamp,
-		Status:            "new", // Default status
-	}
-
-	// Create alert with proper structure
-	alert := models.Alert{
-		Agency: agency,
-		Alert:  alertDetails,
-	}
-
-	// Validate required fields
-	if alert.Agency.Name == "" {
-		h.respondWithError(w, http.StatusBadRequest, "Missing required field: agency.name")
-		return
-	}
+	if !queued {
+		// Create alert in database
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
 
-	// Create alert in database
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+		id, err := h.store.CreateAlert(ctx, alert)
+		if err != nil {
+			h.abortIngest(ingestKey)
+			if err == storage.ErrConflict {
+				h.respondWithError(w, http.StatusConflict, "Alert "+alert.Alert.ID+" already exists")
+				return
+			}
+			h.logger.Error(err, "Failed to create alert")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to create alert: "+err.Error())
+			return
+		}
 
-	id, err := h.store.CreateAlert(ctx, alert)
-	if err != nil {
-		h.logger.Error(err, "Failed to create alert")
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to create alert: "+err.Error())
-		return
-	}
+		// Update ID in case it was generated
+		alert.Alert.ID = id
 
-	// Update ID in case it was generated
-	alert.Alert.ID = id
+		if h.onAlertStored != nil {
+			h.onAlertStored(alert)
+		}
+	}
 
 	// Broadcast the new alert event
 	if h.eventEmitter != nil {
 		h.eventEmitter("new_alert", alert)
-		h.logger.Infof("Alert %s broadcasted to WebSocket clients", id)
+		h.logger.Infof("Alert %s broadcasted to WebSocket clients", alert.Alert.ID)
 	}
 
+	// Remember the response for retries, which get 409 until it is stored
+	h.finishIngest(ingestKey, http.StatusCreated, alert)
+
 	h.respondWithJSON(w, http.StatusCreated, alert)
 }
 
@@ -326,8 +302,8 @@ func (h *Handler) GetAlert(w http.ResponseWriter, r *http.Request) {
 	// Prepare the response - either original or redacted
 	var responseAlert *models.Alert
 
-	// Redact sensitive information if not authenticated
-	if !authInfo.Authenticated {
+	// Redact sensitive information if the caller can't read full alerts
+	if !authInfo.Can(auth.PermAlertsRead) {
 		redacted := auth.RedactAlertData(&alert)
 		responseAlert = redacted
 		h.logger.Infof("Returning redacted alert %s (unauthenticated access)", id)
@@ -341,14 +317,6 @@ func (h *Handler) GetAlert(w http.ResponseWriter, r *http.Request) {
 
 // DeleteAlert handles DELETE /alerts/{id} requests
 func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to delete alert")
-		return
-	}
-
 	// Get alert ID from URL
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -370,7 +338,7 @@ func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
 
 	// Broadcast alert deletion event
 	if h.eventEmitter != nil {
-		deleteNotification := map[string]string{"id": id}
+		deleteNotification := protocol.AlertDeleted{ID: id}
 		h.eventEmitter("alert_deleted", deleteNotification)
 		h.logger.Infof("Alert %s deletion broadcasted to WebSocket clients", id)
 	}
@@ -383,14 +351,6 @@ func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
 
 // GetLogs handles GET /logs requests
 func (h *Handler) GetLogs(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access logs")
-		return
-	}
-
 	// Parse query parameters
 	query := r.URL.Query()
 
@@ -501,14 +461,6 @@ func (h *Handler) GetLogs(w http.ResponseWriter, r *http.Request) {
 
 // GetLogByID handles GET /logs/{id} requests
 func (h *Handler) GetLogByID(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access log details")
-		return
-	}
-
 	// Get log ID from URL
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -541,17 +493,34 @@ func (h *Handler) GetLogByID(w http.ResponseWriter, r *http.Request) {
 	h.respondWithJSON(w, http.StatusOK, response)
 }
 
-// GetConnectionStats handles GET /connections requests
-// It returns the count of active websocket connections for each hub
-func (h *Handler) GetConnectionStats(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access connection stats")
+// GetAlertDeliveries handles GET /alerts/{id}/deliveries requests
+// It returns which dashboard clients received the alert and which stations acknowledged it
+func (h *Handler) GetAlertDeliveries(w http.ResponseWriter, r *http.Request) {
+	// Check if websocket handler is set
+	if h.websocketHandler == nil {
+		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
+		return
+	}
+
+	// Get alert ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	deliveries, ok := h.websocketHandler.GetAlertDeliveries(id)
+	if !ok {
+		h.respondWithError(w, http.StatusNotFound, "No delivery receipts for alert")
 		return
 	}
 
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    deliveries,
+	})
+}
+
+// GetConnectionStats handles GET /connections requests
+// It returns the count of active websocket connections for each hub
+func (h *Handler) GetConnectionStats(w http.ResponseWriter, r *http.Request) {
 	// Check if websocket handler is set
 	if h.websocketHandler == nil {
 		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
@@ -573,14 +542,6 @@ func (h *Handler) GetConnectionStats(w http.ResponseWriter, r *http.Request) {
 // GetLogConnectionDetails handles GET /connections/logs requests
 // It returns detailed information about active log websocket connections
 func (h *Handler) GetLogConnectionDetails(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access log connection details")
-		return
-	}
-
 	// Check if websocket handler is set
 	if h.websocketHandler == nil {
 		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
@@ -589,6 +550,11 @@ func (h *Handler) GetLogConnectionDetails(w http.ResponseWriter, r *http.Request
 	
 	// Get detailed log connection info
 	details := h.websocketHandler.GetLogConnectionDetails()
+
+	// Append recently disconnected clients with their disconnect reason when asked
+	if r.URL.Query().Get("include_disconnected") == "true" {
+		details = append(details, h.websocketHandler.GetRecentDisconnects(websocket.HubTypeLogs)...)
+	}
 	
 	// Build response
 	response := models.APIResponse{
@@ -602,14 +568,6 @@ func (h *Handler) GetLogConnectionDetails(w http.ResponseWriter, r *http.Request
 // GetDashboardConnectionDetails handles GET /connections/dashboard requests
 // It returns detailed information about active dashboard websocket connections
 func (h *Handler) GetDashboardConnectionDetails(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access dashboard connection details")
-		return
-	}
-
 	// Check if websocket handler is set
 	if h.websocketHandler == nil {
 		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
@@ -618,6 +576,11 @@ func (h *Handler) GetDashboardConnectionDetails(w http.ResponseWriter, r *http.R
 	
 	// Get detailed dashboard connection info
 	details := h.websocketHandler.GetDashboardConnectionDetails()
+
+	// Append recently disconnected clients with their disconnect reason when asked
+	if r.URL.Query().Get("include_disconnected") == "true" {
+		details = append(details, h.websocketHandler.GetRecentDisconnects(websocket.HubTypeDashboard)...)
+	}
 	
 	// Build response
 	response := models.APIResponse{
@@ -631,14 +594,6 @@ func (h *Handler) GetDashboardConnectionDetails(w http.ResponseWriter, r *http.R
 // GetClientConnectionDetails handles GET /connections/client requests
 // It returns detailed information about active client websocket connections
 func (h *Handler) GetClientConnectionDetails(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to access client connection details")
-		return
-	}
-
 	// Check if websocket handler is set
 	if h.websocketHandler == nil {
 		h.respondWithError(w, http.StatusInternalServerError, "WebSocket handler not available")
@@ -647,6 +602,11 @@ func (h *Handler) GetClientConnectionDetails(w http.ResponseWriter, r *http.Requ
 	
 	// Get detailed client connection info
 	details := h.websocketHandler.GetClientConnectionDetails()
+
+	// Append recently disconnected clients with their disconnect reason when asked
+	if r.URL.Query().Get("include_disconnected") == "true" {
+		details = append(details, h.websocketHandler.GetRecentDisconnects(websocket.HubTypeClient)...)
+	}
 	
 	// Build response
 	response := models.APIResponse{
@@ -683,65 +643,6 @@ func (h *Handler) respondWithJSON(w http.ResponseWriter, code int, payload inter
 	}
 }
 
-// Helper functions for data extraction
-
-func getString(data map[string]interface{}, key string) string {
-	if val, ok := data[key]; ok {
-		if str, ok := val.(string); ok {
-			return str
-		}
-		// Try to convert to string
-		return fmt.Sprintf("%v", val)
-	}
-	return ""
-}
-
-func getStringPtr(data map[string]interface{}, key string) *string {
-	if val, ok := data[key]; ok && val != nil {
-		str := fmt.Sprintf("%v", val)
-		return &str
-	}
-	return nil
-}
-
-func getInt(data map[string]interface{}, key string) int {
-	if val, ok := data[key]; ok {
-		switch v := val.(type) {
-		case int:
-			return v
-		case float64:
-			return int(v)
-		case string:
-			i, err := strconv.Atoi(v)
-			if err != nil {
-				// Return 0 on error (but we don't need to log this as it's a normal conversion operation)
-				return 0
-			}
-			return i
-		}
-	}
-	return 0
-}
-
-func getFloat(data map[string]interface{}, key string) float64 {
-	if val, ok := data[key]; ok {
-		switch v := val.(type) {
-		case float64:
-			return v
-		case int:
-			return float64(v)
-		case string:
-			f, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				// Return 0 on error (but we don't need to log this as it's a normal conversion operation)
-				return 0
-			}
-			return f
-		}
-	}
-	return 0
-}
-
 func parseIntParam(param string, defaultValue int) int {
 	if param == "" {
 		return defaultValue
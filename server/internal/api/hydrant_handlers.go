@@ -14,6 +14,7 @@ import (
 	"github.com/user/alerting/server/internal/auth"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
 	"github.com/user/alerting/server/internal/storage"
 	"github.com/user/alerting/server/internal/websocket"
 )
@@ -47,11 +48,11 @@ func (h *HydrantHandler) RegisterRoutes(r *mux.Router) {
 	hydrantRouter.HandleFunc("/{id}", h.GetHydrant).Methods("GET")
 
 	// POST routes
-	hydrantRouter.HandleFunc("", h.UploadHydrants).Methods("POST")
-	hydrantRouter.HandleFunc("/single", h.CreateHydrant).Methods("POST")
+	hydrantRouter.HandleFunc("", auth.Require(auth.PermHydrantsWrite, h.UploadHydrants)).Methods("POST")
+	hydrantRouter.HandleFunc("/single", auth.Require(auth.PermHydrantsWrite, h.CreateHydrant)).Methods("POST")
 
 	// DELETE routes
-	hydrantRouter.HandleFunc("/all", h.DeleteAllHydrants).Methods("DELETE")
+	hydrantRouter.HandleFunc("/all", auth.Require(auth.PermHydrantsWrite, h.DeleteAllHydrants)).Methods("DELETE")
 }
 
 // GetHydrants handles GET /hydrants requests with bounds parameters
@@ -147,14 +148,6 @@ func (h *HydrantHandler) GetHydrant(w http.ResponseWriter, r *http.Request) {
 
 // CreateHydrant handles POST /hydrants/single requests
 func (h *HydrantHandler) CreateHydrant(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to create hydrant")
-		return
-	}
-
 	// Parse request body
 	var hydrant models.Hydrant
 	if err := json.NewDecoder(r.Body).Decode(&hydrant); err != nil {
@@ -188,14 +181,6 @@ func (h *HydrantHandler) CreateHydrant(w http.ResponseWriter, r *http.Request) {
 
 // UploadHydrants handles POST /hydrants requests for batch upload
 func (h *HydrantHandler) UploadHydrants(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to upload hydrants")
-		return
-	}
-
 	// Check if there's already an active upload
 	h.batchMutex.Lock()
 	if h.activeUpload != nil && h.activeUpload.InProgress {
@@ -305,14 +290,6 @@ func (h *HydrantHandler) GetUploadStatus(w http.ResponseWriter, r *http.Request)
 
 // DeleteAllHydrants handles DELETE /hydrants/all requests
 func (h *HydrantHandler) DeleteAllHydrants(w http.ResponseWriter, r *http.Request) {
-	// Get authentication info from context
-	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
-	if !authInfo.Authenticated {
-		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid API password")
-		h.logger.Warn("Unauthorized attempt to delete all hydrants")
-		return
-	}
-
 	// Check if there's an active upload
 	h.batchMutex.Lock()
 	if h.activeUpload != nil && h.activeUpload.InProgress {
@@ -331,9 +308,9 @@ func (h *HydrantHandler) DeleteAllHydrants(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Broadcast event to websocket clients
-	deleteEvent := map[string]interface{}{
-		"count":     count,
-		"timestamp": time.Now().Unix(),
+	deleteEvent := protocol.HydrantsDeleted{
+		Count:     count,
+		Timestamp: time.Now().Unix(),
 	}
 	h.hub.BroadcastEvent("hydrants_deleted", deleteEvent)
 
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/alerting/server/internal/active911"
+	"github.com/user/alerting/server/internal/ingest"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// IdempotencyKeyHeader lets a sender mark retries of the same alert
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const maxIdempotencyKeyLength = 255
+
+// dedupTimeout limits how long a new alert stored directly waits for the duplicate check when the database is slow
+const dedupTimeout = 2 * time.Second
+
+// queuedDedupTimeout limits how long a new alert waits for the duplicate check before it is queued.
+// When the database doesn't answer in time, the queue's in-memory keys are used instead.
+const queuedDedupTimeout = 500 * time.Millisecond
+
+// ingestLease is how long a request holds its dedup key before its response is stored. It is
+// longer than any request should take, so only the key of a crashed or cut off request is taken over.
+const ingestLease = 30 * time.Second
+
+// ingestKeyStore keeps the dedup keys of ingested alerts
+type ingestKeyStore interface {
+	ReserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, error)
+	CompleteIngestKey(ctx context.Context, key string, statusCode int, response []byte, expiresAt time.Time) error
+	ReleaseIngestKey(ctx context.Context, key string) error
+}
+
+// SetDedupWindow sets how long ingested alerts are remembered to deduplicate retries, 0 disables deduplication
+func (h *Handler) SetDedupWindow(window time.Duration) {
+	h.dedupWindow = window
+}
+
+// SetParseMode sets whether alert payloads with fields of the wrong type are rejected or repaired
+func (h *Handler) SetParseMode(mode active911.Mode) {
+	h.parseMode = mode
+}
+
+// SetIngestQueue sets the on-disk queue new alerts are written to before they are broadcast
+func (h *Handler) SetIngestQueue(queue *ingest.Queue) {
+	h.ingestQueue = queue
+}
+
+// ingestReservation is a dedup key reserved by beginIngest, with the store that holds it
+type ingestReservation struct {
+	key   string
+	store ingestKeyStore
+}
+
+// reserveIngestKey reserves a dedup key in the database, which every instance shares and which
+// survives restarts. With a queue the database gets a short timeout, and when it can't be reached
+// the key is reserved in the queue's memory, so an outage doesn't delay the alert.
+func (h *Handler) reserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, ingestKeyStore, error) {
+	timeout := dedupTimeout
+	if h.ingestQueue != nil {
+		timeout = queuedDedupTimeout
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	existing, reserved, err := h.ingestKeys.ReserveIngestKey(dbCtx, key)
+	if err != nil && h.ingestQueue != nil && databaseUnavailable(err) {
+		h.logger.Warnf("Database unavailable for the duplicate check, deduplicating alert %s on this instance only: %v", key.AlertID, err)
+		existing, reserved, err = h.ingestQueue.ReserveIngestKey(ctx, key)
+		return existing, reserved, h.ingestQueue, err
+	}
+	return existing, reserved, h.ingestKeys, err
+}
+
+// databaseUnavailable reports whether an error means the database couldn't be reached in time,
+// as opposed to an error it returned
+func databaseUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// beginIngest reserves the dedup key of an alert ingestion request. It returns false after
+// responding when the request repeats an alert ingested within the dedup window: with the
+// original response once that is stored, or with 409 while the original is still being handled.
+// A request that doesn't finish within the lease loses the key to the next retry.
+// The returned reservation is passed to finishIngest or abortIngest, and is empty when nothing was reserved.
+func (h *Handler) beginIngest(w http.ResponseWriter, r *http.Request, request interface{}, alertID string) (ingestReservation, bool) {
+	if h.dedupWindow <= 0 {
+		return ingestReservation{}, true
+	}
+
+	// Hash the parsed alert so formatting, compression and unknown fields don't hide a retry
+	canonical, err := json.Marshal(request)
+	if err != nil {
+		h.logger.Error(err, "Failed to hash alert request")
+		return ingestReservation{}, true
+	}
+	sum := sha256.Sum256(canonical)
+	requestHash := hex.EncodeToString(sum[:])
+
+	key := "hash:" + requestHash
+	if idempotencyKey := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader)); idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			h.respondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return ingestReservation{}, false
+		}
+		key = "key:" + idempotencyKey
+	}
+
+	// The key is held for the lease until the response is stored, then for the dedup window
+	now := h.now()
+	existing, reserved, store, err := h.reserveIngestKey(r.Context(), models.IngestKey{
+		Key:         key,
+		RequestHash: requestHash,
+		AlertID:     alertID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(min(ingestLease, h.dedupWindow)),
+	})
+	if err != nil {
+		if err == storage.ErrConflict {
+			h.respondWithConflict(w, "An identical alert is being ingested, retry shortly")
+			return ingestReservation{}, false
+		}
+		// Ingesting a possible duplicate is better than dropping an alert
+		h.logger.Error(err, "Failed to check for a duplicate alert, ingesting it anyway")
+		return ingestReservation{}, true
+	}
+	if reserved {
+		return ingestReservation{key: key, store: store}, true
+	}
+
+	if existing.RequestHash != requestHash {
+		h.respondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different alert")
+		return ingestReservation{}, false
+	}
+	if !existing.Completed() {
+		h.respondWithConflict(w, "An identical alert is being ingested, retry shortly")
+		return ingestReservation{}, false
+	}
+
+	h.logger.Infof("Duplicate of alert %s received within the dedup window, returning the original response", existing.AlertID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.StatusCode)
+	if _, err := w.Write(existing.Response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+	return ingestReservation{}, false
+}
+
+// finishIngest stores the response of an ingested alert for retries of the request
+func (h *Handler) finishIngest(reservation ingestReservation, statusCode int, payload interface{}) {
+	if reservation.key == "" {
+		return
+	}
+
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response for deduplication")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := reservation.store.CompleteIngestKey(ctx, reservation.key, statusCode, response, h.now().Add(h.dedupWindow)); err != nil {
+		h.logger.Error(err, "Failed to store response for deduplication")
+	}
+}
+
+// abortIngest releases the key of an alert that wasn't ingested, so a retry can ingest it
+func (h *Handler) abortIngest(reservation ingestReservation) {
+	if reservation.key == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := reservation.store.ReleaseIngestKey(ctx, reservation.key); err != nil {
+		h.logger.Error(err, "Failed to release ingest key")
+	}
+}
+
+// respondWithConflict sends a 409 asking the sender to retry after a second
+func (h *Handler) respondWithConflict(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", "1")
+	h.respondWithError(w, http.StatusConflict, message)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/ingest"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// fakeIngestKeys keeps dedup keys in memory the way the ingest_keys table does
+type fakeIngestKeys struct {
+	keys map[string]models.IngestKey
+}
+
+func (f *fakeIngestKeys) ReserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, error) {
+	if existing, ok := f.keys[key.Key]; ok && existing.ExpiresAt.After(key.CreatedAt) {
+		return existing, false, nil
+	}
+	f.keys[key.Key] = key
+	return key, true, nil
+}
+
+func (f *fakeIngestKeys) CompleteIngestKey(ctx context.Context, key string, statusCode int, response []byte, expiresAt time.Time) error {
+	k := f.keys[key]
+	k.StatusCode, k.Response, k.ExpiresAt = statusCode, response, expiresAt
+	f.keys[key] = k
+	return nil
+}
+
+func (f *fakeIngestKeys) ReleaseIngestKey(ctx context.Context, key string) error {
+	if f.keys[key].StatusCode == 0 {
+		delete(f.keys, key)
+	}
+	return nil
+}
+
+func TestIngestKeyLease(t *testing.T) {
+	now := time.Now()
+	keys := &fakeIngestKeys{keys: make(map[string]models.IngestKey)}
+	h := &Handler{
+		logger:      logging.New("error", "api_test"),
+		dedupWindow: 10 * time.Minute,
+		ingestKeys:  keys,
+		now:         func() time.Time { return now },
+	}
+
+	request := map[string]string{"id": "A1"}
+	begin := func(idempotencyKey string) (ingestReservation, bool, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("POST", "/alerts", nil)
+		if idempotencyKey != "" {
+			r.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		w := httptest.NewRecorder()
+		key, proceed := h.beginIngest(w, r, request, "A1")
+		return key, proceed, w
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		finish  bool // Store the response of the reserved request, otherwise it is abandoned
+		proceed bool
+		code    int // Response sent when the request doesn't proceed
+	}{
+		// The first request is cut off before its response is stored
+		{name: "first request", proceed: true},
+		{name: "retry while in flight", advance: 5 * time.Second, code: http.StatusConflict},
+		{name: "retry at the end of the lease", advance: ingestLease - 5*time.Second - time.Nanosecond, code: http.StatusConflict},
+		// Once the lease ends a retry takes over the key and its response is stored
+		{name: "retry after the lease", advance: time.Nanosecond, proceed: true, finish: true},
+		{name: "retry after completion", advance: ingestLease, code: http.StatusCreated},
+		{name: "retry late in the window", advance: 9 * time.Minute, code: http.StatusCreated},
+		{name: "retry after the window", advance: time.Minute, proceed: true},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		key, proceed, w := begin("")
+		if proceed != tt.proceed {
+			t.Fatalf("%s: expected proceed %v, got %v with %d", tt.name, tt.proceed, proceed, w.Code)
+		}
+		if !proceed && w.Code != tt.code {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.code, w.Code)
+		}
+		if tt.code == http.StatusConflict && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected a Retry-After header", tt.name)
+		}
+		if tt.code == http.StatusCreated && w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("%s: expected the stored response to be replayed", tt.name)
+		}
+		if tt.finish {
+			h.finishIngest(key, http.StatusCreated, map[string]string{"id": "A1"})
+		}
+	}
+}
+
+func TestIngestKeyReuse(t *testing.T) {
+	keys := &fakeIngestKeys{keys: make(map[string]models.IngestKey)}
+	h := &Handler{
+		logger:      logging.New("error", "api_test"),
+		dedupWindow: 10 * time.Minute,
+		ingestKeys:  keys,
+		now:         time.Now,
+	}
+
+	begin := func(request interface{}, idempotencyKey string) (ingestReservation, bool, int) {
+		r := httptest.NewRequest("POST", "/alerts", nil)
+		r.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		w := httptest.NewRecorder()
+		key, proceed := h.beginIngest(w, r, request, "A1")
+		return key, proceed, w.Code
+	}
+
+	key, proceed, _ := begin(map[string]string{"id": "A1"}, "incident-1")
+	if !proceed || key.key != "key:incident-1" {
+		t.Fatalf("Expected the Idempotency-Key to be reserved, got %q", key.key)
+	}
+
+	// A key reused for another alert is rejected
+	if _, proceed, code := begin(map[string]string{"id": "A2"}, "incident-1"); proceed || code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a reused key, got %d", code)
+	}
+
+	// A released key can be reserved again at once
+	h.abortIngest(key)
+	if _, proceed, _ := begin(map[string]string{"id": "A1"}, "incident-1"); !proceed {
+		t.Error("Expected a released key to be reserved again")
+	}
+
+	// Overlong keys are rejected
+	if _, proceed, code := begin(map[string]string{"id": "A1"}, strings.Repeat("k", maxIdempotencyKeyLength+1)); proceed || code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an overlong key, got %d", code)
+	}
+}
+
+// downIngestKeys fails every call the way the database does during an outage
+type downIngestKeys struct {
+	calls int
+}
+
+// errDatabaseDown is the error returned while the database can't be reached
+var errDatabaseDown = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+func (d *downIngestKeys) ReserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, error) {
+	d.calls++
+	return models.IngestKey{}, false, fmt.Errorf("failed to reserve ingest key: %w", errDatabaseDown)
+}
+
+func (d *downIngestKeys) CompleteIngestKey(ctx context.Context, key string, statusCode int, response []byte, expiresAt time.Time) error {
+	d.calls++
+	return fmt.Errorf("failed to complete ingest key: %w", errDatabaseDown)
+}
+
+func (d *downIngestKeys) ReleaseIngestKey(ctx context.Context, key string) error {
+	d.calls++
+	return fmt.Errorf("failed to release ingest key: %w", errDatabaseDown)
+}
+
+func TestIngestKeysWithQueue(t *testing.T) {
+	queue, err := ingest.Open(config.IngestConfig{QueueDir: t.TempDir()}, nil, logging.New("error", "api_test"))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	database := &downIngestKeys{}
+	h := &Handler{
+		logger:      logging.New("error", "api_test"),
+		dedupWindow: 10 * time.Minute,
+		ingestQueue: queue,
+		ingestKeys:  database,
+		now:         time.Now,
+	}
+
+	begin := func() (ingestReservation, bool, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("POST", "/alerts", nil)
+		w := httptest.NewRecorder()
+		key, proceed := h.beginIngest(w, r, map[string]string{"id": "A1"}, "A1")
+		return key, proceed, w
+	}
+
+	// Retries are deduplicated by the queue while the database is down
+	key, proceed, _ := begin()
+	if !proceed || key.key == "" {
+		t.Fatalf("Expected the first request to reserve a key, got %q", key.key)
+	}
+	if _, proceed, w := begin(); proceed || w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for a retry in flight, got %d", w.Code)
+	}
+
+	h.finishIngest(key, http.StatusCreated, map[string]string{"id": "A1"})
+	if _, proceed, w := begin(); proceed || w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Expected the stored response to be replayed, got %d", w.Code)
+	}
+
+	// The database is asked first for every request, the response is only stored in the queue
+	if database.calls != 3 {
+		t.Errorf("Expected 3 reservations in the database, got %d calls", database.calls)
+	}
+}
+
+func TestIngestKeysSurviveQueueRestart(t *testing.T) {
+	dir := t.TempDir()
+	database := &fakeIngestKeys{keys: make(map[string]models.IngestKey)}
+
+	// begin sends the alert to a new handler with a freshly opened queue, as after a restart
+	begin := func() (*Handler, ingestReservation, bool, *httptest.ResponseRecorder) {
+		queue, err := ingest.Open(config.IngestConfig{QueueDir: dir}, nil, logging.New("error", "api_test"))
+		if err != nil {
+			t.Fatalf("Failed to open queue: %v", err)
+		}
+		h := &Handler{
+			logger:      logging.New("error", "api_test"),
+			dedupWindow: 10 * time.Minute,
+			ingestQueue: queue,
+			ingestKeys:  database,
+			now:         time.Now,
+		}
+
+		r := httptest.NewRequest("POST", "/alerts", nil)
+		r.Header.Set(IdempotencyKeyHeader, "incident-1")
+		w := httptest.NewRecorder()
+		key, proceed := h.beginIngest(w, r, map[string]string{"id": "A1"}, "A1")
+		return h, key, proceed, w
+	}
+
+	h, key, proceed, _ := begin()
+	if !proceed {
+		t.Fatal("Expected the first request to proceed")
+	}
+	h.finishIngest(key, http.StatusCreated, map[string]string{"id": "A1"})
+
+	// The key is kept in the database, so a retry after the restart is still recognized
+	if _, _, proceed, w := begin(); proceed || w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Expected the stored response to be replayed after a restart, got %d", w.Code)
+	}
+}
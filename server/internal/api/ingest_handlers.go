@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/ingest"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// IngestHandler handles requests for the queue of alerts waiting to be stored
+type IngestHandler struct {
+	queue  *ingest.Queue
+	logger *logging.Logger
+}
+
+// NewIngestHandler creates a new ingest queue handler
+func NewIngestHandler(queue *ingest.Queue, logger *logging.Logger) *IngestHandler {
+	return &IngestHandler{
+		queue:  queue,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers API routes for the ingest queue
+func (h *IngestHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/ingest/queue", auth.Require(auth.PermAlertsWrite, h.GetQueue)).Methods("GET")
+	r.HandleFunc("/ingest/queue/{id}/retry", auth.Require(auth.PermAlertsWrite, h.RetryEntry)).Methods("POST")
+	r.HandleFunc("/ingest/queue/{id}", auth.Require(auth.PermAlertsWrite, h.DiscardEntry)).Methods("DELETE")
+}
+
+// GetQueue handles GET /ingest/queue requests, oldest first
+func (h *IngestHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.IngestStatusPending && status != models.IngestStatusFailed {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid status, expected pending or failed")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    h.queue.Entries(status),
+	})
+}
+
+// RetryEntry handles POST /ingest/queue/{id}/retry requests for failed entries
+func (h *IngestHandler) RetryEntry(w http.ResponseWriter, r *http.Request) {
+	// Get entry ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	entry, err := h.queue.Retry(id)
+	if err != nil {
+		h.respondWithQueueError(w, err, "Failed to retry ingest queue entry")
+		return
+	}
+
+	h.logger.Infof("Ingest queue entry %s for alert %s queued for retry", id, entry.Alert.Alert.ID)
+	h.respondWithJSON(w, http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Data:    entry,
+	})
+}
+
+// DiscardEntry handles DELETE /ingest/queue/{id} requests. Only failed entries can be discarded.
+func (h *IngestHandler) DiscardEntry(w http.ResponseWriter, r *http.Request) {
+	// Get entry ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.queue.Discard(id); err != nil {
+		h.respondWithQueueError(w, err, "Failed to discard ingest queue entry")
+		return
+	}
+
+	h.logger.Warnf("Ingest queue entry %s discarded", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Ingest queue entry discarded successfully",
+	})
+}
+
+// respondWithQueueError maps a queue error to a response
+func (h *IngestHandler) respondWithQueueError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case ingest.ErrNotFound:
+		h.respondWithError(w, http.StatusNotFound, "Ingest queue entry not found")
+	case ingest.ErrNotFailed:
+		h.respondWithError(w, http.StatusConflict, "Only failed entries can be retried or discarded")
+	default:
+		h.logger.Error(err, message)
+		h.respondWithError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// respondWithError sends an error response
+func (h *IngestHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *IngestHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
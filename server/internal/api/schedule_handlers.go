@@ -0,0 +1,312 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/scheduler"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// ScheduleHandler handles scheduled display command requests
+type ScheduleHandler struct {
+	store     *storage.Storage
+	scheduler *scheduler.Service
+	logger    *logging.Logger
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(store *storage.Storage, scheduler *scheduler.Service, logger *logging.Logger) *ScheduleHandler {
+	return &ScheduleHandler{
+		store:     store,
+		scheduler: scheduler,
+		logger:    logger,
+	}
+}
+
+// RegisterRoutes registers API routes for scheduled jobs
+func (h *ScheduleHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/schedules", auth.Require(auth.PermClientControl, h.GetSchedules)).Methods("GET")
+	r.HandleFunc("/schedules", auth.Require(auth.PermClientControl, h.CreateSchedule)).Methods("POST")
+	r.HandleFunc("/schedules/{id}", auth.Require(auth.PermClientControl, h.GetSchedule)).Methods("GET")
+	r.HandleFunc("/schedules/{id}", auth.Require(auth.PermClientControl, h.UpdateSchedule)).Methods("PUT")
+	r.HandleFunc("/schedules/{id}", auth.Require(auth.PermClientControl, h.DeleteSchedule)).Methods("DELETE")
+	r.HandleFunc("/schedules/{id}/runs", auth.Require(auth.PermClientControl, h.GetScheduleRuns)).Methods("GET")
+	r.HandleFunc("/schedules/{id}/run", auth.Require(auth.PermClientControl, h.RunSchedule)).Methods("POST")
+}
+
+// scheduleRequest is the body of POST /schedules and PUT /schedules/{id}
+type scheduleRequest struct {
+	Name            string                 `json:"name"`
+	Cron            string                 `json:"cron"`
+	Timezone        string                 `json:"timezone"`
+	Command         string                 `json:"command"`
+	Args            map[string]interface{} `json:"args"`
+	Target          models.CommandTarget   `json:"target"`
+	MissedRunPolicy string                 `json:"missed_run_policy"`
+	Enabled         *bool                  `json:"enabled"`
+}
+
+// apply copies the request onto a job. Enabled is left unchanged when omitted.
+func (req scheduleRequest) apply(job *models.ScheduledJob) {
+	job.Name = req.Name
+	job.Cron = req.Cron
+	job.Timezone = req.Timezone
+	job.Command = req.Command
+	job.Args = req.Args
+	job.Target = req.Target
+	job.MissedRunPolicy = req.MissedRunPolicy
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+}
+
+// GetSchedules handles GET /schedules requests
+func (h *ScheduleHandler) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	jobs, err := h.store.ListScheduledJobs(ctx, false)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve scheduled jobs")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled jobs")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    jobs,
+	})
+}
+
+// CreateSchedule handles POST /schedules requests
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	job := models.ScheduledJob{Enabled: true}
+	req.apply(&job)
+
+	job.CreatedBy = authInfo.Username
+	if job.CreatedBy == "" {
+		job.CreatedBy = string(authInfo.Method)
+	}
+
+	if err := h.scheduler.Prepare(&job, time.Now()); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := h.store.CreateScheduledJob(ctx, job)
+	if err != nil {
+		h.logger.Error(err, "Failed to create scheduled job")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to create scheduled job")
+		return
+	}
+
+	h.scheduler.Wake()
+	h.logger.Infof("Scheduled job %s (%s) created with schedule %q", job.Name, job.ID, job.Cron)
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// GetSchedule handles GET /schedules/{id} requests
+func (h *ScheduleHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getJob(w, r)
+	if !ok {
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// UpdateSchedule handles PUT /schedules/{id} requests. The job's next run is recalculated.
+func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	job, ok := h.getJob(w, r)
+	if !ok {
+		return
+	}
+
+	req.apply(&job)
+	if err := h.scheduler.Prepare(&job, time.Now()); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := h.store.UpdateScheduledJob(ctx, job)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Scheduled job not found")
+		} else {
+			h.logger.Error(err, "Failed to update scheduled job")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to update scheduled job")
+		}
+		return
+	}
+
+	h.scheduler.Wake()
+	h.logger.Infof("Scheduled job %s (%s) updated", job.Name, job.ID)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// DeleteSchedule handles DELETE /schedules/{id} requests
+func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	// Get job ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.store.DeleteScheduledJob(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Scheduled job not found")
+		} else {
+			h.logger.Error(err, "Failed to delete scheduled job")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to delete scheduled job")
+		}
+		return
+	}
+
+	h.logger.Infof("Scheduled job %s deleted", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Scheduled job deleted successfully",
+	})
+}
+
+// GetScheduleRuns handles GET /schedules/{id}/runs requests, newest first
+func (h *ScheduleHandler) GetScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	// Get job ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid limit, expected 1 to 500")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	runs, err := h.store.ListScheduledJobRuns(ctx, id, limit)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve scheduled job runs")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled job runs")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    runs,
+	})
+}
+
+// RunSchedule handles POST /schedules/{id}/run requests. The command is sent now
+// and the job's schedule is left unchanged.
+func (h *ScheduleHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.getJob(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	run, err := h.scheduler.RunNow(ctx, job)
+	if err != nil {
+		h.logger.Error(err, "Failed to run scheduled job")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to run scheduled job")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    run,
+	})
+}
+
+// getJob loads the job named in the URL, responding with an error if it can't
+func (h *ScheduleHandler) getJob(w http.ResponseWriter, r *http.Request) (models.ScheduledJob, bool) {
+	// Get job ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	job, err := h.store.GetScheduledJob(ctx, id)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Scheduled job not found")
+		} else {
+			h.logger.Error(err, "Failed to retrieve scheduled job")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled job")
+		}
+		return models.ScheduledJob{}, false
+	}
+
+	return job, true
+}
+
+// respondWithError sends an error response
+func (h *ScheduleHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *ScheduleHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	"github.com/user/alerting/server/internal/webhook"
+)
+
+// WebhookHandler handles outbound webhook subscription and delivery requests
+type WebhookHandler struct {
+	store    *storage.Storage
+	webhooks *webhook.Service
+	logger   *logging.Logger
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(store *storage.Storage, webhooks *webhook.Service, logger *logging.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		store:    store,
+		webhooks: webhooks,
+		logger:   logger,
+	}
+}
+
+// RegisterRoutes registers API routes for webhooks
+func (h *WebhookHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/webhooks", auth.Require(auth.PermWebhooksManage, h.GetWebhooks)).Methods("GET")
+	r.HandleFunc("/webhooks", auth.Require(auth.PermWebhooksManage, h.CreateWebhook)).Methods("POST")
+	r.HandleFunc("/webhooks/dead-letters", auth.Require(auth.PermWebhooksManage, h.GetDeadLetters)).Methods("GET")
+	r.HandleFunc("/webhooks/deliveries/{id}/retry", auth.Require(auth.PermWebhooksManage, h.RetryDelivery)).Methods("POST")
+	r.HandleFunc("/webhooks/{id}", auth.Require(auth.PermWebhooksManage, h.GetWebhook)).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", auth.Require(auth.PermWebhooksManage, h.UpdateWebhook)).Methods("PUT")
+	r.HandleFunc("/webhooks/{id}", auth.Require(auth.PermWebhooksManage, h.DeleteWebhook)).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", auth.Require(auth.PermWebhooksManage, h.GetDeliveries)).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/test", auth.Require(auth.PermWebhooksManage, h.TestWebhook)).Methods("POST")
+}
+
+// webhookRequest is the body of POST /webhooks and PUT /webhooks/{id}
+type webhookRequest struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"` // Generated when empty on creation, ignored on update
+	EventTypes []string `json:"event_types"`
+	PageGroups []string `json:"page_groups"`
+	CallTypes  []string `json:"call_types"`
+	Redaction  string   `json:"redaction"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// apply copies the request onto a subscription. Enabled is left unchanged when omitted.
+func (req webhookRequest) apply(sub *models.WebhookSubscription) {
+	sub.Name = req.Name
+	sub.URL = req.URL
+	sub.EventTypes = req.EventTypes
+	sub.PageGroups = req.PageGroups
+	sub.CallTypes = req.CallTypes
+	sub.Redaction = req.Redaction
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+}
+
+// GetWebhooks handles GET /webhooks requests
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	subs, err := h.store.ListWebhookSubscriptions(ctx, false)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve webhooks")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    subs,
+	})
+}
+
+// CreateWebhook handles POST /webhooks requests.
+// The signing secret is only included in this response.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	sub := models.WebhookSubscription{Enabled: true, Secret: req.Secret}
+	req.apply(&sub)
+	if err := webhook.Prepare(&sub); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if sub.Secret == "" {
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			h.logger.Error(err, "Failed to generate webhook secret")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+		sub.Secret = secret
+	}
+
+	sub.CreatedBy = authInfo.Username
+	if sub.CreatedBy == "" {
+		sub.CreatedBy = string(authInfo.Method)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sub, err := h.store.CreateWebhookSubscription(ctx, sub)
+	if err != nil {
+		h.logger.Error(err, "Failed to create webhook")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	h.logger.Infof("Webhook %s (%s) created for %s", sub.Name, sub.ID, sub.URL)
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"secret":  sub.Secret,
+			"webhook": sub,
+		},
+	})
+}
+
+// GetWebhook handles GET /webhooks/{id} requests
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    sub,
+	})
+}
+
+// UpdateWebhook handles PUT /webhooks/{id} requests. The signing secret is kept.
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	sub, ok := h.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	req.apply(&sub)
+	if err := webhook.Prepare(&sub); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sub, err := h.store.UpdateWebhookSubscription(ctx, sub)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			h.logger.Error(err, "Failed to update webhook")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to update webhook")
+		}
+		return
+	}
+
+	h.logger.Infof("Webhook %s (%s) updated", sub.Name, sub.ID)
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    sub,
+	})
+}
+
+// DeleteWebhook handles DELETE /webhooks/{id} requests. Its deliveries are deleted with it.
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get webhook ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.store.DeleteWebhookSubscription(ctx, id); err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			h.logger.Error(err, "Failed to delete webhook")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		}
+		return
+	}
+
+	h.logger.Infof("Webhook %s deleted", id)
+	h.respondWithJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// TestWebhook handles POST /webhooks/{id}/test requests. A ping event is queued
+// and its outcome appears in the webhook's delivery log.
+func (h *WebhookHandler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.getSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	delivery, err := h.webhooks.SendTest(ctx, sub)
+	if err != nil {
+		h.logger.Error(err, "Failed to queue webhook test")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to queue webhook test")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Data:    delivery,
+	})
+}
+
+// GetDeliveries handles GET /webhooks/{id}/deliveries requests, newest first
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	// Get webhook ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains([]string{models.WebhookStatusPending, models.WebhookStatusDelivered, models.WebhookStatusDead}, status) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid status, expected pending, delivered or dead")
+		return
+	}
+
+	h.listDeliveries(w, r, id, status)
+}
+
+// GetDeadLetters handles GET /webhooks/dead-letters requests: deliveries of every
+// webhook that failed all their attempts, newest first
+func (h *WebhookHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	h.listDeliveries(w, r, "", models.WebhookStatusDead)
+}
+
+// RetryDelivery handles POST /webhooks/deliveries/{id}/retry requests. The delivery
+// is queued again with a fresh set of attempts.
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	// Get delivery ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	delivery, err := h.store.RetryWebhookDelivery(ctx, id, time.Now())
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Webhook delivery not found")
+		} else {
+			h.logger.Error(err, "Failed to retry webhook delivery")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to retry webhook delivery")
+		}
+		return
+	}
+
+	h.webhooks.Wake()
+	h.logger.Infof("Webhook delivery %s queued for retry", id)
+	h.respondWithJSON(w, http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Data:    delivery,
+	})
+}
+
+// listDeliveries responds with the newest deliveries, honouring the limit query parameter
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request, subscriptionID, status string) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid limit, expected 1 to 500")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deliveries, err := h.store.ListWebhookDeliveries(ctx, subscriptionID, status, limit)
+	if err != nil {
+		h.logger.Error(err, "Failed to retrieve webhook deliveries")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhook deliveries")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    deliveries,
+	})
+}
+
+// getSubscription loads the webhook named in the URL, responding with an error if it can't
+func (h *WebhookHandler) getSubscription(w http.ResponseWriter, r *http.Request) (models.WebhookSubscription, bool) {
+	// Get webhook ID from URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sub, err := h.store.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			h.respondWithError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			h.logger.Error(err, "Failed to retrieve webhook")
+			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhook")
+		}
+		return models.WebhookSubscription{}, false
+	}
+
+	return sub, true
+}
+
+// respondWithError sends an error response
+func (h *WebhookHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *WebhookHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// APIKeyHeader is the request header that carries an API key
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix is prepended to every generated key so leaked keys are easy to spot
+const apiKeyPrefix = "ak_"
+
+// apiKeyTouchInterval limits how often last-used information is written for a key
+const apiKeyTouchInterval = time.Minute
+
+// API key errors
+var (
+	ErrAPIKeyRevoked      = errors.New("unauthorized: api key has been revoked")
+	ErrAPIKeyExpired      = errors.New("unauthorized: api key has expired")
+	ErrAPIKeyIPNotAllowed = errors.New("unauthorized: api key is not allowed from this address")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+)
+
+// CreateAPIKey validates and stores a new API key.
+// The plaintext key is only returned here; the database keeps its hash.
+func (a *Authenticator) CreateAPIKey(ctx context.Context, key models.APIKey) (string, models.APIKey, error) {
+	if a.store == nil {
+		return "", models.APIKey{}, errors.New("api keys require storage")
+	}
+
+	if len(key.Scopes) == 0 {
+		return "", models.APIKey{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range key.Scopes {
+		if !IsValidPermission(Permission(scope)) {
+			return "", models.APIKey{}, fmt.Errorf("%w: unknown scope %s", ErrInvalidAPIKey, scope)
+		}
+	}
+
+	for _, entry := range key.AllowedIPs {
+		if parseAllowedIP(entry) == nil {
+			return "", models.APIKey{}, fmt.Errorf("%w: invalid allowed IP or CIDR %s", ErrInvalidAPIKey, entry)
+		}
+	}
+
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return "", models.APIKey{}, fmt.Errorf("%w: expiry must be in the future", ErrInvalidAPIKey)
+	}
+
+	token, err := generateToken(32)
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	plaintext := apiKeyPrefix + token
+
+	key.Prefix = plaintext[:len(apiKeyPrefix)+8]
+	key.KeyHash = hashToken(plaintext)
+
+	key, err = a.store.CreateAPIKey(ctx, key)
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	a.logger.Infof("API key %s (%s) created with scopes %v", key.Name, key.Prefix, key.Scopes)
+	return plaintext, key, nil
+}
+
+// authenticateAPIKey resolves an API key to auth info
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, plaintext, clientIP string) (AuthInfo, error) {
+	key, err := a.store.GetAPIKeyByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		return AuthInfo{}, err
+	}
+
+	if err := checkAPIKey(key, clientIP, time.Now()); err != nil {
+		return AuthInfo{}, err
+	}
+
+	// Avoid a database write on every request from busy integrations
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval || key.LastUsedIP != clientIP {
+		if err := a.store.RecordAPIKeyUse(ctx, key.ID, clientIP); err != nil {
+			a.logger.Error(err, "Failed to record API key use")
+		}
+	}
+
+	scopes := make([]Permission, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, Permission(scope))
+	}
+
+	authInfo := AuthInfo{
+		Authenticated: true,
+		Method:        AuthMethodAPIKey,
+		APIKeyID:      key.ID,
+		APIKeyName:    key.Name,
+		Scopes:        scopes,
+	}
+	if key.ExpiresAt != nil {
+		authInfo.ExpiresAt = *key.ExpiresAt
+	}
+
+	return authInfo, nil
+}
+
+// RevokeAPIKey revokes an API key and closes connections opened with it
+func (a *Authenticator) RevokeAPIKey(ctx context.Context, id string) error {
+	if a.store == nil {
+		return nil
+	}
+	if err := a.store.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+	a.notifyRevoked(id)
+	return nil
+}
+
+// checkAPIKey checks that a stored key can be used from the client IP at the given time
+func checkAPIKey(key models.APIKey, clientIP string, now time.Time) error {
+	if key.RevokedAt != nil {
+		return ErrAPIKeyRevoked
+	}
+
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return ErrAPIKeyExpired
+	}
+
+	if !ipAllowed(key.AllowedIPs, clientIP) {
+		return ErrAPIKeyIPNotAllowed
+	}
+	return nil
+}
+
+// ClientIP returns the address of the caller.
+// Proxy headers are only honored when TRUST_PROXY_HEADERS is enabled.
+func (a *Authenticator) ClientIP(r *http.Request) string {
+	if a.trustProxy {
+		if forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ","); forwarded != "" {
+			// Each proxy appends the address it received the request from, so entries left of
+			// the trusted hops are set by the client. Take the one the outermost proxy added.
+			entries := strings.Split(forwarded, ",")
+			return strings.TrimSpace(entries[max(len(entries)-a.proxyHops, 0)])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseAllowedIP parses an allowlist entry, either a single IP or a CIDR range
+func parseAllowedIP(entry string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+// ipAllowed checks if the client IP matches the allowlist. An empty allowlist allows any address.
+func ipAllowed(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range allowed {
+		if network := parseAllowedIP(entry); network != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
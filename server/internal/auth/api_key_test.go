@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		key      models.APIKey
+		clientIP string
+		want     error
+	}{
+		{name: "valid", key: models.APIKey{}, clientIP: "203.0.113.7"},
+		{name: "not expired yet", key: models.APIKey{ExpiresAt: &future}, clientIP: "203.0.113.7"},
+		{name: "expired", key: models.APIKey{ExpiresAt: &past}, clientIP: "203.0.113.7", want: ErrAPIKeyExpired},
+		{name: "revoked", key: models.APIKey{RevokedAt: &past}, clientIP: "203.0.113.7", want: ErrAPIKeyRevoked},
+		{name: "revoked before expiry", key: models.APIKey{RevokedAt: &past, ExpiresAt: &past}, clientIP: "203.0.113.7", want: ErrAPIKeyRevoked},
+		{name: "allowed address", key: models.APIKey{AllowedIPs: []string{"203.0.113.7"}}, clientIP: "203.0.113.7"},
+		{name: "allowed range", key: models.APIKey{AllowedIPs: []string{"10.0.0.1", "203.0.113.0/24"}}, clientIP: "203.0.113.200"},
+		{name: "outside allowlist", key: models.APIKey{AllowedIPs: []string{"203.0.113.0/24"}}, clientIP: "198.51.100.1", want: ErrAPIKeyIPNotAllowed},
+		{name: "unparsable address", key: models.APIKey{AllowedIPs: []string{"203.0.113.0/24"}}, clientIP: "unknown", want: ErrAPIKeyIPNotAllowed},
+		{name: "IPv6 range", key: models.APIKey{AllowedIPs: []string{"2001:db8::/32"}}, clientIP: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAPIKey(tt.key, tt.clientIP, now); err != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		hops       int
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "proxy headers ignored", forwarded: []string{"203.0.113.7"}, want: "192.0.2.1"},
+		{name: "no proxy headers", trustProxy: true, hops: 1, want: "192.0.2.1"},
+		{name: "single proxy", trustProxy: true, hops: 1, forwarded: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed entry before the proxy", trustProxy: true, hops: 1, forwarded: []string{"10.0.0.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "two proxies", trustProxy: true, hops: 2, forwarded: []string{"10.0.0.1, 203.0.113.7, 198.51.100.2"}, want: "203.0.113.7"},
+		{name: "more hops than entries", trustProxy: true, hops: 3, forwarded: []string{"203.0.113.7, 198.51.100.2"}, want: "203.0.113.7"},
+		{name: "repeated headers", trustProxy: true, hops: 1, forwarded: []string{"10.0.0.1", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "zero hops counts as one", trustProxy: true, forwarded: []string{"10.0.0.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "real IP", trustProxy: true, hops: 1, realIP: "203.0.113.9", want: "203.0.113.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(config.AuthConfig{TrustProxy: tt.trustProxy, ProxyHops: tt.hops}, nil, logging.New("error", "auth_test"))
+
+			r := httptest.NewRequest("GET", "/alerts", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := a.ClientIP(r); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
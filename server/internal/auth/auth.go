@@ -2,19 +2,25 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/user/alerting/server/internal/config"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
 )
 
 // Common errors
 var (
-	ErrUnauthorized = errors.New("unauthorized: invalid API password")
+	ErrUnauthorized       = errors.New("unauthorized: invalid API password")
+	ErrInvalidCredentials = errors.New("unauthorized: invalid username or password")
+	ErrUserDisabled       = errors.New("unauthorized: user account is disabled")
 )
 
 // AuthKey is the context key for authentication info
@@ -25,66 +31,174 @@ const (
 	AuthInfoKey AuthKey = "auth_info"
 )
 
+// AuthMethod identifies how a request was authenticated
+type AuthMethod string
+
+const (
+	// AuthMethodNone is used for anonymous requests
+	AuthMethodNone AuthMethod = ""
+	// AuthMethodPassword is the deprecated shared API password
+	AuthMethodPassword AuthMethod = "password"
+	// AuthMethodSession is a login session token issued to a user
+	AuthMethodSession AuthMethod = "session"
+	// AuthMethodAPIKey is a scoped key sent in the X-API-Key header
+	AuthMethodAPIKey AuthMethod = "api_key"
+	// AuthMethodDevice is the credential of a paired display
+	AuthMethodDevice AuthMethod = "device"
+)
+
 // AuthInfo contains authentication information
 type AuthInfo struct {
 	Authenticated bool
-	Password      string
+	Method        AuthMethod
+	Role          Role
+	UserID        string
+	Username      string
+	SessionID     string
+	APIKeyID      string
+	APIKeyName    string
+	Scopes        []Permission // Permissions granted to an API key, used instead of Role
+	DeviceID      string
+	Station       string    // Station a paired device is bound to
+	DeviceGroup   string    // Group of a paired device, used to target control commands
+	ExpiresAt     time.Time // When the session or API key expires, zero if it doesn't
 }
 
+// CredentialID identifies the session or API key behind the auth info, used for revocation
+func (i AuthInfo) CredentialID() string {
+	switch i.Method {
+	case AuthMethodSession:
+		return i.SessionID
+	case AuthMethodAPIKey:
+		return i.APIKeyID
+	case AuthMethodDevice:
+		return i.DeviceID
+	default:
+		return ""
+	}
+}
+
+// RevokeCallback is called with the ID of a session or API key when it is revoked
+type RevokeCallback func(credentialID string)
+
 // Authenticator handles authentication
 type Authenticator struct {
-	apiPassword string
-	logger      *logging.Logger
+	apiPassword        string
+	sessionTTL         time.Duration
+	ticketTTL          time.Duration
+	trustProxy         bool
+	proxyHops          int
+	lockoutThreshold   int
+	ipLockoutThreshold int
+	store              *storage.Storage
+	tickets            *ticketStore
+	lockouts           *lockoutTracker
+	revokeCallback     RevokeCallback
+	eventEmitter       func(string, interface{})
+	logger             *logging.Logger
 }
 
-// New creates a new Authenticator
-func New(apiPassword string, logger *logging.Logger) *Authenticator {
+// New creates a new Authenticator.
+// The store may be nil, in which case only the shared API password is accepted.
+func New(cfg config.AuthConfig, store *storage.Storage, logger *logging.Logger) *Authenticator {
+	if cfg.APIPassword != "" {
+		logger.Warn("API_PASSWORD is deprecated - requests using it are granted the admin role")
+	}
+
 	return &Authenticator{
-		apiPassword: apiPassword,
-		logger:      logger,
+		apiPassword:        cfg.APIPassword,
+		sessionTTL:         cfg.SessionTTL,
+		ticketTTL:          cfg.TicketTTL,
+		trustProxy:         cfg.TrustProxy,
+		proxyHops:          max(cfg.ProxyHops, 1),
+		lockoutThreshold:   cfg.LockoutThreshold,
+		ipLockoutThreshold: cfg.IPLockoutThreshold,
+		store:              store,
+		tickets:            newTicketStore(),
+		lockouts:           newLockoutTracker(cfg.LockoutBaseDuration, cfg.LockoutMaxDuration),
+		logger:             logger,
 	}
 }
 
-// Authenticate checks the API password
-func (a *Authenticator) Authenticate(password string) (bool, error) {
-	if a.apiPassword == "" {
-		// If no password is set, authentication is bypassed
-		a.logger.Info("No API password configured - authentication bypass enabled")
-		return true, nil
+// SetEventEmitter sets the function used to report auth events such as lockouts
+func (a *Authenticator) SetEventEmitter(emitter func(string, interface{})) {
+	a.eventEmitter = emitter
+}
+
+// SetRevokeCallback sets the callback invoked when a session or API key is revoked
+func (a *Authenticator) SetRevokeCallback(callback RevokeCallback) {
+	a.revokeCallback = callback
+}
+
+// notifyRevoked reports revoked credentials to the revoke callback
+func (a *Authenticator) notifyRevoked(credentialIDs ...string) {
+	if a.revokeCallback == nil {
+		return
 	}
+	for _, id := range credentialIDs {
+		a.revokeCallback(id)
+	}
+}
 
-	if password != a.apiPassword {
+// Authenticate checks the shared API password
+func (a *Authenticator) Authenticate(password string) (bool, error) {
+	if a.apiPassword == "" || subtle.ConstantTimeCompare([]byte(password), []byte(a.apiPassword)) != 1 {
 		return false, ErrUnauthorized
 	}
 
-	a.logger.Info("Authentication successful")
 	return true, nil
 }
 
 // GetAuthInfo extracts authentication info from a request
 func (a *Authenticator) GetAuthInfo(r *http.Request) AuthInfo {
-	// Check query parameter first
-	password := r.URL.Query().Get("password")
-
-	// If empty, check Authorization header
-	if password == "" {
-		authHeader := r.Header.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			password = strings.TrimPrefix(authHeader, "Bearer ")
+	// API keys are sent in their own header
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" && a.store != nil {
+		authInfo, err := a.authenticateAPIKey(r.Context(), apiKey, a.ClientIP(r))
+		if err == nil {
+			return authInfo
 		}
+		a.logger.Warnf("Rejected API key from %s: %v", a.ClientIP(r), err)
+		return AuthInfo{}
+	}
+
+	// Credentials are only read from the Authorization header, query strings end up in logs
+	token := ""
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token = strings.TrimPrefix(authHeader, "Bearer ")
 	}
 
-	// Check if password is valid
-	isAuthenticated, err := a.Authenticate(password)
-	if err != nil {
-		a.logger.Debugf("Error authenticating request: %v", err)
-		isAuthenticated = false
+	// The shared password grants the admin role
+	if token != "" {
+		if ok, _ := a.Authenticate(token); ok {
+			return AuthInfo{
+				Authenticated: true,
+				Method:        AuthMethodPassword,
+				Role:          RoleAdmin,
+			}
+		}
 	}
 
-	return AuthInfo{
-		Authenticated: isAuthenticated,
-		Password:      password,
+	// Bearer tokens with the device prefix belong to paired displays
+	if strings.HasPrefix(token, devicePrefix) && a.store != nil {
+		authInfo, err := a.authenticateDevice(r.Context(), token, a.ClientIP(r))
+		if err == nil {
+			return authInfo
+		}
+		a.logger.Warnf("Rejected device credential from %s: %v", a.ClientIP(r), err)
+		return AuthInfo{}
+	}
+
+	// Other Bearer tokens are looked up as login sessions
+	if token != "" && a.store != nil {
+		authInfo, err := a.authenticateSession(r.Context(), token)
+		if err == nil {
+			return authInfo
+		}
+		a.logger.Debugf("Error authenticating session: %v", err)
 	}
+
+	return AuthInfo{}
 }
 
 // GetAuthInfoFromContext gets authentication info from context
@@ -1501,12 +1615,40 @@ func toUint64(val interface{}) (uint64, bool) {
 // Auth middleware adds authentication info to the request context
 func (a *Authenticator) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := a.ClientIP(r)
+		credential := credentialKey(r)
+		target := credentialTarget(r)
+
+		// A locked out address or target is refused before its credential is checked, so the
+		// response doesn't tell right guesses from wrong ones. Credentials that already
+		// authenticated within the lockout window are spared, so clients sharing an address
+		// with an attacker keep working.
+		if credential != "" && !a.lockouts.wasValidated(credential, time.Now()) {
+			var lockoutErr *LockoutError
+			keys := []string{"ip:" + clientIP}
+			if target != "" {
+				keys = append(keys, "credential:"+target)
+			}
+			if errors.As(a.checkLockout(keys...), &lockoutErr) {
+				writeLockoutError(w, lockoutErr)
+				return
+			}
+		}
+
 		// Get authentication info
 		authInfo := a.GetAuthInfo(r)
 
+		if credential != "" {
+			if authInfo.Authenticated {
+				a.lockouts.markValidated(credential, time.Now())
+			} else {
+				a.recordAuthFailure(clientIP, target)
+			}
+		}
+
 		// Set authentication info in context
 		ctx := context.WithValue(r.Context(), AuthInfoKey, authInfo)
-		a.logger.Infof("Authentication info: %+v", authInfo)
+		a.logger.Debugf("Authentication info: %+v", authInfo)
 		// Call the next handler with the updated context
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
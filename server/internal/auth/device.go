@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// devicePrefix is prepended to every device credential so it can be told apart from session tokens
+const devicePrefix = "dev_"
+
+// pairingTTL is how long a pairing code can be approved after the display requests it
+const pairingTTL = 10 * time.Minute
+
+// pairingCodeAlphabet leaves out characters that are easy to confuse on a TV screen
+const pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Device errors
+var (
+	ErrDeviceRevoked   = errors.New("unauthorized: device has been revoked")
+	ErrPairingPending  = errors.New("device pairing has not been approved yet")
+	ErrPairingNotFound = errors.New("device pairing not found or expired")
+	ErrInvalidDevice   = errors.New("invalid device")
+)
+
+// generatePairingCode creates a short, human readable code formatted as XXXX-XXXX
+func generatePairingCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate pairing code: %w", err)
+	}
+
+	code := make([]byte, 0, 9)
+	for i, b := range buf {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, pairingCodeAlphabet[int(b)%len(pairingCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizePairingCode uppercases a code typed by an admin and restores the dash
+func normalizePairingCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) == 8 {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
+
+// StartPairing creates a pairing request for a display.
+// The returned poll token is the secret the display uses to claim its credential once approved.
+func (a *Authenticator) StartPairing(ctx context.Context, remoteAddr, userAgent string) (string, models.DevicePairing, error) {
+	if a.store == nil {
+		return "", models.DevicePairing{}, errors.New("device pairing requires storage")
+	}
+
+	code, err := generatePairingCode()
+	if err != nil {
+		return "", models.DevicePairing{}, err
+	}
+
+	pollToken, err := generateToken(32)
+	if err != nil {
+		return "", models.DevicePairing{}, err
+	}
+
+	pairing, err := a.store.CreateDevicePairing(ctx, models.DevicePairing{
+		Code:          code,
+		PollTokenHash: hashToken(pollToken),
+		RemoteAddr:    remoteAddr,
+		UserAgent:     userAgent,
+		ExpiresAt:     time.Now().Add(pairingTTL),
+	})
+	if err != nil {
+		return "", models.DevicePairing{}, err
+	}
+
+	a.logger.Infof("Device pairing %s started from %s", pairing.Code, remoteAddr)
+	return pollToken, pairing, nil
+}
+
+// ApprovePairing binds a pending pairing code to a new device with a station and role
+func (a *Authenticator) ApprovePairing(ctx context.Context, code string, device models.Device) (models.Device, error) {
+	if a.store == nil {
+		return models.Device{}, errors.New("device pairing requires storage")
+	}
+
+	if device.Station == "" {
+		return models.Device{}, fmt.Errorf("%w: station is required", ErrInvalidDevice)
+	}
+	if device.Role == "" {
+		device.Role = string(RoleDisplay)
+	}
+	if !IsValidRole(Role(device.Role)) {
+		return models.Device{}, fmt.Errorf("%w: unknown role %s", ErrInvalidDevice, device.Role)
+	}
+
+	pairing, err := a.store.GetPendingPairingByCode(ctx, normalizePairingCode(code))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return models.Device{}, ErrPairingNotFound
+		}
+		return models.Device{}, err
+	}
+
+	if device.Name == "" {
+		device.Name = device.Station + " display"
+	}
+
+	device, err = a.store.ApproveDevicePairing(ctx, pairing.ID, device)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return models.Device{}, ErrPairingNotFound
+		}
+		return models.Device{}, err
+	}
+
+	a.logger.Infof("Device pairing %s approved as %s for station %s", pairing.Code, device.Name, device.Station)
+	return device, nil
+}
+
+// ClaimPairing exchanges the poll token of an approved pairing for the long-lived device credential.
+// The credential is only returned once; the database keeps its hash.
+func (a *Authenticator) ClaimPairing(ctx context.Context, pairingID, pollToken string) (string, models.Device, error) {
+	if a.store == nil {
+		return "", models.Device{}, ErrPairingNotFound
+	}
+
+	pairing, err := a.store.GetDevicePairing(ctx, pairingID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return "", models.Device{}, ErrPairingNotFound
+		}
+		return "", models.Device{}, err
+	}
+
+	if err := checkClaim(pairing, pollToken, time.Now()); err != nil {
+		return "", models.Device{}, err
+	}
+
+	token, err := generateToken(32)
+	if err != nil {
+		return "", models.Device{}, err
+	}
+	credential := devicePrefix + token
+
+	device, err := a.store.ClaimDevicePairing(ctx, pairing.ID, hashToken(credential))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return "", models.Device{}, ErrPairingNotFound
+		}
+		return "", models.Device{}, err
+	}
+
+	a.logger.Infof("Device %s claimed its credential", device.Name)
+	return credential, device, nil
+}
+
+// checkClaim checks that the poll token belongs to the pairing and the pairing was approved.
+// A wrong token or an expired pairing looks like a missing one.
+func checkClaim(pairing models.DevicePairing, pollToken string, now time.Time) error {
+	if pairing.PollTokenHash != hashToken(pollToken) {
+		return ErrPairingNotFound
+	}
+
+	switch pairing.Status {
+	case models.PairingStatusPending:
+		if now.After(pairing.ExpiresAt) {
+			return ErrPairingNotFound
+		}
+		return ErrPairingPending
+	case models.PairingStatusApproved:
+		return nil
+	default:
+		return ErrPairingNotFound
+	}
+}
+
+// RevokeDevice revokes a device credential and closes connections opened with it
+func (a *Authenticator) RevokeDevice(ctx context.Context, id string) error {
+	if a.store == nil {
+		return nil
+	}
+	if err := a.store.RevokeDevice(ctx, id); err != nil {
+		return err
+	}
+	a.notifyRevoked(id)
+	return nil
+}
+
+// PruneExpiredPairings deletes pairing requests that were never approved
+func (a *Authenticator) PruneExpiredPairings(ctx context.Context) {
+	if a.store == nil {
+		return
+	}
+
+	count, err := a.store.DeleteExpiredPairings(ctx, time.Now())
+	if err != nil {
+		a.logger.Error(err, "Failed to prune expired device pairings")
+		return
+	}
+	if count > 0 {
+		a.logger.Infof("Pruned %d expired device pairings", count)
+	}
+}
+
+// authenticateDevice resolves a device credential to auth info
+func (a *Authenticator) authenticateDevice(ctx context.Context, credential, clientIP string) (AuthInfo, error) {
+	device, err := a.store.GetDeviceByTokenHash(ctx, hashToken(credential))
+	if err != nil {
+		return AuthInfo{}, err
+	}
+
+	if device.RevokedAt != nil {
+		return AuthInfo{}, ErrDeviceRevoked
+	}
+
+	// Avoid a database write on every request from the display
+	if device.LastSeenAt == nil || time.Since(*device.LastSeenAt) > apiKeyTouchInterval || device.LastSeenIP != clientIP {
+		if err := a.store.RecordDeviceSeen(ctx, device.ID, clientIP); err != nil {
+			a.logger.Error(err, "Failed to record device seen")
+		}
+	}
+
+	return AuthInfo{
+		Authenticated: true,
+		Method:        AuthMethodDevice,
+		Role:          Role(device.Role),
+		DeviceID:      device.ID,
+		Station:       device.Station,
+		DeviceGroup:   device.Group,
+	}, nil
+}
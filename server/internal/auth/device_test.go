@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+func TestPairingCode(t *testing.T) {
+	code, err := generatePairingCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[` + pairingCodeAlphabet + `]{4}-[` + pairingCodeAlphabet + `]{4}$`).MatchString(code) {
+		t.Errorf("Unexpected pairing code format: %s", code)
+	}
+
+	tests := map[string]string{
+		"ABCD-EFGH":   "ABCD-EFGH",
+		"abcd-efgh":   "ABCD-EFGH",
+		" abcdefgh ":  "ABCD-EFGH",
+		"AB-CD-EF-GH": "ABCD-EFGH",
+		"ABC":         "ABC",
+	}
+	for input, want := range tests {
+		if got := normalizePairingCode(input); got != want {
+			t.Errorf("normalizePairingCode(%q): expected %q, got %q", input, want, got)
+		}
+	}
+}
+
+func TestCheckClaim(t *testing.T) {
+	now := time.Now()
+	pairing := func(status string, expiresAt time.Time) models.DevicePairing {
+		return models.DevicePairing{Status: status, PollTokenHash: hashToken("poll-token"), ExpiresAt: expiresAt}
+	}
+
+	tests := []struct {
+		name      string
+		pairing   models.DevicePairing
+		pollToken string
+		want      error
+	}{
+		{name: "approved", pairing: pairing(models.PairingStatusApproved, now.Add(-time.Minute)), pollToken: "poll-token"},
+		{name: "pending", pairing: pairing(models.PairingStatusPending, now.Add(time.Minute)), pollToken: "poll-token", want: ErrPairingPending},
+		{name: "pending and expired", pairing: pairing(models.PairingStatusPending, now.Add(-time.Minute)), pollToken: "poll-token", want: ErrPairingNotFound},
+		{name: "already claimed", pairing: pairing(models.PairingStatusClaimed, now.Add(time.Minute)), pollToken: "poll-token", want: ErrPairingNotFound},
+		{name: "wrong poll token", pairing: pairing(models.PairingStatusApproved, now.Add(time.Minute)), pollToken: "guess", want: ErrPairingNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkClaim(tt.pairing, tt.pollToken, now); err != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
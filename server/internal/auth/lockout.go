@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// maxLockoutEntries is the size at which stale failure counters are swept
+const maxLockoutEntries = 1024
+
+// LockoutError is returned when too many failed attempts were made
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// lockoutEntry tracks failed attempts for a single IP or credential
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// lockoutTracker counts failed attempts and locks keys out with an exponentially growing duration.
+// It also remembers credentials that authenticated recently, so they keep working from a locked out address.
+type lockoutTracker struct {
+	entries   map[string]*lockoutEntry
+	validated map[string]time.Time
+	base      time.Duration
+	max       time.Duration
+	mutex     sync.Mutex
+}
+
+// newLockoutTracker creates a tracker whose lockouts start at base and are capped at max
+func newLockoutTracker(base, max time.Duration) *lockoutTracker {
+	return &lockoutTracker{
+		entries:   make(map[string]*lockoutEntry),
+		validated: make(map[string]time.Time),
+		base:      base,
+		max:       max,
+	}
+}
+
+// retryAfter returns how long the key is still locked out, or zero
+func (t *lockoutTracker) retryAfter(key string, now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+// recordFailure counts a failed attempt. Once the threshold is reached every further
+// failure locks the key out for twice as long as the previous one.
+// It returns the new lockout duration, or zero if the key is not locked.
+func (t *lockoutTracker) recordFailure(key string, threshold int, now time.Time) (time.Duration, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.entries) >= maxLockoutEntries {
+		t.sweep(now)
+	}
+
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > t.max {
+		// Failures are forgotten after a quiet period
+		entry = &lockoutEntry{}
+		t.entries[key] = entry
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+
+	if threshold <= 0 || entry.failures < threshold {
+		return 0, entry.failures
+	}
+
+	exponent := float64(entry.failures - threshold)
+	duration := time.Duration(float64(t.base) * math.Pow(2, exponent))
+	if duration > t.max || duration <= 0 {
+		duration = t.max
+	}
+
+	entry.lockedUntil = now.Add(duration)
+	return duration, entry.failures
+}
+
+// reset clears the failures of a key after a successful attempt
+func (t *lockoutTracker) reset(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.entries, key)
+}
+
+// markValidated remembers that a credential authenticated, for as long as the longest lockout
+func (t *lockoutTracker) markValidated(key string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.validated) >= maxLockoutEntries {
+		t.sweep(now)
+	}
+	t.validated[key] = now
+}
+
+// wasValidated reports whether a credential authenticated within the last lockout window
+func (t *lockoutTracker) wasValidated(key string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	validatedAt, ok := t.validated[key]
+	return ok && now.Sub(validatedAt) <= t.max
+}
+
+// sweep removes entries that are no longer locked and have been quiet,
+// and credentials validated before the last lockout window. The caller must hold the mutex.
+func (t *lockoutTracker) sweep(now time.Time) {
+	for key, entry := range t.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > t.max {
+			delete(t.entries, key)
+		}
+	}
+	for key, validatedAt := range t.validated {
+		if now.Sub(validatedAt) > t.max {
+			delete(t.validated, key)
+		}
+	}
+}
+
+// checkLockout returns a LockoutError if any of the keys is locked out
+func (a *Authenticator) checkLockout(keys ...string) error {
+	now := time.Now()
+	var longest time.Duration
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if wait := a.lockouts.retryAfter(key, now); wait > longest {
+			longest = wait
+		}
+	}
+
+	if longest > 0 {
+		return &LockoutError{RetryAfter: longest}
+	}
+	return nil
+}
+
+// recordAuthFailure counts a failure against the client IP and the targeted credential,
+// emitting an auth_lockout event when either becomes locked out
+func (a *Authenticator) recordAuthFailure(clientIP, target string) {
+	now := time.Now()
+
+	if duration, failures := a.lockouts.recordFailure("ip:"+clientIP, a.ipLockoutThreshold, now); duration > 0 {
+		a.emitLockout("ip", clientIP, clientIP, failures, duration, now)
+	}
+
+	if target != "" {
+		if duration, failures := a.lockouts.recordFailure("credential:"+target, a.lockoutThreshold, now); duration > 0 {
+			a.emitLockout("credential", target, clientIP, failures, duration, now)
+		}
+	}
+}
+
+// emitLockout logs a lockout and reports it to the event emitter
+func (a *Authenticator) emitLockout(kind, key, clientIP string, failures int, duration time.Duration, now time.Time) {
+	a.logger.Warnf("Locked out %s %s for %s after %d failed attempts from %s", kind, key, duration, failures, clientIP)
+
+	if a.eventEmitter == nil {
+		return
+	}
+
+	a.eventEmitter("auth_lockout", protocol.AuthLockout{
+		Kind:              kind,
+		Key:               key,
+		SourceIP:          clientIP,
+		Failures:          failures,
+		LockedUntil:       now.Add(duration),
+		RetryAfterSeconds: int(math.Ceil(duration.Seconds())),
+		Timestamp:         now.Unix(),
+	})
+}
+
+// credentialKey identifies the exact credential presented by a request, so credentials
+// that already authenticated can be told apart from guesses. It is a hash of the whole secret.
+func credentialKey(r *http.Request) string {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		return "api_key:" + hashToken(apiKey)[:16]
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		return ""
+	}
+	if strings.HasPrefix(token, devicePrefix) {
+		return "device:" + hashToken(token)[:16]
+	}
+	return "token:" + hashToken(token)[:16]
+}
+
+// credentialTarget identifies what a request's credential is trying to unlock, so failures
+// accumulate across guesses. API keys name their key with the public prefix. Other Bearer
+// tokens are either random session tokens or the shared password, so guesses target the password.
+// Device credentials are random and name no device, so only the client IP counts their failures.
+func credentialTarget(r *http.Request) string {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		if len(apiKey) > len(apiKeyPrefix)+8 {
+			apiKey = apiKey[:len(apiKeyPrefix)+8]
+		}
+		return "api_key:" + apiKey
+	}
+
+	token := bearerToken(r)
+	if token == "" || strings.HasPrefix(token, devicePrefix) {
+		return ""
+	}
+	return "password"
+}
+
+// bearerToken returns the token of a Bearer Authorization header, or an empty string
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(authHeader, "Bearer ")
+}
+
+// writeLockoutError sends a 429 response with a Retry-After header
+func writeLockoutError(w http.ResponseWriter, err *LockoutError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	writeAuthError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// Role is a named set of permissions assigned to a user
+type Role string
+
+const (
+	// RoleAdmin can do everything, including managing users
+	RoleAdmin Role = "admin"
+	// RoleOperator manages alerts, hydrants and displays
+	RoleOperator Role = "operator"
+	// RoleViewer can see unredacted alerts
+	RoleViewer Role = "viewer"
+	// RoleDisplay is assigned to paired station displays
+	RoleDisplay Role = "display"
+)
+
+// Permission identifies a single action that can be authorized
+type Permission string
+
+const (
+	// PermAlertsRead allows reading unredacted alert data
+	PermAlertsRead Permission = "alerts:read"
+	// PermAlertsWrite allows creating and deleting alerts
+	PermAlertsWrite Permission = "alerts:write"
+	// PermHydrantsWrite allows uploading and deleting hydrants
+	PermHydrantsWrite Permission = "hydrants:write"
+	// PermLogsRead allows reading request and websocket logs
+	PermLogsRead Permission = "logs:read"
+	// PermConnectionsRead allows inspecting websocket connections
+	PermConnectionsRead Permission = "connections:read"
+	// PermClientControl allows sending control commands to displays
+	PermClientControl Permission = "client:control"
+	// PermUsersManage allows creating, updating and deleting users
+	PermUsersManage Permission = "users:manage"
+	// PermAPIKeysManage allows creating and revoking API keys
+	PermAPIKeysManage Permission = "api_keys:manage"
+	// PermDevicesManage allows approving device pairings and revoking devices
+	PermDevicesManage Permission = "devices:manage"
+	// PermWebhooksManage allows managing outbound webhooks and their deliveries
+	PermWebhooksManage Permission = "webhooks:manage"
+)
+
+// allPermissions lists every known permission
+var allPermissions = []Permission{
+	PermAlertsRead,
+	PermAlertsWrite,
+	PermHydrantsWrite,
+	PermLogsRead,
+	PermConnectionsRead,
+	PermClientControl,
+	PermUsersManage,
+	PermAPIKeysManage,
+	PermDevicesManage,
+	PermWebhooksManage,
+}
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermAlertsRead,
+		PermAlertsWrite,
+		PermHydrantsWrite,
+		PermLogsRead,
+		PermConnectionsRead,
+		PermClientControl,
+		PermUsersManage,
+		PermAPIKeysManage,
+		PermDevicesManage,
+		PermWebhooksManage,
+	},
+	RoleOperator: {
+		PermAlertsRead,
+		PermAlertsWrite,
+		PermHydrantsWrite,
+		PermLogsRead,
+		PermConnectionsRead,
+		PermClientControl,
+		PermDevicesManage,
+	},
+	RoleViewer: {
+		PermAlertsRead,
+	},
+	RoleDisplay: {
+		PermAlertsRead,
+	},
+}
+
+// IsValidRole checks if the role is one of the known roles
+func IsValidRole(role Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// IsValidPermission checks if the permission is one of the known permissions
+func IsValidPermission(permission Permission) bool {
+	for _, p := range allPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Has checks if the role grants the given permission
+func (r Role) Has(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Can checks if the authenticated caller holds the given permission
+func (i AuthInfo) Can(permission Permission) bool {
+	if !i.Authenticated {
+		return false
+	}
+
+	// API keys are limited to their scopes
+	if i.Method == AuthMethodAPIKey {
+		for _, p := range i.Scopes {
+			if p == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	return i.Role.Has(permission)
+}
+
+// Require wraps a handler so it only runs when the caller holds the given permission.
+// Unauthenticated callers get 401, authenticated callers lacking the permission get 403.
+func Require(permission Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authInfo, _ := GetAuthInfoFromContext(r.Context())
+
+		if !authInfo.Authenticated {
+			writeAuthError(w, http.StatusUnauthorized, "Unauthorized: Authentication required")
+			return
+		}
+
+		if !authInfo.Can(permission) {
+			writeAuthError(w, http.StatusForbidden, "Forbidden: Missing permission "+string(permission))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeAuthError sends an error response in the standard API format
+func writeAuthError(w http.ResponseWriter, code int, message string) {
+	response, err := json.Marshal(models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(response)
+}
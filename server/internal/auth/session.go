@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum length accepted for user passwords
+const MinPasswordLength = 10
+
+// HashPassword hashes a password with bcrypt
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash returns a valid bcrypt hash used to equalize login timing for unknown users
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+		if err == nil {
+			dummyHash = string(hash)
+		}
+	})
+	return dummyHash
+}
+
+// checkPassword compares a password with a bcrypt hash
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// generateToken creates a random hex token with the given number of bytes of entropy
+func generateToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the SHA-256 hash of a token as stored in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Login verifies a username and password and issues a new session token.
+// The plaintext token is only returned here; the database keeps its hash.
+// Repeated failures from the same address or for the same username return a LockoutError.
+func (a *Authenticator) Login(ctx context.Context, username, password, remoteAddr, userAgent string) (string, models.Session, models.User, error) {
+	if a.store == nil {
+		return "", models.Session{}, models.User{}, ErrInvalidCredentials
+	}
+
+	// Refuse locked out addresses and usernames before checking the password
+	userKey := "user:" + strings.ToLower(username)
+	if err := a.checkLockout("ip:"+remoteAddr, "credential:"+userKey); err != nil {
+		return "", models.Session{}, models.User{}, err
+	}
+
+	user, err := a.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			// Spend the same time as a real comparison so usernames can't be probed
+			checkPassword(dummyPasswordHash(), password)
+			a.recordAuthFailure(remoteAddr, userKey)
+			return "", models.Session{}, models.User{}, ErrInvalidCredentials
+		}
+		return "", models.Session{}, models.User{}, err
+	}
+
+	if !checkPassword(user.PasswordHash, password) {
+		a.recordAuthFailure(remoteAddr, userKey)
+		return "", models.Session{}, models.User{}, ErrInvalidCredentials
+	}
+	a.lockouts.reset("credential:" + userKey)
+
+	if user.Disabled {
+		return "", models.Session{}, models.User{}, ErrUserDisabled
+	}
+
+	token, err := generateToken(32)
+	if err != nil {
+		return "", models.Session{}, models.User{}, err
+	}
+
+	session, err := a.store.CreateSession(ctx, models.Session{
+		TokenHash:  hashToken(token),
+		UserID:     user.ID,
+		RemoteAddr: remoteAddr,
+		UserAgent:  userAgent,
+		ExpiresAt:  time.Now().Add(a.sessionTTL),
+	})
+	if err != nil {
+		return "", models.Session{}, models.User{}, err
+	}
+
+	if err := a.store.RecordUserLogin(ctx, user.ID); err != nil {
+		a.logger.Error(err, "Failed to record user login")
+	}
+
+	a.logger.Infof("User %s logged in", user.Username)
+	return token, session, user, nil
+}
+
+// Logout deletes a session so its token can no longer be used
+func (a *Authenticator) Logout(ctx context.Context, sessionID string) error {
+	if a.store == nil {
+		return nil
+	}
+	if err := a.store.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+	a.notifyRevoked(sessionID)
+	return nil
+}
+
+// RevokeUserSessions deletes all sessions belonging to a user
+func (a *Authenticator) RevokeUserSessions(ctx context.Context, userID string) error {
+	if a.store == nil {
+		return nil
+	}
+	ids, err := a.store.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	a.notifyRevoked(ids...)
+	return nil
+}
+
+// authenticateSession resolves a session token to auth info
+func (a *Authenticator) authenticateSession(ctx context.Context, token string) (AuthInfo, error) {
+	session, user, err := a.store.GetSessionByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return AuthInfo{}, err
+	}
+
+	if user.Disabled {
+		return AuthInfo{}, ErrUserDisabled
+	}
+
+	return AuthInfo{
+		Authenticated: true,
+		Method:        AuthMethodSession,
+		Role:          Role(user.Role),
+		UserID:        user.ID,
+		Username:      user.Username,
+		SessionID:     session.ID,
+		ExpiresAt:     session.ExpiresAt,
+	}, nil
+}
+
+// EnsureBootstrapAdmin creates an admin user when the users table is empty
+func (a *Authenticator) EnsureBootstrapAdmin(ctx context.Context, username, password string) error {
+	if a.store == nil {
+		return nil
+	}
+
+	count, err := a.store.CountUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if username == "" || password == "" {
+		a.logger.Warn("No users exist - set ADMIN_USERNAME and ADMIN_PASSWORD to create the first admin")
+		return nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.store.CreateUser(ctx, models.User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         string(RoleAdmin),
+	}); err != nil {
+		return err
+	}
+
+	a.logger.Infof("Created bootstrap admin user %s", username)
+	return nil
+}
+
+// PruneExpiredSessions deletes sessions that have expired
+func (a *Authenticator) PruneExpiredSessions(ctx context.Context) {
+	if a.store == nil {
+		return
+	}
+
+	count, err := a.store.DeleteExpiredSessions(ctx, time.Now())
+	if err != nil {
+		a.logger.Error(err, "Failed to prune expired sessions")
+		return
+	}
+	if count > 0 {
+		a.logger.Infof("Pruned %d expired sessions", count)
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// Ticket errors
+var (
+	ErrTicketInvalid  = errors.New("unauthorized: websocket ticket is invalid or already used")
+	ErrTicketExpired  = errors.New("unauthorized: websocket ticket has expired")
+	ErrTicketWrongHub = errors.New("forbidden: websocket ticket was issued for a different hub")
+)
+
+// Ticket is a single-use credential for opening a websocket connection.
+// It carries the caller's auth info so the password never appears in the URL.
+type Ticket struct {
+	Hub       string
+	Station   string
+	AuthInfo  AuthInfo
+	ExpiresAt time.Time
+}
+
+// ticketStore keeps issued tickets in memory when there is no database, as in tests
+type ticketStore struct {
+	tickets map[string]Ticket
+	mutex   sync.Mutex
+}
+
+// newTicketStore creates an empty ticket store
+func newTicketStore() *ticketStore {
+	return &ticketStore{
+		tickets: make(map[string]Ticket),
+	}
+}
+
+// IssueTicket creates a single-use websocket ticket bound to a hub, station and the caller's credentials.
+// Tickets are stored in the database, so they can be redeemed on any server instance.
+func (a *Authenticator) IssueTicket(ctx context.Context, authInfo AuthInfo, hub, station string) (string, Ticket, error) {
+	token, err := generateToken(24)
+	if err != nil {
+		return "", Ticket{}, err
+	}
+
+	now := time.Now()
+	ticket := Ticket{
+		Hub:       hub,
+		Station:   station,
+		AuthInfo:  authInfo,
+		ExpiresAt: now.Add(a.ticketTTL),
+	}
+
+	if a.store == nil {
+		a.tickets.mutex.Lock()
+		defer a.tickets.mutex.Unlock()
+
+		// Drop expired tickets that were never redeemed
+		for key, t := range a.tickets.tickets {
+			if now.After(t.ExpiresAt) {
+				delete(a.tickets.tickets, key)
+			}
+		}
+
+		a.tickets.tickets[hashToken(token)] = ticket
+		return token, ticket, nil
+	}
+
+	authInfoJSON, err := json.Marshal(authInfo)
+	if err != nil {
+		return "", Ticket{}, fmt.Errorf("failed to marshal ticket credentials: %w", err)
+	}
+
+	// Drop expired tickets that were never redeemed
+	if err := a.store.DeleteExpiredWebSocketTickets(ctx, now); err != nil {
+		a.logger.Error(err, "Failed to delete expired websocket tickets")
+	}
+
+	if err := a.store.CreateWebSocketTicket(ctx, models.WebSocketTicket{
+		TokenHash: hashToken(token),
+		Hub:       hub,
+		Station:   station,
+		AuthInfo:  authInfoJSON,
+		ExpiresAt: ticket.ExpiresAt,
+	}); err != nil {
+		return "", Ticket{}, err
+	}
+
+	return token, ticket, nil
+}
+
+// RedeemTicket consumes a ticket for the given hub. A ticket can only be redeemed once.
+func (a *Authenticator) RedeemTicket(ctx context.Context, token, hub string) (Ticket, error) {
+	ticket, err := a.takeTicket(ctx, hashToken(token))
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	if time.Now().After(ticket.ExpiresAt) {
+		return Ticket{}, ErrTicketExpired
+	}
+
+	if ticket.Hub != hub {
+		return Ticket{}, ErrTicketWrongHub
+	}
+
+	return ticket, nil
+}
+
+// takeTicket removes a ticket and returns it, or ErrTicketInvalid when it doesn't exist
+func (a *Authenticator) takeTicket(ctx context.Context, key string) (Ticket, error) {
+	if a.store == nil {
+		a.tickets.mutex.Lock()
+		defer a.tickets.mutex.Unlock()
+
+		ticket, ok := a.tickets.tickets[key]
+		if !ok {
+			return Ticket{}, ErrTicketInvalid
+		}
+		delete(a.tickets.tickets, key)
+		return ticket, nil
+	}
+
+	stored, err := a.store.RedeemWebSocketTicket(ctx, key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return Ticket{}, ErrTicketInvalid
+		}
+		return Ticket{}, err
+	}
+
+	ticket := Ticket{
+		Hub:       stored.Hub,
+		Station:   stored.Station,
+		ExpiresAt: stored.ExpiresAt,
+	}
+	if err := json.Unmarshal(stored.AuthInfo, &ticket.AuthInfo); err != nil {
+		return Ticket{}, fmt.Errorf("failed to unmarshal ticket credentials: %w", err)
+	}
+	return ticket, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+)
+
+func TestRedeemTicket(t *testing.T) {
+	a := New(config.AuthConfig{TicketTTL: 30 * time.Second}, nil, logging.New("error", "auth_test"))
+	authInfo := AuthInfo{Authenticated: true, Method: AuthMethodSession, Role: RoleViewer, SessionID: "s1"}
+
+	tests := []struct {
+		name   string
+		issue  string // Hub the ticket is issued for, empty to redeem an unknown ticket
+		redeem string
+		twice  bool
+		want   error
+	}{
+		{name: "valid", issue: "dashboard", redeem: "dashboard"},
+		{name: "wrong hub", issue: "dashboard", redeem: "logs", want: ErrTicketWrongHub},
+		{name: "unknown ticket", redeem: "dashboard", want: ErrTicketInvalid},
+		{name: "redeemed twice", issue: "dashboard", redeem: "dashboard", twice: true, want: ErrTicketInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := "unknown"
+			if tt.issue != "" {
+				var err error
+				token, _, err = a.IssueTicket(context.Background(), authInfo, tt.issue, "station-1")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.twice {
+				if _, err := a.RedeemTicket(context.Background(), token, tt.redeem); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ticket, err := a.RedeemTicket(context.Background(), token, tt.redeem)
+			if err != tt.want {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if err == nil && (ticket.Station != "station-1" || ticket.AuthInfo.SessionID != "s1") {
+				t.Errorf("Expected the ticket to keep the station and credentials, got %+v", ticket)
+			}
+		})
+	}
+}
+
+func TestRedeemExpiredTicket(t *testing.T) {
+	a := New(config.AuthConfig{TicketTTL: -time.Second}, nil, logging.New("error", "auth_test"))
+
+	token, _, err := a.IssueTicket(context.Background(), AuthInfo{Authenticated: true}, "dashboard", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RedeemTicket(context.Background(), token, "dashboard"); err != ErrTicketExpired {
+		t.Errorf("Expected ErrTicketExpired, got %v", err)
+	}
+}
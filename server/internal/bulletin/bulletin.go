@@ -0,0 +1,248 @@
+package bulletin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// checkInterval is how often the service looks for bulletins that started or ended
+const checkInterval = 15 * time.Second
+
+// wakeTopic is the event bus topic that tells the other instances bulletins were changed
+const wakeTopic = "bulletins"
+
+// Event types broadcast on the dashboard hub
+const (
+	EventBulletin        = "bulletin"
+	EventBulletinExpired = "bulletin_expired"
+)
+
+// Store loads the bulletins shown at a given time
+type Store interface {
+	ListActiveBulletins(ctx context.Context, now time.Time) ([]models.Bulletin, error)
+}
+
+// EventSender broadcasts a bulletin event to dashboard clients
+type EventSender func(eventType string, content any)
+
+// Leader reports whether this server instance announces bulletins. Every instance keeps
+// the active bulletins, but announcements reach every instance's displays through the
+// event bus, so only the leader sends them.
+type Leader interface {
+	IsLeader() bool
+}
+
+// EventBus carries wake-ups between server instances, so a change made through any
+// instance is announced by the leader right away
+type EventBus interface {
+	Publish(ctx context.Context, event models.BusEvent) error
+	Subscribe(hub string, handler func(models.BusEvent))
+}
+
+// Service keeps the set of active bulletins and broadcasts bulletins as they start,
+// change and end. Changes made through the API are picked up after a call to Wake.
+type Service struct {
+	store      Store
+	send       EventSender
+	logger     *logging.Logger
+	leader     Leader   // nil when this is the only instance
+	bus        EventBus // nil when this is the only instance
+	active     map[string]models.Bulletin
+	mutex      sync.RWMutex
+	wake       chan struct{}
+	shutdownCh chan struct{}
+	done       chan struct{}
+}
+
+// New creates a bulletin service that broadcasts through send
+func New(store Store, send EventSender, logger *logging.Logger) *Service {
+	return &Service{
+		store:      store,
+		send:       send,
+		logger:     logger,
+		active:     make(map[string]models.Bulletin),
+		wake:       make(chan struct{}, 1),
+		shutdownCh: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// SetLeader makes the service announce bulletins only while this instance is the leader
+func (s *Service) SetLeader(leader Leader) {
+	s.leader = leader
+}
+
+// SetEventBus makes Wake also wake the other instances, so the leader announces changes
+// made through any instance without waiting for its next check
+func (s *Service) SetEventBus(bus EventBus) {
+	s.bus = bus
+	bus.Subscribe(wakeTopic, func(models.BusEvent) {
+		s.wakeLocal()
+	})
+}
+
+// Start loads the active bulletins and then checks for changes until Stop is called.
+// The bulletins active at startup are not broadcast, clients receive them when they connect.
+func (s *Service) Start() {
+	if err := s.refresh(time.Now(), false); err != nil {
+		s.logger.Error(err, "Failed to load active bulletins")
+	}
+	s.logger.Infof("Starting bulletin service with %d active bulletins", len(s.Active()))
+
+	ticker := time.NewTicker(checkInterval)
+
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			case <-s.shutdownCh:
+				return
+			}
+			if err := s.refresh(time.Now(), true); err != nil {
+				s.logger.Error(err, "Failed to refresh active bulletins")
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the service
+func (s *Service) Stop() {
+	close(s.shutdownCh)
+	<-s.done
+}
+
+// Wake makes the service, and with an event bus every other instance's, check for changes
+// now, after bulletins were changed
+func (s *Service) Wake() {
+	s.wakeLocal()
+	if s.bus != nil {
+		go s.publishWake()
+	}
+}
+
+// publishWake tells the other instances that bulletins were changed
+func (s *Service) publishWake() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := models.BusEvent{Hub: wakeTopic, Message: models.WebSocketMessage{
+		Type: "bulletins_changed",
+		ID:   uuid.New().String(),
+		Time: time.Now(),
+	}}
+	if err := s.bus.Publish(ctx, event); err != nil {
+		s.logger.Error(err, "Failed to publish bulletin change, the leader announces it at its next check")
+	}
+}
+
+// wakeLocal makes this instance's service check for changes now
+func (s *Service) wakeLocal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Active returns the active bulletins, most important first
+func (s *Service) Active() []models.Bulletin {
+	s.mutex.RLock()
+	bulletins := make([]models.Bulletin, 0, len(s.active))
+	for _, bulletin := range s.active {
+		bulletins = append(bulletins, bulletin)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(bulletins, func(i, j int) bool {
+		if ri, rj := bulletins[i].PriorityRank(), bulletins[j].PriorityRank(); ri != rj {
+			return ri > rj
+		}
+		return bulletins[i].StartsAt.Before(bulletins[j].StartsAt)
+	})
+	return bulletins
+}
+
+// refresh loads the active bulletins and, when announce is set and this instance leads, broadcasts
+// the ones that started or changed and the ones that ended since the last refresh
+func (s *Service) refresh(now time.Time, announce bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bulletins, err := s.store.ListActiveBulletins(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to list active bulletins: %w", err)
+	}
+
+	active := make(map[string]models.Bulletin, len(bulletins))
+	for _, bulletin := range bulletins {
+		active[bulletin.ID] = bulletin
+	}
+
+	s.mutex.Lock()
+	previous := s.active
+	s.active = active
+	s.mutex.Unlock()
+
+	if !announce || (s.leader != nil && !s.leader.IsLeader()) {
+		return nil
+	}
+
+	for id, old := range previous {
+		if _, ok := active[id]; ok {
+			continue
+		}
+		if old.EndsAt == nil || old.EndsAt.After(now) {
+			old.EndsAt = &now
+		}
+		s.logger.Infof("Bulletin %s expired", id)
+		s.send(EventBulletinExpired, old)
+	}
+
+	for _, bulletin := range bulletins {
+		old, ok := previous[bulletin.ID]
+		if ok && old.UpdatedAt.Equal(bulletin.UpdatedAt) {
+			continue
+		}
+		// Stations that are no longer targeted won't receive the update, so they're told it ended
+		if ok && !sameStations(old.Stations, bulletin.Stations) {
+			s.send(EventBulletinExpired, old)
+		}
+		s.logger.Infof("Broadcasting %s priority bulletin %s to %s", bulletin.Priority, bulletin.ID, describeStations(bulletin.Stations))
+		s.send(EventBulletin, bulletin)
+	}
+
+	return nil
+}
+
+// sameStations checks if two station lists name the same stations
+func sameStations(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, station := range a {
+		if !slices.ContainsFunc(b, func(s string) bool { return strings.EqualFold(s, station) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeStations names the stations of a bulletin for logging
+func describeStations(stations []string) string {
+	if len(stations) == 0 {
+		return "every station"
+	}
+	return "stations " + strings.Join(stations, ", ")
+}
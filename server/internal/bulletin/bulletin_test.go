@@ -0,0 +1,161 @@
+package bulletin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/eventbus"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// fakeStore returns the bulletins active at the given time
+type fakeStore []models.Bulletin
+
+func (f *fakeStore) ListActiveBulletins(ctx context.Context, now time.Time) ([]models.Bulletin, error) {
+	active := make([]models.Bulletin, 0)
+	for _, bulletin := range *f {
+		if bulletin.ActiveAt(now) {
+			active = append(active, bulletin)
+		}
+	}
+	return active, nil
+}
+
+// recorder collects broadcast events
+type recorder struct {
+	events    []string
+	bulletins []models.Bulletin
+}
+
+func (r *recorder) send(eventType string, content any) {
+	r.events = append(r.events, eventType)
+	r.bulletins = append(r.bulletins, content.(models.Bulletin))
+}
+
+// take returns and clears the recorded event types
+func (r *recorder) take() []string {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestRefresh(t *testing.T) {
+	start := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	store := &fakeStore{
+		{ID: "engine", Message: "Engine 2 out of service", Priority: models.BulletinPriorityHigh, StartsAt: start.Add(-time.Hour), UpdatedAt: start},
+		{ID: "training", Message: "Training at 1900", Priority: models.BulletinPriorityLow, Stations: []string{"51"}, StartsAt: start.Add(time.Hour), EndsAt: &end, UpdatedAt: start},
+	}
+	rec := &recorder{}
+	s := New(store, rec.send, logging.New("error", "bulletin_test"))
+
+	// Bulletins active at startup are loaded without a broadcast
+	if err := s.refresh(start, false); err != nil {
+		t.Fatal(err)
+	}
+	if events := rec.take(); len(events) != 0 {
+		t.Fatalf("Expected no events on startup, got %v", events)
+	}
+	if active := s.Active(); len(active) != 1 || active[0].ID != "engine" {
+		t.Fatalf("Expected the engine bulletin to be active, got %+v", active)
+	}
+
+	// A scheduled bulletin is broadcast once it starts, and only once
+	s.refresh(start.Add(time.Hour), true)
+	if events := rec.take(); len(events) != 1 || events[0] != EventBulletin || rec.bulletins[len(rec.bulletins)-1].ID != "training" {
+		t.Fatalf("Expected the training bulletin to be broadcast, got %v", events)
+	}
+	s.refresh(start.Add(time.Hour), true)
+	if events := rec.take(); len(events) != 0 {
+		t.Fatalf("Expected unchanged bulletins not to be broadcast, got %v", events)
+	}
+	if active := s.Active(); len(active) != 2 || active[0].ID != "engine" {
+		t.Fatalf("Expected the high priority bulletin first, got %+v", active)
+	}
+
+	// Moving a bulletin to other stations ends it at the old ones
+	(*store)[1].Stations = []string{"52"}
+	(*store)[1].UpdatedAt = start.Add(time.Hour)
+	s.refresh(start.Add(time.Hour), true)
+	if events := rec.take(); len(events) != 2 || events[0] != EventBulletinExpired || events[1] != EventBulletin {
+		t.Fatalf("Expected the old stations to be told the bulletin ended, got %v", events)
+	}
+
+	// The bulletin is expired once its end time passes
+	s.refresh(end, true)
+	expired := rec.bulletins[len(rec.bulletins)-1]
+	if events := rec.take(); len(events) != 1 || events[0] != EventBulletinExpired || expired.ID != "training" {
+		t.Fatalf("Expected the training bulletin to expire, got %v", events)
+	}
+	if !expired.EndsAt.Equal(end) {
+		t.Errorf("Expected the expired bulletin to end at %s, got %s", end, expired.EndsAt)
+	}
+
+	// A bulletin removed before its end time is expired now
+	*store = (*store)[1:]
+	s.refresh(end.Add(time.Minute), true)
+	expired = rec.bulletins[len(rec.bulletins)-1]
+	if events := rec.take(); len(events) != 1 || expired.ID != "engine" || expired.EndsAt == nil {
+		t.Fatalf("Expected the engine bulletin to expire with an end time, got %v %+v", events, expired)
+	}
+}
+
+// fakeLeader reports a leadership that the test can change
+type fakeLeader struct {
+	leader bool
+}
+
+func (f *fakeLeader) IsLeader() bool {
+	return f.leader
+}
+
+func TestRefreshLeader(t *testing.T) {
+	start := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+	store := &fakeStore{}
+	rec := &recorder{}
+	leader := &fakeLeader{}
+	s := New(store, rec.send, logging.New("error", "bulletin_test"))
+	s.SetLeader(leader)
+
+	// Instances that don't lead keep the active bulletins without announcing them
+	*store = append(*store, models.Bulletin{ID: "engine", Priority: models.BulletinPriorityHigh, StartsAt: start, UpdatedAt: start})
+	s.refresh(start, true)
+	if events := rec.take(); len(events) != 0 {
+		t.Fatalf("Expected no events from an instance that doesn't lead, got %v", events)
+	}
+	if active := s.Active(); len(active) != 1 {
+		t.Fatalf("Expected the engine bulletin to be active, got %+v", active)
+	}
+
+	// A new leader only announces the changes made after it took over
+	leader.leader = true
+	s.refresh(start, true)
+	if events := rec.take(); len(events) != 0 {
+		t.Fatalf("Expected announced bulletins not to be announced again, got %v", events)
+	}
+	*store = (*store)[:0]
+	s.refresh(start.Add(time.Minute), true)
+	if events := rec.take(); len(events) != 1 || events[0] != EventBulletinExpired {
+		t.Fatalf("Expected the leader to announce the expiry, got %v", events)
+	}
+}
+
+// TestWakeEventBus wakes the services of the other instances when bulletins change
+func TestWakeEventBus(t *testing.T) {
+	bus := eventbus.NewLocal()
+	logger := logging.New("error", "bulletin_test")
+	changed := New(&fakeStore{}, (&recorder{}).send, logger)
+	changed.SetEventBus(bus)
+	leader := New(&fakeStore{}, (&recorder{}).send, logger)
+	leader.SetEventBus(bus)
+
+	changed.Wake()
+
+	select {
+	case <-leader.wake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the other instance's service to be woken")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -13,6 +14,14 @@ type Config struct {
 	Server       ServerConfig
 	Database     DatabaseConfig
 	Auth         AuthConfig
+	RateLimit    RateLimitConfig
+	Signature    SignatureConfig
+	Ingest       IngestConfig
+	WebSocket    WebSocketConfig
+	EventBus     EventBusConfig
+	Scheduler    SchedulerConfig
+	Watchdog     WatchdogConfig
+	Webhook      WebhookConfig
 	Logging      LoggingConfig
 	Notification NotificationConfig
 }
@@ -40,7 +49,94 @@ type DatabaseConfig struct {
 
 // AuthConfig holds the authentication configuration
 type AuthConfig struct {
-	APIPassword string
+	APIPassword   string        // Deprecated shared password, grants the admin role when set
+	SessionTTL    time.Duration // Lifetime of login session tokens
+	AdminUsername string        // Bootstrap admin created when no users exist
+	AdminPassword string
+	TrustProxy    bool          // Use X-Forwarded-For / X-Real-IP for the client address (API key IP allowlists)
+	ProxyHops     int           // Number of trusted reverse proxies that append to X-Forwarded-For
+	TicketTTL     time.Duration // How long a websocket ticket can be redeemed after it is issued
+
+	LockoutThreshold    int           // Failed attempts per credential before it is locked out
+	IPLockoutThreshold  int           // Failed attempts per client IP before it is locked out
+	LockoutBaseDuration time.Duration // First lockout duration, doubled on every further failure
+	LockoutMaxDuration  time.Duration // Longest lockout, also how long failures are remembered
+}
+
+// WebSocketConfig holds the websocket hub configuration
+type WebSocketConfig struct {
+	StationPageGroups  map[string][]string // Page groups that belong to each station, for station filters
+	ReplayBufferSize   int                 // Dashboard events kept for clients that resume after a disconnect
+	AckTimeout         time.Duration       // How long a station's display has to acknowledge an alert, 0 disables warnings
+	SlowConsumerPolicy string              // drop_oldest, coalesce or disconnect when a client's send queue is full
+	PingInterval       time.Duration       // How often clients are sent protocol pings
+	PongTimeout        time.Duration       // How long a client may stay silent before it is disconnected
+	HistoryRetention   time.Duration       // How long ended connection sessions are kept for history and uptime reports
+	Compression        bool                // Negotiate permessage-deflate with clients that offer it
+	CompressThreshold  int                 // Frames smaller than this many bytes are sent uncompressed
+}
+
+// EventBusConfig holds the configuration of the bus that carries broadcasts between server instances
+type EventBusConfig struct {
+	Driver    string        // local for a single instance, postgres to share broadcasts through LISTEN/NOTIFY
+	Channel   string        // Postgres notification channel
+	Retention time.Duration // How long published events are kept for listeners that reconnect
+	Instance  string        // Names this server instance, replayable events are numbered per instance. Required with the postgres driver.
+}
+
+// SchedulerConfig holds the scheduled display command configuration
+type SchedulerConfig struct {
+	Enabled        bool
+	Timezone       string        // IANA zone for schedules that don't set their own
+	MissedRunGrace time.Duration // How late a run may start before the job's missed run policy applies
+	RunRetention   time.Duration // How long the run history is kept
+}
+
+// WatchdogConfig holds the offline display watchdog configuration
+type WatchdogConfig struct {
+	Stations    []string      // Stations that must always have a dashboard display connected, empty disables the watchdog
+	GracePeriod time.Duration // How long a station may have no display before it is reported offline
+}
+
+// WebhookConfig holds the outbound webhook delivery configuration
+type WebhookConfig struct {
+	Enabled     bool
+	Timeout     time.Duration // How long a receiver has to answer each attempt
+	MaxAttempts int           // Attempts before a delivery moves to the dead-letter queue
+	BackoffBase time.Duration // Delay after the first failed attempt, doubled after each further failure
+	BackoffMax  time.Duration // Longest delay between attempts
+	Workers     int           // Deliveries sent at the same time
+	Retention   time.Duration // How long delivered and dead deliveries are kept
+}
+
+// RateLimitConfig holds the token bucket settings for each route group
+type RateLimitConfig struct {
+	Enabled bool
+	Auth    RateLimit // Login, device pairing and websocket tickets
+	Ingest  RateLimit // Alert ingestion
+	Public  RateLimit // Public dashboard endpoints
+}
+
+// SignatureConfig holds the HMAC signature verification of alert ingestion
+type SignatureConfig struct {
+	Secret         string        // Current shared secret, empty disables verification
+	PreviousSecret string        // Also accepted while senders move to a new secret
+	Required       bool          // Reject unsigned requests, otherwise only signed requests are verified
+	Tolerance      time.Duration // How far the signed timestamp may be from the server clock
+}
+
+// IngestConfig holds the alert ingestion configuration
+type IngestConfig struct {
+	DedupWindow time.Duration // How long ingested alerts are remembered to deduplicate retries, 0 disables deduplication
+	QueueDir    string        // Directory of the on-disk queue of alerts waiting for the database, empty disables the queue
+	RetryMax    time.Duration // Longest wait between attempts to store a queued alert
+	ParseMode   string        // strict rejects alert payloads with fields of the wrong type, lenient converts or drops them
+}
+
+// RateLimit is a token bucket refilled at PerMinute tokens per minute holding up to Burst tokens
+type RateLimit struct {
+	PerMinute int
+	Burst     int
 }
 
 // LoggingConfig holds the logging configuration
@@ -87,7 +183,81 @@ func New() *Config {
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 		},
 		Auth: AuthConfig{
-			APIPassword: getEnv("API_PASSWORD", ""),
+			APIPassword:   getEnv("API_PASSWORD", ""),
+			SessionTTL:    getDurationEnv("SESSION_TTL", 12*time.Hour),
+			AdminUsername: getEnv("ADMIN_USERNAME", ""),
+			AdminPassword: getEnv("ADMIN_PASSWORD", ""),
+			TrustProxy:    getBoolEnv("TRUST_PROXY_HEADERS", false),
+			ProxyHops:     getIntEnv("TRUSTED_PROXY_HOPS", 1),
+			TicketTTL:     getDurationEnv("WS_TICKET_TTL", 30*time.Second),
+
+			LockoutThreshold:    getIntEnv("LOCKOUT_THRESHOLD", 5),
+			IPLockoutThreshold:  getIntEnv("LOCKOUT_IP_THRESHOLD", 20),
+			LockoutBaseDuration: getDurationEnv("LOCKOUT_BASE_DURATION", 30*time.Second),
+			LockoutMaxDuration:  getDurationEnv("LOCKOUT_MAX_DURATION", time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: getBoolEnv("RATE_LIMIT_ENABLED", true),
+			Auth: RateLimit{
+				PerMinute: getIntEnv("RATE_LIMIT_AUTH_PER_MINUTE", 10),
+				Burst:     getIntEnv("RATE_LIMIT_AUTH_BURST", 5),
+			},
+			Ingest: RateLimit{
+				PerMinute: getIntEnv("RATE_LIMIT_INGEST_PER_MINUTE", 120),
+				Burst:     getIntEnv("RATE_LIMIT_INGEST_BURST", 30),
+			},
+			Public: RateLimit{
+				PerMinute: getIntEnv("RATE_LIMIT_PUBLIC_PER_MINUTE", 300),
+				Burst:     getIntEnv("RATE_LIMIT_PUBLIC_BURST", 60),
+			},
+		},
+		Signature: SignatureConfig{
+			Secret:         getEnv("INGEST_SIGNATURE_SECRET", ""),
+			PreviousSecret: getEnv("INGEST_SIGNATURE_PREVIOUS_SECRET", ""),
+			Required:       getBoolEnv("INGEST_SIGNATURE_REQUIRED", true),
+			Tolerance:      getDurationEnv("INGEST_SIGNATURE_TOLERANCE", 5*time.Minute),
+		},
+		Ingest: IngestConfig{
+			DedupWindow: getDurationEnv("INGEST_DEDUP_WINDOW", 10*time.Minute),
+			QueueDir:    getEnv("INGEST_QUEUE_DIR", "data/ingest-queue"),
+			RetryMax:    getDurationEnv("INGEST_QUEUE_RETRY_MAX", time.Minute),
+			ParseMode:   getEnv("INGEST_PARSE_MODE", "lenient"),
+		},
+		WebSocket: WebSocketConfig{
+			StationPageGroups:  getMapSliceEnv("STATION_PAGE_GROUPS"),
+			ReplayBufferSize:   getIntEnv("WS_REPLAY_BUFFER_SIZE", 500),
+			AckTimeout:         getDurationEnv("ALERT_ACK_TIMEOUT", 60*time.Second),
+			SlowConsumerPolicy: getEnv("WS_SLOW_CONSUMER_POLICY", "drop_oldest"),
+			PingInterval:       getDurationEnv("WS_PING_INTERVAL", 20*time.Second),
+			PongTimeout:        getDurationEnv("WS_PONG_TIMEOUT", 60*time.Second),
+			HistoryRetention:   getDurationEnv("CONNECTION_HISTORY_RETENTION", 90*24*time.Hour),
+			Compression:        getBoolEnv("WS_COMPRESSION", true),
+			CompressThreshold:  getIntEnv("WS_COMPRESSION_THRESHOLD", 1024),
+		},
+		EventBus: EventBusConfig{
+			Driver:    getEnv("EVENT_BUS", "local"),
+			Channel:   getEnv("EVENT_BUS_CHANNEL", "alerting_events"),
+			Retention: getDurationEnv("EVENT_BUS_RETENTION", time.Hour),
+			Instance:  getEnv("INSTANCE_ID", ""),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:        getBoolEnv("SCHEDULER_ENABLED", true),
+			Timezone:       getEnv("SCHEDULER_TIMEZONE", "Local"),
+			MissedRunGrace: getDurationEnv("SCHEDULER_MISSED_RUN_GRACE", 5*time.Minute),
+			RunRetention:   getDurationEnv("SCHEDULER_RUN_RETENTION", 30*24*time.Hour),
+		},
+		Watchdog: WatchdogConfig{
+			Stations:    getSliceEnv("WATCHDOG_STATIONS", []string{}),
+			GracePeriod: getDurationEnv("WATCHDOG_GRACE_PERIOD", 5*time.Minute),
+		},
+		Webhook: WebhookConfig{
+			Enabled:     getBoolEnv("WEBHOOK_ENABLED", true),
+			Timeout:     getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts: getIntEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+			BackoffBase: getDurationEnv("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+			BackoffMax:  getDurationEnv("WEBHOOK_BACKOFF_MAX", time.Hour),
+			Workers:     getIntEnv("WEBHOOK_WORKERS", 4),
+			Retention:   getDurationEnv("WEBHOOK_RETENTION", 14*24*time.Hour),
 		},
 		Logging: LoggingConfig{
 			Level:          getEnv("LOG_LEVEL", "debug"),
@@ -114,11 +284,19 @@ func (c *Config) Initialize() {
 	// Build the DSN for the database
 	c.Database.DSN = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		c.Database.User, c.Database.Password, c.Database.Host, c.Database.Port, c.Database.Name, c.Database.SSLMode)
+
+	// A single instance keeps a fixed name, so its replay buffer survives a new host name after a restart
+	if c.EventBus.Instance == "" && c.EventBus.Driver == "local" {
+		c.EventBus.Instance = "local"
+	}
 }
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	// Add validation logic as needed
+	// Host names change when containers restart, so shared instances must be named explicitly
+	if c.EventBus.Driver == "postgres" && c.EventBus.Instance == "" {
+		return errors.New("INSTANCE_ID is required with EVENT_BUS=postgres")
+	}
 	return nil
 }
 
@@ -165,3 +343,28 @@ func getSliceEnv(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// getMapSliceEnv parses "key:a|b;key2:c" into a map of keys to values
+func getMapSliceEnv(key string) map[string][]string {
+	result := make(map[string][]string)
+
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return result
+	}
+
+	for _, entry := range strings.Split(value, ";") {
+		name, values, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		for _, v := range strings.Split(values, "|") {
+			if v = strings.TrimSpace(v); v != "" {
+				result[name] = append(result[name], v)
+			}
+		}
+	}
+
+	return result
+}
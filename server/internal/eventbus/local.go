@@ -0,0 +1,41 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// Local delivers events to the hubs of this server instance only. It is the default bus.
+type Local struct {
+	handlers map[string][]func(models.BusEvent)
+	mutex    sync.RWMutex
+}
+
+// NewLocal creates an in-process event bus
+func NewLocal() *Local {
+	return &Local{
+		handlers: make(map[string][]func(models.BusEvent)),
+	}
+}
+
+// Publish delivers the event to the hub's handlers before returning
+func (b *Local) Publish(ctx context.Context, event models.BusEvent) error {
+	b.mutex.RLock()
+	handlers := b.handlers[event.Hub]
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for the events of a hub
+func (b *Local) Subscribe(hub string, handler func(models.BusEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.handlers[hub] = append(b.handlers[hub], handler)
+}
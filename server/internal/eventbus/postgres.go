@@ -0,0 +1,239 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+const (
+	// maxInlineMessage is the largest message sent in the notification itself. NOTIFY payloads
+	// are limited to 8000 bytes, so larger messages are read from the bus_events table.
+	maxInlineMessage = 7000
+	// pingInterval is how often the listener connection is checked
+	pingInterval = 90 * time.Second
+	// catchUpSlack widens the catch-up window after a reconnect to allow for clock skew
+	// between instances. Events delivered twice are dropped by the hubs.
+	catchUpSlack = 30 * time.Second
+	// maxCatchUpEvents bounds how many missed events are delivered after a reconnect
+	maxCatchUpEvents = 1000
+)
+
+// Store persists bus events and sends the notifications that announce them
+type Store interface {
+	PublishBusEvent(ctx context.Context, channel string, event models.BusEvent, notify func(position int64, message []byte) (string, error)) error
+	GetBusEvent(ctx context.Context, position int64) (models.BusEvent, error)
+	ListBusEventsSince(ctx context.Context, since time.Time, limit int) ([]storage.PositionedBusEvent, error)
+	DeleteBusEventsBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// notification is the payload of a bus NOTIFY. Message is left out when it is too large to inline.
+type notification struct {
+	Position int64           `json:"position"`
+	Hub      string          `json:"hub"`
+	Origin   string          `json:"origin"`
+	Message  json.RawMessage `json:"message,omitempty"`
+}
+
+// Postgres carries events between server instances with Postgres LISTEN/NOTIFY.
+// Every event is stored in the bus_events table, so an instance whose listener
+// reconnects catches up on the events it missed.
+type Postgres struct {
+	store        Store
+	listener     *pq.Listener
+	channel      string
+	instanceID   string
+	retention    time.Duration
+	logger       *logging.Logger
+	handlers     map[string][]func(models.BusEvent)
+	mutex        sync.RWMutex
+	lastReceived time.Time // Publish time of the latest event received, used to catch up after a reconnect
+	shutdownCh   chan struct{}
+	done         chan struct{}
+}
+
+// NewPostgres creates a bus that listens on the configured channel with its own database connection
+func NewPostgres(cfg config.EventBusConfig, dsn string, store Store, logger *logging.Logger) (*Postgres, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warnf("Event bus listener connection problem: %v", err)
+		}
+	})
+	if err := listener.Listen(cfg.Channel); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to listen on event bus channel %s: %w", cfg.Channel, err)
+	}
+
+	return &Postgres{
+		store:      store,
+		listener:   listener,
+		channel:    cfg.Channel,
+		instanceID: uuid.New().String(),
+		retention:  cfg.Retention,
+		logger:     logger,
+		handlers:   make(map[string][]func(models.BusEvent)),
+		shutdownCh: make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Start delivers notified events to the subscribed hubs until Stop is called
+func (b *Postgres) Start() {
+	b.logger.Infof("Starting Postgres event bus on channel %s as instance %s", b.channel, b.instanceID)
+	b.lastReceived = time.Now()
+
+	pingTicker := time.NewTicker(pingInterval)
+	pruneTicker := time.NewTicker(time.Hour)
+
+	go func() {
+		defer close(b.done)
+		defer pingTicker.Stop()
+		defer pruneTicker.Stop()
+
+		for {
+			select {
+			case n := <-b.listener.Notify:
+				if n == nil {
+					// The listener reconnected and may have missed notifications
+					b.catchUp()
+					continue
+				}
+				b.handle(n.Extra)
+			case <-pingTicker.C:
+				if err := b.listener.Ping(); err != nil {
+					b.logger.Warnf("Event bus listener ping failed: %v", err)
+				}
+			case <-pruneTicker.C:
+				b.prune()
+			case <-b.shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the bus
+func (b *Postgres) Stop() {
+	close(b.shutdownCh)
+	<-b.done
+	if err := b.listener.Close(); err != nil {
+		b.logger.Error(err, "Failed to close event bus listener")
+	}
+}
+
+// Publish stores the event and notifies every instance. The publishing instance skips its own
+// notifications, as its hubs deliver their events before publishing them.
+func (b *Postgres) Publish(ctx context.Context, event models.BusEvent) error {
+	event.Origin = b.instanceID
+
+	return b.store.PublishBusEvent(ctx, b.channel, event, func(position int64, message []byte) (string, error) {
+		n := notification{Position: position, Hub: event.Hub, Origin: event.Origin}
+		if len(message) <= maxInlineMessage {
+			n.Message = message
+		}
+
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal bus notification: %w", err)
+		}
+		return string(payload), nil
+	})
+}
+
+// Subscribe registers a handler for the events of a hub
+func (b *Postgres) Subscribe(hub string, handler func(models.BusEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.handlers[hub] = append(b.handlers[hub], handler)
+}
+
+// handle decodes a notification, loading the event from the table when it wasn't inlined
+func (b *Postgres) handle(payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		b.logger.Warnf("Ignoring invalid event bus notification: %v", err)
+		return
+	}
+	if n.Origin == b.instanceID {
+		return
+	}
+
+	var event models.BusEvent
+	if len(n.Message) > 0 {
+		message, err := storage.DecodeBusMessage(n.Message)
+		if err != nil {
+			b.logger.Error(err, "Failed to decode event bus notification")
+			return
+		}
+		event = models.BusEvent{Hub: n.Hub, Origin: n.Origin, Message: message}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		event, err = b.store.GetBusEvent(ctx, n.Position)
+		if err != nil {
+			b.logger.Error(err, fmt.Sprintf("Failed to load event bus event %d", n.Position))
+			return
+		}
+	}
+
+	b.dispatch(event)
+}
+
+// catchUp delivers the events published since the last one received
+func (b *Postgres) catchUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := b.store.ListBusEventsSince(ctx, b.lastReceived.Add(-catchUpSlack), maxCatchUpEvents)
+	if err != nil {
+		b.logger.Error(err, "Failed to catch up on missed event bus events")
+		return
+	}
+
+	b.logger.Warnf("Event bus listener reconnected, delivering %d recent events", len(events))
+	for _, event := range events {
+		b.dispatch(event.Event)
+	}
+}
+
+// dispatch hands an event to the handlers of its hub
+func (b *Postgres) dispatch(event models.BusEvent) {
+	if event.Message.Time.After(b.lastReceived) {
+		b.lastReceived = event.Message.Time
+	}
+
+	b.mutex.RLock()
+	handlers := b.handlers[event.Hub]
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// prune removes stored events older than the retention
+func (b *Postgres) prune() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := b.store.DeleteBusEventsBefore(ctx, time.Now().Add(-b.retention))
+	if err != nil {
+		b.logger.Error(err, "Failed to prune event bus events")
+		return
+	}
+	if count > 0 {
+		b.logger.Infof("Pruned %d event bus events", count)
+	}
+}
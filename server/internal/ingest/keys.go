@@ -0,0 +1,59 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// maxKeys is the number of dedup keys at which expired keys are swept
+const maxKeys = 1024
+
+// ReserveIngestKey claims a dedup key for a new ingestion, the way the database's ingest_keys
+// table does. It returns the key and true when it was claimed, or the unexpired key of an
+// earlier request and false when it wasn't. Keys are kept in memory and used in place of the
+// database's while it can't be reached. They are forgotten on restart and only cover requests
+// received by this instance.
+func (q *Queue) ReserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, error) {
+	q.keysMutex.Lock()
+	defer q.keysMutex.Unlock()
+
+	if existing, ok := q.keys[key.Key]; ok && existing.ExpiresAt.After(key.CreatedAt) {
+		return existing, false, nil
+	}
+
+	if len(q.keys) >= maxKeys {
+		for k, existing := range q.keys {
+			if !existing.ExpiresAt.After(key.CreatedAt) {
+				delete(q.keys, k)
+			}
+		}
+	}
+
+	q.keys[key.Key] = key
+	return key, true, nil
+}
+
+// CompleteIngestKey stores the response sent for a reserved key and keeps it until expiresAt
+func (q *Queue) CompleteIngestKey(ctx context.Context, key string, statusCode int, response []byte, expiresAt time.Time) error {
+	q.keysMutex.Lock()
+	defer q.keysMutex.Unlock()
+
+	if reserved, ok := q.keys[key]; ok {
+		reserved.StatusCode, reserved.Response, reserved.ExpiresAt = statusCode, response, expiresAt
+		q.keys[key] = reserved
+	}
+	return nil
+}
+
+// ReleaseIngestKey removes a reserved key whose request failed, so a retry can ingest the alert
+func (q *Queue) ReleaseIngestKey(ctx context.Context, key string) error {
+	q.keysMutex.Lock()
+	defer q.keysMutex.Unlock()
+
+	if !q.keys[key].Completed() {
+		delete(q.keys, key)
+	}
+	return nil
+}
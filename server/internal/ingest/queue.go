@@ -0,0 +1,464 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/metrics"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// errConflict marks an entry whose alert ID is already used by a different stored alert
+var errConflict = errors.New("alert ID conflict")
+
+// checkInterval is how often the queue looks for entries due to be stored
+const checkInterval = 5 * time.Second
+
+// retryBase is the wait after the first failed attempt, doubled after each further failure
+const retryBase = time.Second
+
+// Errors returned when changing queue entries
+var (
+	ErrNotFound  = errors.New("queue entry not found")
+	ErrNotFailed = errors.New("queue entry has not failed")
+	ErrDuplicate = errors.New("an alert with this ID is already queued")
+)
+
+// Store saves queued alerts
+type Store interface {
+	CreateAlert(ctx context.Context, alert models.Alert) (string, error)
+	GetAlertByID(ctx context.Context, id string) (models.Alert, error)
+}
+
+// Queue is a write-ahead queue of inbound alerts. Each alert is written to its own file and
+// synced to disk before it is broadcast, then stored in the database in the order received.
+// While the database is unavailable entries are retried with backoff, and an entry is only
+// removed from disk once the database has it.
+type Queue struct {
+	dir        string
+	retryMax   time.Duration
+	store      Store
+	logger     *logging.Logger
+	entries    []models.IngestEntry // In the order received
+	mutex      sync.Mutex
+	keys       map[string]models.IngestKey // Dedup keys of alerts received by this instance
+	keysMutex  sync.Mutex
+	onStored   func(models.Alert) // Called with each alert once the database has it
+	wake       chan struct{}
+	shutdownCh chan struct{}
+	done       chan struct{}
+}
+
+// Open creates the queue directory if needed and loads the entries left by a previous run.
+// Loaded entries were already broadcast and are only stored.
+func Open(cfg config.IngestConfig, store Store, logger *logging.Logger) (*Queue, error) {
+	if err := os.MkdirAll(cfg.QueueDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create ingest queue directory: %w", err)
+	}
+
+	q := &Queue{
+		dir:        cfg.QueueDir,
+		retryMax:   cfg.RetryMax,
+		store:      store,
+		logger:     logger,
+		entries:    make([]models.IngestEntry, 0),
+		keys:       make(map[string]models.IngestKey),
+		wake:       make(chan struct{}, 1),
+		shutdownCh: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if q.retryMax < retryBase {
+		q.retryMax = retryBase
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load reads the queued entries from disk
+func (q *Queue) load() error {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read ingest queue directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(q.dir, file.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read ingest queue entry: %w", err)
+		}
+		var entry models.IngestEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			// Keep the file for inspection rather than losing the alert silently
+			q.logger.Errorf(err, "Skipping unreadable ingest queue entry %s", file.Name())
+			continue
+		}
+		q.entries = append(q.entries, entry)
+	}
+
+	sort.SliceStable(q.entries, func(i, j int) bool {
+		return q.entries[i].ReceivedAt.Before(q.entries[j].ReceivedAt)
+	})
+	if len(q.entries) > 0 {
+		q.logger.Warnf("Loaded %d alerts from the ingest queue that were not stored before the last shutdown", len(q.entries))
+	}
+	return nil
+}
+
+// Start stores due entries until Stop is called
+func (q *Queue) Start() {
+	ticker := time.NewTicker(checkInterval)
+
+	go func() {
+		defer close(q.done)
+		defer ticker.Stop()
+
+		q.process(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+			case <-q.wake:
+			case <-q.shutdownCh:
+				q.logger.Info("Ingest queue shutting down")
+				return
+			}
+			q.process(time.Now())
+		}
+	}()
+}
+
+// Stop gracefully shuts down the queue. Entries not yet stored stay on disk for the next run.
+func (q *Queue) Stop() {
+	close(q.shutdownCh)
+	<-q.done
+}
+
+// Wake makes the queue store due entries now
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SetStoredCallback sets the callback invoked with each queued alert once it is stored,
+// including alerts reloaded from a previous run. It is called from the queue's goroutine.
+func (q *Queue) SetStoredCallback(callback func(models.Alert)) {
+	q.onStored = callback
+}
+
+// Enqueue writes an alert to disk and queues it to be stored. Once it returns
+// the alert survives a restart, so it can be broadcast. It returns ErrDuplicate
+// when an alert with the same ID is still queued.
+func (q *Queue) Enqueue(alert models.Alert) (models.IngestEntry, error) {
+	now := time.Now()
+	entry := models.IngestEntry{
+		ID:            uuid.New().String(),
+		Alert:         alert,
+		Status:        models.IngestStatusPending,
+		ReceivedAt:    now,
+		NextAttemptAt: &now,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, queued := range q.entries {
+		if queued.Alert.Alert.ID == alert.Alert.ID {
+			return models.IngestEntry{}, ErrDuplicate
+		}
+	}
+
+	if err := q.write(entry); err != nil {
+		return models.IngestEntry{}, err
+	}
+	q.entries = append(q.entries, entry)
+
+	q.Wake()
+	return entry, nil
+}
+
+// Entries returns the queued entries in the order received, limited to a status unless it is empty
+func (q *Queue) Entries(status string) []models.IngestEntry {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	entries := make([]models.IngestEntry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		if status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Retry queues a failed entry to be stored again
+func (q *Queue) Retry(id string) (models.IngestEntry, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.index(id)
+	if i < 0 {
+		return models.IngestEntry{}, ErrNotFound
+	}
+	if q.entries[i].Status != models.IngestStatusFailed {
+		return models.IngestEntry{}, ErrNotFailed
+	}
+
+	now := time.Now()
+	entry := q.entries[i]
+	entry.Status = models.IngestStatusPending
+	entry.Attempts = 0
+	entry.NextAttemptAt = &now
+	if err := q.write(entry); err != nil {
+		return models.IngestEntry{}, err
+	}
+	q.entries[i] = entry
+
+	q.Wake()
+	return entry, nil
+}
+
+// Discard removes a failed entry without storing it
+func (q *Queue) Discard(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if q.entries[i].Status != models.IngestStatusFailed {
+		return ErrNotFailed
+	}
+
+	return q.remove(i)
+}
+
+// process stores due pending entries in the order received and returns how many were stored.
+// It stops at the first entry that can't be stored yet, so alerts reach the database in order.
+func (q *Queue) process(now time.Time) int {
+	stored := 0
+	for {
+		entry, ok := q.next(now)
+		if !ok {
+			return stored
+		}
+
+		err := q.create(entry)
+
+		q.mutex.Lock()
+		moveOn := q.record(entry, err, now)
+		q.mutex.Unlock()
+		if !moveOn {
+			return stored
+		}
+		if err == nil {
+			stored++
+			if q.onStored != nil {
+				q.onStored(entry.Alert)
+			}
+		}
+	}
+}
+
+// create stores the alert of an entry. An alert that already exists with the same content was
+// stored by an earlier attempt whose entry wasn't removed, such as one that timed out after the
+// insert or was interrupted by a restart, and counts as stored. Another alert with the same ID
+// is a conflict the entry can't resolve by retrying.
+func (q *Queue) create(entry models.IngestEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := q.store.CreateAlert(ctx, entry.Alert)
+	if !errors.Is(err, storage.ErrConflict) {
+		return err
+	}
+
+	existing, getErr := q.store.GetAlertByID(ctx, entry.Alert.Alert.ID)
+	if getErr != nil {
+		return fmt.Errorf("failed to compare with the stored alert: %w", getErr)
+	}
+	if sameAlert(existing, entry.Alert) {
+		return nil
+	}
+	return fmt.Errorf("%w: a different alert with ID %s is already stored", errConflict, entry.Alert.Alert.ID)
+}
+
+// next returns the first pending entry if it is due
+func (q *Queue) next(now time.Time) (models.IngestEntry, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, entry := range q.entries {
+		if entry.Status != models.IngestStatusPending {
+			continue
+		}
+		if entry.NextAttemptAt != nil && entry.NextAttemptAt.After(now) {
+			return models.IngestEntry{}, false
+		}
+		return entry, true
+	}
+	return models.IngestEntry{}, false
+}
+
+// record applies the outcome of an attempt to store an entry and reports whether
+// the queue can move on to the next entry. The caller must hold the mutex.
+func (q *Queue) record(entry models.IngestEntry, err error, now time.Time) bool {
+	i := q.index(entry.ID)
+	if i < 0 {
+		return true
+	}
+
+	if err == nil {
+		if err := q.remove(i); err != nil {
+			q.logger.Error(err, "Failed to remove stored alert from the ingest queue")
+		}
+		if entry.Attempts > 0 {
+			q.logger.Infof("Stored queued alert %s after %d failed attempts", entry.Alert.Alert.ID, entry.Attempts)
+		}
+		return true
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	moveOn := false
+	if storage.IsPermanentError(err) || errors.Is(err, errConflict) {
+		q.logger.Errorf(err, "Database rejected queued alert %s, it needs attention", entry.Alert.Alert.ID)
+		entry.Status = models.IngestStatusFailed
+		entry.NextAttemptAt = nil
+		moveOn = true
+	} else {
+		next := now.Add(q.backoff(entry.Attempts))
+		entry.NextAttemptAt = &next
+		q.logger.Warnf("Failed to store queued alert %s (attempt %d), retrying at %s: %v",
+			entry.Alert.Alert.ID, entry.Attempts, next.Format(time.RFC3339), err)
+	}
+
+	if err := q.write(entry); err != nil {
+		q.logger.Error(err, "Failed to update ingest queue entry")
+	}
+	q.entries[i] = entry
+	return moveOn
+}
+
+// sameAlert reports whether a stored alert has the content of a queued one. Only the fields
+// the database keeps are compared, and the status is left out because displays may have changed it since.
+func sameAlert(stored, queued models.Alert) bool {
+	a, errA := json.Marshal(storage.SavedAlert(stored))
+	b, errB := json.Marshal(storage.SavedAlert(queued))
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// backoff returns the wait before the next attempt after the given number of failed attempts
+func (q *Queue) backoff(attempts int) time.Duration {
+	wait := retryBase
+	for i := 1; i < attempts && wait < q.retryMax; i++ {
+		wait *= 2
+	}
+	return min(wait, q.retryMax)
+}
+
+// index returns the position of an entry, or -1. The caller must hold the mutex.
+func (q *Queue) index(id string) int {
+	for i, entry := range q.entries {
+		if entry.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove deletes an entry from disk and the queue. The caller must hold the mutex.
+func (q *Queue) remove(i int) error {
+	if err := os.Remove(q.path(q.entries[i])); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove ingest queue entry: %w", err)
+	}
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	return nil
+}
+
+// path returns the file of an entry. Names sort in the order received.
+func (q *Queue) path(entry models.IngestEntry) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d-%s.json", entry.ReceivedAt.UnixNano(), entry.ID))
+}
+
+// write atomically replaces an entry's file and syncs it to disk
+func (q *Queue) write(entry models.IngestEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ingest queue entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(q.dir, "entry-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create ingest queue entry: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write ingest queue entry: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync ingest queue entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close ingest queue entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path(entry)); err != nil {
+		return fmt.Errorf("failed to save ingest queue entry: %w", err)
+	}
+
+	// Sync the directory so the rename itself survives a power loss
+	dir, err := os.Open(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to open ingest queue directory: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync ingest queue directory: %w", err)
+	}
+	return nil
+}
+
+// RegisterMetrics exposes the number of queued entries by status
+func (q *Queue) RegisterMetrics(registry *metrics.Registry) {
+	registry.GaugeFunc("alerting_ingest_queue_entries", "Alerts in the ingest queue waiting to be stored in the database", func() []metrics.Sample {
+		counts := map[string]int{models.IngestStatusPending: 0, models.IngestStatusFailed: 0}
+		for _, entry := range q.Entries("") {
+			counts[entry.Status]++
+		}
+
+		samples := make([]metrics.Sample, 0, len(counts))
+		for status, count := range counts {
+			samples = append(samples, metrics.Sample{
+				Labels: metrics.Labels{"status": status},
+				Value:  float64(count),
+			})
+		}
+		return samples
+	})
+}
@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// fakeStore stores alerts unless an error is set for their ID or the database is down
+type fakeStore struct {
+	down   bool
+	errors map[string]error
+	alerts map[string]models.Alert
+	stored []string
+}
+
+func (f *fakeStore) CreateAlert(ctx context.Context, alert models.Alert) (string, error) {
+	if f.down {
+		return "", errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+	}
+	if err := f.errors[alert.Alert.ID]; err != nil {
+		return "", err
+	}
+	if _, ok := f.alerts[alert.Alert.ID]; ok {
+		return "", storage.ErrConflict
+	}
+	if f.alerts == nil {
+		f.alerts = make(map[string]models.Alert)
+	}
+	f.alerts[alert.Alert.ID] = alert
+	f.stored = append(f.stored, alert.Alert.ID)
+	return alert.Alert.ID, nil
+}
+
+func (f *fakeStore) GetAlertByID(ctx context.Context, id string) (models.Alert, error) {
+	if f.down {
+		return models.Alert{}, errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+	}
+	alert, ok := f.alerts[id]
+	if !ok {
+		return models.Alert{}, storage.ErrNotFound
+	}
+	return alert, nil
+}
+
+// testAlert returns an alert with fields that Active911 sends but the alerts table doesn't keep
+func testAlert(id string) models.Alert {
+	empty := ""
+	return models.Alert{
+		Agency: models.Agency{Name: "Test FD"},
+		Alert:  models.AlertDetails{ID: id, CustomIdentifiers: &empty, DispatchCoords: &empty, PageGroups: []string{}},
+	}
+}
+
+func openQueue(t *testing.T, dir string, store Store) *Queue {
+	t.Helper()
+	q, err := Open(config.IngestConfig{QueueDir: dir, RetryMax: 4 * time.Second}, store, logging.New("error", "ingest_test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQueueSurvivesDatabaseOutage(t *testing.T) {
+	dir := t.TempDir()
+	store := &fakeStore{down: true}
+	q := openQueue(t, dir, store)
+
+	for _, id := range []string{"A1", "A2"} {
+		if _, err := q.Enqueue(testAlert(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// While the database is down the first alert is retried with backoff and the second waits behind it
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Minute)
+		if stored := q.process(now); stored != 0 {
+			t.Fatalf("Expected nothing to be stored while the database is down, got %d", stored)
+		}
+	}
+	entries := q.Entries(models.IngestStatusPending)
+	if len(entries) != 2 || entries[0].Attempts != 4 || entries[1].Attempts != 0 || entries[0].LastError == "" {
+		t.Fatalf("Unexpected pending entries: %+v", entries)
+	}
+	if wait := entries[0].NextAttemptAt.Sub(now); wait != 4*time.Second {
+		t.Errorf("Expected the backoff to be capped at 4s, got %s", wait)
+	}
+
+	// A restart reloads the queued alerts from disk in order
+	q = openQueue(t, dir, store)
+	if entries := q.Entries(""); len(entries) != 2 || entries[0].Alert.Alert.ID != "A1" || entries[0].Attempts != 4 {
+		t.Fatalf("Expected both alerts to be reloaded, got %+v", entries)
+	}
+
+	// Once the database recovers every alert is stored in order, reported and removed from disk
+	var reported []string
+	q.SetStoredCallback(func(alert models.Alert) { reported = append(reported, alert.Alert.ID) })
+	store.down = false
+	if stored := q.process(now.Add(time.Minute)); stored != 2 {
+		t.Fatalf("Expected both alerts to be stored, got %d", stored)
+	}
+	if len(store.stored) != 2 || store.stored[0] != "A1" || store.stored[1] != "A2" {
+		t.Errorf("Expected the alerts to be stored in order, got %v", store.stored)
+	}
+	if len(reported) != 2 || reported[0] != "A1" || reported[1] != "A2" {
+		t.Errorf("Expected the stored alerts to be reported in order, got %v", reported)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 || len(q.Entries("")) != 0 {
+		t.Errorf("Expected the queue to be empty, %d files are left", len(files))
+	}
+}
+
+func TestQueueFailedEntries(t *testing.T) {
+	// "duplicate" was stored by an earlier attempt, and displays acknowledged it since.
+	// It is read back without the fields the database doesn't keep.
+	acknowledged := storage.SavedAlert(testAlert("duplicate"))
+	acknowledged.Alert.Status = "acknowledged"
+	store := &fakeStore{
+		errors: map[string]error{"bad": &pq.Error{Code: "23502", Message: "null value in column \"agency_name\""}},
+		alerts: map[string]models.Alert{"duplicate": acknowledged},
+	}
+	q := openQueue(t, t.TempDir(), store)
+
+	for _, id := range []string{"bad", "duplicate", "A3"} {
+		if _, err := q.Enqueue(testAlert(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An alert the database rejects is set aside, and an alert it already has counts as stored
+	if stored := q.process(time.Now()); stored != 2 {
+		t.Fatalf("Expected 2 alerts to be stored, got %d", stored)
+	}
+	failed := q.Entries(models.IngestStatusFailed)
+	if len(failed) != 1 || failed[0].Alert.Alert.ID != "bad" || failed[0].NextAttemptAt != nil {
+		t.Fatalf("Expected the rejected alert to be failed, got %+v", failed)
+	}
+	if len(q.Entries(models.IngestStatusPending)) != 0 {
+		t.Errorf("Expected no pending entries")
+	}
+
+	// Pending entries can't be retried or discarded
+	if _, err := q.Retry("unknown"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// A retried entry is stored once the problem is fixed
+	delete(store.errors, "bad")
+	if _, err := q.Retry(failed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored := q.process(time.Now()); stored != 1 || len(q.Entries("")) != 0 {
+		t.Fatalf("Expected the retried alert to be stored, got %d", stored)
+	}
+
+	// A failed entry can be discarded instead
+	store.errors["A4"] = &pq.Error{Code: "22001", Message: "value too long"}
+	entry, _ := q.Enqueue(testAlert("A4"))
+	if err := q.Discard(entry.ID); err != ErrNotFailed {
+		t.Errorf("Expected a pending entry not to be discarded, got %v", err)
+	}
+	q.process(time.Now())
+	if err := q.Discard(entry.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Entries("")) != 0 {
+		t.Errorf("Expected the discarded entry to be removed")
+	}
+}
+
+func TestQueueDuplicateAlertID(t *testing.T) {
+	stored := testAlert("A1")
+	stored.Alert.Description = &[]string{"STRUCTURE FIRE"}[0]
+	store := &fakeStore{alerts: map[string]models.Alert{"A1": stored}}
+	q := openQueue(t, t.TempDir(), store)
+
+	// An alert ID that is still queued can't be queued again
+	update := testAlert("A1")
+	update.Alert.Description = &[]string{"STRUCTURE FIRE - UPGRADED"}[0]
+	if _, err := q.Enqueue(update); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(update); err != ErrDuplicate {
+		t.Fatalf("Expected ErrDuplicate, got %v", err)
+	}
+
+	// A different alert stored under the same ID is set aside rather than dropped
+	if n := q.process(time.Now()); n != 0 {
+		t.Fatalf("Expected nothing to be stored, got %d", n)
+	}
+	failed := q.Entries(models.IngestStatusFailed)
+	if len(failed) != 1 || *failed[0].Alert.Alert.Description != "STRUCTURE FIRE - UPGRADED" || failed[0].LastError == "" {
+		t.Fatalf("Expected the conflicting alert to be kept as failed, got %+v", failed)
+	}
+	if *store.alerts["A1"].Alert.Description != "STRUCTURE FIRE" {
+		t.Errorf("Expected the stored alert to be unchanged")
+	}
+}
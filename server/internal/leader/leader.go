@@ -0,0 +1,116 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// checkInterval is how often the lock is taken or checked. A leader whose connection
+// failed stops leading within this interval, and another instance takes over.
+const checkInterval = 10 * time.Second
+
+// Store takes the advisory lock that makes an instance the leader
+type Store interface {
+	TryLeaderLock(ctx context.Context, name string) (*storage.LeaderLock, error)
+}
+
+// Elector makes one server instance the leader with a Postgres advisory lock. Work that
+// must happen once across instances, such as announcing bulletins, only runs on the leader.
+type Elector struct {
+	store      Store
+	name       string
+	logger     *logging.Logger
+	lock       *storage.LeaderLock
+	leader     atomic.Bool
+	shutdownCh chan struct{}
+	done       chan struct{}
+}
+
+// New creates an elector for the lock with the given name
+func New(store Store, name string, logger *logging.Logger) *Elector {
+	return &Elector{
+		store:      store,
+		name:       name,
+		logger:     logger,
+		shutdownCh: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start tries to become the leader now and then keeps checking until Stop is called
+func (e *Elector) Start() {
+	e.logger.Infof("Starting leader election on lock %s", e.name)
+	e.check()
+
+	ticker := time.NewTicker(checkInterval)
+
+	go func() {
+		defer close(e.done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.check()
+			case <-e.shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the elector and hands the lock to another instance
+func (e *Elector) Stop() {
+	close(e.shutdownCh)
+	<-e.done
+
+	if e.lock == nil {
+		return
+	}
+	e.leader.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.Error(err, "Failed to release leader lock")
+	}
+}
+
+// IsLeader reports whether this instance holds the lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// check takes the lock when it is free, or makes sure the held lock is still held
+func (e *Elector) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if e.lock != nil {
+		if err := e.lock.Check(ctx); err != nil {
+			e.logger.Warnf("Lost leadership: %v", err)
+			e.leader.Store(false)
+			_ = e.lock.Release(ctx)
+			e.lock = nil
+		}
+		return
+	}
+
+	lock, err := e.store.TryLeaderLock(ctx, e.name)
+	if err != nil {
+		e.logger.Error(err, "Failed to take leader lock")
+		return
+	}
+	if lock == nil {
+		return
+	}
+
+	e.lock = lock
+	e.leader.Store(true)
+	e.logger.Infof("This instance is now the leader")
+}
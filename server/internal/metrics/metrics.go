@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metric types written in the exposition format
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Labels are the label names and values of a sample
+type Labels map[string]string
+
+// Sample is a single value of a metric
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// metric is a registered metric family
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	collect func() []Sample
+}
+
+// Registry holds the metrics served on the metrics endpoint
+type Registry struct {
+	metrics map[string]*metric
+	mutex   sync.Mutex
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]*metric),
+	}
+}
+
+// register adds a metric family, replacing any family with the same name
+func (r *Registry) register(name, help, kind string, collect func() []Sample) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics[name] = &metric{name: name, help: help, kind: kind, collect: collect}
+}
+
+// GaugeFunc registers a gauge whose samples are read when the metrics are served
+func (r *Registry) GaugeFunc(name, help string, collect func() []Sample) {
+	r.register(name, help, TypeGauge, collect)
+}
+
+// CounterFunc registers a counter whose samples are read when the metrics are served
+func (r *Registry) CounterFunc(name, help string, collect func() []Sample) {
+	r.register(name, help, TypeCounter, collect)
+}
+
+// Counter is a monotonically increasing value with a fixed set of label names
+type Counter struct {
+	labelNames []string
+	values     map[string]*Sample
+	mutex      sync.Mutex
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{
+		labelNames: labelNames,
+		values:     make(map[string]*Sample),
+	}
+	r.register(name, help, TypeCounter, counter.collect)
+	return counter
+}
+
+// Inc increments the counter for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a value to the counter for the given label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sample, ok := c.values[key]
+	if !ok {
+		labels := make(Labels, len(c.labelNames))
+		for i, name := range c.labelNames {
+			if i < len(labelValues) {
+				labels[name] = labelValues[i]
+			}
+		}
+		sample = &Sample{Labels: labels}
+		c.values[key] = sample
+	}
+	sample.Value += value
+}
+
+// collect returns a copy of the counter's samples
+func (c *Counter) collect() []Sample {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	samples := make([]Sample, 0, len(c.values))
+	for _, sample := range c.values {
+		samples = append(samples, *sample)
+	}
+	return samples
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	families := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		families = append(families, m)
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	for _, m := range families {
+		samples := m.collect()
+		sort.Slice(samples, func(i, j int) bool {
+			return formatLabels(samples[i].Labels) < formatLabels(samples[j].Labels)
+		})
+
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+		for _, sample := range samples {
+			if _, err := fmt.Fprintf(w, "%s%s %g\n", m.name, formatLabels(sample.Labels), sample.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = r.WriteText(w)
+}
+
+// formatLabels formats labels as {name="value",...} sorted by name
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, labels[name])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
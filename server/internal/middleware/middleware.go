@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"slices"
@@ -16,6 +17,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
 )
 
 // Logger logs HTTP requests and responses
@@ -76,7 +78,9 @@ func (l *Logger) Logging(next http.Handler) http.Handler {
 
 		// Create JSON representation of the body
 		var bodyJSON json.RawMessage
-		if len(bodyBytes) > 0 {
+		if isSensitivePath(r.URL.Path) {
+			bodyJSON = json.RawMessage([]byte(`"[REDACTED]"`))
+		} else if len(bodyBytes) > 0 {
 			if json.Valid(bodyBytes) {
 				bodyJSON = bodyBytes
 			} else {
@@ -93,6 +97,10 @@ func (l *Logger) Logging(next http.Handler) http.Handler {
 		// Create headers JSON
 		headersMap := make(map[string][]string)
 		for k, v := range r.Header {
+			if isSensitiveHeader(k) {
+				headersMap[k] = []string{"[REDACTED]"}
+				continue
+			}
 			headersMap[k] = v
 		}
 		headersJSON, err := json.Marshal(headersMap)
@@ -133,14 +141,14 @@ func (l *Logger) Logging(next http.Handler) http.Handler {
 
 		// Emit an event for the new log
 		if l.eventEmitter != nil && !isLogEndpoint(r.URL.Path) {
-			logNotification := map[string]interface{}{
-				"id":         requestID,
-				"method":     r.Method,
-				"path":       r.URL.Path,
-				"timestamp":  time.Now().Unix(),
-				"source_ip":  r.RemoteAddr,
-				"duration":   duration,
-				"statusCode": recorder.statusCode,
+			logNotification := protocol.LogNotification{
+				ID:         requestID,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Timestamp:  time.Now().Unix(),
+				SourceIP:   r.RemoteAddr,
+				Duration:   duration,
+				StatusCode: recorder.statusCode,
 			}
 			l.eventEmitter("new_log", logNotification)
 		}
@@ -159,7 +167,7 @@ func CORS(allowedOrigins []string) func(next http.Handler) http.Handler {
 			if slices.Contains(allowedOrigins, origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, ngrok-skip-browser-warning")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, ngrok-skip-browser-warning")
 			}
 
 			next.ServeHTTP(w, r)
@@ -172,19 +180,28 @@ type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
 	body       *bytes.Buffer
+	streaming  bool // Server-sent event streams are not buffered, they never end
 }
 
 func (r *responseRecorder) WriteHeader(statusCode int) {
 	r.statusCode = statusCode
+	r.streaming = strings.HasPrefix(r.Header().Get("Content-Type"), "text/event-stream")
 	r.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (r *responseRecorder) Write(b []byte) (int, error) {
 	// Write to the response and to our buffer
-	r.body.Write(b)
+	if !r.streaming {
+		r.body.Write(b)
+	}
 	return r.ResponseWriter.Write(b)
 }
 
+// Unwrap returns the underlying writer so http.ResponseController can reach it
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *responseRecorder) Flush() {
 	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
@@ -207,6 +224,37 @@ func (r *responseRecorder) CloseNotify() <-chan bool {
 	return nil
 }
 
+// sensitiveHeaders are request headers whose values must never be written to logs
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"X-Api-Key",
+}
+
+// sensitivePaths are endpoints whose request bodies carry credentials
+var sensitivePaths = []string{
+	"/auth/login",
+	"/users",
+	"/api-keys",
+	"/devices/pair",
+	"/webhooks",
+}
+
+// isSensitivePath checks if the request body of a path must not be logged
+func isSensitivePath(path string) bool {
+	for _, p := range sensitivePaths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isSensitiveHeader checks if a header carries credentials
+func isSensitiveHeader(name string) bool {
+	return slices.Contains(sensitiveHeaders, http.CanonicalHeaderKey(name))
+}
+
 // isLogEndpoint checks if the path is a log-related endpoint
 func isLogEndpoint(path string) bool {
 	return path == "/logs" || path == "/internal/logs" || len(path) > 5 && path[:6] == "/logs/"
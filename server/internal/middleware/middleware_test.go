@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+func TestLoggingRedactsSensitiveBodies(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		redacted bool
+	}{
+		{"POST", "/webhooks", `{"url": "https://example.com/hook", "secret": "whsec-1"}`, true},
+		{"PUT", "/webhooks/42", `{"secret": "whsec-2"}`, true},
+		{"POST", "/auth/login", `{"username": "admin", "password": "hunter2"}`, true},
+		{"POST", "/alerts", `{"alert": {"id": "1"}}`, false},
+	}
+
+	for _, tt := range tests {
+		var entry models.LogEntry
+		logger := NewLogger(logging.New("error", "middleware_test"), func(e models.LogEntry) error {
+			entry = e
+			return nil
+		}, nil)
+		handler := logger.Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if redacted := string(entry.Body) == `"[REDACTED]"`; redacted != tt.redacted {
+			t.Errorf("%s %s: expected redacted %v, logged body %s", tt.method, tt.path, tt.redacted, entry.Body)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// bucketIdleTimeout is how long an unused bucket is kept before it is swept
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimitRule applies a token bucket to requests matching a route group
+type RateLimitRule struct {
+	Name     string
+	Methods  []string // Empty matches every method
+	Paths    []string // Exact paths, or prefixes when ending in "/"
+	Limit    config.RateLimit
+	ByClient bool // Share one bucket per authenticated credential instead of per IP, the auth middleware must run first
+}
+
+// matches checks if the rule applies to the request
+func (rule RateLimitRule) matches(r *http.Request) bool {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, r.Method) {
+		return false
+	}
+
+	for _, p := range rule.Paths {
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(r.URL.Path, p) || r.URL.Path == strings.TrimSuffix(p, "/") {
+				return true
+			}
+		} else if r.URL.Path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenBucket holds the tokens left for one key
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter limits requests per client with a token bucket for each route group
+type RateLimiter struct {
+	rules     []RateLimitRule
+	buckets   map[string]*tokenBucket
+	clientKey func(*http.Request) string
+	lastSweep time.Time
+	mutex     sync.Mutex
+	logger    *logging.Logger
+}
+
+// NewRateLimiter creates a rate limiter. clientKey identifies the caller, usually by IP.
+func NewRateLimiter(rules []RateLimitRule, clientKey func(*http.Request) string, logger *logging.Logger) *RateLimiter {
+	return &RateLimiter{
+		rules:     rules,
+		buckets:   make(map[string]*tokenBucket),
+		clientKey: clientKey,
+		lastSweep: time.Now(),
+		logger:    logger,
+	}
+}
+
+// DefaultRateLimitRules returns the route groups limited by the server
+func DefaultRateLimitRules(cfg config.RateLimitConfig) []RateLimitRule {
+	return []RateLimitRule{
+		{
+			Name:    "auth",
+			Methods: []string{"POST"},
+			Paths:   []string{"/auth/login", "/devices/pair/", "/ws/ticket"},
+			Limit:   cfg.Auth,
+		},
+		{
+			Name:     "ingest",
+			Methods:  []string{"POST"},
+			Paths:    []string{"/alerts"},
+			Limit:    cfg.Ingest,
+			ByClient: true,
+		},
+		{
+			Name:    "public",
+			Methods: []string{"GET"},
+			Paths:   []string{"/alerts/", "/weather/", "/hydrants/", "/ws/dashboard", "/ws/client", "/events/dashboard"},
+			Limit:   cfg.Public,
+		},
+	}
+}
+
+// Limit is the middleware that rejects requests over their route group's limit with 429
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range l.rules {
+			if !rule.matches(r) {
+				continue
+			}
+
+			key := rule.Name + ":" + l.clientKey(r)
+			if rule.ByClient {
+				key = rule.Name + ":" + clientCredential(r, l.clientKey)
+			}
+
+			if wait := l.take(key, rule.Limit, time.Now()); wait > 0 {
+				l.logger.Warnf("Rate limit %s exceeded by %s on %s %s", rule.Name, l.clientKey(r), r.Method, r.URL.Path)
+				writeRateLimitError(w, wait)
+				return
+			}
+			break
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take removes a token from the bucket, returning how long to wait if it is empty
+func (l *RateLimiter) take(key string, limit config.RateLimit, now time.Time) time.Duration {
+	if limit.PerMinute <= 0 || limit.Burst <= 0 {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		l.sweep(now)
+	}
+
+	perSecond := float64(limit.PerMinute) / 60
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	// Refill for the time since the last request
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*perSecond)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return 0
+}
+
+// sweep removes buckets that have not been used recently. The caller must hold the mutex.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientCredential returns the authenticated credential of a request, falling back to the client key.
+// Integrations sharing an address then get separate buckets, while a key that didn't authenticate
+// can't be changed on every request to get a fresh bucket.
+func clientCredential(r *http.Request, clientKey func(*http.Request) string) string {
+	if authInfo, ok := auth.GetAuthInfoFromContext(r.Context()); ok && authInfo.Authenticated {
+		if id := authInfo.CredentialID(); id != "" {
+			return "credential:" + id
+		}
+	}
+	return clientKey(r)
+}
+
+// writeRateLimitError sends a 429 response with a Retry-After header
+func writeRateLimitError(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response, _ := json.Marshal(models.APIResponse{
+		Success: false,
+		Error:   "Too many requests, try again later",
+	})
+	_, _ = w.Write(response)
+}
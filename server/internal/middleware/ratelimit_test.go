@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limiter := NewRateLimiter(nil, nil, logging.New("error", "ratelimit_test"))
+	limit := config.RateLimit{PerMinute: 60, Burst: 3}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    time.Duration
+	}{
+		{name: "first of burst", want: 0},
+		{name: "second of burst", want: 0},
+		{name: "last of burst", want: 0},
+		{name: "empty", want: time.Second},
+		{name: "partly refilled", advance: 500 * time.Millisecond, want: 500 * time.Millisecond},
+		{name: "refilled", advance: 500 * time.Millisecond, want: 0},
+		{name: "refill capped at burst", advance: time.Hour, want: 0},
+		{name: "second after refill", want: 0},
+		{name: "third after refill", want: 0},
+		{name: "empty again", want: time.Second},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		if wait := limiter.take("ingest:203.0.113.7", limit, now); wait != tt.want {
+			t.Fatalf("%s: expected to wait %s, got %s", tt.name, tt.want, wait)
+		}
+	}
+
+	// A disabled limit never blocks
+	for i := 0; i < 10; i++ {
+		if wait := limiter.take("public:203.0.113.7", config.RateLimit{}, now); wait != 0 {
+			t.Fatalf("Expected a disabled limit not to block, got %s", wait)
+		}
+	}
+}
+
+func TestRateLimiterBuckets(t *testing.T) {
+	limiter := NewRateLimiter(DefaultRateLimitRules(config.RateLimitConfig{
+		Auth:   config.RateLimit{PerMinute: 1, Burst: 2},
+		Ingest: config.RateLimit{PerMinute: 1, Burst: 2},
+		Public: config.RateLimit{PerMinute: 1, Burst: 2},
+	}), func(r *http.Request) string { return r.RemoteAddr }, logging.New("error", "ratelimit_test"))
+
+	handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	type request struct {
+		method   string
+		path     string
+		ip       string
+		apiKey   string
+		authInfo *auth.AuthInfo
+	}
+	send := func(req request) int {
+		r := httptest.NewRequest(req.method, req.path, nil)
+		r.RemoteAddr = req.ip
+		if req.apiKey != "" {
+			r.Header.Set(auth.APIKeyHeader, req.apiKey)
+		}
+		if req.authInfo != nil {
+			r = r.WithContext(context.WithValue(r.Context(), auth.AuthInfoKey, *req.authInfo))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	keyA := &auth.AuthInfo{Authenticated: true, Method: auth.AuthMethodAPIKey, APIKeyID: "key-a"}
+	keyB := &auth.AuthInfo{Authenticated: true, Method: auth.AuthMethodAPIKey, APIKeyID: "key-b"}
+
+	tests := []struct {
+		name     string
+		requests []request
+		want     []int
+	}{
+		{
+			name:     "ingest limited per client IP",
+			requests: []request{{"POST", "/alerts", "10.0.0.1", "", nil}, {"POST", "/alerts", "10.0.0.1", "", nil}, {"POST", "/alerts", "10.0.0.1", "", nil}},
+			want:     []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			// A new unauthenticated key on every request must not get a fresh bucket
+			name: "unauthenticated keys share the IP bucket",
+			requests: []request{
+				{"POST", "/alerts", "10.0.0.2", "ak_random0001", &auth.AuthInfo{}},
+				{"POST", "/alerts", "10.0.0.2", "ak_random0002", &auth.AuthInfo{}},
+				{"POST", "/alerts", "10.0.0.2", "ak_random0003", &auth.AuthInfo{}},
+			},
+			want: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "authenticated keys get their own bucket",
+			requests: []request{
+				{"POST", "/alerts", "10.0.0.3", "", keyA},
+				{"POST", "/alerts", "10.0.0.3", "", keyA},
+				{"POST", "/alerts", "10.0.0.3", "", keyB},
+				{"POST", "/alerts", "10.0.0.3", "", keyA},
+				{"POST", "/alerts", "10.0.0.4", "", keyB},
+				{"POST", "/alerts", "10.0.0.4", "", keyB},
+			},
+			want: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "route groups have separate buckets",
+			requests: []request{
+				{"POST", "/auth/login", "10.0.0.5", "", nil},
+				{"POST", "/auth/login", "10.0.0.5", "", nil},
+				{"POST", "/auth/login", "10.0.0.5", "", nil},
+				{"GET", "/alerts/", "10.0.0.5", "", nil},
+			},
+			want: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name: "unmatched routes are not limited",
+			requests: []request{
+				{"DELETE", "/alerts/A1", "10.0.0.6", "", nil},
+				{"DELETE", "/alerts/A1", "10.0.0.6", "", nil},
+				{"DELETE", "/alerts/A1", "10.0.0.6", "", nil},
+			},
+			want: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, req := range tt.requests {
+				if code := send(req); code != tt.want[i] {
+					t.Fatalf("Request %d: expected %d, got %d", i+1, tt.want[i], code)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitRuleMatches(t *testing.T) {
+	rule := RateLimitRule{Methods: []string{"GET"}, Paths: []string{"/alerts/", "/ws/dashboard"}}
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"GET", "/alerts", true},
+		{"GET", "/alerts/A1", true},
+		{"GET", "/ws/dashboard", true},
+		{"GET", "/ws/dashboard/extra", false},
+		{"POST", "/alerts", false},
+		{"GET", "/alertsx", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := rule.matches(r); got != tt.want {
+			t.Errorf("%s %s: expected %v, got %v", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
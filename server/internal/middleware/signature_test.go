@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/metrics"
+	"github.com/user/alerting/server/internal/webhook"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	verifier := NewSignatureVerifier(config.SignatureConfig{
+		Secret:         "new-secret",
+		PreviousSecret: "old-secret",
+		Required:       true,
+		Tolerance:      5 * time.Minute,
+	}, logging.New("error", "signature_test"))
+	verifier.now = func() time.Time { return now }
+
+	var received []byte
+	handler := verifier.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	body := []byte(`{"alert":{"id":"A1"}}`)
+	send := func(path string, headers map[string]string) int {
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	signed := func(secret string, at time.Time) map[string]string {
+		return map[string]string{
+			webhook.HeaderTimestamp: strconv.FormatInt(at.Unix(), 10),
+			webhook.HeaderSignature: webhook.Sign(secret, at.Unix(), body),
+		}
+	}
+
+	// Both secrets are accepted during a rotation, and the body still reaches the handler
+	for _, secret := range []string{"new-secret", "old-secret"} {
+		if code := send("/alerts", signed(secret, now.Add(-time.Minute))); code != http.StatusCreated {
+			t.Fatalf("Expected a request signed with %s to be accepted, got %d", secret, code)
+		}
+		if !bytes.Equal(received, body) {
+			t.Fatalf("Expected the handler to read the signed body, got %q", received)
+		}
+	}
+
+	// The bare hex digest is accepted too
+	headers := signed("new-secret", now)
+	headers[webhook.HeaderSignature] = strings.TrimPrefix(headers[webhook.HeaderSignature], "sha256=")
+	if code := send("/alerts", headers); code != http.StatusCreated {
+		t.Errorf("Expected a signature without prefix to be accepted, got %d", code)
+	}
+
+	rejected := []struct {
+		name    string
+		headers map[string]string
+		reason  string
+	}{
+		{"unsigned", nil, SignatureMissing},
+		{"bad timestamp", map[string]string{webhook.HeaderTimestamp: "yesterday", webhook.HeaderSignature: "sha256=00"}, SignatureMalformed},
+		{"replayed", signed("new-secret", now.Add(-10*time.Minute)), SignatureExpired},
+		{"future", signed("new-secret", now.Add(10*time.Minute)), SignatureExpired},
+		{"wrong secret", signed("leaked-password", now), SignatureInvalid},
+	}
+	for _, test := range rejected {
+		if code := send("/alerts", test.headers); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", test.name, code)
+		}
+	}
+
+	// Other routes aren't checked
+	if code := send("/hydrants", nil); code != http.StatusCreated {
+		t.Errorf("Expected other routes to pass unsigned, got %d", code)
+	}
+
+	registry := metrics.NewRegistry()
+	verifier.RegisterMetrics(registry)
+	var out bytes.Buffer
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`alerting_ingest_signature_failures_total{reason="expired"} 2`,
+		`alerting_ingest_signature_failures_total{reason="invalid"} 1`,
+		`alerting_ingest_signature_failures_total{reason="missing"} 1`,
+		`alerting_ingest_signatures_verified_total{secret="current"} 2`,
+		`alerting_ingest_signatures_verified_total{secret="previous"} 1`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestSignatureVerifierOptional(t *testing.T) {
+	verifier := NewSignatureVerifier(config.SignatureConfig{
+		Secret:    "secret",
+		Tolerance: 5 * time.Minute,
+	}, logging.New("error", "signature_test"))
+	handler := verifier.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// Unsigned requests pass while senders are moved over, but signed ones are still checked
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/alerts", strings.NewReader("{}")))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected an unsigned request to pass, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest("POST", "/alerts", strings.NewReader("{}"))
+	r.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	r.Header.Set(webhook.HeaderSignature, "sha256=deadbeef")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a bad signature to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSignatureVerifierSecretSlots(t *testing.T) {
+	// A previous secret alone doesn't turn verification on
+	if NewSignatureVerifier(config.SignatureConfig{PreviousSecret: "old-secret"}, logging.New("error", "signature_test")).Enabled() {
+		t.Error("Expected verification to need a current secret")
+	}
+
+	// Without a previous secret only the current one is reported
+	verifier := NewSignatureVerifier(config.SignatureConfig{Secret: "secret", Tolerance: 5 * time.Minute}, logging.New("error", "signature_test"))
+	now := time.Now()
+	if reason := verifier.check(webhook.Sign("secret", now.Unix(), nil), strconv.FormatInt(now.Unix(), 10), nil); reason != "" {
+		t.Fatalf("Expected the signature to be valid, got %s", reason)
+	}
+
+	registry := metrics.NewRegistry()
+	verifier.RegisterMetrics(registry)
+	var out bytes.Buffer
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `alerting_ingest_signatures_verified_total{secret="current"} 1`) || strings.Contains(out.String(), `secret="previous"`) {
+		t.Errorf("Expected only the current secret to be reported, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIKey represents a named, scoped key used by integrations such as the CAD webhook
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`                 // First characters of the key, used to identify it
+	KeyHash    string     `json:"-"`                      // SHA-256 of the key, never serialized
+	Scopes     []string   `json:"scopes"`                 // Permissions granted to the key
+	AllowedIPs []string   `json:"allowed_ips"`            // IPs or CIDR ranges allowed to use the key, empty allows any
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // Optional expiry
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // Last successful use
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"` // Username of the admin who created the key
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Bulletin priorities, lowest first
+const (
+	BulletinPriorityLow    = "low"
+	BulletinPriorityNormal = "normal"
+	BulletinPriorityHigh   = "high"
+	BulletinPriorityUrgent = "urgent"
+)
+
+// BulletinPriorities lists the bulletin priorities, lowest first
+var BulletinPriorities = []string{
+	BulletinPriorityLow,
+	BulletinPriorityNormal,
+	BulletinPriorityHigh,
+	BulletinPriorityUrgent,
+}
+
+// Bulletin is a free-text notice shown on station displays between its start and end times
+type Bulletin struct {
+	ID        string     `json:"id"`
+	Message   string     `json:"message"`
+	Priority  string     `json:"priority" enum:"low,normal,high,urgent"`
+	Stations  []string   `json:"stations,omitempty"` // Stations the bulletin is shown at, every station if empty
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"` // Shown until expired if empty
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ActiveAt checks if the bulletin is shown at the given time
+func (b Bulletin) ActiveAt(t time.Time) bool {
+	return !t.Before(b.StartsAt) && (b.EndsAt == nil || t.Before(*b.EndsAt))
+}
+
+// AppliesTo checks if the bulletin is shown at the station. Clients without a station see every bulletin.
+func (b Bulletin) AppliesTo(station string) bool {
+	if station == "" || len(b.Stations) == 0 {
+		return true
+	}
+	for _, s := range b.Stations {
+		if strings.EqualFold(s, station) {
+			return true
+		}
+	}
+	return false
+}
+
+// PriorityRank orders priorities, higher is more important. Unknown priorities rank as normal.
+func (b Bulletin) PriorityRank() int {
+	for i, priority := range BulletinPriorities {
+		if priority == b.Priority {
+			return i
+		}
+	}
+	return 1
+}
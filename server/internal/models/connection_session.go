@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// ConnectionSession is the persisted record of one websocket connection, from connect to disconnect
+type ConnectionSession struct {
+	ID               string     `json:"id"` // Client ID of the connection
+	Hub              string     `json:"hub"`
+	Station          string     `json:"station,omitempty"`
+	DeviceID         string     `json:"device_id,omitempty"`
+	Username         string     `json:"username,omitempty"`
+	Role             string     `json:"role,omitempty"`
+	UserAgent        string     `json:"user_agent"`
+	RemoteAddr       string     `json:"remote_addr"`
+	ConnectedAt      time.Time  `json:"connected_at"`
+	LastSeenAt       *time.Time `json:"last_seen_at,omitempty"`    // Last time the server confirmed the connection was open
+	DisconnectedAt   *time.Time `json:"disconnected_at,omitempty"` // Nil while the connection is open
+	DisconnectReason string     `json:"disconnect_reason,omitempty"`
+	DurationSeconds  int64      `json:"duration_seconds"` // Up to now for open connections
+	MessagesSent     int64      `json:"messages_sent"`
+	MessagesReceived int64      `json:"messages_received"`
+}
+
+// DarkPeriod is a span of time in which a station had no display connected
+type DarkPeriod struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	Ongoing         bool      `json:"ongoing"` // Still dark at the end of the report window
+}
+
+// StationUptime summarizes how long a station had at least one display connected
+type StationUptime struct {
+	Station            string       `json:"station"`
+	UptimePercent      float64      `json:"uptime_percent"`
+	ConnectedSeconds   int64        `json:"connected_seconds"`
+	DarkSeconds        int64        `json:"dark_seconds"`
+	LongestDarkSeconds int64        `json:"longest_dark_seconds"`
+	DarkPeriods        []DarkPeriod `json:"dark_periods"`
+}
+
+// UptimeReport is the display uptime of every station over a time window
+type UptimeReport struct {
+	Hub      string          `json:"hub"`
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Stations []StationUptime `json:"stations"`
+}
+
+// DisplayOutage is the content of display_offline and display_recovered events,
+// sent when a watched station has had no dashboard display connected for the grace period
+type DisplayOutage struct {
+	Station         string     `json:"station"`
+	OfflineSince    time.Time  `json:"offline_since"`          // When the station's last display disconnected
+	RecoveredAt     *time.Time `json:"recovered_at,omitempty"` // Set once a display reconnected
+	DurationSeconds int64      `json:"duration_seconds"`       // How long the station has been or was offline
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// DeliveryReceipt records that an alert was written to a websocket client and whether the display acknowledged it
+type DeliveryReceipt struct {
+	ClientID       string     `json:"client_id"`
+	Station        string     `json:"station,omitempty"`
+	DeviceID       string     `json:"device_id,omitempty"`
+	RemoteAddr     string     `json:"remote_addr"`
+	UserAgent      string     `json:"user_agent"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+// StationAcknowledgement summarizes whether any display of a station acknowledged an alert
+type StationAcknowledgement struct {
+	Station        string     `json:"station"`
+	Acknowledged   bool       `json:"acknowledged"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	TimedOut       bool       `json:"timed_out"` // No acknowledgement arrived within the ack timeout
+}
+
+// AlertDeliveries lists the delivery receipts of an alert
+type AlertDeliveries struct {
+	AlertID     string                   `json:"alert_id"`
+	BroadcastAt time.Time                `json:"broadcast_at"`
+	Receipts    []DeliveryReceipt        `json:"receipts"`
+	Stations    []StationAcknowledgement `json:"stations"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Device pairing statuses
+const (
+	PairingStatusPending  = "pending"
+	PairingStatusApproved = "approved"
+	PairingStatusClaimed  = "claimed"
+)
+
+// Device represents a paired, unattended display such as a Fire TV or kiosk
+type Device struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Station    string     `json:"station"`
+	Role       string     `json:"role"`
+	Group      string     `json:"group,omitempty"` // Device group that control commands can target
+	TokenHash  string     `json:"-"`               // SHA-256 of the device credential, never serialized
+	PairedBy   string     `json:"paired_by,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	LastSeenIP string     `json:"last_seen_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// DevicePairing is a pairing request started by a display and approved by an admin
+type DevicePairing struct {
+	ID            string    `json:"id"`
+	Code          string    `json:"code"`   // Short code shown on the display
+	Status        string    `json:"status"` // pending, approved, claimed
+	PollTokenHash string    `json:"-"`      // SHA-256 of the secret the display uses to claim its credential
+	DeviceID      string    `json:"device_id,omitempty"`
+	RemoteAddr    string    `json:"remote_addr"`
+	UserAgent     string    `json:"user_agent"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// DeviceConnection describes a paired device and its live websocket connections
+type DeviceConnection struct {
+	Device
+	Online      bool `json:"online"`
+	Connections int  `json:"connections"`
+}
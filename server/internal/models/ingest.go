@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// IngestKey remembers an ingested alert so retries of the same request within the
+// dedup window get the original response instead of creating the alert again
+type IngestKey struct {
+	Key         string          `json:"key"`          // "key:" and the Idempotency-Key header, or "hash:" and the content hash
+	RequestHash string          `json:"request_hash"` // Content hash of the request, to catch a key reused for another request
+	AlertID     string          `json:"alert_id"`
+	StatusCode  int             `json:"status_code,omitempty"` // Zero while the original request is still being handled
+	Response    json.RawMessage `json:"response,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"` // End of the in-flight lease, then of the dedup window once completed
+}
+
+// Completed reports whether the original response was stored
+func (k IngestKey) Completed() bool {
+	return k.StatusCode != 0
+}
+
+// Ingest queue entry statuses
+const (
+	IngestStatusPending = "pending" // Waiting to be stored in the database
+	IngestStatusFailed  = "failed"  // Rejected by the database, kept until an admin retries or discards it
+)
+
+// IngestEntry is an alert held in the on-disk ingestion queue until it is stored in the database
+type IngestEntry struct {
+	ID            string     `json:"id"`
+	Alert         Alert      `json:"alert"`
+	Status        string     `json:"status"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+}
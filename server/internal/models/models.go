@@ -63,10 +63,19 @@ type LogEntry struct {
 
 // WebSocketMessage represents a structured message for WebSocket communication
 type WebSocketMessage struct {
-	Type    string      `json:"type"`    // Message type (e.g., new_alert, ping, pong, heartbeat)
-	Content interface{} `json:"content"` // Message payload
-	ID      string      `json:"id"`      // Unique message ID
-	Time    time.Time   `json:"time"`    // Message timestamp
+	Type     string      `json:"type"`               // Message type (e.g., new_alert, ping, pong, heartbeat)
+	Content  interface{} `json:"content"`            // Message payload
+	ID       string      `json:"id"`                 // Unique message ID
+	Time     time.Time   `json:"time"`               // Message timestamp
+	Seq      int64       `json:"seq,omitempty"`      // Per-hub event sequence number, set on replayable broadcasts
+	Instance string      `json:"instance,omitempty"` // Server instance that assigned Seq, each instance numbers its own events
+}
+
+// BusEvent is a broadcast event carried between server instances by the event bus
+type BusEvent struct {
+	Hub     string           `json:"hub"`              // Hub type the event is broadcast on
+	Origin  string           `json:"origin,omitempty"` // Instance that published the event
+	Message WebSocketMessage `json:"message"`
 }
 
 // LogEntrySummary is a lightweight version of LogEntry without large fields like body and headers
@@ -107,16 +116,29 @@ type APIResponse struct {
 
 // ConnectionDetail represents detailed information about a WebSocket connection
 type ConnectionDetail struct {
-	ID                string            `json:"id"`                // Client ID
-	ConnectedAt       time.Time         `json:"connected_at"`      // When the client connected
-	IsAuthenticated   bool              `json:"is_authenticated"`  // Authentication status
-	RemoteAddr        string            `json:"remote_addr"`       // Remote address
-	LastActivity      time.Time         `json:"last_activity"`     // Last message/activity time
-	MessagesSent      int               `json:"messages_sent"`     // Messages sent to client
-	MessagesReceived  int               `json:"messages_received"` // Messages received from client
-	UserAgent         string            `json:"user_agent"`        // User agent if available
-	Metadata          map[string]string `json:"metadata"`          // Client metadata
+	ID                string            `json:"id"`                            // Client ID
+	ConnectedAt       time.Time         `json:"connected_at"`                  // When the client connected
+	IsAuthenticated   bool              `json:"is_authenticated"`              // Authentication status
+	Role              string            `json:"role,omitempty"`                // Role of the authenticated caller
+	Username          string            `json:"username,omitempty"`            // Username if signed in with a session
+	DeviceID          string            `json:"device_id,omitempty"`           // Paired device ID if connected as a device
+	Group             string            `json:"group,omitempty"`               // Device group used to target control commands
+	Station           string            `json:"station,omitempty"`             // Station the client displays
+	Topics            []string          `json:"topics,omitempty"`              // Subscribed topics
+	StationFilter     string            `json:"station_filter,omitempty"`      // Station alerts are filtered to
+	RemoteAddr        string            `json:"remote_addr"`                   // Remote address
+	LastActivity      time.Time         `json:"last_activity"`                 // Last message/activity time
+	MessagesSent      int               `json:"messages_sent"`                 // Messages sent to client
+	MessagesReceived  int               `json:"messages_received"`             // Messages received from client
+	QueueDepth        int               `json:"queue_depth"`                   // Messages waiting to be written
+	MessagesDropped   int64             `json:"messages_dropped"`              // Messages dropped because the queue was full
+	MessagesCoalesced int64             `json:"messages_coalesced"`            // Queued messages replaced by a newer version
+	UserAgent         string            `json:"user_agent"`                    // User agent if available
+	Metadata          map[string]string `json:"metadata"`                      // Client metadata
 	LastHeartbeatSent *time.Time        `json:"last_heartbeat_sent,omitempty"` // Last heartbeat time
+	LastPongAt        *time.Time        `json:"last_pong_at,omitempty"`        // Last protocol pong received
+	DisconnectedAt    *time.Time        `json:"disconnected_at,omitempty"`     // When the client left, for recent disconnects
+	DisconnectReason  string            `json:"disconnect_reason,omitempty"`   // Why the client left, for recent disconnects
 }
 
 // DeepCopyAlertPtr creates a deep copy of an Alert struct from a pointer
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Missed run policies decide what happens to runs that were due while the server was down
+const (
+	MissedRunSkip    = "skip"     // Record the missed run and wait for the next one
+	MissedRunRunOnce = "run_once" // Run once as soon as the scheduler starts
+)
+
+// Scheduled job run statuses
+const (
+	JobRunStatusSent      = "sent"       // The command was sent and acknowledgements are pending
+	JobRunStatusCompleted = "completed"  // Every target acknowledged or timed out
+	JobRunStatusNoTargets = "no_targets" // No connected display matched the target
+	JobRunStatusMissed    = "missed"     // The run was due while the scheduler was down and was skipped
+	JobRunStatusFailed    = "failed"     // The command could not be sent
+)
+
+// CommandTarget selects the display clients a control command is sent to
+type CommandTarget struct {
+	ClientIDs []string `json:"client_ids,omitempty"`
+	Station   string   `json:"station,omitempty"`
+	Group     string   `json:"group,omitempty"`
+}
+
+// IsEmpty reports whether the target selects every client
+func (t CommandTarget) IsEmpty() bool {
+	return len(t.ClientIDs) == 0 && t.Station == "" && t.Group == ""
+}
+
+// ScheduledJob is a display command sent on a cron schedule
+type ScheduledJob struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Cron            string                 `json:"cron"`               // Five-field cron expression or a macro such as @daily
+	Timezone        string                 `json:"timezone,omitempty"` // IANA zone the schedule is evaluated in, the scheduler default if empty
+	Command         string                 `json:"command"`
+	Args            map[string]interface{} `json:"args,omitempty"`
+	Target          CommandTarget          `json:"target"`
+	MissedRunPolicy string                 `json:"missed_run_policy"` // skip or run_once
+	Enabled         bool                   `json:"enabled"`
+	NextRunAt       *time.Time             `json:"next_run_at,omitempty"`
+	LastRunAt       *time.Time             `json:"last_run_at,omitempty"`
+	CreatedBy       string                 `json:"created_by,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// ScheduledJobRun records one run of a scheduled job and the acknowledgements it received
+type ScheduledJobRun struct {
+	ID           string     `json:"id"`
+	JobID        string     `json:"job_id"`
+	ScheduledFor time.Time  `json:"scheduled_for"` // When the run was due
+	StartedAt    time.Time  `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Status       string     `json:"status"`
+	Manual       bool       `json:"manual"` // Triggered through the API rather than the schedule
+	CommandID    string     `json:"command_id,omitempty"`
+	Targets      int        `json:"targets"`
+	Acknowledged int        `json:"acknowledged"`
+	Failed       int        `json:"failed"`
+	TimedOut     int        `json:"timed_out"`
+	Error        string     `json:"error,omitempty"`
+}
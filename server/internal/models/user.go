@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// User represents an account that can sign in to the dashboard and API
+type User struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`                       // bcrypt hash, never serialized
+	Role         string     `json:"role"`                    // admin, operator, viewer
+	Disabled     bool       `json:"disabled"`                // Disabled users cannot sign in
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"` // Last successful login
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Session represents a login session issued to a user
+type Session struct {
+	ID         string    `json:"id"`
+	TokenHash  string    `json:"-"` // SHA-256 of the session token, never serialized
+	UserID     string    `json:"user_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// WebSocketTicket is a single-use credential for opening a websocket connection,
+// stored so it can be redeemed on any server instance
+type WebSocketTicket struct {
+	TokenHash string          `json:"-"` // SHA-256 of the ticket, never serialized
+	Hub       string          `json:"hub"`
+	Station   string          `json:"station"`
+	AuthInfo  json.RawMessage `json:"auth_info"` // Credentials of the caller the ticket was issued to
+	ExpiresAt time.Time       `json:"expires_at"`
+}
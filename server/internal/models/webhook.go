@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook redaction profiles decide how much of an alert a subscription receives
+const (
+	WebhookRedactionNone     = "none"     // The full alert
+	WebhookRedactionStandard = "standard" // Redacted as for displays without alerts:read
+	WebhookRedactionFull     = "full"     // Everything but the ID, time, status and units
+)
+
+// Webhook delivery statuses
+const (
+	WebhookStatusPending   = "pending"   // Waiting for its first or next attempt
+	WebhookStatusDelivered = "delivered" // The receiver answered with a 2xx status
+	WebhookStatusDead      = "dead"      // Every attempt failed, kept in the dead-letter queue
+)
+
+// WebhookSubscription is an external URL that alert events are posted to
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`                     // Signs every payload, only returned when the subscription is created
+	EventTypes []string  `json:"event_types"`           // Events delivered, every event if empty
+	PageGroups []string  `json:"page_groups,omitempty"` // Only alerts paged to one of these groups, any alert if empty
+	CallTypes  []string  `json:"call_types,omitempty"`  // Only alerts with one of these descriptions, any alert if empty
+	Redaction  string    `json:"redaction"`             // none, standard or full
+	Enabled    bool      `json:"enabled"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one event queued for a subscription and the outcome of its latest attempt
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"` // Shared by the deliveries of the same event to every subscription
+	EventType      string          `json:"event_type"`
+	AlertID        string          `json:"alert_id,omitempty"`
+	Payload        json.RawMessage `json:"payload"` // Body posted to the URL, identical on every attempt
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"` // HTTP status of the latest attempt
+	Error          string          `json:"error,omitempty"`           // Why the latest attempt failed
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookEvent is the body posted to webhook URLs
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
@@ -13,8 +13,9 @@ import (
 type NotificationType string
 
 const (
-	NotificationTypeError NotificationType = "error"
-	NotificationTypeFatal NotificationType = "fatal"
+	NotificationTypeWarning NotificationType = "warning"
+	NotificationTypeError   NotificationType = "error"
+	NotificationTypeFatal   NotificationType = "fatal"
 )
 
 type EmailService struct {
@@ -67,6 +68,38 @@ func (s *EmailService) NotifyFatal(err error, context string) {
 	}
 }
 
+// NotifyWarning sends an operational warning. Warnings are only emailed when EMAIL_MIN_LEVEL is "warning".
+func (s *EmailService) NotifyWarning(message string, context string) {
+	if !s.config.Enabled || s.config.MinLevel != string(NotificationTypeWarning) {
+		return
+	}
+
+	subject := fmt.Sprintf("WARNING: %s", context)
+	body := formatWarningEmail(message, context)
+
+	if err := s.sendDirectly(subject, body); err != nil {
+		s.logger.Warnf("Failed to send warning email notification: %v", err)
+	} else {
+		s.logger.Infof("Sent warning email notification: %s", subject)
+	}
+}
+
+// NotifyRecovery reports that an earlier warning has cleared. It is emailed whenever warnings are.
+func (s *EmailService) NotifyRecovery(message string, context string) {
+	if !s.config.Enabled || s.config.MinLevel != string(NotificationTypeWarning) {
+		return
+	}
+
+	subject := fmt.Sprintf("RECOVERED: %s", context)
+	body := formatRecoveryEmail(message, context)
+
+	if err := s.sendDirectly(subject, body); err != nil {
+		s.logger.Warnf("Failed to send recovery email notification: %v", err)
+	} else {
+		s.logger.Infof("Sent recovery email notification: %s", subject)
+	}
+}
+
 func (s *EmailService) sendDirectly(subject string, body string) error {
 	if len(s.config.ToAddresses) == 0 {
 		return fmt.Errorf("no recipient email addresses configured")
@@ -96,3 +129,29 @@ Error: %s
 This email was automatically generated by the alerting system.
 `, timestamp, context, err.Error())
 }
+
+func formatWarningEmail(message string, context string) string {
+	timestamp := time.Now().Format(time.RFC3339)
+	return fmt.Sprintf(`
+WARNING: An operational issue has been detected
+
+Time: %s
+Context: %s
+Details: %s
+
+This email was automatically generated by the alerting system.
+`, timestamp, context, message)
+}
+
+func formatRecoveryEmail(message string, context string) string {
+	timestamp := time.Now().Format(time.RFC3339)
+	return fmt.Sprintf(`
+RECOVERED: An earlier operational issue has cleared
+
+Time: %s
+Context: %s
+Details: %s
+
+This email was automatically generated by the alerting system.
+`, timestamp, context, message)
+}
@@ -17,6 +17,20 @@ func NewService(cfg config.NotificationConfig, logger *logging.Logger) *Service
 	}
 }
 
+// NotifyWarning sends a warning notification to all configured channels
+func (s *Service) NotifyWarning(message string, context string) {
+	s.Email.logger.Warnf("Sending warning notification: %s: %s", context, message)
+	s.Email.NotifyWarning(message, context)
+	// Add other notification channels here as needed (SMS, Slack, etc.)
+}
+
+// NotifyRecovery sends a notification that an earlier warning has cleared to all configured channels
+func (s *Service) NotifyRecovery(message string, context string) {
+	s.Email.logger.Infof("Sending recovery notification: %s: %s", context, message)
+	s.Email.NotifyRecovery(message, context)
+	// Add other notification channels here as needed (SMS, Slack, etc.)
+}
+
 // NotifyError sends an error notification to all configured channels
 func (s *Service) NotifyError(err error, context string) {
 	s.Email.logger.Infof("Sending error notification: %v", err)
@@ -0,0 +1,334 @@
+package protocol
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// Direction tells which side sends a message
+type Direction string
+
+const (
+	// FromClient messages are sent by clients to the server
+	FromClient Direction = "client"
+	// FromServer messages are sent by the server to clients
+	FromServer Direction = "server"
+)
+
+// Hubs messages are exchanged on
+const (
+	HubDashboard = "dashboard"
+	HubClient    = "client"
+	HubLogs      = "logs"
+)
+
+// DisplayCommands are the commands sent to displays on the client hub, as messages named after the command
+var DisplayCommands = []string{
+	"refresh", "redirect", "set_volume", "mute", "test_tone", "show_message", "screen_on", "screen_off", "reload_config",
+}
+
+// MessageType describes a type of message and the type of its content
+type MessageType struct {
+	Type        string
+	Direction   Direction
+	Hubs        []string
+	Description string
+	content     reflect.Type // nil for messages without content
+	decode      func(content interface{}, strict bool) (interface{}, *Error)
+}
+
+// Decode converts the content of a message of this type to its typed form and validates it
+func (m MessageType) Decode(content interface{}, strict bool) (interface{}, *Error) {
+	return m.decode(content, strict)
+}
+
+// message describes a message type with content of type T
+func message[T any](messageType string, direction Direction, description string, hubs ...string) MessageType {
+	return MessageType{
+		Type:        messageType,
+		Direction:   direction,
+		Hubs:        hubs,
+		Description: description,
+		content:     reflect.TypeFor[T](),
+		decode: func(content interface{}, strict bool) (interface{}, *Error) {
+			return Decode[T](content, strict)
+		},
+	}
+}
+
+// signal describes a message type without content
+func signal(messageType string, direction Direction, description string, hubs ...string) MessageType {
+	return MessageType{
+		Type:        messageType,
+		Direction:   direction,
+		Hubs:        hubs,
+		Description: description,
+		decode: func(content interface{}, strict bool) (interface{}, *Error) {
+			if strict && content != nil {
+				return nil, NewError(CodeInvalidContent, "%s messages have no content", messageType)
+			}
+			return nil, nil
+		},
+	}
+}
+
+// messageTypes lists every message of the protocol
+var messageTypes = buildMessageTypes()
+
+func buildMessageTypes() []MessageType {
+	types := []MessageType{
+		// Sent by clients
+		message[Ping]("ping", FromClient, "Asks the server for a pong", HubDashboard, HubClient, HubLogs),
+		message[Subscription]("subscribe", FromClient, "Adds topics and sets the station filter", HubDashboard),
+		message[Subscription]("unsubscribe", FromClient, "Removes topics and sets the station filter", HubDashboard),
+		message[Resume]("resume", FromClient, "Replays the events missed after last_seq", HubDashboard),
+		message[Ack]("ack", FromClient, "Confirms that a display showed an alert", HubDashboard),
+		message[Command]("command", FromClient, "Sends a command to the targeted displays, needs client:control", HubClient),
+		message[CommandAck]("command_ack", FromClient, "Answers a display command", HubClient),
+		signal("refresh", FromClient, "Reloads every display without acknowledgements, needs client:control", HubClient),
+		message[Redirect]("redirect", FromClient, "Redirects every display without acknowledgements, needs client:control", HubClient),
+
+		// Sent by the server
+		message[Heartbeat]("heartbeat", FromServer, "Sent every 30 seconds", HubDashboard, HubClient, HubLogs),
+		message[Heartbeat]("pong", FromServer, "Answers a ping", HubDashboard, HubClient, HubLogs),
+		message[Error]("error", FromServer, "Rejects a client message. Version 1 clients get the message as a string.", HubDashboard, HubClient, HubLogs),
+		message[models.Alert]("new_alert", FromServer, "A new alert, redacted for clients without alerts:read", HubDashboard),
+		message[AlertDeleted]("alert_deleted", FromServer, "An alert was deleted", HubDashboard),
+		message[models.Weather]("weather_update", FromServer, "The latest weather", HubDashboard),
+		message[HydrantsDeleted]("hydrants_deleted", FromServer, "Every hydrant was deleted", HubDashboard),
+		message[Subscribed]("subscribed", FromServer, "Confirms the subscriptions after subscribe or unsubscribe", HubDashboard),
+		message[Resumed]("resumed", FromServer, "Follows the events replayed after resume", HubDashboard),
+		message[ResyncRequired]("resync_required", FromServer, "The missed events can't be replayed, reload the current state", HubDashboard),
+		message[Bulletins]("bulletins", FromServer, "The active bulletins for the client's station, sent on connect", HubDashboard),
+		message[models.Bulletin]("bulletin", FromServer, "A bulletin started or changed, replaces any bulletin with the same ID", HubDashboard),
+		message[models.Bulletin]("bulletin_expired", FromServer, "A bulletin ended or is no longer shown at the client's station", HubDashboard),
+		message[Close]("close", FromServer, "Ends a server-sent event stream", HubDashboard),
+		message[CommandSent]("command_sent", FromServer, "Lists the displays a command was sent to", HubClient),
+		message[CommandResult]("command_result", FromServer, "A display answered a command, or didn't in time", HubClient),
+		message[models.DisplayOutage]("display_offline", FromServer, "A watched station has had no dashboard display, sent to clients with connections:read", HubClient),
+		message[models.DisplayOutage]("display_recovered", FromServer, "A display reconnected at an offline station, sent to clients with connections:read", HubClient),
+		message[LogNotification]("new_log", FromServer, "An API request was logged", HubLogs),
+		message[AuthLockout]("auth_lockout", FromServer, "An IP or credential was locked out after failed logins", HubLogs),
+	}
+
+	for _, command := range DisplayCommands {
+		types = append(types, message[DisplayCommand](command, FromServer, "Display command, answer with command_ack", HubClient))
+	}
+	return types
+}
+
+// ClientMessage returns the description of a message clients may send on a hub
+func ClientMessage(hub, messageType string) (MessageType, bool) {
+	for _, m := range messageTypes {
+		if m.Direction == FromClient && m.Type == messageType && slices.Contains(m.Hubs, hub) {
+			return m, true
+		}
+	}
+	return MessageType{}, false
+}
+
+// Ping is the content of a ping message
+type Ping struct {
+	Timestamp int64 `json:"timestamp,omitempty"` // Client clock, ignored by the server
+}
+
+// Subscription is the content of subscribe and unsubscribe messages
+type Subscription struct {
+	Topics  []string `json:"topics,omitempty" enum:"alerts,weather,hydrants,system"`
+	Station *string  `json:"station,omitempty"` // Only deliver alerts paged to this station, empty removes the filter
+}
+
+// Resume is the content of a resume message
+type Resume struct {
+	LastSeq  int64  `json:"last_seq"`           // Sequence number of the last event the client received
+	Instance string `json:"instance,omitempty"` // Server instance that numbered that event
+}
+
+// Validate checks the sequence number
+func (r *Resume) Validate() *Error {
+	if r.LastSeq < 0 {
+		return FieldError("last_seq", "last_seq must not be negative")
+	}
+	return nil
+}
+
+// Ack is the content of an ack message
+type Ack struct {
+	AlertID string `json:"alert_id"`
+}
+
+// Validate checks the alert ID is set
+func (a *Ack) Validate() *Error {
+	if a.AlertID == "" {
+		return FieldError("alert_id", "alert_id is required")
+	}
+	return nil
+}
+
+// Command is the content of a command message from an admin connection
+type Command struct {
+	Command string                 `json:"command"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Target  models.CommandTarget   `json:"target,omitzero"` // Empty targets every display
+}
+
+// Validate checks the command is named. Its arguments are checked by the command router.
+func (c *Command) Validate() *Error {
+	if c.Command == "" {
+		return FieldError("command", "command is required")
+	}
+	return nil
+}
+
+// CommandAck is the content of a command_ack message from a display
+type CommandAck struct {
+	CommandID string      `json:"command_id"`
+	Status    string      `json:"status,omitempty"` // error, anything else counts as ok
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+}
+
+// Validate checks the command ID is set
+func (a *CommandAck) Validate() *Error {
+	if a.CommandID == "" {
+		return FieldError("command_id", "command_id is required")
+	}
+	return nil
+}
+
+// Redirect is the content of a redirect message from an admin connection
+type Redirect struct {
+	URL string `json:"url"`
+}
+
+// Validate checks the URL is set
+func (r *Redirect) Validate() *Error {
+	if r.URL == "" {
+		return FieldError("url", "url is required")
+	}
+	return nil
+}
+
+// Heartbeat is the content of heartbeat and pong messages
+type Heartbeat struct {
+	Timestamp int64 `json:"timestamp"` // Unix seconds
+}
+
+// AlertDeleted is the content of an alert_deleted message
+type AlertDeleted struct {
+	ID string `json:"id"`
+}
+
+// HydrantsDeleted is the content of a hydrants_deleted message
+type HydrantsDeleted struct {
+	Count     int   `json:"count"`
+	Timestamp int64 `json:"timestamp"` // Unix seconds
+}
+
+// Subscribed is the content of a subscribed message
+type Subscribed struct {
+	Topics  []string `json:"topics" enum:"alerts,weather,hydrants,system"`
+	Station string   `json:"station"`
+}
+
+// Bulletins is the content of a bulletins message
+type Bulletins struct {
+	Bulletins []models.Bulletin `json:"bulletins"` // Most important first
+}
+
+// Resumed is the content of a resumed message
+type Resumed struct {
+	Instance   string `json:"instance"`
+	LastSeq    int64  `json:"last_seq"`
+	CurrentSeq int64  `json:"current_seq"`
+	Replayed   int    `json:"replayed"`
+}
+
+// ResyncRequired is the content of a resync_required message
+type ResyncRequired struct {
+	Reason     string `json:"reason,omitempty"`   // Set when the hub doesn't keep events for replay or the events came from another instance
+	Instance   string `json:"instance,omitempty"` // Server instance that numbers the hub's events
+	LastSeq    int64  `json:"last_seq"`
+	OldestSeq  int64  `json:"oldest_seq"`
+	CurrentSeq int64  `json:"current_seq"`
+}
+
+// Close is the content of the close event that ends a server-sent event stream
+type Close struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// CommandSent is the content of a command_sent message
+type CommandSent struct {
+	CommandID string   `json:"command_id"`
+	Command   string   `json:"command"`
+	Targets   []string `json:"targets"` // Client IDs
+}
+
+// CommandResult is the content of a command_result message
+type CommandResult struct {
+	CommandID string      `json:"command_id"`
+	Command   string      `json:"command"`
+	ClientID  string      `json:"client_id"`
+	Station   string      `json:"station"`
+	Group     string      `json:"group"`
+	Status    string      `json:"status" enum:"ok,error,timeout"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+}
+
+// DisplayCommand is the content of a command sent to displays: the command's arguments and
+// the ID to acknowledge it with. Broadcasts of the refresh and redirect messages have no ID.
+type DisplayCommand struct {
+	CommandID string
+	Args      map[string]interface{}
+}
+
+// MarshalJSON writes the arguments and the command ID as one object
+func (c DisplayCommand) MarshalJSON() ([]byte, error) {
+	content := make(map[string]interface{}, len(c.Args)+1)
+	maps.Copy(content, c.Args)
+	if c.CommandID != "" {
+		content["command_id"] = c.CommandID
+	}
+	return json.Marshal(content)
+}
+
+// JSONSchema describes the object written by MarshalJSON
+func (DisplayCommand) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command_id": map[string]interface{}{"type": "string"},
+		},
+		"additionalProperties": true,
+	}
+}
+
+// LogNotification is the content of a new_log message
+type LogNotification struct {
+	ID         string `json:"id"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Timestamp  int64  `json:"timestamp"` // Unix seconds
+	SourceIP   string `json:"source_ip"`
+	Duration   int64  `json:"duration"` // Milliseconds
+	StatusCode int    `json:"statusCode"`
+}
+
+// AuthLockout is the content of an auth_lockout message
+type AuthLockout struct {
+	Kind              string    `json:"kind" enum:"ip,credential"`
+	Key               string    `json:"key"`
+	SourceIP          string    `json:"source_ip"`
+	Failures          int       `json:"failures"`
+	LockedUntil       time.Time `json:"locked_until"`
+	RetryAfterSeconds int       `json:"retry_after_seconds"`
+	Timestamp         int64     `json:"timestamp"` // Unix seconds
+}
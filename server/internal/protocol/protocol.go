@@ -0,0 +1,231 @@
+// Package protocol defines the versioned websocket protocol: the typed content of every
+// message, the validation of client messages and the schema published at /ws/schema.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Protocol versions
+const (
+	// Version1 is spoken by clients that don't request a versioned subprotocol. Content is
+	// decoded leniently, errors are plain strings and unknown messages are echoed back.
+	Version1 = 1
+	// Version2 validates client messages strictly and answers invalid ones with structured errors
+	Version2 = 2
+	// CurrentVersion is the latest protocol version
+	CurrentVersion = Version2
+)
+
+// Subprotocols that select the current version, in order of preference
+const (
+	// SubprotocolMsgpack frames batches of messages as MessagePack arrays in binary frames
+	SubprotocolMsgpack = "alerting.v2+msgpack"
+	// SubprotocolJSON frames batches of messages as JSON arrays in text frames
+	SubprotocolJSON = "alerting.v2+json"
+)
+
+// Error codes sent in the content of error messages
+const (
+	CodeMalformed      = "malformed_message"
+	CodeUnknownType    = "unknown_type"
+	CodeInvalidContent = "invalid_content"
+	CodeUnauthorized   = "unauthorized"
+	CodeNoTargets      = "no_targets"
+)
+
+// errorCodes describes each error code in the schema
+var errorCodes = map[string]string{
+	CodeMalformed:      "The frame isn't a message in the negotiated encoding",
+	CodeUnknownType:    "The hub doesn't accept messages of this type",
+	CodeInvalidContent: "The content doesn't match the schema of the message type",
+	CodeUnauthorized:   "The connection lacks the permission the message needs",
+	CodeNoTargets:      "No client matches the target of a command",
+}
+
+// Error is the content of the error messages sent to version 2 clients
+type Error struct {
+	Code    string `json:"code" enum:"malformed_message,unknown_type,invalid_content,unauthorized,no_targets"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`  // Content field that failed validation
+	RefID   string `json:"ref_id,omitempty"` // ID of the client message the error answers
+}
+
+// Error returns the message of the error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError creates an error with a code
+func NewError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// FieldError creates an invalid_content error for a content field
+func FieldError(field, format string, args ...interface{}) *Error {
+	return &Error{Code: CodeInvalidContent, Message: fmt.Sprintf(format, args...), Field: field}
+}
+
+// Validator is implemented by content that checks more than its JSON shape
+type Validator interface {
+	Validate() *Error
+}
+
+// Decode converts message content to its typed form and validates it. Strict decoding
+// also rejects fields the type doesn't have.
+func Decode[T any](content interface{}, strict bool) (T, *Error) {
+	var value T
+
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return value, NewError(CodeInvalidContent, "content can't be encoded as JSON: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&value); err != nil {
+		return value, contentError(err)
+	}
+
+	if strict {
+		if err := checkRequired(raw, reflect.TypeFor[T]()); err != nil {
+			return value, err
+		}
+	}
+	if err := checkEnums(reflect.ValueOf(value)); err != nil {
+		return value, err
+	}
+	if validator, ok := any(&value).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return value, err
+		}
+	}
+	return value, nil
+}
+
+// contentError describes why content couldn't be decoded
+func contentError(err error) *Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldError(typeErr.Field, "%s must be %s, got %s", typeErr.Field, describeKind(typeErr.Type), typeErr.Value)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return FieldError(field, "unknown field %s", field)
+	}
+	if typeErr != nil {
+		return NewError(CodeInvalidContent, "content must be %s, got %s", describeKind(typeErr.Type), typeErr.Value)
+	}
+	return NewError(CodeInvalidContent, "invalid content: %v", err)
+}
+
+// describeKind names the JSON type a Go type is decoded from
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// checkRequired checks that content has every field of a struct type that may not be left out
+func checkRequired(raw []byte, t reflect.Type) *Error {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return NewError(CodeInvalidContent, "content must be an object")
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if name, optional := jsonName(t.Field(i)); !optional && name != "-" {
+			if _, ok := fields[name]; !ok {
+				return FieldError(name, "%s is required", name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkEnums checks the string fields of a struct, and the elements of its string slice
+// fields, against the values listed in their enum tags
+func checkEnums(v reflect.Value) *Error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		allowed := enumValues(field)
+		if allowed == nil {
+			continue
+		}
+
+		name, _ := jsonName(field)
+		value := v.Field(i)
+		var values []string
+		switch {
+		case value.Kind() == reflect.String:
+			if value.String() != "" {
+				values = []string{value.String()}
+			}
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+			for j := 0; j < value.Len(); j++ {
+				values = append(values, value.Index(j).String())
+			}
+		}
+
+		for _, item := range values {
+			if !slices.Contains(allowed, item) {
+				return FieldError(name, "%s must be one of %s, got %q", name, strings.Join(allowed, ", "), item)
+			}
+		}
+	}
+	return nil
+}
+
+// enumValues returns the values allowed by a field's enum tag, nil when it has none
+func enumValues(field reflect.StructField) []string {
+	tag, ok := field.Tag.Lookup("enum")
+	if !ok {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// jsonName returns the JSON name of a struct field and whether it may be left out
+func jsonName(field reflect.StructField) (string, bool) {
+	name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		name = field.Name
+	}
+	optional := field.Type.Kind() == reflect.Pointer
+	for _, option := range strings.Split(options, ",") {
+		if option == "omitempty" || option == "omitzero" {
+			optional = true
+		}
+	}
+	return name, optional
+}
@@ -0,0 +1,105 @@
+package protocol_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// TestDecode checks strict and lenient decoding of client message content
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType string
+		content     interface{}
+		strict      bool
+		code        string
+		field       string
+	}{
+		{"valid", "resume", map[string]interface{}{"last_seq": 4}, true, "", ""},
+		{"wrong type", "resume", map[string]interface{}{"last_seq": "4"}, true, protocol.CodeInvalidContent, "last_seq"},
+		{"missing field", "resume", map[string]interface{}{}, true, protocol.CodeInvalidContent, "last_seq"},
+		{"missing content", "ack", nil, true, protocol.CodeInvalidContent, "alert_id"},
+		{"unknown field", "ack", map[string]interface{}{"alert_id": "a", "extra": true}, true, protocol.CodeInvalidContent, "extra"},
+		{"lenient unknown field", "ack", map[string]interface{}{"alert_id": "a", "extra": true}, false, "", ""},
+		{"lenient still validates", "ack", map[string]interface{}{}, false, protocol.CodeInvalidContent, "alert_id"},
+		{"unknown topic", "subscribe", map[string]interface{}{"topics": []string{"alerts", "sports"}}, false, protocol.CodeInvalidContent, "topics"},
+		{"optional fields", "subscribe", map[string]interface{}{"station": "51"}, true, "", ""},
+		{"signal with content", "refresh", map[string]interface{}{"x": 1}, true, protocol.CodeInvalidContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := protocol.HubDashboard
+			if tt.messageType == "refresh" {
+				hub = protocol.HubClient
+			}
+			spec, ok := protocol.ClientMessage(hub, tt.messageType)
+			if !ok {
+				t.Fatalf("Expected %s to be a client message", tt.messageType)
+			}
+
+			_, err := spec.Decode(tt.content, tt.strict)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Code != tt.code || err.Field != tt.field {
+				t.Fatalf("Expected %s on field %q, got %+v", tt.code, tt.field, err)
+			}
+		})
+	}
+
+	if _, ok := protocol.ClientMessage(protocol.HubLogs, "resume"); ok {
+		t.Error("Expected resume to be rejected on the logs hub")
+	}
+}
+
+// TestSchema checks every message has a content schema whose references resolve
+func TestSchema(t *testing.T) {
+	doc := protocol.Schema()
+
+	var check func(path string, schema interface{})
+	check = func(path string, schema interface{}) {
+		switch value := schema.(type) {
+		case map[string]interface{}:
+			if ref, ok := value["$ref"].(string); ok {
+				if _, ok := doc.Defs[strings.TrimPrefix(ref, "#/$defs/")]; !ok {
+					t.Errorf("%s refers to missing definition %s", path, ref)
+				}
+			}
+			for key, item := range value {
+				check(path+"."+key, item)
+			}
+		case []interface{}:
+			for _, item := range value {
+				check(path, item)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range doc.Messages {
+		key := string(m.Direction) + ":" + m.Type
+		if seen[key] {
+			t.Errorf("Message %s is described twice", key)
+		}
+		seen[key] = true
+		if len(m.Content) == 0 {
+			t.Errorf("Message %s has no content schema", key)
+		}
+		check(key, m.Content)
+	}
+	for name, def := range doc.Defs {
+		check(name, def)
+	}
+
+	alert, _ := doc.Defs["Alert"].(map[string]interface{})
+	required, _ := alert["required"].([]string)
+	if strings.Join(required, ",") != "agency,alert" {
+		t.Errorf("Expected agency and alert to be required, got %v", required)
+	}
+}
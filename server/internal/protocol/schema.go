@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// jsonSchemaDialect is the JSON Schema version the document is written in
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaProvider is implemented by content types whose JSON doesn't follow their fields
+type SchemaProvider interface {
+	JSONSchema() map[string]interface{}
+}
+
+// Document is the machine-readable description of the protocol, for generating clients
+type Document struct {
+	Schema       string                 `json:"$schema"`
+	Title        string                 `json:"title"`
+	Version      int                    `json:"version"`
+	Subprotocols []string               `json:"subprotocols"`
+	Envelope     map[string]interface{} `json:"envelope"` // Schema of every message, with content left open
+	Messages     []MessageSchema        `json:"messages"`
+	ErrorCodes   map[string]string      `json:"error_codes"`
+	Defs         map[string]interface{} `json:"$defs"` // Named types referenced by the message schemas
+}
+
+// MessageSchema describes one type of message and the schema of its content
+type MessageSchema struct {
+	Type        string                 `json:"type"`
+	Direction   Direction              `json:"direction"`
+	Hubs        []string               `json:"hubs"`
+	Description string                 `json:"description"`
+	Content     map[string]interface{} `json:"content"`
+}
+
+// Schema describes every message of the current protocol version
+func Schema() Document {
+	g := &schemaGenerator{defs: make(map[string]interface{})}
+
+	doc := Document{
+		Schema:       jsonSchemaDialect,
+		Title:        "Alerting websocket protocol",
+		Version:      CurrentVersion,
+		Subprotocols: []string{SubprotocolMsgpack, SubprotocolJSON},
+		Envelope:     g.schema(reflect.TypeFor[models.WebSocketMessage]()),
+		Messages:     make([]MessageSchema, 0, len(messageTypes)),
+		ErrorCodes:   errorCodes,
+		Defs:         g.defs,
+	}
+
+	for _, m := range messageTypes {
+		content := map[string]interface{}{"type": "null"}
+		if m.content != nil {
+			content = g.schema(m.content)
+		}
+		doc.Messages = append(doc.Messages, MessageSchema{
+			Type:        m.Type,
+			Direction:   m.Direction,
+			Hubs:        m.Hubs,
+			Description: m.Description,
+			Content:     content,
+		})
+	}
+	return doc
+}
+
+// schemaGenerator builds JSON Schemas from Go types, collecting named structs in defs
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+// schema returns the schema of the JSON encoding of a type
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if provider, ok := reflect.Zero(t).Interface().(SchemaProvider); ok {
+		return provider.JSONSchema()
+	}
+
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = map[string]interface{}{} // Placeholder for types that refer to themselves
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct's fields
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name, optional := jsonName(field)
+		property := g.schema(field.Type)
+		if values := enumValues(field); values != nil {
+			if field.Type.Kind() == reflect.Slice {
+				property = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": values}}
+			} else {
+				property = map[string]interface{}{"type": "string", "enum": values}
+			}
+		}
+
+		properties[name] = property
+		if !optional {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
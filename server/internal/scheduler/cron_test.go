@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@fortnightly",
+	}
+
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, expected an error", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skipf("Timezone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "nightly refresh later today",
+			expr:     "0 3 * * *",
+			after:    time.Date(2026, 3, 2, 1, 15, 0, 0, time.UTC),
+			expected: time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "nightly refresh tomorrow",
+			expr:     "0 3 * * *",
+			after:    time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "step",
+			expr:     "*/15 * * * *",
+			after:    time.Date(2026, 3, 2, 10, 16, 30, 0, time.UTC),
+			expected: time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays by name",
+			expr:     "30 22 * * mon-fri",
+			after:    time.Date(2026, 3, 6, 23, 0, 0, 0, time.UTC), // Friday
+			expected: time.Date(2026, 3, 9, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "sunday as 7",
+			expr:     "0 12 * * 7",
+			after:    time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day of month or day of week",
+			expr:     "0 0 15 * sat",
+			after:    time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "leap day",
+			expr:     "0 0 29 feb *",
+			after:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "macro",
+			expr:     "@monthly",
+			after:    time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC),
+			expected: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "skipped hour at spring forward",
+			expr:     "30 2 * * *",
+			after:    time.Date(2026, 3, 8, 0, 0, 0, 0, chicago),
+			expected: time.Date(2026, 3, 9, 2, 30, 0, 0, chicago),
+		},
+		{
+			name:     "repeated hour at fall back runs once",
+			expr:     "30 1 * * *",
+			after:    time.Date(2026, 11, 1, 1, 30, 0, 0, chicago),
+			expected: time.Date(2026, 11, 2, 1, 30, 0, 0, chicago),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+			}
+			if next := schedule.Next(tt.after); !next.Equal(tt.expected) {
+				t.Errorf("Next(%s) = %s, expected %s", tt.after, next, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScheduleNeverMatches(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 feb *")
+	if err != nil {
+		t.Fatalf("ParseCron failed: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next run, got %s", next)
+	}
+}
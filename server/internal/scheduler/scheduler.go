@@ -0,0 +1,340 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	"github.com/user/alerting/server/internal/websocket"
+)
+
+// checkInterval is how often the scheduler looks for due jobs
+const checkInterval = 15 * time.Second
+
+// Leader reports whether this server instance runs the scheduled jobs
+type Leader interface {
+	IsLeader() bool
+}
+
+// Service runs scheduled display commands and records their run history
+type Service struct {
+	store          *storage.Storage
+	commands       *websocket.Handler
+	logger         *logging.Logger
+	leader         Leader // nil when this is the only instance
+	location       *time.Location
+	missedRunGrace time.Duration
+	runRetention   time.Duration
+	wake           chan struct{}
+	shutdownCh     chan struct{}
+	done           chan struct{}
+}
+
+// NewService creates a scheduler that sends commands through the websocket handler
+func NewService(cfg config.SchedulerConfig, store *storage.Storage, commands *websocket.Handler, logger *logging.Logger) (*Service, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scheduler timezone %q: %w", cfg.Timezone, err)
+	}
+
+	return &Service{
+		store:          store,
+		commands:       commands,
+		logger:         logger,
+		location:       location,
+		missedRunGrace: cfg.MissedRunGrace,
+		runRetention:   cfg.RunRetention,
+		wake:           make(chan struct{}, 1),
+		shutdownCh:     make(chan struct{}),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// SetLeader makes the scheduler run jobs only while this instance is the leader,
+// so a job isn't run once by every server instance
+func (s *Service) SetLeader(leader Leader) {
+	s.leader = leader
+}
+
+// Start runs due jobs until Stop is called. Runs that were due while the
+// server was down are handled first, according to each job's missed run policy.
+func (s *Service) Start() {
+	s.logger.Infof("Starting scheduler in timezone %s", s.location)
+
+	ticker := time.NewTicker(checkInterval)
+	pruneTicker := time.NewTicker(time.Hour)
+
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		defer pruneTicker.Stop()
+
+		s.runDue(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+				s.runDue(time.Now())
+			case <-s.wake:
+				s.runDue(time.Now())
+			case <-pruneTicker.C:
+				if s.leading() {
+					s.pruneRuns()
+				}
+			case <-s.shutdownCh:
+				s.logger.Info("Scheduler shutting down")
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the scheduler
+func (s *Service) Stop() {
+	s.logger.Info("Stopping scheduler")
+	close(s.shutdownCh)
+	<-s.done
+}
+
+// Wake makes the scheduler check for due jobs now, after jobs were changed
+func (s *Service) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Prepare validates a job definition, fills in defaults and sets its next run time
+func (s *Service) Prepare(job *models.ScheduledJob, now time.Time) error {
+	job.Name = strings.TrimSpace(job.Name)
+	if job.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	schedule, err := ParseCron(job.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression: %v", err)
+	}
+
+	location, err := s.jobLocation(*job)
+	if err != nil {
+		return err
+	}
+
+	if job.Args == nil {
+		job.Args = map[string]interface{}{}
+	}
+	if err := websocket.ValidateCommand(job.Command, job.Args); err != nil {
+		return err
+	}
+
+	switch job.MissedRunPolicy {
+	case "":
+		job.MissedRunPolicy = models.MissedRunSkip
+	case models.MissedRunSkip, models.MissedRunRunOnce:
+	default:
+		return fmt.Errorf("invalid missed_run_policy %q, expected %s or %s",
+			job.MissedRunPolicy, models.MissedRunSkip, models.MissedRunRunOnce)
+	}
+
+	job.NextRunAt = nil
+	if job.Enabled {
+		job.NextRunAt = nextRun(schedule, now.In(location))
+		if job.NextRunAt == nil {
+			return fmt.Errorf("cron expression %q never matches", job.Cron)
+		}
+	}
+
+	return nil
+}
+
+// RunNow sends a job's command immediately without changing its schedule
+func (s *Service) RunNow(ctx context.Context, job models.ScheduledJob) (models.ScheduledJobRun, error) {
+	now := time.Now()
+	return s.dispatch(ctx, job, now, now, true)
+}
+
+// jobLocation returns the timezone a job's schedule is evaluated in
+func (s *Service) jobLocation(job models.ScheduledJob) (*time.Location, error) {
+	if job.Timezone == "" {
+		return s.location, nil
+	}
+	location, err := time.LoadLocation(job.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", job.Timezone)
+	}
+	return location, nil
+}
+
+// nextRun returns the next run of a schedule after t, or nil if it never matches
+func nextRun(schedule *Schedule, t time.Time) *time.Time {
+	next := schedule.Next(t)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// leading reports whether this instance runs the jobs
+func (s *Service) leading() bool {
+	return s.leader == nil || s.leader.IsLeader()
+}
+
+// runDue runs every enabled job whose next run time has passed, on the leader only
+func (s *Service) runDue(now time.Time) {
+	if !s.leading() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	jobs, err := s.store.ListScheduledJobs(ctx, true)
+	if err != nil {
+		s.logger.Error(err, "Failed to load scheduled jobs")
+		return
+	}
+
+	for _, job := range jobs {
+		if job.NextRunAt != nil && job.NextRunAt.After(now) {
+			continue
+		}
+
+		next, err := s.nextRunOf(job, now)
+		if err != nil {
+			s.logger.Warnf("Scheduled job %s (%s) has an invalid schedule: %v", job.Name, job.ID, err)
+			continue
+		}
+
+		if job.NextRunAt == nil {
+			// Jobs that were just enabled, or whose schedule stopped matching, are scheduled from now
+			if err := s.store.SetScheduledJobRunTimes(ctx, job.ID, next, nil); err != nil {
+				s.logger.Error(err, "Failed to schedule job")
+			}
+			continue
+		}
+
+		due := *job.NextRunAt
+		if now.Sub(due) > s.missedRunGrace && job.MissedRunPolicy != models.MissedRunRunOnce {
+			s.recordMissed(ctx, job, due, now)
+			if err := s.store.SetScheduledJobRunTimes(ctx, job.ID, next, nil); err != nil {
+				s.logger.Error(err, "Failed to schedule job")
+			}
+			continue
+		}
+
+		// Move the schedule on before sending so a crash can't send the command twice
+		if err := s.store.SetScheduledJobRunTimes(ctx, job.ID, next, &now); err != nil {
+			s.logger.Error(err, "Failed to schedule job")
+			continue
+		}
+		if _, err := s.dispatch(ctx, job, due, now, false); err != nil {
+			s.logger.Error(err, "Failed to record scheduled job run")
+		}
+	}
+}
+
+// nextRunOf returns a job's next run time after now
+func (s *Service) nextRunOf(job models.ScheduledJob, now time.Time) (*time.Time, error) {
+	schedule, err := ParseCron(job.Cron)
+	if err != nil {
+		return nil, err
+	}
+	location, err := s.jobLocation(job)
+	if err != nil {
+		return nil, err
+	}
+	return nextRun(schedule, now.In(location)), nil
+}
+
+// recordMissed records a run that was due while the scheduler wasn't running
+func (s *Service) recordMissed(ctx context.Context, job models.ScheduledJob, due, now time.Time) {
+	s.logger.Warnf("Skipping scheduled job %s (%s) that was due at %s", job.Name, job.ID, due.Format(time.RFC3339))
+
+	_, err := s.store.CreateScheduledJobRun(ctx, models.ScheduledJobRun{
+		JobID:        job.ID,
+		ScheduledFor: due,
+		StartedAt:    now,
+		CompletedAt:  &now,
+		Status:       models.JobRunStatusMissed,
+		Error:        "the scheduler was not running when the job was due",
+	})
+	if err != nil {
+		s.logger.Error(err, "Failed to record missed scheduled job run")
+	}
+}
+
+// dispatch sends a job's command and records the run.
+// The run is completed with the acknowledgement counts once every target answered or timed out.
+// Commands shared with other instances may match displays of any instance, so whether a shared
+// command had targets is only known when its run is completed.
+func (s *Service) dispatch(ctx context.Context, job models.ScheduledJob, due, now time.Time, manual bool) (models.ScheduledJobRun, error) {
+	run := models.ScheduledJobRun{
+		ID:           uuid.New().String(),
+		JobID:        job.ID,
+		ScheduledFor: due,
+		StartedAt:    now,
+		Manual:       manual,
+	}
+
+	// The outcome may arrive before the run is stored, so completing it waits for the insert
+	stored := make(chan struct{})
+	defer close(stored)
+
+	outcome, err := s.commands.SendCommand(job.Command, job.Args, job.Target, func(outcome websocket.CommandOutcome) {
+		go func() {
+			<-stored
+			s.completeRun(run.ID, outcome)
+		}()
+	})
+
+	switch {
+	case err != nil:
+		run.Status = models.JobRunStatusFailed
+		run.Error = err.Error()
+		run.CompletedAt = &now
+		s.logger.Warnf("Scheduled job %s (%s) failed: %v", job.Name, job.ID, err)
+	case len(outcome.Targets) == 0 && !s.commands.CommandsShared():
+		run.Status = models.JobRunStatusNoTargets
+		run.CompletedAt = &now
+		s.logger.Warnf("Scheduled job %s (%s) matched no connected displays", job.Name, job.ID)
+	default:
+		run.Status = models.JobRunStatusSent
+		run.CommandID = outcome.CommandID
+		run.Targets = len(outcome.Targets)
+		s.logger.Infof("Scheduled job %s (%s) sent %s to %d displays of this instance", job.Name, job.ID, job.Command, run.Targets)
+	}
+
+	return s.store.CreateScheduledJobRun(ctx, run)
+}
+
+// completeRun records the targets and acknowledgement counts of a run
+func (s *Service) completeRun(runID string, outcome websocket.CommandOutcome) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.store.CompleteScheduledJobRun(ctx, runID, len(outcome.Targets), outcome.Acknowledged, outcome.Failed, outcome.TimedOut)
+	if err != nil {
+		s.logger.Error(err, "Failed to complete scheduled job run")
+	}
+}
+
+// pruneRuns removes run history older than the retention period
+func (s *Service) pruneRuns() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := s.store.DeleteScheduledJobRunsBefore(ctx, time.Now().Add(-s.runRetention))
+	if err != nil {
+		s.logger.Error(err, "Failed to prune scheduled job runs")
+		return
+	}
+	if count > 0 {
+		s.logger.Infof("Pruned %d scheduled job runs", count)
+	}
+}
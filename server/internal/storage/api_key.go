@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitAPIKeyTable initializes the api_keys table if it doesn't exist
+func (s *Storage) InitAPIKeyTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		allowed_ips TEXT[] NOT NULL DEFAULT '{}',
+		expires_at TIMESTAMP WITH TIME ZONE,
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		last_used_ip TEXT,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_by TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create api_keys table: %w", err)
+	}
+
+	return nil
+}
+
+// apiKeyColumns is the column list shared by the API key queries
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, allowed_ips, expires_at, last_used_at,
+	COALESCE(last_used_ip, ''), revoked_at, COALESCE(created_by, ''), created_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+	var k models.APIKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&k.ID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), pq.Array(&k.AllowedIPs),
+		&expiresAt, &lastUsedAt, &k.LastUsedIP, &revokedAt, &k.CreatedBy, &k.CreatedAt,
+	)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	return k, nil
+}
+
+// CreateAPIKey stores a new API key
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+
+	query := `
+	INSERT INTO api_keys (id, name, prefix, key_hash, scopes, allowed_ips, expires_at, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING created_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		key.ID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), pq.Array(key.AllowedIPs), key.ExpiresAt, key.CreatedBy,
+	).Scan(&key.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.APIKey{}, ErrConflict
+		}
+		return models.APIKey{}, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its value
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrNotFound
+		}
+		return models.APIKey{}, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key row: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api key rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks an API key as revoked so it can no longer be used
+func (s *Storage) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordAPIKeyUse sets the last used time and address of an API key
+func (s *Storage) RecordAPIKeyUse(ctx context.Context, id, ip string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $2 WHERE id = $1", id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to record api key use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitBulletinTable initializes the bulletins table if it doesn't exist
+func (s *Storage) InitBulletinTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS bulletins (
+		id TEXT PRIMARY KEY,
+		message TEXT NOT NULL,
+		priority TEXT NOT NULL,
+		stations TEXT[] NOT NULL DEFAULT '{}',
+		starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		ends_at TIMESTAMP WITH TIME ZONE,
+		created_by TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS bulletins_ends_at_idx ON bulletins (ends_at);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create bulletins table: %w", err)
+	}
+
+	return nil
+}
+
+// bulletinColumns is the column list shared by the bulletin queries
+const bulletinColumns = `id, message, priority, stations, starts_at, ends_at, COALESCE(created_by, ''), created_at, updated_at`
+
+// scanBulletin scans a row selected with bulletinColumns
+func scanBulletin(row interface{ Scan(...any) error }) (models.Bulletin, error) {
+	var b models.Bulletin
+	var endsAt sql.NullTime
+	err := row.Scan(
+		&b.ID, &b.Message, &b.Priority, pq.Array(&b.Stations), &b.StartsAt, &endsAt, &b.CreatedBy, &b.CreatedAt, &b.UpdatedAt,
+	)
+	if err != nil {
+		return models.Bulletin{}, err
+	}
+
+	if endsAt.Valid {
+		b.EndsAt = &endsAt.Time
+	}
+
+	return b, nil
+}
+
+// CreateBulletin stores a new bulletin
+func (s *Storage) CreateBulletin(ctx context.Context, bulletin models.Bulletin) (models.Bulletin, error) {
+	if bulletin.ID == "" {
+		bulletin.ID = uuid.New().String()
+	}
+
+	query := `
+	INSERT INTO bulletins (id, message, priority, stations, starts_at, ends_at, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING ` + bulletinColumns
+
+	created, err := scanBulletin(s.db.QueryRowContext(ctx, query,
+		bulletin.ID, bulletin.Message, bulletin.Priority, textArray(bulletin.Stations), bulletin.StartsAt, bulletin.EndsAt,
+		bulletin.CreatedBy,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Bulletin{}, ErrConflict
+		}
+		return models.Bulletin{}, fmt.Errorf("failed to create bulletin: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetBulletin retrieves a bulletin by ID
+func (s *Storage) GetBulletin(ctx context.Context, id string) (models.Bulletin, error) {
+	query := `SELECT ` + bulletinColumns + ` FROM bulletins WHERE id = $1`
+
+	bulletin, err := scanBulletin(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Bulletin{}, ErrNotFound
+		}
+		return models.Bulletin{}, fmt.Errorf("failed to get bulletin: %w", err)
+	}
+
+	return bulletin, nil
+}
+
+// ListBulletins retrieves the bulletins that haven't ended by the given time, including
+// those that start later, ordered by start time. With includeExpired every bulletin is returned.
+func (s *Storage) ListBulletins(ctx context.Context, now time.Time, includeExpired bool) ([]models.Bulletin, error) {
+	query := `SELECT ` + bulletinColumns + ` FROM bulletins`
+	args := []interface{}{}
+	if !includeExpired {
+		query += ` WHERE ends_at IS NULL OR ends_at > $1`
+		args = append(args, now)
+	}
+	query += ` ORDER BY starts_at DESC, created_at DESC`
+
+	return s.queryBulletins(ctx, query, args...)
+}
+
+// ListActiveBulletins retrieves the bulletins shown at the given time
+func (s *Storage) ListActiveBulletins(ctx context.Context, now time.Time) ([]models.Bulletin, error) {
+	query := `SELECT ` + bulletinColumns + ` FROM bulletins
+	WHERE starts_at <= $1 AND (ends_at IS NULL OR ends_at > $1)
+	ORDER BY starts_at, created_at`
+
+	return s.queryBulletins(ctx, query, now)
+}
+
+// queryBulletins runs a query selecting bulletinColumns
+func (s *Storage) queryBulletins(ctx context.Context, query string, args ...interface{}) ([]models.Bulletin, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bulletins: %w", err)
+	}
+	defer rows.Close()
+
+	bulletins := make([]models.Bulletin, 0)
+	for rows.Next() {
+		bulletin, err := scanBulletin(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bulletin row: %w", err)
+		}
+		bulletins = append(bulletins, bulletin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bulletin rows: %w", err)
+	}
+
+	return bulletins, nil
+}
+
+// UpdateBulletin replaces the message, priority, stations and times of a bulletin
+func (s *Storage) UpdateBulletin(ctx context.Context, bulletin models.Bulletin) (models.Bulletin, error) {
+	query := `
+	UPDATE bulletins SET
+		message = $2, priority = $3, stations = $4, starts_at = $5, ends_at = $6, updated_at = NOW()
+	WHERE id = $1
+	RETURNING ` + bulletinColumns
+
+	updated, err := scanBulletin(s.db.QueryRowContext(ctx, query,
+		bulletin.ID, bulletin.Message, bulletin.Priority, textArray(bulletin.Stations), bulletin.StartsAt, bulletin.EndsAt,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Bulletin{}, ErrNotFound
+		}
+		return models.Bulletin{}, fmt.Errorf("failed to update bulletin: %w", err)
+	}
+
+	return updated, nil
+}
+
+// ExpireBulletin ends a bulletin at the given time, unless it already ended earlier
+func (s *Storage) ExpireBulletin(ctx context.Context, id string, at time.Time) (models.Bulletin, error) {
+	query := `
+	UPDATE bulletins SET
+		ends_at = CASE WHEN ends_at IS NULL OR ends_at > $2 THEN $2 ELSE ends_at END,
+		updated_at = NOW()
+	WHERE id = $1
+	RETURNING ` + bulletinColumns
+
+	expired, err := scanBulletin(s.db.QueryRowContext(ctx, query, id, at))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Bulletin{}, ErrNotFound
+		}
+		return models.Bulletin{}, fmt.Errorf("failed to expire bulletin: %w", err)
+	}
+
+	return expired, nil
+}
+
+// DeleteBulletin removes a bulletin
+func (s *Storage) DeleteBulletin(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM bulletins WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete bulletin: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
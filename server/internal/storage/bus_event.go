@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitBusEventTable initializes the bus_events table that carries broadcast events between server instances
+func (s *Storage) InitBusEventTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS bus_events (
+		position BIGSERIAL PRIMARY KEY,
+		hub TEXT NOT NULL,
+		origin TEXT NOT NULL,
+		message JSONB NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS bus_events_created_idx ON bus_events (created_at);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create bus_events table: %w", err)
+	}
+
+	return nil
+}
+
+// PublishBusEvent stores a broadcast event and notifies the listeners of the channel in one transaction.
+// The notify function builds the notification payload from the event's position.
+func (s *Storage) PublishBusEvent(ctx context.Context, channel string, event models.BusEvent, notify func(position int64, message []byte) (string, error)) error {
+	message, err := json.Marshal(event.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bus event: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var position int64
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO bus_events (hub, origin, message) VALUES ($1, $2, $3)
+	RETURNING position
+	`, event.Hub, event.Origin, message).Scan(&position)
+	if err != nil {
+		return fmt.Errorf("failed to save bus event: %w", err)
+	}
+
+	payload, err := notify(position, message)
+	if err != nil {
+		return err
+	}
+
+	// Notifications are sent when the transaction commits, in commit order
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		return fmt.Errorf("failed to notify bus event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetBusEvent retrieves a stored broadcast event by its position
+func (s *Storage) GetBusEvent(ctx context.Context, position int64) (models.BusEvent, error) {
+	events, err := s.queryBusEvents(ctx, `
+	SELECT position, hub, origin, message FROM bus_events WHERE position = $1
+	`, position)
+	if err != nil {
+		return models.BusEvent{}, err
+	}
+	if len(events) == 0 {
+		return models.BusEvent{}, ErrNotFound
+	}
+
+	return events[0].Event, nil
+}
+
+// PositionedBusEvent is a stored broadcast event with its position in the bus
+type PositionedBusEvent struct {
+	Position int64
+	Event    models.BusEvent
+}
+
+// ListBusEventsSince retrieves the events published after the given time, oldest first
+func (s *Storage) ListBusEventsSince(ctx context.Context, since time.Time, limit int) ([]PositionedBusEvent, error) {
+	return s.queryBusEvents(ctx, `
+	SELECT position, hub, origin, message FROM bus_events
+	WHERE created_at > $1
+	ORDER BY position
+	LIMIT $2
+	`, since, limit)
+}
+
+// queryBusEvents runs a query selecting position, hub, origin and message. Content is returned as raw JSON.
+func (s *Storage) queryBusEvents(ctx context.Context, query string, args ...interface{}) ([]PositionedBusEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bus events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]PositionedBusEvent, 0)
+	for rows.Next() {
+		var event PositionedBusEvent
+		var message []byte
+		if err := rows.Scan(&event.Position, &event.Event.Hub, &event.Event.Origin, &message); err != nil {
+			return nil, fmt.Errorf("failed to scan bus event row: %w", err)
+		}
+		if event.Event.Message, err = DecodeBusMessage(message); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bus event rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// DecodeBusMessage decodes a marshalled websocket message, leaving its content as raw JSON
+func DecodeBusMessage(data []byte) (models.WebSocketMessage, error) {
+	var raw struct {
+		models.WebSocketMessage
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return models.WebSocketMessage{}, fmt.Errorf("failed to unmarshal bus event: %w", err)
+	}
+
+	message := raw.WebSocketMessage
+	message.Content = raw.Content
+	return message, nil
+}
+
+// DeleteBusEventsBefore removes events published before the given time
+func (s *Storage) DeleteBusEventsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM bus_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete bus events: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitConnectionSessionTable initializes the connection_sessions table if it doesn't exist
+func (s *Storage) InitConnectionSessionTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS connection_sessions (
+		id TEXT PRIMARY KEY,
+		hub TEXT NOT NULL,
+		station TEXT NOT NULL DEFAULT '',
+		device_id TEXT,
+		username TEXT,
+		role TEXT,
+		user_agent TEXT,
+		remote_addr TEXT,
+		connected_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		last_seen_at TIMESTAMP WITH TIME ZONE,
+		disconnected_at TIMESTAMP WITH TIME ZONE,
+		disconnect_reason TEXT,
+		messages_sent BIGINT NOT NULL DEFAULT 0,
+		messages_received BIGINT NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS connection_sessions_connected_idx ON connection_sessions (hub, connected_at DESC);
+	CREATE INDEX IF NOT EXISTS connection_sessions_station_idx ON connection_sessions (hub, station, connected_at);
+	CREATE INDEX IF NOT EXISTS connection_sessions_open_idx ON connection_sessions (hub) WHERE disconnected_at IS NULL;
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create connection_sessions table: %w", err)
+	}
+
+	return nil
+}
+
+// connectionSessionColumns is the column list shared by the connection session queries
+const connectionSessionColumns = `id, hub, station, COALESCE(device_id, ''), COALESCE(username, ''), COALESCE(role, ''),
+	COALESCE(user_agent, ''), COALESCE(remote_addr, ''), connected_at, last_seen_at, disconnected_at,
+	COALESCE(disconnect_reason, ''), messages_sent, messages_received`
+
+// scanConnectionSession scans a row selected with connectionSessionColumns
+func scanConnectionSession(row interface{ Scan(...any) error }) (models.ConnectionSession, error) {
+	var c models.ConnectionSession
+	var lastSeenAt, disconnectedAt sql.NullTime
+	err := row.Scan(
+		&c.ID, &c.Hub, &c.Station, &c.DeviceID, &c.Username, &c.Role,
+		&c.UserAgent, &c.RemoteAddr, &c.ConnectedAt, &lastSeenAt, &disconnectedAt,
+		&c.DisconnectReason, &c.MessagesSent, &c.MessagesReceived,
+	)
+	if err != nil {
+		return models.ConnectionSession{}, err
+	}
+
+	end := time.Now()
+	if lastSeenAt.Valid {
+		c.LastSeenAt = &lastSeenAt.Time
+	}
+	if disconnectedAt.Valid {
+		c.DisconnectedAt = &disconnectedAt.Time
+		end = disconnectedAt.Time
+	}
+	c.DurationSeconds = int64(end.Sub(c.ConnectedAt).Seconds())
+
+	return c, nil
+}
+
+// StartConnectionSession records a new websocket connection.
+// A session that already ended is left unchanged.
+func (s *Storage) StartConnectionSession(ctx context.Context, hub string, detail models.ConnectionDetail) error {
+	query := `
+	INSERT INTO connection_sessions (id, hub, station, device_id, username, role, user_agent, remote_addr, connected_at, last_seen_at)
+	VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $9)
+	ON CONFLICT (id) DO NOTHING
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		detail.ID, hub, detail.Station, detail.DeviceID, detail.Username, detail.Role,
+		detail.UserAgent, detail.RemoteAddr, detail.ConnectedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start connection session: %w", err)
+	}
+
+	return nil
+}
+
+// EndConnectionSession records that a websocket connection closed
+func (s *Storage) EndConnectionSession(ctx context.Context, hub string, detail models.ConnectionDetail) error {
+	disconnectedAt := time.Now()
+	if detail.DisconnectedAt != nil {
+		disconnectedAt = *detail.DisconnectedAt
+	}
+
+	// Insert as well, in case the connection closed before its start was recorded
+	query := `
+	INSERT INTO connection_sessions (id, hub, station, device_id, username, role, user_agent, remote_addr,
+		connected_at, last_seen_at, disconnected_at, disconnect_reason, messages_sent, messages_received)
+	VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10, $10, $11, $12, $13)
+	ON CONFLICT (id) DO UPDATE SET
+		station = $3,
+		last_seen_at = $10,
+		disconnected_at = $10,
+		disconnect_reason = $11,
+		messages_sent = $12,
+		messages_received = $13
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		detail.ID, hub, detail.Station, detail.DeviceID, detail.Username, detail.Role,
+		detail.UserAgent, detail.RemoteAddr, detail.ConnectedAt, disconnectedAt, detail.DisconnectReason,
+		detail.MessagesSent, detail.MessagesReceived,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end connection session: %w", err)
+	}
+
+	return nil
+}
+
+// TouchConnectionSessions sets the last seen time of open sessions
+func (s *Storage) TouchConnectionSessions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE connection_sessions SET last_seen_at = NOW()
+	WHERE id = ANY($1) AND disconnected_at IS NULL
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to touch connection sessions: %w", err)
+	}
+
+	return nil
+}
+
+// CloseStaleConnectionSessions ends open sessions of a hub that haven't been seen since the given time,
+// such as those left open when the server stopped. They are closed at their last seen time.
+func (s *Storage) CloseStaleConnectionSessions(ctx context.Context, hub string, seenBefore time.Time, reason string) (int, error) {
+	result, err := s.db.ExecContext(ctx, `
+	UPDATE connection_sessions
+	SET disconnected_at = COALESCE(last_seen_at, connected_at), disconnect_reason = $3
+	WHERE hub = $1 AND disconnected_at IS NULL AND COALESCE(last_seen_at, connected_at) < $2
+	`, hub, seenBefore, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to close stale connection sessions: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// ConnectionSessionFilter selects connection sessions. Zero fields don't filter.
+type ConnectionSessionFilter struct {
+	Hub     string
+	Station string
+	From    time.Time // Sessions still open at or after this time
+	To      time.Time // Sessions that started before this time
+	Limit   int
+	Offset  int
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f ConnectionSessionFilter) where() (string, []interface{}) {
+	conditions := make([]string, 0, 4)
+	args := make([]interface{}, 0, 4)
+
+	if f.Hub != "" {
+		args = append(args, f.Hub)
+		conditions = append(conditions, fmt.Sprintf("hub = $%d", len(args)))
+	}
+	if f.Station != "" {
+		args = append(args, f.Station)
+		conditions = append(conditions, fmt.Sprintf("station = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conditions = append(conditions, fmt.Sprintf("(disconnected_at IS NULL OR disconnected_at >= $%d)", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conditions = append(conditions, fmt.Sprintf("connected_at < $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListConnectionSessions retrieves sessions matching the filter, newest first, and the total count
+func (s *Storage) ListConnectionSessions(ctx context.Context, filter ConnectionSessionFilter) ([]models.ConnectionSession, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM connection_sessions"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count connection sessions: %w", err)
+	}
+
+	query := `SELECT ` + connectionSessionColumns + ` FROM connection_sessions` + where + ` ORDER BY connected_at DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	sessions, err := s.queryConnectionSessions(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sessions, total, nil
+}
+
+// ListStationSessions retrieves every session of a hub with a station that overlaps the window, oldest first
+func (s *Storage) ListStationSessions(ctx context.Context, hub string, from, to time.Time) ([]models.ConnectionSession, error) {
+	query := `SELECT ` + connectionSessionColumns + ` FROM connection_sessions
+	WHERE hub = $1 AND station <> '' AND connected_at < $3 AND (disconnected_at IS NULL OR disconnected_at > $2)
+	ORDER BY connected_at`
+
+	return s.queryConnectionSessions(ctx, query, hub, from, to)
+}
+
+// CountConnectedStations counts the open sessions of each station on a hub that were seen after the given time.
+// Sessions of every server instance are counted.
+func (s *Storage) CountConnectedStations(ctx context.Context, hub string, seenAfter time.Time) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT station, COUNT(*) FROM connection_sessions
+	WHERE hub = $1 AND station <> '' AND disconnected_at IS NULL AND COALESCE(last_seen_at, connected_at) > $2
+	GROUP BY station
+	`, hub, seenAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count connected stations: %w", err)
+	}
+	defer rows.Close()
+
+	stations := make(map[string]int)
+	for rows.Next() {
+		var station string
+		var count int
+		if err := rows.Scan(&station, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan connected station row: %w", err)
+		}
+		stations[station] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating connected station rows: %w", err)
+	}
+
+	return stations, nil
+}
+
+// queryConnectionSessions runs a query selecting connectionSessionColumns
+func (s *Storage) queryConnectionSessions(ctx context.Context, query string, args ...interface{}) ([]models.ConnectionSession, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query connection sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]models.ConnectionSession, 0)
+	for rows.Next() {
+		session, err := scanConnectionSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan connection session row: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating connection session rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteConnectionSessionsBefore removes sessions that ended before the given time
+func (s *Storage) DeleteConnectionSessionsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM connection_sessions WHERE disconnected_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete connection sessions: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
@@ -185,6 +185,18 @@ func (s *Storage) createLogsTable(ctx context.Context) error {
 	return nil
 }
 
+// SavedAlert returns an alert as GetAlertByID reads it back after CreateAlert, without the
+// fields the alerts table doesn't keep and without the status, which changes after it is stored
+func SavedAlert(alert models.Alert) models.Alert {
+	alert.Alert.CustomIdentifiers = nil
+	alert.Alert.DispatchCoords = nil
+	alert.Alert.Status = ""
+	if len(alert.Alert.PageGroups) == 0 {
+		alert.Alert.PageGroups = nil
+	}
+	return alert
+}
+
 // CreateAlert creates a new alert with the new schema
 func (s *Storage) CreateAlert(ctx context.Context, alert models.Alert) (string, error) {
 	query := `
@@ -261,6 +273,9 @@ func (s *Storage) CreateAlert(ctx context.Context, alert models.Alert) (string,
 	).Scan(&alertID)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return "", ErrConflict
+		}
 		return "", err
 	}
 
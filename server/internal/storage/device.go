@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitDeviceTables initializes the devices and device_pairings tables if they don't exist
+func (s *Storage) InitDeviceTables() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS devices (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		station TEXT NOT NULL,
+		role TEXT NOT NULL,
+		token_hash TEXT UNIQUE,
+		paired_by TEXT,
+		last_seen_at TIMESTAMP WITH TIME ZONE,
+		last_seen_ip TEXT,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS device_pairings (
+		id TEXT PRIMARY KEY,
+		code TEXT NOT NULL,
+		status TEXT NOT NULL,
+		poll_token_hash TEXT NOT NULL,
+		device_id TEXT REFERENCES devices(id) ON DELETE CASCADE,
+		remote_addr TEXT,
+		user_agent TEXT,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS device_pairings_code_idx ON device_pairings (code);
+
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS device_group TEXT NOT NULL DEFAULT '';
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create device tables: %w", err)
+	}
+
+	return nil
+}
+
+// deviceColumns is the column list shared by the device queries
+const deviceColumns = `id, name, station, role, device_group, COALESCE(token_hash, ''), COALESCE(paired_by, ''),
+	last_seen_at, COALESCE(last_seen_ip, ''), revoked_at, created_at`
+
+// scanDevice scans a row selected with deviceColumns
+func scanDevice(row interface{ Scan(...any) error }) (models.Device, error) {
+	var d models.Device
+	var lastSeenAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&d.ID, &d.Name, &d.Station, &d.Role, &d.Group, &d.TokenHash, &d.PairedBy,
+		&lastSeenAt, &d.LastSeenIP, &revokedAt, &d.CreatedAt,
+	)
+	if err != nil {
+		return models.Device{}, err
+	}
+
+	if lastSeenAt.Valid {
+		d.LastSeenAt = &lastSeenAt.Time
+	}
+	if revokedAt.Valid {
+		d.RevokedAt = &revokedAt.Time
+	}
+
+	return d, nil
+}
+
+// pairingColumns is the column list shared by the pairing queries
+const pairingColumns = `id, code, status, poll_token_hash, COALESCE(device_id, ''),
+	COALESCE(remote_addr, ''), COALESCE(user_agent, ''), expires_at, created_at`
+
+// scanPairing scans a row selected with pairingColumns
+func scanPairing(row interface{ Scan(...any) error }) (models.DevicePairing, error) {
+	var p models.DevicePairing
+	err := row.Scan(
+		&p.ID, &p.Code, &p.Status, &p.PollTokenHash, &p.DeviceID,
+		&p.RemoteAddr, &p.UserAgent, &p.ExpiresAt, &p.CreatedAt,
+	)
+	return p, err
+}
+
+// CreateDevicePairing stores a new pending pairing request
+func (s *Storage) CreateDevicePairing(ctx context.Context, pairing models.DevicePairing) (models.DevicePairing, error) {
+	if pairing.ID == "" {
+		pairing.ID = uuid.New().String()
+	}
+	pairing.Status = models.PairingStatusPending
+
+	query := `
+	INSERT INTO device_pairings (id, code, status, poll_token_hash, remote_addr, user_agent, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING created_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		pairing.ID, pairing.Code, pairing.Status, pairing.PollTokenHash, pairing.RemoteAddr, pairing.UserAgent, pairing.ExpiresAt,
+	).Scan(&pairing.CreatedAt)
+	if err != nil {
+		return models.DevicePairing{}, fmt.Errorf("failed to create device pairing: %w", err)
+	}
+
+	return pairing, nil
+}
+
+// GetDevicePairing retrieves a pairing request by ID
+func (s *Storage) GetDevicePairing(ctx context.Context, id string) (models.DevicePairing, error) {
+	query := `SELECT ` + pairingColumns + ` FROM device_pairings WHERE id = $1`
+
+	pairing, err := scanPairing(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DevicePairing{}, ErrNotFound
+		}
+		return models.DevicePairing{}, fmt.Errorf("failed to get device pairing: %w", err)
+	}
+
+	return pairing, nil
+}
+
+// GetPendingPairingByCode retrieves an unexpired pending pairing request by its code
+func (s *Storage) GetPendingPairingByCode(ctx context.Context, code string) (models.DevicePairing, error) {
+	query := `SELECT ` + pairingColumns + ` FROM device_pairings
+	WHERE code = $1 AND status = $2 AND expires_at > NOW()`
+
+	pairing, err := scanPairing(s.db.QueryRowContext(ctx, query, code, models.PairingStatusPending))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DevicePairing{}, ErrNotFound
+		}
+		return models.DevicePairing{}, fmt.Errorf("failed to get device pairing: %w", err)
+	}
+
+	return pairing, nil
+}
+
+// ListPendingPairings retrieves unexpired pairing requests awaiting approval
+func (s *Storage) ListPendingPairings(ctx context.Context) ([]models.DevicePairing, error) {
+	query := `SELECT ` + pairingColumns + ` FROM device_pairings
+	WHERE status = $1 AND expires_at > NOW()
+	ORDER BY created_at DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, models.PairingStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device pairings: %w", err)
+	}
+	defer rows.Close()
+
+	pairings := make([]models.DevicePairing, 0)
+	for rows.Next() {
+		pairing, err := scanPairing(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device pairing row: %w", err)
+		}
+		pairings = append(pairings, pairing)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device pairing rows: %w", err)
+	}
+
+	return pairings, nil
+}
+
+// ApproveDevicePairing creates the device for a pending pairing and links the two
+func (s *Storage) ApproveDevicePairing(ctx context.Context, pairingID string, device models.Device) (models.Device, error) {
+	if device.ID == "" {
+		device.ID = uuid.New().String()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO devices (id, name, station, role, device_group, paired_by)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at
+	`, device.ID, device.Name, device.Station, device.Role, device.Group, device.PairedBy).Scan(&device.CreatedAt)
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to create device: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE device_pairings SET status = $2, device_id = $3
+	WHERE id = $1 AND status = $4 AND expires_at > NOW()
+	`, pairingID, models.PairingStatusApproved, device.ID, models.PairingStatusPending)
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to approve device pairing: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return models.Device{}, ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Device{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return device, nil
+}
+
+// DeletePendingPairing removes a pairing request an admin denied, so the display can't claim it
+func (s *Storage) DeletePendingPairing(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM device_pairings WHERE id = $1 AND status = $2", id, models.PairingStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to delete device pairing: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ClaimDevicePairing sets the credential of an approved pairing's device and marks the pairing claimed
+func (s *Storage) ClaimDevicePairing(ctx context.Context, pairingID, tokenHash string) (models.Device, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var deviceID string
+	err = tx.QueryRowContext(ctx, `
+	UPDATE device_pairings SET status = $2
+	WHERE id = $1 AND status = $3
+	RETURNING device_id
+	`, pairingID, models.PairingStatusClaimed, models.PairingStatusApproved).Scan(&deviceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Device{}, ErrNotFound
+		}
+		return models.Device{}, fmt.Errorf("failed to claim device pairing: %w", err)
+	}
+
+	device, err := scanDevice(tx.QueryRowContext(ctx, `
+	UPDATE devices SET token_hash = $2
+	WHERE id = $1
+	RETURNING `+deviceColumns, deviceID, tokenHash))
+	if err != nil {
+		return models.Device{}, fmt.Errorf("failed to set device credential: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Device{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return device, nil
+}
+
+// GetDeviceByTokenHash retrieves a device by the hash of its credential
+func (s *Storage) GetDeviceByTokenHash(ctx context.Context, tokenHash string) (models.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE token_hash = $1`
+
+	device, err := scanDevice(s.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Device{}, ErrNotFound
+		}
+		return models.Device{}, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	return device, nil
+}
+
+// ListDevices retrieves all paired devices ordered by station and name
+func (s *Storage) ListDevices(ctx context.Context) ([]models.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices ORDER BY station, name`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := make([]models.Device, 0)
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device row: %w", err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device rows: %w", err)
+	}
+
+	return devices, nil
+}
+
+// UpdateDevice changes the name, station and group of a device. Nil fields are left unchanged.
+func (s *Storage) UpdateDevice(ctx context.Context, id string, name, station, group *string) (models.Device, error) {
+	query := `
+	UPDATE devices SET
+		name = COALESCE($2, name),
+		station = COALESCE($3, station),
+		device_group = COALESCE($4, device_group)
+	WHERE id = $1
+	RETURNING ` + deviceColumns
+
+	device, err := scanDevice(s.db.QueryRowContext(ctx, query, id, name, station, group))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Device{}, ErrNotFound
+		}
+		return models.Device{}, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	return device, nil
+}
+
+// RevokeDevice marks a device as revoked so its credential can no longer be used
+func (s *Storage) RevokeDevice(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE devices SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordDeviceSeen sets the last seen time and address of a device
+func (s *Storage) RecordDeviceSeen(ctx context.Context, id, ip string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE devices SET last_seen_at = NOW(), last_seen_ip = $2 WHERE id = $1", id, ip)
+	if err != nil {
+		return fmt.Errorf("failed to record device seen: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredPairings removes expired pairing requests. Approved pairings are kept until the display claims them.
+func (s *Storage) DeleteExpiredPairings(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM device_pairings WHERE expires_at <= $1 AND status <> $2", before, models.PairingStatusApproved)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired device pairings: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
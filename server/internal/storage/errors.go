@@ -1,6 +1,10 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
 
 // Common error definitions
 var (
@@ -12,4 +16,24 @@ var (
 
 	// ErrDatabaseOperation indicates a database operation failure
 	ErrDatabaseOperation = errors.New("database operation failed")
+
+	// ErrConflict indicates that a resource with the same unique key already exists
+	ErrConflict = errors.New("resource already exists")
 )
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// IsPermanentError reports whether err is a Postgres data exception or integrity violation,
+// which fails the same way however often the statement is retried
+func IsPermanentError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitIngestKeyTable initializes the ingest_keys table used to deduplicate alert ingestion
+func (s *Storage) InitIngestKeyTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS ingest_keys (
+		key TEXT PRIMARY KEY,
+		request_hash TEXT NOT NULL,
+		alert_id TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		response JSONB,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS ingest_keys_expires_at_idx ON ingest_keys (expires_at);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create ingest_keys table: %w", err)
+	}
+
+	return nil
+}
+
+// ingestKeyColumns is the column list shared by the ingest key queries
+const ingestKeyColumns = `key, request_hash, alert_id, status_code, response, created_at, expires_at`
+
+// scanIngestKey scans a row selected with ingestKeyColumns
+func scanIngestKey(row interface{ Scan(...any) error }) (models.IngestKey, error) {
+	var k models.IngestKey
+	var response []byte
+	err := row.Scan(&k.Key, &k.RequestHash, &k.AlertID, &k.StatusCode, &response, &k.CreatedAt, &k.ExpiresAt)
+	if err != nil {
+		return models.IngestKey{}, err
+	}
+
+	k.Response = response
+	return k, nil
+}
+
+// ReserveIngestKey claims a key for a new ingestion. It returns the stored key and true when
+// the key was claimed, or the unexpired key of an earlier request and false when it wasn't.
+// An expired key is claimed again, including the reservation of a request that never completed.
+func (s *Storage) ReserveIngestKey(ctx context.Context, key models.IngestKey) (models.IngestKey, bool, error) {
+	query := `
+	INSERT INTO ingest_keys (key, request_hash, alert_id, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (key) DO UPDATE SET
+		request_hash = EXCLUDED.request_hash, alert_id = EXCLUDED.alert_id, status_code = 0, response = NULL,
+		created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+	WHERE ingest_keys.expires_at <= EXCLUDED.created_at
+	RETURNING ` + ingestKeyColumns
+
+	reserved, err := scanIngestKey(s.db.QueryRowContext(ctx, query,
+		key.Key, key.RequestHash, key.AlertID, key.CreatedAt, key.ExpiresAt,
+	))
+	if err == nil {
+		return reserved, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return models.IngestKey{}, false, fmt.Errorf("failed to reserve ingest key: %w", err)
+	}
+
+	// The key is held by an unexpired earlier request
+	existing, err := scanIngestKey(s.db.QueryRowContext(ctx, `SELECT `+ingestKeyColumns+` FROM ingest_keys WHERE key = $1`, key.Key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Released between the two queries, let the caller retry
+			return models.IngestKey{}, false, ErrConflict
+		}
+		return models.IngestKey{}, false, fmt.Errorf("failed to get ingest key: %w", err)
+	}
+
+	return existing, false, nil
+}
+
+// CompleteIngestKey stores the response sent for a reserved key and keeps it until expiresAt
+func (s *Storage) CompleteIngestKey(ctx context.Context, key string, statusCode int, response []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE ingest_keys SET status_code = $2, response = $3, expires_at = $4 WHERE key = $1`,
+		key, statusCode, response, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete ingest key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIngestKey removes a reserved key whose request failed, so a retry can ingest the alert
+func (s *Storage) ReleaseIngestKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ingest_keys WHERE key = $1 AND status_code = 0`, key)
+	if err != nil {
+		return fmt.Errorf("failed to release ingest key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIngestKeys removes the keys whose dedup window ended and returns how many were removed
+func (s *Storage) DeleteExpiredIngestKeys(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM ingest_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired ingest keys: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	return int(count), nil
+}
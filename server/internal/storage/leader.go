@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// LeaderLock is a Postgres advisory lock held on a dedicated connection.
+// Postgres releases the lock when that connection closes, so it can't outlive its holder.
+type LeaderLock struct {
+	conn *sql.Conn
+	name string
+}
+
+// TryLeaderLock takes the advisory lock with the given name without waiting.
+// It returns nil when another server instance holds the lock.
+func (s *Storage) TryLeaderLock(ctx context.Context, name string) (*LeaderLock, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open leader lock connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to take leader lock %s: %w", name, err)
+	}
+
+	if !acquired {
+		if err := conn.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close leader lock connection: %w", err)
+		}
+		return nil, nil
+	}
+
+	return &LeaderLock{conn: conn, name: name}, nil
+}
+
+// Check verifies that the connection holding the lock is still open
+func (l *LeaderLock) Check(ctx context.Context) error {
+	if _, err := l.conn.ExecContext(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("leader lock %s connection failed: %w", l.name, err)
+	}
+	return nil
+}
+
+// Release unlocks the lock and closes its connection
+func (l *LeaderLock) Release(ctx context.Context) error {
+	defer l.conn.Close()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", l.name); err != nil {
+		return fmt.Errorf("failed to release leader lock %s: %w", l.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitScheduleTables initializes the scheduled_jobs and scheduled_job_runs tables if they don't exist
+func (s *Storage) InitScheduleTables() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS scheduled_jobs (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		cron TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		command TEXT NOT NULL,
+		args JSONB NOT NULL DEFAULT '{}',
+		target JSONB NOT NULL DEFAULT '{}',
+		missed_run_policy TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		next_run_at TIMESTAMP WITH TIME ZONE,
+		last_run_at TIMESTAMP WITH TIME ZONE,
+		created_by TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS scheduled_job_runs (
+		id TEXT PRIMARY KEY,
+		job_id TEXT NOT NULL REFERENCES scheduled_jobs(id) ON DELETE CASCADE,
+		scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+		started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		completed_at TIMESTAMP WITH TIME ZONE,
+		status TEXT NOT NULL,
+		manual BOOLEAN NOT NULL DEFAULT FALSE,
+		command_id TEXT,
+		targets INTEGER NOT NULL DEFAULT 0,
+		acknowledged INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		timed_out INTEGER NOT NULL DEFAULT 0,
+		error TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS scheduled_job_runs_job_idx ON scheduled_job_runs (job_id, started_at DESC);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule tables: %w", err)
+	}
+
+	return nil
+}
+
+// scheduledJobColumns is the column list shared by the scheduled job queries
+const scheduledJobColumns = `id, name, cron, timezone, command, args, target, missed_run_policy, enabled,
+	next_run_at, last_run_at, COALESCE(created_by, ''), created_at, updated_at`
+
+// scanScheduledJob scans a row selected with scheduledJobColumns
+func scanScheduledJob(row interface{ Scan(...any) error }) (models.ScheduledJob, error) {
+	var j models.ScheduledJob
+	var argsJSON, targetJSON []byte
+	var nextRunAt, lastRunAt sql.NullTime
+	err := row.Scan(
+		&j.ID, &j.Name, &j.Cron, &j.Timezone, &j.Command, &argsJSON, &targetJSON, &j.MissedRunPolicy, &j.Enabled,
+		&nextRunAt, &lastRunAt, &j.CreatedBy, &j.CreatedAt, &j.UpdatedAt,
+	)
+	if err != nil {
+		return models.ScheduledJob{}, err
+	}
+
+	if err := json.Unmarshal(argsJSON, &j.Args); err != nil {
+		return models.ScheduledJob{}, fmt.Errorf("failed to unmarshal job args: %w", err)
+	}
+	if err := json.Unmarshal(targetJSON, &j.Target); err != nil {
+		return models.ScheduledJob{}, fmt.Errorf("failed to unmarshal job target: %w", err)
+	}
+	if nextRunAt.Valid {
+		j.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		j.LastRunAt = &lastRunAt.Time
+	}
+
+	return j, nil
+}
+
+// marshalJobFields encodes the JSON columns of a scheduled job
+func marshalJobFields(job models.ScheduledJob) ([]byte, []byte, error) {
+	args := job.Args
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal job args: %w", err)
+	}
+	targetJSON, err := json.Marshal(job.Target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal job target: %w", err)
+	}
+	return argsJSON, targetJSON, nil
+}
+
+// CreateScheduledJob stores a new scheduled job
+func (s *Storage) CreateScheduledJob(ctx context.Context, job models.ScheduledJob) (models.ScheduledJob, error) {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+
+	argsJSON, targetJSON, err := marshalJobFields(job)
+	if err != nil {
+		return models.ScheduledJob{}, err
+	}
+
+	query := `
+	INSERT INTO scheduled_jobs (id, name, cron, timezone, command, args, target, missed_run_policy, enabled, next_run_at, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING ` + scheduledJobColumns
+
+	created, err := scanScheduledJob(s.db.QueryRowContext(ctx, query,
+		job.ID, job.Name, job.Cron, job.Timezone, job.Command, argsJSON, targetJSON, job.MissedRunPolicy, job.Enabled,
+		job.NextRunAt, job.CreatedBy,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.ScheduledJob{}, ErrConflict
+		}
+		return models.ScheduledJob{}, fmt.Errorf("failed to create scheduled job: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetScheduledJob retrieves a scheduled job by ID
+func (s *Storage) GetScheduledJob(ctx context.Context, id string) (models.ScheduledJob, error) {
+	query := `SELECT ` + scheduledJobColumns + ` FROM scheduled_jobs WHERE id = $1`
+
+	job, err := scanScheduledJob(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ScheduledJob{}, ErrNotFound
+		}
+		return models.ScheduledJob{}, fmt.Errorf("failed to get scheduled job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ListScheduledJobs retrieves scheduled jobs ordered by name, optionally only the enabled ones
+func (s *Storage) ListScheduledJobs(ctx context.Context, enabledOnly bool) ([]models.ScheduledJob, error) {
+	query := `SELECT ` + scheduledJobColumns + ` FROM scheduled_jobs`
+	if enabledOnly {
+		query += ` WHERE enabled`
+	}
+	query += ` ORDER BY name, created_at`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]models.ScheduledJob, 0)
+	for rows.Next() {
+		job, err := scanScheduledJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled job rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// UpdateScheduledJob replaces the definition of a scheduled job and its next run time
+func (s *Storage) UpdateScheduledJob(ctx context.Context, job models.ScheduledJob) (models.ScheduledJob, error) {
+	argsJSON, targetJSON, err := marshalJobFields(job)
+	if err != nil {
+		return models.ScheduledJob{}, err
+	}
+
+	query := `
+	UPDATE scheduled_jobs SET
+		name = $2, cron = $3, timezone = $4, command = $5, args = $6, target = $7,
+		missed_run_policy = $8, enabled = $9, next_run_at = $10, updated_at = NOW()
+	WHERE id = $1
+	RETURNING ` + scheduledJobColumns
+
+	updated, err := scanScheduledJob(s.db.QueryRowContext(ctx, query,
+		job.ID, job.Name, job.Cron, job.Timezone, job.Command, argsJSON, targetJSON, job.MissedRunPolicy, job.Enabled,
+		job.NextRunAt,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ScheduledJob{}, ErrNotFound
+		}
+		return models.ScheduledJob{}, fmt.Errorf("failed to update scheduled job: %w", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteScheduledJob removes a scheduled job and its run history
+func (s *Storage) DeleteScheduledJob(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_jobs WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled job: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetScheduledJobRunTimes records when a job last ran and when it runs next.
+// A nil lastRunAt leaves the last run time unchanged.
+func (s *Storage) SetScheduledJobRunTimes(ctx context.Context, id string, nextRunAt, lastRunAt *time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE scheduled_jobs SET next_run_at = $2, last_run_at = COALESCE($3, last_run_at)
+	WHERE id = $1
+	`, id, nextRunAt, lastRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to set scheduled job run times: %w", err)
+	}
+	return nil
+}
+
+// scheduledJobRunColumns is the column list shared by the job run queries
+const scheduledJobRunColumns = `id, job_id, scheduled_for, started_at, completed_at, status, manual,
+	COALESCE(command_id, ''), targets, acknowledged, failed, timed_out, COALESCE(error, '')`
+
+// scanScheduledJobRun scans a row selected with scheduledJobRunColumns
+func scanScheduledJobRun(row interface{ Scan(...any) error }) (models.ScheduledJobRun, error) {
+	var r models.ScheduledJobRun
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&r.ID, &r.JobID, &r.ScheduledFor, &r.StartedAt, &completedAt, &r.Status, &r.Manual,
+		&r.CommandID, &r.Targets, &r.Acknowledged, &r.Failed, &r.TimedOut, &r.Error,
+	)
+	if err != nil {
+		return models.ScheduledJobRun{}, err
+	}
+
+	if completedAt.Valid {
+		r.CompletedAt = &completedAt.Time
+	}
+
+	return r, nil
+}
+
+// CreateScheduledJobRun stores a run of a scheduled job
+func (s *Storage) CreateScheduledJobRun(ctx context.Context, run models.ScheduledJobRun) (models.ScheduledJobRun, error) {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+
+	query := `
+	INSERT INTO scheduled_job_runs (id, job_id, scheduled_for, started_at, completed_at, status, manual,
+		command_id, targets, acknowledged, failed, timed_out, error)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11, $12, NULLIF($13, ''))
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		run.ID, run.JobID, run.ScheduledFor, run.StartedAt, run.CompletedAt, run.Status, run.Manual,
+		run.CommandID, run.Targets, run.Acknowledged, run.Failed, run.TimedOut, run.Error,
+	)
+	if err != nil {
+		return models.ScheduledJobRun{}, fmt.Errorf("failed to create scheduled job run: %w", err)
+	}
+
+	return run, nil
+}
+
+// CompleteScheduledJobRun records the targets and acknowledgement counts of a run once every
+// target answered or timed out. A run without targets is completed as no_targets.
+func (s *Storage) CompleteScheduledJobRun(ctx context.Context, id string, targets, acknowledged, failed, timedOut int) error {
+	status := models.JobRunStatusCompleted
+	if targets == 0 {
+		status = models.JobRunStatusNoTargets
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE scheduled_job_runs
+	SET status = $2, completed_at = NOW(), targets = $3, acknowledged = $4, failed = $5, timed_out = $6
+	WHERE id = $1
+	`, id, status, targets, acknowledged, failed, timedOut)
+	if err != nil {
+		return fmt.Errorf("failed to complete scheduled job run: %w", err)
+	}
+	return nil
+}
+
+// ListScheduledJobRuns retrieves the newest runs of a scheduled job
+func (s *Storage) ListScheduledJobRuns(ctx context.Context, jobID string, limit int) ([]models.ScheduledJobRun, error) {
+	query := `SELECT ` + scheduledJobRunColumns + ` FROM scheduled_job_runs
+	WHERE job_id = $1
+	ORDER BY started_at DESC
+	LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, query, jobID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled job runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]models.ScheduledJobRun, 0)
+	for rows.Next() {
+		run, err := scanScheduledJobRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled job run row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled job run rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+// DeleteScheduledJobRunsBefore removes job runs started before the given time
+func (s *Storage) DeleteScheduledJobRunsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_job_runs WHERE started_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete scheduled job runs: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitUserTables initializes the users and sessions tables if they don't exist
+func (s *Storage) InitUserTables() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL,
+		disabled BOOLEAN NOT NULL DEFAULT FALSE,
+		last_login_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		remote_addr TEXT,
+		user_agent TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+	CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create user tables: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUser stores a new user
+func (s *Storage) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	query := `
+	INSERT INTO users (id, username, password_hash, role, disabled)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at, updated_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		user.ID, user.Username, user.PasswordHash, user.Role, user.Disabled,
+	).Scan(&user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.User{}, ErrConflict
+		}
+		return models.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByID retrieves a single user by ID
+func (s *Storage) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	return s.getUser(ctx, "id", id)
+}
+
+// GetUserByUsername retrieves a single user by username
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	return s.getUser(ctx, "username", username)
+}
+
+// getUser retrieves a single user by the given column
+func (s *Storage) getUser(ctx context.Context, column, value string) (models.User, error) {
+	query := `
+	SELECT id, username, password_hash, role, disabled, last_login_at, created_at, updated_at
+	FROM users
+	WHERE ` + column + ` = $1
+	`
+
+	var u models.User
+	var lastLogin sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, value).Scan(
+		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &lastLogin, &u.CreatedAt, &u.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+
+	return u, nil
+}
+
+// ListUsers retrieves all users ordered by username
+func (s *Storage) ListUsers(ctx context.Context) ([]models.User, error) {
+	query := `
+	SELECT id, username, password_hash, role, disabled, last_login_at, created_at, updated_at
+	FROM users
+	ORDER BY username
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var u models.User
+		var lastLogin sql.NullTime
+		if err := rows.Scan(
+			&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &lastLogin, &u.CreatedAt, &u.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		if lastLogin.Valid {
+			u.LastLoginAt = &lastLogin.Time
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpdateUser updates the role, password hash and disabled flag of a user
+func (s *Storage) UpdateUser(ctx context.Context, user models.User) error {
+	query := `
+	UPDATE users
+	SET role = $2, password_hash = $3, disabled = $4, updated_at = NOW()
+	WHERE id = $1
+	`
+
+	result, err := s.db.ExecContext(ctx, query, user.ID, user.Role, user.PasswordHash, user.Disabled)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser deletes a user and, through the foreign key, all of its sessions
+func (s *Storage) DeleteUser(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CountUsers returns the total number of users
+func (s *Storage) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// RecordUserLogin sets the last login time of a user to now
+func (s *Storage) RecordUserLogin(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET last_login_at = NOW() WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to record user login: %w", err)
+	}
+	return nil
+}
+
+// CreateSession stores a new session
+func (s *Storage) CreateSession(ctx context.Context, session models.Session) (models.Session, error) {
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+	}
+
+	query := `
+	INSERT INTO sessions (id, token_hash, user_id, remote_addr, user_agent, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		session.ID, session.TokenHash, session.UserID, session.RemoteAddr, session.UserAgent, session.ExpiresAt,
+	).Scan(&session.CreatedAt)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session and its user by token hash
+func (s *Storage) GetSessionByTokenHash(ctx context.Context, tokenHash string) (models.Session, models.User, error) {
+	query := `
+	SELECT
+		s.id, s.token_hash, s.user_id, COALESCE(s.remote_addr, ''), COALESCE(s.user_agent, ''), s.created_at, s.expires_at,
+		u.id, u.username, u.password_hash, u.role, u.disabled, u.last_login_at, u.created_at, u.updated_at
+	FROM sessions s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.token_hash = $1 AND s.expires_at > NOW()
+	`
+
+	var session models.Session
+	var u models.User
+	var lastLogin sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&session.ID, &session.TokenHash, &session.UserID, &session.RemoteAddr, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt,
+		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &lastLogin, &u.CreatedAt, &u.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Session{}, models.User{}, ErrNotFound
+		}
+		return models.Session{}, models.User{}, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+
+	return session, u, nil
+}
+
+// DeleteSession deletes a single session by ID
+func (s *Storage) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions deletes all sessions of a user and returns their IDs
+func (s *Storage) DeleteUserSessions(ctx context.Context, userID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "DELETE FROM sessions WHERE user_id = $1 RETURNING id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// DeleteExpiredSessions removes sessions that expired before the given time
+func (s *Storage) DeleteExpiredSessions(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitWebhookTables initializes the webhook_subscriptions and webhook_deliveries tables if they don't exist
+func (s *Storage) InitWebhookTables() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		event_types TEXT[] NOT NULL DEFAULT '{}',
+		page_groups TEXT[] NOT NULL DEFAULT '{}',
+		call_types TEXT[] NOT NULL DEFAULT '{}',
+		redaction TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_by TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		subscription_id TEXT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		event_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		alert_id TEXT,
+		payload JSONB NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP WITH TIME ZONE,
+		last_attempt_at TIMESTAMP WITH TIME ZONE,
+		response_status INTEGER,
+		error TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		delivered_at TIMESTAMP WITH TIME ZONE
+	);
+
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_alert_idx ON webhook_deliveries (alert_id);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook tables: %w", err)
+	}
+
+	return nil
+}
+
+// webhookSubscriptionColumns is the column list shared by the webhook subscription queries
+const webhookSubscriptionColumns = `id, name, url, secret, event_types, page_groups, call_types, redaction, enabled,
+	COALESCE(created_by, ''), created_at, updated_at`
+
+// scanWebhookSubscription scans a row selected with webhookSubscriptionColumns
+func scanWebhookSubscription(row interface{ Scan(...any) error }) (models.WebhookSubscription, error) {
+	var w models.WebhookSubscription
+	err := row.Scan(
+		&w.ID, &w.Name, &w.URL, &w.Secret, pq.Array(&w.EventTypes), pq.Array(&w.PageGroups), pq.Array(&w.CallTypes),
+		&w.Redaction, &w.Enabled, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt,
+	)
+	return w, err
+}
+
+// textArray returns a string slice for a NOT NULL array column
+func textArray(values []string) interface{} {
+	if values == nil {
+		values = []string{}
+	}
+	return pq.Array(values)
+}
+
+// CreateWebhookSubscription stores a new webhook subscription
+func (s *Storage) CreateWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	if sub.ID == "" {
+		sub.ID = uuid.New().String()
+	}
+
+	query := `
+	INSERT INTO webhook_subscriptions (id, name, url, secret, event_types, page_groups, call_types, redaction, enabled, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING ` + webhookSubscriptionColumns
+
+	created, err := scanWebhookSubscription(s.db.QueryRowContext(ctx, query,
+		sub.ID, sub.Name, sub.URL, sub.Secret, textArray(sub.EventTypes), textArray(sub.PageGroups), textArray(sub.CallTypes),
+		sub.Redaction, sub.Enabled, sub.CreatedBy,
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.WebhookSubscription{}, ErrConflict
+		}
+		return models.WebhookSubscription{}, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetWebhookSubscription retrieves a webhook subscription by ID
+func (s *Storage) GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+
+	sub, err := scanWebhookSubscription(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookSubscription{}, ErrNotFound
+		}
+		return models.WebhookSubscription{}, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// ListWebhookSubscriptions retrieves webhook subscriptions ordered by name, optionally only the enabled ones
+func (s *Storage) ListWebhookSubscriptions(ctx context.Context, enabledOnly bool) ([]models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions`
+	if enabledOnly {
+		query += ` WHERE enabled`
+	}
+	query += ` ORDER BY name, created_at`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]models.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription row: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook subscription rows: %w", err)
+	}
+
+	return subs, nil
+}
+
+// UpdateWebhookSubscription replaces the definition of a webhook subscription. The secret is left unchanged.
+func (s *Storage) UpdateWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	query := `
+	UPDATE webhook_subscriptions SET
+		name = $2, url = $3, event_types = $4, page_groups = $5, call_types = $6, redaction = $7, enabled = $8,
+		updated_at = NOW()
+	WHERE id = $1
+	RETURNING ` + webhookSubscriptionColumns
+
+	updated, err := scanWebhookSubscription(s.db.QueryRowContext(ctx, query,
+		sub.ID, sub.Name, sub.URL, textArray(sub.EventTypes), textArray(sub.PageGroups), textArray(sub.CallTypes),
+		sub.Redaction, sub.Enabled,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookSubscription{}, ErrNotFound
+		}
+		return models.WebhookSubscription{}, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteWebhookSubscription removes a webhook subscription and its deliveries
+func (s *Storage) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// webhookDeliveryColumns is the column list shared by the webhook delivery queries
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, COALESCE(alert_id, ''), payload, status, attempts,
+	next_attempt_at, last_attempt_at, COALESCE(response_status, 0), COALESCE(error, ''), created_at, delivered_at`
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var nextAttemptAt, lastAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(
+		&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.AlertID, &d.Payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastAttemptAt, &d.ResponseStatus, &d.Error, &d.CreatedAt, &deliveredAt,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastAttemptAt.Valid {
+		d.LastAttemptAt = &lastAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return d, nil
+}
+
+// CreateWebhookDeliveries queues deliveries in a single transaction
+func (s *Storage) CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, alert_id, payload, status, next_attempt_at)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare webhook delivery insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, d := range deliveries {
+		if d.ID == "" {
+			d.ID = uuid.New().String()
+		}
+		_, err := stmt.ExecContext(ctx, d.ID, d.SubscriptionID, d.EventID, d.EventType, d.AlertID, []byte(d.Payload), d.Status, d.NextAttemptAt)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due and pushes their
+// next attempt back by lease, so other server instances skip them while they are being sent
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries SET next_attempt_at = $2
+	WHERE id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + webhookDeliveryColumns
+
+	rows, err := s.db.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt
+func (s *Storage) RecordWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	_, err := s.db.ExecContext(ctx, `
+	UPDATE webhook_deliveries SET
+		status = $2, attempts = $3, next_attempt_at = $4, last_attempt_at = $5,
+		response_status = NULLIF($6, 0), error = NULLIF($7, ''), delivered_at = $8
+	WHERE id = $1
+	`, d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.LastAttemptAt, d.ResponseStatus, d.Error, d.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID
+func (s *Storage) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	d, err := scanWebhookDelivery(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookDelivery{}, ErrNotFound
+		}
+		return models.WebhookDelivery{}, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+
+	return d, nil
+}
+
+// ListWebhookDeliveries retrieves the newest deliveries, optionally of one subscription and with one status
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+	WHERE ($1 = '' OR subscription_id = $1) AND ($2 = '' OR status = $2)
+	ORDER BY created_at DESC
+	LIMIT $3`
+
+	rows, err := s.db.QueryContext(ctx, query, subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// collectWebhookDeliveries scans and closes rows selected with webhookDeliveryColumns
+func collectWebhookDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery queues a delivery again with a fresh set of attempts
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, id string, now time.Time) (models.WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $2, delivered_at = NULL
+	WHERE id = $1
+	RETURNING ` + webhookDeliveryColumns
+
+	d, err := scanWebhookDelivery(s.db.QueryRowContext(ctx, query, id, now))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebhookDelivery{}, ErrNotFound
+		}
+		return models.WebhookDelivery{}, fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+
+	return d, nil
+}
+
+// WebhookAlertDelivered reports whether an alert was queued for a subscription
+func (s *Storage) WebhookAlertDelivered(ctx context.Context, subscriptionID, alertID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE subscription_id = $1 AND alert_id = $2 AND event_type = 'new_alert')
+	`, subscriptionID, alertID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up webhook alert delivery: %w", err)
+	}
+	return exists, nil
+}
+
+// DeleteWebhookDeliveriesBefore removes delivered and dead deliveries created before the given time
+func (s *Storage) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return int(count), nil
+}
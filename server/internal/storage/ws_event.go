@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitWebSocketEventTable initializes the ws_events table used to replay missed events
+func (s *Storage) InitWebSocketEventTable() error {
+	// Events stored before instances were recorded can't be attributed to one, so that table is replaced
+	migrateSQL := `
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'ws_events')
+			AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ws_events' AND column_name = 'instance') THEN
+			DROP TABLE ws_events;
+		END IF;
+	END $$;
+	`
+
+	if _, err := s.db.ExecContext(context.Background(), migrateSQL); err != nil {
+		return fmt.Errorf("failed to migrate ws_events table: %w", err)
+	}
+
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS ws_events (
+		hub TEXT NOT NULL,
+		instance TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		content JSONB,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		PRIMARY KEY (hub, instance, seq)
+	);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create ws_events table: %w", err)
+	}
+
+	return nil
+}
+
+// SaveWebSocketEvent stores a broadcast event with its sequence number.
+// Each server instance numbers events on its own, so rows are keyed by the instance that numbered them.
+func (s *Storage) SaveWebSocketEvent(ctx context.Context, hub string, message models.WebSocketMessage) error {
+	contentJSON, err := json.Marshal(message.Content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event content: %w", err)
+	}
+
+	query := `
+	INSERT INTO ws_events (hub, instance, seq, id, event_type, content, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (hub, instance, seq) DO UPDATE
+	SET id = $4, event_type = $5, content = $6, created_at = $7
+	`
+
+	_, err = s.db.ExecContext(ctx, query, hub, message.Instance, message.Seq, message.ID, message.Type, contentJSON, message.Time)
+	if err != nil {
+		return fmt.Errorf("failed to save websocket event: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecentWebSocketEvents retrieves the newest events a server instance numbered on a hub, in sequence order.
+// Content is returned as raw JSON.
+func (s *Storage) GetRecentWebSocketEvents(ctx context.Context, hub, instance string, limit int) ([]models.WebSocketMessage, error) {
+	query := `
+	SELECT seq, id, event_type, content, created_at FROM (
+		SELECT seq, id, event_type, content, created_at
+		FROM ws_events
+		WHERE hub = $1 AND instance = $2
+		ORDER BY seq DESC
+		LIMIT $3
+	) recent
+	ORDER BY seq ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, hub, instance, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query websocket events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.WebSocketMessage, 0)
+	for rows.Next() {
+		event := models.WebSocketMessage{Instance: instance}
+		var content []byte
+		if err := rows.Scan(&event.Seq, &event.ID, &event.Type, &content, &event.Time); err != nil {
+			return nil, fmt.Errorf("failed to scan websocket event row: %w", err)
+		}
+		event.Content = json.RawMessage(content)
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating websocket event rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// DeleteWebSocketEventsBefore removes events a server instance numbered on a hub before the given sequence number
+func (s *Storage) DeleteWebSocketEventsBefore(ctx context.Context, hub, instance string, seq int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM ws_events WHERE hub = $1 AND instance = $2 AND seq < $3", hub, instance, seq)
+	if err != nil {
+		return fmt.Errorf("failed to delete websocket events: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebSocketEventsOlderThan removes the events of every instance stored before the given time,
+// so instances that were retired don't leave their events behind
+func (s *Storage) DeleteWebSocketEventsOlderThan(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM ws_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old websocket events: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+	return int(count), nil
+}
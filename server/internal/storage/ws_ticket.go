@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// InitWebSocketTicketTable initializes the ws_tickets table if it doesn't exist
+func (s *Storage) InitWebSocketTicketTable() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS ws_tickets (
+		token_hash TEXT PRIMARY KEY,
+		hub TEXT NOT NULL,
+		station TEXT NOT NULL,
+		auth_info JSONB NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS ws_tickets_expires_at_idx ON ws_tickets (expires_at);
+	`
+
+	_, err := s.db.ExecContext(context.Background(), createTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create ws_tickets table: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWebSocketTicket stores an issued websocket ticket
+func (s *Storage) CreateWebSocketTicket(ctx context.Context, ticket models.WebSocketTicket) error {
+	query := `
+	INSERT INTO ws_tickets (token_hash, hub, station, auth_info, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, ticket.TokenHash, ticket.Hub, ticket.Station, []byte(ticket.AuthInfo), ticket.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create websocket ticket: %w", err)
+	}
+	return nil
+}
+
+// RedeemWebSocketTicket deletes a ticket and returns it, so it can only be redeemed once
+// even when several instances try at the same time. It returns ErrNotFound for an unknown ticket.
+func (s *Storage) RedeemWebSocketTicket(ctx context.Context, tokenHash string) (models.WebSocketTicket, error) {
+	query := `
+	DELETE FROM ws_tickets
+	WHERE token_hash = $1
+	RETURNING token_hash, hub, station, auth_info, expires_at
+	`
+
+	var ticket models.WebSocketTicket
+	var authInfo []byte
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&ticket.TokenHash, &ticket.Hub, &ticket.Station, &authInfo, &ticket.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.WebSocketTicket{}, ErrNotFound
+		}
+		return models.WebSocketTicket{}, fmt.Errorf("failed to redeem websocket ticket: %w", err)
+	}
+	ticket.AuthInfo = authInfo
+
+	return ticket, nil
+}
+
+// DeleteExpiredWebSocketTickets removes the tickets that expired before they were redeemed
+func (s *Storage) DeleteExpiredWebSocketTickets(ctx context.Context, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM ws_tickets WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("failed to delete expired websocket tickets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package uptime
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// ReconnectTolerance is the shortest gap between a station's connections that counts as dark.
+// Shorter gaps are displays reconnecting and count as connected.
+const ReconnectTolerance = time.Minute
+
+// interval is a span of time a station had a display connected
+type interval struct {
+	start, end time.Time
+}
+
+// Compute reports how long each station had at least one display connected between from and to.
+// Stations lists the stations expected to have a display; stations seen in the sessions are added.
+// Open sessions count as connected until now, and the window ends at now if that is earlier than to.
+func Compute(hub string, sessions []models.ConnectionSession, stations []string, from, to, now time.Time) models.UptimeReport {
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	byStation := make(map[string][]interval)
+	for _, station := range stations {
+		byStation[station] = nil
+	}
+
+	for _, session := range sessions {
+		if session.Station == "" {
+			continue
+		}
+		// Stations seen in the window are reported even if their connections were too short to count
+		intervals := byStation[session.Station]
+
+		sessionEnd := end
+		if session.DisconnectedAt != nil && session.DisconnectedAt.Before(sessionEnd) {
+			sessionEnd = *session.DisconnectedAt
+		}
+		sessionStart := session.ConnectedAt
+		if sessionStart.Before(from) {
+			sessionStart = from
+		}
+		if sessionEnd.After(sessionStart) {
+			intervals = append(intervals, interval{start: sessionStart, end: sessionEnd})
+		}
+		byStation[session.Station] = intervals
+	}
+
+	names := make([]string, 0, len(byStation))
+	for station := range byStation {
+		names = append(names, station)
+	}
+	sort.Strings(names)
+
+	report := models.UptimeReport{
+		Hub:      hub,
+		From:     from,
+		To:       to,
+		Stations: make([]models.StationUptime, 0, len(names)),
+	}
+	for _, station := range names {
+		report.Stations = append(report.Stations, stationUptime(station, byStation[station], from, end, end.Equal(now)))
+	}
+
+	return report
+}
+
+// stationUptime finds the dark periods of one station between from and end
+func stationUptime(station string, intervals []interval, from, end time.Time, endIsNow bool) models.StationUptime {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start.Before(intervals[j].start)
+	})
+
+	result := models.StationUptime{
+		Station:     station,
+		DarkPeriods: make([]models.DarkPeriod, 0),
+	}
+
+	addGap := func(start, stop time.Time) {
+		if stop.Sub(start) < ReconnectTolerance {
+			return
+		}
+		period := models.DarkPeriod{
+			Start:           start,
+			End:             stop,
+			DurationSeconds: int64(stop.Sub(start).Seconds()),
+			Ongoing:         endIsNow && stop.Equal(end),
+		}
+		result.DarkPeriods = append(result.DarkPeriods, period)
+		result.DarkSeconds += period.DurationSeconds
+		if period.DurationSeconds > result.LongestDarkSeconds {
+			result.LongestDarkSeconds = period.DurationSeconds
+		}
+	}
+
+	// Walk the connections in start order, tracking how far the coverage reaches
+	covered := from
+	for _, iv := range intervals {
+		if iv.start.After(covered) {
+			addGap(covered, iv.start)
+		}
+		if iv.end.After(covered) {
+			covered = iv.end
+		}
+	}
+	if end.After(covered) {
+		addGap(covered, end)
+	}
+
+	window := int64(end.Sub(from).Seconds())
+	if window > 0 {
+		result.ConnectedSeconds = window - result.DarkSeconds
+		result.UptimePercent = math.Round(float64(result.ConnectedSeconds)/float64(window)*10000) / 100
+	}
+
+	return result
+}
+
+// WriteCSV writes a report with one row per station. The dark periods of a station
+// are listed in the last column as start/end pairs separated by semicolons.
+func WriteCSV(w io.Writer, report models.UptimeReport) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"station", "uptime_percent", "connected_seconds", "dark_seconds", "longest_dark_seconds", "dark_periods", "dark_period_details"}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	location := report.From.Location()
+	for _, station := range report.Stations {
+		details := make([]string, 0, len(station.DarkPeriods))
+		for _, period := range station.DarkPeriods {
+			details = append(details, period.Start.In(location).Format(time.RFC3339)+"/"+period.End.In(location).Format(time.RFC3339))
+		}
+
+		row := []string{
+			station.Station,
+			strconv.FormatFloat(station.UptimePercent, 'f', 2, 64),
+			strconv.FormatInt(station.ConnectedSeconds, 10),
+			strconv.FormatInt(station.DarkSeconds, 10),
+			strconv.FormatInt(station.LongestDarkSeconds, 10),
+			strconv.Itoa(len(station.DarkPeriods)),
+			strings.Join(details, "; "),
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
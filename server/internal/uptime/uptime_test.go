@@ -0,0 +1,108 @@
+package uptime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// session builds a connection session of a station; a zero end leaves it open
+func session(station string, start, end time.Time) models.ConnectionSession {
+	s := models.ConnectionSession{Station: station, ConnectedAt: start}
+	if !end.IsZero() {
+		s.DisconnectedAt = &end
+	}
+	return s
+}
+
+func TestCompute(t *testing.T) {
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	now := to.Add(time.Hour)
+	at := func(hour, minute int) time.Time {
+		return from.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	sessions := []models.ConnectionSession{
+		// Station 1 starts before the window, reconnects briefly and goes dark from 02:00 to 04:00
+		session("1", from.Add(-time.Hour), at(1, 0)),
+		session("1", at(1, 0).Add(10*time.Second), at(2, 0)),
+		session("1", at(4, 0), time.Time{}),
+		// Two displays at station 2 overlap so it is never dark
+		session("2", from, at(12, 0)),
+		session("2", at(11, 0), to.Add(time.Hour)),
+	}
+
+	report := Compute("dashboard", sessions, []string{"3"}, from, to, now)
+
+	if len(report.Stations) != 3 {
+		t.Fatalf("Expected 3 stations, got %d", len(report.Stations))
+	}
+
+	one := report.Stations[0]
+	if one.Station != "1" || len(one.DarkPeriods) != 1 {
+		t.Fatalf("Expected one dark period for station 1, got %+v", one)
+	}
+	if one.DarkSeconds != 2*3600 || !one.DarkPeriods[0].Start.Equal(at(2, 0)) {
+		t.Errorf("Unexpected dark period for station 1: %+v", one.DarkPeriods[0])
+	}
+	if one.UptimePercent != 91.67 {
+		t.Errorf("Expected 91.67%% uptime for station 1, got %v", one.UptimePercent)
+	}
+
+	two := report.Stations[1]
+	if two.UptimePercent != 100 || len(two.DarkPeriods) != 0 {
+		t.Errorf("Expected station 2 to be fully up, got %+v", two)
+	}
+
+	// Expected stations without any connection are dark for the whole window
+	three := report.Stations[2]
+	if three.UptimePercent != 0 || three.DarkSeconds != 24*3600 || three.LongestDarkSeconds != 24*3600 {
+		t.Errorf("Expected station 3 to be dark all day, got %+v", three)
+	}
+	if three.DarkPeriods[0].Ongoing {
+		t.Error("A dark period ending with a past window is not ongoing")
+	}
+}
+
+func TestComputeWindowEndsNow(t *testing.T) {
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+	now := from.Add(10 * time.Hour)
+
+	sessions := []models.ConnectionSession{
+		session("7", from, from.Add(8*time.Hour)),
+	}
+
+	report := Compute("dashboard", sessions, nil, from, to, now)
+	station := report.Stations[0]
+
+	if station.ConnectedSeconds != 8*3600 || station.DarkSeconds != 2*3600 {
+		t.Errorf("Expected 8h connected and 2h dark, got %+v", station)
+	}
+	if !station.DarkPeriods[0].Ongoing {
+		t.Error("Expected the dark period to be ongoing")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	report := Compute("dashboard", nil, []string{"5"}, from, to, to)
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, report); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a header and one row, got %q", buf.String())
+	}
+	if expected := "5,0.00,0,3600,3600,1,2026-10-05T00:00:00Z/2026-10-05T01:00:00Z"; lines[1] != expected {
+		t.Errorf("Expected row %q, got %q", expected, lines[1])
+	}
+}
@@ -0,0 +1,233 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// checkInterval is how often the watchdog looks at the connected displays
+const checkInterval = 15 * time.Second
+
+// Event types sent to admin clients
+const (
+	EventDisplayOffline   = "display_offline"
+	EventDisplayRecovered = "display_recovered"
+)
+
+// StationSource reports how many displays of each station are connected.
+// A nil map means the displays couldn't be counted.
+type StationSource interface {
+	ConnectedStations() map[string]int
+}
+
+// Leader reports whether this server instance reports outages
+type Leader interface {
+	IsLeader() bool
+}
+
+// Notifier raises and clears operational warnings
+type Notifier interface {
+	NotifyWarning(message string, context string)
+	NotifyRecovery(message string, context string)
+}
+
+// EventSender posts a watchdog event to admin clients
+type EventSender func(eventType string, content any)
+
+// stationState is what the watchdog knows about one station
+type stationState struct {
+	lastSeen time.Time // Last check at which a display was connected, or when watching started
+	offline  bool      // Offline and not yet recovered, only the leader reports it
+}
+
+// Watchdog reports stations whose dashboard displays have all been disconnected for longer than a grace period
+type Watchdog struct {
+	stations    map[string]*stationState
+	gracePeriod time.Duration
+	source      StationSource
+	notifier    Notifier
+	send        EventSender
+	leader      Leader // nil when this is the only instance
+	logger      *logging.Logger
+	shutdownCh  chan struct{}
+	done        chan struct{}
+}
+
+// New creates a watchdog for the configured stations. Every station is given the
+// grace period from now to connect, so a server restart doesn't report every display.
+func New(cfg config.WatchdogConfig, source StationSource, notifier Notifier, send EventSender, logger *logging.Logger, now time.Time) *Watchdog {
+	stations := make(map[string]*stationState)
+	for _, station := range cfg.Stations {
+		if station = strings.TrimSpace(station); station != "" {
+			stations[station] = &stationState{lastSeen: now}
+		}
+	}
+
+	return &Watchdog{
+		stations:    stations,
+		gracePeriod: cfg.GracePeriod,
+		source:      source,
+		notifier:    notifier,
+		send:        send,
+		logger:      logger,
+		shutdownCh:  make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Enabled reports whether any station is watched
+func (w *Watchdog) Enabled() bool {
+	return len(w.stations) > 0
+}
+
+// SetLeader makes the watchdog report outages only while this instance is the leader.
+// Other instances keep following the stations, so a new leader knows which are already offline.
+func (w *Watchdog) SetLeader(leader Leader) {
+	w.leader = leader
+}
+
+// Start checks the watched stations until Stop is called
+func (w *Watchdog) Start() {
+	w.logger.Infof("Starting display watchdog for stations %s with a grace period of %s",
+		strings.Join(w.stationNames(), ", "), w.gracePeriod)
+
+	ticker := time.NewTicker(checkInterval)
+
+	go func() {
+		defer close(w.done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.check(time.Now())
+			case <-w.shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the watchdog
+func (w *Watchdog) Stop() {
+	close(w.shutdownCh)
+	<-w.done
+}
+
+// check reports stations that went offline or recovered since the last check
+func (w *Watchdog) check(now time.Time) {
+	connected := w.source.ConnectedStations()
+	if connected == nil {
+		return
+	}
+
+	for _, station := range w.stationNames() {
+		state := w.stations[station]
+
+		if connected[station] > 0 {
+			if state.offline {
+				w.recovered(station, state, now)
+			}
+			state.lastSeen = now
+			continue
+		}
+
+		if !state.offline && now.Sub(state.lastSeen) >= w.gracePeriod {
+			w.wentOffline(station, state, now)
+		}
+	}
+}
+
+// leading reports whether this instance reports outages
+func (w *Watchdog) leading() bool {
+	return w.leader == nil || w.leader.IsLeader()
+}
+
+// wentOffline raises the warning for a station without a display
+func (w *Watchdog) wentOffline(station string, state *stationState, now time.Time) {
+	state.offline = true
+	offline := now.Sub(state.lastSeen)
+	if !w.leading() {
+		return
+	}
+
+	w.logger.Warnf("Station %s has had no dashboard display connected for %s", station, offline.Round(time.Second))
+	w.notifier.NotifyWarning(
+		fmt.Sprintf("Station %s has had no dashboard display connected since %s", station, state.lastSeen.Format(time.RFC3339)),
+		"Display offline")
+	w.send(EventDisplayOffline, models.DisplayOutage{
+		Station:         station,
+		OfflineSince:    state.lastSeen,
+		DurationSeconds: int64(offline.Seconds()),
+	})
+}
+
+// recovered clears the warning of a station whose display reconnected
+func (w *Watchdog) recovered(station string, state *stationState, now time.Time) {
+	state.offline = false
+	offline := now.Sub(state.lastSeen)
+	if !w.leading() {
+		return
+	}
+
+	w.logger.Infof("Station %s dashboard display reconnected after %s", station, offline.Round(time.Second))
+	w.notifier.NotifyRecovery(
+		fmt.Sprintf("Station %s dashboard display reconnected after being offline for %s", station, offline.Round(time.Second)),
+		"Display offline")
+	w.send(EventDisplayRecovered, models.DisplayOutage{
+		Station:         station,
+		OfflineSince:    state.lastSeen,
+		RecoveredAt:     &now,
+		DurationSeconds: int64(offline.Seconds()),
+	})
+}
+
+// stationNames returns the watched stations in order
+func (w *Watchdog) stationNames() []string {
+	names := make([]string, 0, len(w.stations))
+	for station := range w.stations {
+		names = append(names, station)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sessionStaleAfter is how long an open session may go unseen before its display isn't counted
+const sessionStaleAfter = 3 * time.Minute
+
+// SessionStore counts the displays connected to every server instance from their connection sessions
+type SessionStore interface {
+	CountConnectedStations(ctx context.Context, hub string, seenAfter time.Time) (map[string]int, error)
+}
+
+// SessionSource reports the dashboard displays connected to any server instance. Open sessions
+// are marked as seen every minute, so sessions unseen for sessionStaleAfter are left out.
+type SessionSource struct {
+	store  SessionStore
+	logger *logging.Logger
+}
+
+// NewSessionSource creates a station source for watchdogs that run with several server instances
+func NewSessionSource(store SessionStore, logger *logging.Logger) *SessionSource {
+	return &SessionSource{store: store, logger: logger}
+}
+
+// ConnectedStations counts the connected displays of each station, or returns nil when they can't be counted
+func (s *SessionSource) ConnectedStations() map[string]int {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stations, err := s.store.CountConnectedStations(ctx, "dashboard", time.Now().Add(-sessionStaleAfter))
+	if err != nil {
+		s.logger.Error(err, "Failed to count connected displays")
+		return nil
+	}
+	return stations
+}
@@ -0,0 +1,135 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// fakeStations reports a fixed set of connected stations
+type fakeStations map[string]int
+
+func (f fakeStations) ConnectedStations() map[string]int {
+	return f
+}
+
+// recorder collects notifications and events
+type recorder struct {
+	warnings   []string
+	recoveries []string
+	events     []string
+	outages    []models.DisplayOutage
+}
+
+func (r *recorder) NotifyWarning(message string, context string) {
+	r.warnings = append(r.warnings, message)
+}
+
+func (r *recorder) NotifyRecovery(message string, context string) {
+	r.recoveries = append(r.recoveries, message)
+}
+
+func (r *recorder) send(eventType string, content any) {
+	r.events = append(r.events, eventType)
+	r.outages = append(r.outages, content.(models.DisplayOutage))
+}
+
+// fakeLeader reports a leadership that the test can change
+type fakeLeader struct {
+	leader bool
+}
+
+func (f *fakeLeader) IsLeader() bool {
+	return f.leader
+}
+
+func TestWatchdog(t *testing.T) {
+	start := time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)
+	stations := fakeStations{"1": 1}
+	rec := &recorder{}
+	cfg := config.WatchdogConfig{Stations: []string{"1", " 3 "}, GracePeriod: 5 * time.Minute}
+	w := New(cfg, stations, rec, rec.send, logging.New("error", "watchdog_test"), start)
+
+	// Station 3 is given the grace period to connect after startup
+	w.check(start.Add(4 * time.Minute))
+	if len(rec.events) != 0 {
+		t.Fatalf("Expected no events within the grace period, got %v", rec.events)
+	}
+
+	w.check(start.Add(5 * time.Minute))
+	if len(rec.events) != 1 || rec.events[0] != EventDisplayOffline || rec.outages[0].Station != "3" {
+		t.Fatalf("Expected station 3 to be reported offline, got %v %+v", rec.events, rec.outages)
+	}
+	if len(rec.warnings) != 1 {
+		t.Errorf("Expected one warning, got %d", len(rec.warnings))
+	}
+
+	// An offline station is only reported once
+	w.check(start.Add(10 * time.Minute))
+	if len(rec.events) != 1 {
+		t.Fatalf("Expected station 3 to be reported once, got %v", rec.events)
+	}
+
+	// Station 1 loses its display and station 3 reconnects
+	delete(stations, "1")
+	stations["3"] = 2
+	w.check(start.Add(11 * time.Minute))
+	if len(rec.events) != 2 || rec.events[1] != EventDisplayRecovered {
+		t.Fatalf("Expected station 3 to recover, got %v", rec.events)
+	}
+	recovery := rec.outages[1]
+	if recovery.Station != "3" || recovery.RecoveredAt == nil || recovery.DurationSeconds != 11*60 {
+		t.Errorf("Unexpected recovery event: %+v", recovery)
+	}
+	if len(rec.recoveries) != 1 {
+		t.Errorf("Expected one recovery notification, got %d", len(rec.recoveries))
+	}
+
+	// Station 1 was last seen at the previous check
+	w.check(start.Add(14 * time.Minute))
+	if len(rec.events) != 2 {
+		t.Fatalf("Expected station 1 to be within its grace period, got %v", rec.events)
+	}
+	w.check(start.Add(15 * time.Minute))
+	if len(rec.events) != 3 || rec.outages[2].Station != "1" || !rec.outages[2].OfflineSince.Equal(start.Add(10*time.Minute)) {
+		t.Fatalf("Expected station 1 to be reported offline since its last check, got %v %+v", rec.events, rec.outages)
+	}
+}
+
+func TestWatchdogLeader(t *testing.T) {
+	start := time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)
+	stations := fakeStations{}
+	rec := &recorder{}
+	leader := &fakeLeader{}
+	cfg := config.WatchdogConfig{Stations: []string{"1"}, GracePeriod: 5 * time.Minute}
+	w := New(cfg, stations, rec, rec.send, logging.New("error", "watchdog_test"), start)
+	w.SetLeader(leader)
+
+	// Instances that don't lead follow the station without reporting it
+	w.check(start.Add(5 * time.Minute))
+	if len(rec.events) != 0 || len(rec.warnings) != 0 {
+		t.Fatalf("Expected no reports from an instance that doesn't lead, got %v", rec.events)
+	}
+
+	// A new leader doesn't report an outage again, and reports its recovery
+	leader.leader = true
+	w.check(start.Add(6 * time.Minute))
+	if len(rec.events) != 0 {
+		t.Fatalf("Expected the outage not to be reported again, got %v", rec.events)
+	}
+	stations["1"] = 1
+	w.check(start.Add(7 * time.Minute))
+	if len(rec.events) != 1 || rec.events[0] != EventDisplayRecovered {
+		t.Fatalf("Expected station 1 to recover, got %v", rec.events)
+	}
+
+	// Stations are left alone when the displays can't be counted
+	w.source = fakeStations(nil)
+	w.check(start.Add(20 * time.Minute))
+	if len(rec.events) != 1 {
+		t.Fatalf("Expected no events without a display count, got %v", rec.events)
+	}
+}
@@ -0,0 +1,601 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// checkInterval is how often the service looks for deliveries that are due
+const checkInterval = 5 * time.Second
+
+// claimBatch bounds how many deliveries are claimed at once
+const claimBatch = 50
+
+// maxResponseExcerpt bounds how much of a failed response is kept with the delivery
+const maxResponseExcerpt = 512
+
+// maxQueueRetry caps the wait between attempts to queue a published event while the database is unavailable
+const maxQueueRetry = time.Minute
+
+// Event types delivered to webhooks
+const (
+	EventNewAlert     = "new_alert"
+	EventAlertDeleted = "alert_deleted"
+	EventPing         = "ping" // Sent by POST /webhooks/{id}/test, whatever the subscription's filters
+)
+
+// EventTypes lists the events a subscription can choose
+var EventTypes = []string{EventNewAlert, EventAlertDeleted}
+
+// RedactionProfiles lists the redaction profiles a subscription can choose
+var RedactionProfiles = []string{models.WebhookRedactionNone, models.WebhookRedactionStandard, models.WebhookRedactionFull}
+
+// Store persists subscriptions and queued deliveries
+type Store interface {
+	ListWebhookSubscriptions(ctx context.Context, enabledOnly bool) ([]models.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error)
+	CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error
+	WebhookAlertDelivered(ctx context.Context, subscriptionID, alertID string) (bool, error)
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// Service queues alert events for webhook subscriptions and posts them, retrying failed
+// attempts with exponential backoff until they are delivered or moved to the dead-letter queue
+type Service struct {
+	store      Store
+	client     *http.Client
+	cfg        config.WebhookConfig
+	logger     *logging.Logger
+	wake       chan struct{}
+	shutdownCh chan struct{}
+	done       chan struct{}
+
+	// Events published but not yet stored as deliveries, in the order published
+	published    []publishedEvent
+	publishMutex sync.Mutex
+	publishWake  chan struct{}
+	queueDone    chan struct{}
+}
+
+// publishedEvent is an event waiting to be queued for the subscriptions
+type publishedEvent struct {
+	eventType string
+	content   any
+	at        time.Time
+}
+
+// New creates a webhook service
+func New(cfg config.WebhookConfig, store Store, logger *logging.Logger) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &Service{
+		store:       store,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		cfg:         cfg,
+		logger:      logger,
+		wake:        make(chan struct{}, 1),
+		shutdownCh:  make(chan struct{}),
+		done:        make(chan struct{}),
+		publishWake: make(chan struct{}, 1),
+		queueDone:   make(chan struct{}),
+	}
+}
+
+// Start sends due deliveries until Stop is called
+func (s *Service) Start() {
+	s.logger.Infof("Starting webhook delivery with %d workers and up to %d attempts", s.cfg.Workers, s.cfg.MaxAttempts)
+
+	ticker := time.NewTicker(checkInterval)
+	pruneTicker := time.NewTicker(time.Hour)
+
+	go s.queuePublished()
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		defer pruneTicker.Stop()
+
+		s.sendDue()
+		for {
+			select {
+			case <-ticker.C:
+				s.sendDue()
+			case <-s.wake:
+				s.sendDue()
+			case <-pruneTicker.C:
+				s.pruneDeliveries()
+			case <-s.shutdownCh:
+				s.logger.Info("Webhook delivery shutting down")
+				return
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the service once the attempts in progress finish.
+// Published events that could not be queued yet are lost.
+func (s *Service) Stop() {
+	close(s.shutdownCh)
+	<-s.done
+	<-s.queueDone
+
+	s.publishMutex.Lock()
+	defer s.publishMutex.Unlock()
+	if len(s.published) > 0 {
+		s.logger.Warnf("Dropping %d webhook events that could not be queued", len(s.published))
+	}
+}
+
+// Wake makes the service look for due deliveries now, after deliveries were queued
+func (s *Service) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Publish queues an event for every enabled subscription whose filters match it.
+// Only alert events are delivered; other events are ignored. Publish doesn't wait for
+// the database: events are queued in the background in the order published, and retried
+// with backoff while the database is unavailable.
+func (s *Service) Publish(eventType string, content any) {
+	s.publishMutex.Lock()
+	s.published = append(s.published, publishedEvent{eventType: eventType, content: content, at: time.Now()})
+	s.publishMutex.Unlock()
+
+	select {
+	case s.publishWake <- struct{}{}:
+	default:
+	}
+}
+
+// queuePublished queues published events until Stop is called. An event that can't be
+// queued is retried before the events published after it.
+func (s *Service) queuePublished() {
+	defer close(s.queueDone)
+
+	retry := time.Second
+	for {
+		s.publishMutex.Lock()
+		var event publishedEvent
+		pending := len(s.published) > 0
+		if pending {
+			event = s.published[0]
+		}
+		s.publishMutex.Unlock()
+
+		if !pending {
+			select {
+			case <-s.publishWake:
+				continue
+			case <-s.shutdownCh:
+				return
+			}
+		}
+
+		if err := s.queueEvent(event); err != nil {
+			s.logger.Errorf(err, "Failed to queue %s webhook deliveries, retrying in %s", event.eventType, retry)
+			select {
+			case <-time.After(retry):
+			case <-s.shutdownCh:
+				return
+			}
+			retry = min(retry*2, maxQueueRetry)
+			continue
+		}
+		retry = time.Second
+
+		s.publishMutex.Lock()
+		s.published = s.published[1:]
+		s.publishMutex.Unlock()
+	}
+}
+
+// queueEvent stores the deliveries of a published event and wakes the senders
+func (s *Service) queueEvent(event publishedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.enqueue(ctx, event.eventType, event.content, event.at)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		s.logger.Infof("Queued %s event for %d webhook subscriptions", event.eventType, count)
+		s.Wake()
+	}
+	return nil
+}
+
+// enqueue stores a delivery of the event for each matching subscription and returns how many were queued
+func (s *Service) enqueue(ctx context.Context, eventType string, content any, now time.Time) (int, error) {
+	var alert *models.Alert
+	var alertID string
+	switch c := content.(type) {
+	case models.Alert:
+		alert, alertID = &c, c.Alert.ID
+	case *models.Alert:
+		alert, alertID = c, c.Alert.ID
+	case protocol.AlertDeleted:
+		alertID = c.ID
+	default:
+		return 0, nil
+	}
+
+	subs, err := s.store.ListWebhookSubscriptions(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+
+	eventID := uuid.New().String()
+	deliveries := make([]models.WebhookDelivery, 0, len(subs))
+	for _, sub := range subs {
+		if len(sub.EventTypes) > 0 && !slices.Contains(sub.EventTypes, eventType) {
+			continue
+		}
+
+		data := content
+		if alert != nil {
+			if !matchesAlert(sub, alert) {
+				continue
+			}
+			data = redact(*alert, sub.Redaction)
+		} else if hasAlertFilters(sub) {
+			// Filtered subscriptions only hear of deletions of alerts they were sent
+			sent, err := s.store.WebhookAlertDelivered(ctx, sub.ID, alertID)
+			if err != nil {
+				return 0, err
+			}
+			if !sent {
+				continue
+			}
+		}
+
+		delivery, err := newDelivery(sub.ID, eventID, eventType, alertID, data, now)
+		if err != nil {
+			return 0, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+	if err := s.store.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+		return 0, err
+	}
+	return len(deliveries), nil
+}
+
+// SendTest queues a ping event for a subscription, whatever its filters
+func (s *Service) SendTest(ctx context.Context, sub models.WebhookSubscription) (models.WebhookDelivery, error) {
+	now := time.Now()
+	delivery, err := newDelivery(sub.ID, uuid.New().String(), EventPing, "", map[string]string{
+		"subscription_id": sub.ID,
+		"message":         "Test event from the alerting server",
+	}, now)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	if err := s.store.CreateWebhookDeliveries(ctx, []models.WebhookDelivery{delivery}); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	s.Wake()
+	return delivery, nil
+}
+
+// newDelivery builds a pending delivery that is due now
+func newDelivery(subscriptionID, eventID, eventType, alertID string, data any, now time.Time) (models.WebhookDelivery, error) {
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	return models.WebhookDelivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		EventType:      eventType,
+		AlertID:        alertID,
+		Payload:        payload,
+		Status:         models.WebhookStatusPending,
+		NextAttemptAt:  &now,
+		CreatedAt:      now,
+	}, nil
+}
+
+// sendDue sends due deliveries until none are left
+func (s *Service) sendDue() {
+	for {
+		claimed, err := s.process(time.Now())
+		if err != nil {
+			s.logger.Error(err, "Failed to send webhook deliveries")
+			return
+		}
+		if claimed < claimBatch {
+			return
+		}
+	}
+}
+
+// process claims a batch of due deliveries and attempts each of them, returning how many were claimed
+func (s *Service) process(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Claimed deliveries are skipped by other instances until every attempt has had time to finish
+	lease := s.cfg.Timeout*time.Duration(claimBatch/s.cfg.Workers+1) + time.Minute
+	deliveries, err := s.store.ClaimWebhookDeliveries(ctx, now, lease, claimBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	subs := make(map[string]models.WebhookSubscription)
+	sem := make(chan struct{}, s.cfg.Workers)
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			sub, err = s.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return len(deliveries), err
+			}
+			subs[delivery.SubscriptionID] = sub
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := s.attempt(sub, delivery)
+			recordCtx, recordCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer recordCancel()
+			if err := s.store.RecordWebhookAttempt(recordCtx, result); err != nil {
+				s.logger.Error(err, "Failed to record webhook attempt")
+			}
+		}()
+	}
+
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// attempt posts a delivery to its subscription and returns the delivery with the outcome recorded
+func (s *Service) attempt(sub models.WebhookSubscription, delivery models.WebhookDelivery) models.WebhookDelivery {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+
+	switch {
+	case sub.ID == "":
+		delivery.Error = "Subscription no longer exists"
+		delivery.Attempts = s.cfg.MaxAttempts
+	case !sub.Enabled:
+		// Retrying the delivery after the subscription is enabled again sends it
+		delivery.Error = "Subscription is disabled"
+		delivery.Attempts = s.cfg.MaxAttempts
+	default:
+		status, err := s.post(sub, delivery, now)
+		delivery.ResponseStatus = status
+		if err == nil {
+			delivery.Status = models.WebhookStatusDelivered
+			delivery.DeliveredAt = &now
+			delivery.NextAttemptAt = nil
+			delivery.Error = ""
+			s.logger.Debugf("Delivered %s webhook %s to %s", delivery.EventType, delivery.ID, sub.Name)
+			return delivery
+		}
+		delivery.Error = err.Error()
+	}
+
+	if delivery.Attempts >= s.cfg.MaxAttempts {
+		delivery.Status = models.WebhookStatusDead
+		delivery.NextAttemptAt = nil
+		s.logger.Warnf("Webhook delivery %s to %s moved to the dead-letter queue after %d attempts: %s",
+			delivery.ID, sub.Name, delivery.Attempts, delivery.Error)
+		return delivery
+	}
+
+	next := now.Add(s.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+	s.logger.Infof("Webhook delivery %s to %s failed on attempt %d, retrying at %s: %s",
+		delivery.ID, sub.Name, delivery.Attempts, next.Format(time.RFC3339), delivery.Error)
+	return delivery
+}
+
+// post sends the signed payload and returns the response status. Statuses other than 2xx are errors.
+func (s *Service) post(sub models.WebhookSubscription, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid request: %w", err)
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "alerting-webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseExcerpt))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := fmt.Sprintf("receiver answered %s", resp.Status)
+		if body := strings.TrimSpace(string(excerpt)); body != "" {
+			message += ": " + body
+		}
+		return resp.StatusCode, errors.New(message)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts, doubling from the base up to the maximum
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.cfg.BackoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= s.cfg.BackoffMax || delay <= 0 {
+			return s.cfg.BackoffMax
+		}
+	}
+	return min(delay, s.cfg.BackoffMax)
+}
+
+// pruneDeliveries removes finished deliveries older than the retention period
+func (s *Service) pruneDeliveries() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	count, err := s.store.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-s.cfg.Retention))
+	if err != nil {
+		s.logger.Error(err, "Failed to prune webhook deliveries")
+		return
+	}
+	if count > 0 {
+		s.logger.Infof("Pruned %d webhook deliveries", count)
+	}
+}
+
+// Prepare validates a subscription and fills in defaults
+func Prepare(sub *models.WebhookSubscription) error {
+	sub.Name = strings.TrimSpace(sub.Name)
+	if sub.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(sub.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	sub.URL = parsed.String()
+
+	sub.EventTypes = trimAll(sub.EventTypes)
+	sub.PageGroups = trimAll(sub.PageGroups)
+	sub.CallTypes = trimAll(sub.CallTypes)
+
+	for _, eventType := range sub.EventTypes {
+		if !slices.Contains(EventTypes, eventType) {
+			return fmt.Errorf("invalid event type %q, expected one of %s", eventType, strings.Join(EventTypes, ", "))
+		}
+	}
+
+	if sub.Redaction == "" {
+		sub.Redaction = models.WebhookRedactionStandard
+	}
+	if !slices.Contains(RedactionProfiles, sub.Redaction) {
+		return fmt.Errorf("invalid redaction %q, expected one of %s", sub.Redaction, strings.Join(RedactionProfiles, ", "))
+	}
+
+	return nil
+}
+
+// GenerateSecret creates a random signing secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// trimAll trims every value and drops the empty ones
+func trimAll(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
+
+// hasAlertFilters checks if a subscription only receives some alerts
+func hasAlertFilters(sub models.WebhookSubscription) bool {
+	return len(sub.PageGroups) > 0 || len(sub.CallTypes) > 0
+}
+
+// matchesAlert checks an alert against a subscription's page group and call type filters
+func matchesAlert(sub models.WebhookSubscription, alert *models.Alert) bool {
+	if len(sub.PageGroups) > 0 && !slices.ContainsFunc(alert.Alert.PageGroups, func(group string) bool {
+		return containsFold(sub.PageGroups, group)
+	}) {
+		return false
+	}
+
+	if len(sub.CallTypes) > 0 {
+		if alert.Alert.Description == nil || !containsFold(sub.CallTypes, strings.TrimSpace(*alert.Alert.Description)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsFold checks if values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	return slices.ContainsFunc(values, func(value string) bool { return strings.EqualFold(value, s) })
+}
+
+// redact applies a subscription's redaction profile to a copy of the alert
+func redact(alert models.Alert, profile string) *models.Alert {
+	alertCopy := models.DeepCopyAlert(alert)
+
+	switch profile {
+	case models.WebhookRedactionNone:
+		return &alertCopy
+	case models.WebhookRedactionFull:
+		return auth.RedactAlertDataWithLevel(&alertCopy, auth.FullRedaction)
+	default:
+		if alertCopy.Alert.Description == nil {
+			return auth.RedactAlertDataWithLevel(&alertCopy, auth.NormalRedaction)
+		}
+		return auth.RedactAlertData(&alertCopy)
+	}
+}
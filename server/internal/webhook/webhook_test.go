@@ -0,0 +1,284 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+	"github.com/user/alerting/server/internal/storage"
+)
+
+// memoryStore keeps subscriptions and deliveries in memory
+type memoryStore struct {
+	subs       []models.WebhookSubscription
+	deliveries []models.WebhookDelivery
+	mutex      sync.Mutex
+}
+
+func (m *memoryStore) ListWebhookSubscriptions(ctx context.Context, enabledOnly bool) ([]models.WebhookSubscription, error) {
+	subs := make([]models.WebhookSubscription, 0)
+	for _, sub := range m.subs {
+		if sub.Enabled || !enabledOnly {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (m *memoryStore) GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	for _, sub := range m.subs {
+		if sub.ID == id {
+			return sub, nil
+		}
+	}
+	return models.WebhookSubscription{}, storage.ErrNotFound
+}
+
+func (m *memoryStore) CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deliveries = append(m.deliveries, deliveries...)
+	return nil
+}
+
+func (m *memoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	claimed := make([]models.WebhookDelivery, 0)
+	for i, d := range m.deliveries {
+		if d.Status == models.WebhookStatusPending && !d.NextAttemptAt.After(now) && len(claimed) < limit {
+			leased := now.Add(lease)
+			m.deliveries[i].NextAttemptAt = &leased
+			claimed = append(claimed, m.deliveries[i])
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, d := range m.deliveries {
+		if d.ID == delivery.ID {
+			m.deliveries[i] = delivery
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) WebhookAlertDelivered(ctx context.Context, subscriptionID, alertID string) (bool, error) {
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID && d.AlertID == alertID && d.EventType == EventNewAlert {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+// get returns the stored delivery with the ID
+func (m *memoryStore) get(id string) models.WebhookDelivery {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return models.WebhookDelivery{}
+}
+
+func testService(store Store) *Service {
+	return New(config.WebhookConfig{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		BackoffBase: time.Minute,
+		BackoffMax:  90 * time.Second,
+		Workers:     2,
+	}, store, logging.New("error", "webhook_test"))
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestFiltersAndRedaction(t *testing.T) {
+	store := &memoryStore{subs: []models.WebhookSubscription{
+		{ID: "eoc", Enabled: true, Redaction: models.WebhookRedactionNone},
+		{ID: "station51", Enabled: true, PageGroups: []string{"st51"}, Redaction: models.WebhookRedactionFull},
+		{ID: "fires", Enabled: true, CallTypes: []string{"structure fire"}, EventTypes: []string{EventNewAlert}},
+		{ID: "disabled", Enabled: false},
+	}}
+	s := testService(store)
+
+	alert := models.Alert{Alert: models.AlertDetails{
+		ID:          "A1",
+		Description: strPtr("Medical Emergency"),
+		MapAddress:  strPtr("100 Anderson Ave"),
+		PageGroups:  []string{"ST51"},
+	}}
+	count, err := s.enqueue(context.Background(), EventNewAlert, alert, time.Now())
+	if err != nil || count != 2 {
+		t.Fatalf("Expected the alert to be queued for 2 subscriptions, got %d (%v)", count, err)
+	}
+
+	payloads := make(map[string]models.WebhookEvent)
+	for _, d := range store.deliveries {
+		var event models.WebhookEvent
+		if err := json.Unmarshal(d.Payload, &event); err != nil {
+			t.Fatalf("Invalid payload: %v", err)
+		}
+		payloads[d.SubscriptionID] = event
+	}
+	address := func(subscriptionID string) interface{} {
+		return payloads[subscriptionID].Data.(map[string]interface{})["alert"].(map[string]interface{})["map_address"]
+	}
+	if address("eoc") != "100 Anderson Ave" {
+		t.Errorf("Expected the unredacted address, got %v", address("eoc"))
+	}
+	if address("station51") != "[Redacted]" {
+		t.Errorf("Expected the address to be redacted, got %v", address("station51"))
+	}
+	if *alert.Alert.MapAddress != "100 Anderson Ave" {
+		t.Error("Redaction changed the original alert")
+	}
+
+	// Deletions reach unfiltered subscriptions and filtered ones that were sent the alert
+	store.deliveries = nil
+	store.subs[1].PageGroups = []string{"st52"}
+	count, err = s.enqueue(context.Background(), EventAlertDeleted, protocol.AlertDeleted{ID: "A1"}, time.Now())
+	if err != nil || count != 1 || store.deliveries[0].SubscriptionID != "eoc" {
+		t.Fatalf("Expected the deletion to be queued for the unfiltered subscription, got %d (%v)", count, err)
+	}
+
+	// Other events are not delivered
+	if count, _ := s.enqueue(context.Background(), "weather_update", models.Weather{}, time.Now()); count != 0 {
+		t.Errorf("Expected weather updates to be ignored, got %d deliveries", count)
+	}
+}
+
+func TestDeliveryRetriesAndDeadLetters(t *testing.T) {
+	var mutex sync.Mutex
+	failures := 1
+	var received []*http.Request
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if failures > 0 {
+			failures--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{subs: []models.WebhookSubscription{
+		{ID: "records", Name: "Records", URL: receiver.URL, Secret: "whsec_test", Enabled: true},
+	}}
+	s := testService(store)
+
+	delivery, err := s.SendTest(context.Background(), store.subs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt fails and is retried after the base backoff
+	start := time.Now()
+	s.process(start)
+	failed := store.get(delivery.ID)
+	if failed.Status != models.WebhookStatusPending || failed.Attempts != 1 || failed.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a pending delivery after one failed attempt, got %+v", failed)
+	}
+	if failed.NextAttemptAt.Sub(*failed.LastAttemptAt) != time.Minute {
+		t.Errorf("Expected the retry a minute later, got %s", failed.NextAttemptAt.Sub(*failed.LastAttemptAt))
+	}
+	if claimed, _ := s.process(start); claimed != 0 {
+		t.Fatalf("Expected the retry to wait for its backoff, %d were sent", claimed)
+	}
+
+	s.process(start.Add(2 * time.Minute))
+	delivered := store.get(delivery.ID)
+	if delivered.Status != models.WebhookStatusDelivered || delivered.Attempts != 2 || delivered.DeliveredAt == nil {
+		t.Fatalf("Expected the second attempt to deliver, got %+v", delivered)
+	}
+
+	// Every attempt is signed over the timestamp and the body
+	request := received[1]
+	timestamp, _ := strconv.ParseInt(request.Header.Get(HeaderTimestamp), 10, 64)
+	if request.Header.Get(HeaderSignature) != Sign("whsec_test", timestamp, bodies[1]) {
+		t.Error("Expected a valid signature")
+	}
+	if request.Header.Get(HeaderEvent) != EventPing || request.Header.Get(HeaderDelivery) != delivery.ID {
+		t.Errorf("Unexpected headers: %v", request.Header)
+	}
+
+	// A receiver that keeps failing moves the delivery to the dead-letter queue
+	failures = 3
+	delivery, _ = s.SendTest(context.Background(), store.subs[0])
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		s.process(now)
+		now = now.Add(time.Hour)
+	}
+	dead := store.get(delivery.ID)
+	if dead.Status != models.WebhookStatusDead || dead.Attempts != 3 || dead.NextAttemptAt != nil || dead.Error == "" {
+		t.Fatalf("Expected a dead delivery after 3 attempts, got %+v", dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := testService(&memoryStore{})
+	s.cfg.BackoffBase = 10 * time.Second
+	s.cfg.BackoffMax = time.Minute
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, want := range expected {
+		if got := s.backoff(i + 1); got != want {
+			t.Errorf("Attempt %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+	if got := s.backoff(200); got != time.Minute {
+		t.Errorf("Expected a large attempt count to be capped, got %s", got)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	sub := models.WebhookSubscription{Name: " EOC ", URL: "https://eoc.example.com/hook", PageGroups: []string{" st51 ", ""}}
+	if err := Prepare(&sub); err != nil {
+		t.Fatal(err)
+	}
+	if sub.Name != "EOC" || sub.Redaction != models.WebhookRedactionStandard || len(sub.PageGroups) != 1 {
+		t.Errorf("Unexpected prepared subscription: %+v", sub)
+	}
+
+	for _, invalid := range []models.WebhookSubscription{
+		{Name: "x", URL: "ftp://example.com"},
+		{Name: "x", URL: "/relative"},
+		{Name: "x", URL: "https://example.com", EventTypes: []string{"new_log"}},
+		{Name: "x", URL: "https://example.com", Redaction: "some"},
+		{URL: "https://example.com"},
+	} {
+		if err := Prepare(&invalid); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// BulletinSource provides the bulletins currently shown on displays
+type BulletinSource interface {
+	Active() []models.Bulletin
+}
+
+// SetBulletinSource sends dashboard clients the active bulletins for their station when they connect
+func (h *Handler) SetBulletinSource(source BulletinSource) {
+	h.bulletins = source
+}
+
+// sendBulletins sends a client the active bulletins that apply to its station
+func (h *Handler) sendBulletins(client *Client) {
+	if h.bulletins == nil {
+		return
+	}
+
+	bulletins := make([]models.Bulletin, 0)
+	for _, bulletin := range h.bulletins.Active() {
+		if client.wantsBulletin(bulletin) {
+			bulletins = append(bulletins, bulletin)
+		}
+	}
+	client.SendMessage("bulletins", protocol.Bulletins{Bulletins: bulletins})
+}
+
+// wantsBulletin checks if a bulletin is shown at the client's station
+func (c *Client) wantsBulletin(bulletin models.Bulletin) bool {
+	return bulletin.AppliesTo(c.station())
+}
@@ -0,0 +1,56 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// fixedBulletins is a bulletin source with a fixed set of active bulletins
+type fixedBulletins []models.Bulletin
+
+func (f fixedBulletins) Active() []models.Bulletin {
+	return f
+}
+
+// TestBulletins sends a station's bulletins on connect and filters broadcasts by station
+func TestBulletins(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	now := time.Now()
+	server.handler.SetBulletinSource(fixedBulletins{
+		{ID: "all", Message: "Road closed on Anderson Ave", Priority: models.BulletinPriorityHigh, StartsAt: now},
+		{ID: "other", Message: "Training at 1900", Priority: models.BulletinPriorityNormal, Stations: []string{"52"}, StartsAt: now},
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL+"?ticket="+stationTicket(t, server, ws.HubTypeDashboard, "51"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	server.waitForClients(t, 1)
+
+	var active protocol.Bulletins
+	raw, _ := json.Marshal(readMessage(t, conn, "bulletins").Content)
+	if err := json.Unmarshal(raw, &active); err != nil {
+		t.Fatalf("Failed to decode bulletins: %v", err)
+	}
+	if len(active.Bulletins) != 1 || active.Bulletins[0].ID != "all" {
+		t.Fatalf("Expected only the bulletin for every station, got %+v", active.Bulletins)
+	}
+
+	// A bulletin for another station is skipped
+	server.dashboardHub.BroadcastEvent("bulletin", models.Bulletin{ID: "skipped", Stations: []string{"52"}})
+	server.dashboardHub.BroadcastEvent("bulletin", models.Bulletin{ID: "engine", Stations: []string{"51"}})
+
+	content, _ := readMessage(t, conn, "bulletin").Content.(map[string]interface{})
+	if content["id"] != "engine" {
+		t.Fatalf("Expected the bulletin for station 51, got %v", content)
+	}
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// maxSeenEvents bounds how many event IDs each hub remembers to drop duplicate deliveries
+const maxSeenEvents = 4096
+
+// maxPendingPublishes bounds how many events each hub holds while they wait to be published.
+// Events broadcast while the outbox is full only reach local clients.
+const maxPendingPublishes = 1024
+
+// EventBus carries broadcast events to the hubs of every server instance. Handlers may be
+// called more than once for the same event, and for events the hub published itself.
+type EventBus interface {
+	Publish(ctx context.Context, event models.BusEvent) error
+	Subscribe(hub string, handler func(models.BusEvent))
+}
+
+// seenEvents is a bounded set of the latest event IDs delivered by a hub
+type seenEvents struct {
+	ids   map[string]bool
+	order []string // Oldest first
+}
+
+// SetEventBus sends the hub's broadcasts through the bus, so clients connected to other
+// server instances receive them too. Without a bus, broadcasts only reach local clients.
+func (h *Hub) SetEventBus(bus EventBus) {
+	h.bus = bus
+	h.outbox = make(chan models.WebSocketMessage, maxPendingPublishes)
+	bus.Subscribe(string(h.hubType), h.receive)
+	go h.publishOutbox()
+}
+
+// publish queues an event that was delivered locally to be published to the other instances.
+// Broadcasts don't wait for the bus, so a slow or unavailable database can't hold them up.
+func (h *Hub) publish(event models.WebSocketMessage) {
+	select {
+	case h.outbox <- event:
+	default:
+		h.logger.Warnf("Event bus outbox of %s hub is full, %s event only reached local clients", h.hubType, event.Type)
+	}
+}
+
+// publishOutbox publishes queued events in the order they were broadcast
+func (h *Hub) publishOutbox() {
+	for event := range h.outbox {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := h.bus.Publish(ctx, models.BusEvent{Hub: string(h.hubType), Message: event})
+		cancel()
+		if err != nil {
+			h.logger.Error(err, "Failed to publish event, it only reached local clients")
+		}
+	}
+}
+
+// receive delivers an event that arrived from the bus
+func (h *Hub) receive(event models.BusEvent) {
+	message := event.Message
+	message.Content = decodeReplayContent(message.Type, message.Content)
+	h.deliver(message)
+}
+
+// newEvent creates a broadcast event with a unique ID
+func newEvent(eventType string, content any) models.WebSocketMessage {
+	return models.WebSocketMessage{
+		Type:    eventType,
+		Content: content,
+		ID:      uuid.New().String(),
+		Time:    time.Now(),
+	}
+}
+
+// markSeen records an event ID and reports whether the hub already delivered it.
+// The caller must hold the broadcast mutex.
+func (h *Hub) markSeen(id string) bool {
+	s := &h.seen
+	if s.ids == nil {
+		s.ids = make(map[string]bool)
+	}
+	if s.ids[id] {
+		return true
+	}
+
+	s.ids[id] = true
+	s.order = append(s.order, id)
+	if len(s.order) > maxSeenEvents {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return false
+}
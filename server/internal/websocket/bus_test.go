@@ -0,0 +1,268 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/eventbus"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/storage"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// redeliveringBus serializes events as the Postgres bus does and delivers each one twice
+type redeliveringBus struct {
+	local *eventbus.Local
+}
+
+func (b *redeliveringBus) Publish(ctx context.Context, event models.BusEvent) error {
+	data, err := json.Marshal(event.Message)
+	if err != nil {
+		return err
+	}
+	if event.Message, err = storage.DecodeBusMessage(data); err != nil {
+		return err
+	}
+
+	for range 2 {
+		if err := b.local.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *redeliveringBus) Subscribe(hub string, handler func(models.BusEvent)) {
+	b.local.Subscribe(hub, handler)
+}
+
+// TestEventBusFanOut broadcasts on one instance and delivers each event once to clients of another
+func TestEventBusFanOut(t *testing.T) {
+	bus := &redeliveringBus{local: eventbus.NewLocal()}
+	withBus := func(instance string) func(hub *ws.Hub) {
+		return func(hub *ws.Hub) {
+			hub.SetEventBus(bus)
+			if err := hub.EnableReplay(nil, instance, 100); err != nil {
+				t.Fatalf("Failed to enable replay: %v", err)
+			}
+		}
+	}
+
+	first := newTestServer(t, withBus("first"))
+	defer first.close()
+	second := newTestServer(t, withBus("second"))
+	defer second.close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(second.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	second.waitForClients(t, 1)
+
+	first.dashboardHub.BroadcastEvent("new_alert", testAlert("bus-1"))
+	first.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 20})
+
+	alert := readMessage(t, conn, "new_alert")
+	content, _ := alert.Content.(map[string]interface{})
+	details, _ := content["alert"].(map[string]interface{})
+	if details["id"] != "bus-1" {
+		t.Errorf("Expected alert bus-1, got %v", alert.Content)
+	}
+
+	// The redelivered alert would arrive before the weather update
+	var next models.WebSocketMessage
+	if err := conn.ReadJSON(&next); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if next.Type != "weather_update" {
+		t.Fatalf("Expected the weather update, got %s", next.Type)
+	}
+
+	if next.Instance != "second" || next.Seq != 2 {
+		t.Errorf("Expected sequence 2 of instance second, got %d of %q", next.Seq, next.Instance)
+	}
+
+	// Each instance numbers events on its own, so a resume with another instance's sequence resyncs
+	conn.WriteJSON(models.WebSocketMessage{Type: "resume", Content: map[string]interface{}{"last_seq": 1, "instance": "first"}})
+	resync := readMessage(t, conn, "resync_required")
+	if content, _ := resync.Content.(map[string]interface{}); content["instance"] != "second" {
+		t.Errorf("Expected a resync naming instance second, got %v", resync.Content)
+	}
+
+	conn.WriteJSON(models.WebSocketMessage{Type: "resume", Content: map[string]interface{}{"last_seq": 1, "instance": "second"}})
+	resumed := readMessage(t, conn, "resumed")
+	if content, _ := resumed.Content.(map[string]interface{}); content["replayed"] != float64(1) {
+		t.Errorf("Expected the weather update to be replayed, got %v", resumed.Content)
+	}
+
+	// Clients that predate instances resume on the instance they reach
+	conn.WriteJSON(models.WebSocketMessage{Type: "resume", Content: map[string]interface{}{"last_seq": 1}})
+	resumed = readMessage(t, conn, "resumed")
+	if content, _ := resumed.Content.(map[string]interface{}); content["replayed"] != float64(1) {
+		t.Errorf("Expected a resume without an instance to replay, got %v", resumed.Content)
+	}
+}
+
+// stalledBus never finishes publishing, as when the database doesn't respond
+type stalledBus struct {
+	release chan struct{}
+}
+
+func (b *stalledBus) Publish(ctx context.Context, event models.BusEvent) error {
+	<-b.release
+	return nil
+}
+
+func (b *stalledBus) Subscribe(hub string, handler func(models.BusEvent)) {}
+
+// TestEventBusLocalFirst delivers broadcasts to local clients while the bus is stalled
+func TestEventBusLocalFirst(t *testing.T) {
+	bus := &stalledBus{release: make(chan struct{})}
+	defer close(bus.release)
+
+	server := newTestServer(t, func(hub *ws.Hub) { hub.SetEventBus(bus) })
+	defer server.close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	server.waitForClients(t, 1)
+
+	server.dashboardHub.BroadcastEvent("new_alert", testAlert("stalled-1"))
+	server.dashboardHub.BroadcastEvent("new_alert", testAlert("stalled-2"))
+
+	for _, id := range []string{"stalled-1", "stalled-2"} {
+		alert := readMessage(t, conn, "new_alert")
+		content, _ := alert.Content.(map[string]interface{})
+		details, _ := content["alert"].(map[string]interface{})
+		if details["id"] != id {
+			t.Errorf("Expected alert %s, got %v", id, alert.Content)
+		}
+	}
+}
+
+// TestEventBusRevocation closes connections on other instances when a credential is revoked
+func TestEventBusRevocation(t *testing.T) {
+	bus := &redeliveringBus{local: eventbus.NewLocal()}
+	first := newTestServer(t)
+	defer first.close()
+	second := newTestServer(t)
+	defer second.close()
+	first.handler.SetEventBus(bus)
+	second.handler.SetEventBus(bus)
+
+	ticket, _, err := second.auth.IssueTicket(context.Background(), auth.AuthInfo{
+		Authenticated: true,
+		Method:        auth.AuthMethodSession,
+		Role:          auth.RoleViewer,
+		SessionID:     "session-1",
+	}, string(ws.HubTypeDashboard), "")
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(second.dashboardURL+"?ticket="+ticket, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	second.waitForClients(t, 1)
+
+	first.handler.CloseRevokedConnections("session-1")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, ws.CloseCredentialRevoked) {
+				t.Fatalf("Expected close code %d, got %v", ws.CloseCredentialRevoked, err)
+			}
+			break
+		}
+	}
+	second.waitForClients(t, 0)
+}
+
+// TestSharedCommand sends a command from an admin on one instance to a display on another
+// and routes the display's acknowledgement back once
+func TestSharedCommand(t *testing.T) {
+	bus := &redeliveringBus{local: eventbus.NewLocal()}
+	first := newTestServer(t)
+	defer first.close()
+	second := newTestServer(t)
+	defer second.close()
+	first.handler.ShareCommands(bus)
+	second.handler.ShareCommands(bus)
+
+	ticket, _, err := first.auth.IssueTicket(context.Background(), auth.AuthInfo{Authenticated: true, Role: auth.RoleAdmin}, string(ws.HubTypeClient), "")
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	admin := dialClient(t, first, "?ticket="+ticket)
+	defer admin.Close()
+	target := dialClient(t, second, "?ticket="+stationTicket(t, second, ws.HubTypeClient, "61"))
+	defer target.Close()
+	other := dialClient(t, second, "?ticket="+stationTicket(t, second, ws.HubTypeClient, "62"))
+	defer other.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for first.clientHub.ClientCount() != 1 || second.clientHub.ClientCount() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 1 and 2 clients, hubs have %d and %d", first.clientHub.ClientCount(), second.clientHub.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	admin.WriteJSON(models.WebSocketMessage{
+		Type: "command",
+		Content: map[string]interface{}{
+			"command": "refresh",
+			"target":  map[string]interface{}{"station": "61"},
+		},
+	})
+
+	// No display of the issuing instance matches, the other instance lists its own
+	sent := readMessage(t, admin, "command_sent").Content.(map[string]interface{})
+	if targets := sent["targets"].([]interface{}); len(targets) != 0 {
+		t.Fatalf("Expected no local targets, got %v", targets)
+	}
+	remote := readMessage(t, admin, "command_sent").Content.(map[string]interface{})
+	if targets := remote["targets"].([]interface{}); len(targets) != 1 || remote["command_id"] != sent["command_id"] {
+		t.Fatalf("Expected 1 remote target of the command, got %v", remote)
+	}
+
+	command := readMessage(t, target, "refresh").Content.(map[string]interface{})
+	if command["command_id"] != sent["command_id"] {
+		t.Fatalf("Unexpected command content %v", command)
+	}
+	target.WriteJSON(models.WebSocketMessage{
+		Type:    "command_ack",
+		Content: map[string]interface{}{"command_id": command["command_id"], "status": "ok"},
+	})
+
+	result := readMessage(t, admin, "command_result").Content.(map[string]interface{})
+	if result["status"] != ws.CommandStatusOK || result["station"] != "61" || result["command_id"] != sent["command_id"] {
+		t.Errorf("Unexpected command result %v", result)
+	}
+
+	// The redelivered command and acknowledgement reach nobody twice
+	target.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var message models.WebSocketMessage
+	if err := target.ReadJSON(&message); err == nil && message.Type == "refresh" {
+		t.Error("Display received the command twice")
+	}
+	admin.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := admin.ReadJSON(&message); err == nil && message.Type == "command_result" {
+		t.Error("Admin received the result twice")
+	}
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := other.ReadJSON(&message); err == nil && message.Type == "refresh" {
+		t.Error("Untargeted display received the command")
+	}
+}
@@ -2,13 +2,18 @@ package websocket
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/auth"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
 )
 
 const (
@@ -21,8 +26,45 @@ const (
 	// Time to send heartbeats to peers
 	heartbeatPeriod = 30 * time.Second
 
-	// Buffer size for the send channel
+	// Capacity of each lane of the send queue
 	sendBufferSize = 256
+
+	// Default interval of protocol pings
+	defaultPingInterval = 20 * time.Second
+
+	// Default time allowed without a pong or message before the client is considered dead
+	defaultPongTimeout = 60 * time.Second
+)
+
+// Reasons recorded when a client disconnects
+const (
+	DisconnectClientClosed       = "client_closed"       // The client sent a close frame
+	DisconnectPongTimeout        = "pong_timeout"        // No pong or message arrived within the pong timeout
+	DisconnectReadError          = "read_error"          // The connection failed while reading
+	DisconnectWriteError         = "write_error"         // The connection failed while writing
+	DisconnectSlowConsumer       = "slow_consumer"       // The client couldn't keep up with its send queue
+	DisconnectCredentialsExpired = "credentials_expired" // The session or API key behind the ticket expired
+	DisconnectCredentialsRevoked = "credentials_revoked" // The session or API key behind the ticket was revoked
+	DisconnectServerClosed       = "server_closed"       // The server closed the connection
+)
+
+// closeCodeReasons maps server close codes to disconnect reasons
+var closeCodeReasons = map[int]string{
+	CloseSlowConsumer:      DisconnectSlowConsumer,
+	CloseCredentialExpired: DisconnectCredentialsExpired,
+	CloseCredentialRevoked: DisconnectCredentialsRevoked,
+}
+
+// Close codes sent when the server closes a connection for authentication reasons
+const (
+	// CloseTicketInvalid is sent when the ticket is missing, unknown, used or expired
+	CloseTicketInvalid = 4401
+	// CloseForbidden is sent when the credentials don't grant access to the hub
+	CloseForbidden = 4403
+	// CloseCredentialExpired is sent when the session or API key behind the ticket expires
+	CloseCredentialExpired = 4408
+	// CloseCredentialRevoked is sent when the session or API key behind the ticket is revoked
+	CloseCredentialRevoked = 4409
 )
 
 var (
@@ -30,63 +72,71 @@ var (
 	space   = []byte{' '}
 )
 
-// Client represents a connected websocket client
+// Client represents a connected websocket client.
+// Fields set before the client is registered with its hub are never written again,
+// counters are atomic and the remaining state is guarded by stateMutex or subMutex.
 type Client struct {
 	hub              *Hub
 	conn             *websocket.Conn
-	send             chan models.WebSocketMessage
+	queue            *sendQueue
 	id               string
 	logger           *logging.Logger
-	isAuthenticated  bool                // Track authentication status
-	metadata         map[string]string   // Metadata for storing client-specific info like station
-	connectedAt      time.Time           // When the client connected
-	lastActivity     time.Time           // Last time client sent/received a message
-	messagesSent     int                 // Number of messages sent to this client
-	messagesReceived int                 // Number of messages received from this client
-	remoteAddr       string              // Remote address of the client
-	userAgent        string              // User agent if available
-	lastHeartbeat    time.Time           // Last heartbeat sent to this client
+	authInfo         auth.AuthInfo     // Authentication info of the connecting request
+	connectedAt      time.Time         // When the client connected
+	remoteAddr       string            // Remote address of the client
+	userAgent        string            // User agent if available
+	messagesSent     atomic.Int64      // Number of messages sent to this client
+	messagesReceived atomic.Int64      // Number of messages received from this client
+	metadata         map[string]string // Metadata for storing client-specific info like station
+	lastActivity     time.Time         // Last time client sent/received a message
+	lastHeartbeat    time.Time         // Last heartbeat sent to this client
+	lastPong         time.Time         // Last protocol pong received from this client
+	disconnectReason string            // Why the client left, set once
+	disconnectedAt   time.Time         // When the client left
+	stateMutex       sync.RWMutex      // Protects metadata, timestamps and the disconnect reason
+	topics           map[Topic]bool    // Subscribed topics, nil means every topic
+	stationFilter    string            // Only deliver alerts paged to this station
+	subMutex         sync.RWMutex      // Protects topics and stationFilter
+	streamDone       chan struct{}     // Closed to end a server-sent event stream, nil for websocket clients
+	streamOnce       sync.Once
+	codec            codec // Frame encoding of the negotiated subprotocol
+	version          int   // Protocol version of the negotiated subprotocol
+	compressAbove    int   // Frames of at least this many bytes are compressed, when compression was negotiated
 }
 
 // MessageHandler is a function that handles incoming messages
 type MessageHandler func(message models.WebSocketMessage, client *Client)
 
 // NewClient creates a new websocket client
-func NewClient(hub *Hub, conn *websocket.Conn, logger *logging.Logger, isAuthenticated bool) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, logger *logging.Logger, authInfo auth.AuthInfo) *Client {
 	clientID := uuid.New().String()
 	now := time.Now()
-	
+
 	// Extract remote address and user agent if available
 	remoteAddr := ""
 	userAgent := ""
 	if conn.RemoteAddr() != nil {
 		remoteAddr = conn.RemoteAddr().String()
 	}
-	
-	if conn.UnderlyingConn() != nil {
-		if httpConn, ok := conn.UnderlyingConn().(interface{ RemoteAddr() string }); ok {
-			remoteAddr = httpConn.RemoteAddr()
-		}
-	}
-	
+
 	// We can't directly get the user agent from the WebSocket connection
 	// It would have to be passed from the HTTP request when upgrading
 
 	return &Client{
-		hub:              hub,
-		conn:             conn,
-		send:             make(chan models.WebSocketMessage, sendBufferSize),
-		id:               clientID,
-		logger:           logger.WithField("client_id", clientID),
-		isAuthenticated:  isAuthenticated,
-		metadata:         make(map[string]string),
-		connectedAt:      now,
-		lastActivity:     now,
-		messagesSent:     0,
-		messagesReceived: 0,
-		remoteAddr:       remoteAddr,
-		userAgent:        userAgent,
-		lastHeartbeat:    now,
+		hub:           hub,
+		conn:          conn,
+		queue:         newSendQueue(sendBufferSize, hub.slowConsumerPolicy, &hub.queueStats),
+		id:            clientID,
+		logger:        logger.WithField("client_id", clientID),
+		authInfo:      authInfo,
+		metadata:      make(map[string]string),
+		connectedAt:   now,
+		lastActivity:  now,
+		remoteAddr:    remoteAddr,
+		userAgent:     userAgent,
+		lastHeartbeat: now,
+		codec:         legacyCodec{},
+		version:       protocol.Version1,
 	}
 }
 
@@ -101,10 +151,23 @@ func (c *Client) ReadPump(messageHandler MessageHandler) {
 
 	c.conn.SetReadLimit(maxMessageSize)
 
+	// A client that sends nothing, not even a pong, within the pong timeout is dead
+	pongTimeout := c.hub.pongTimeout
+	c.refreshReadDeadline(pongTimeout)
+	c.conn.SetPongHandler(func(string) error {
+		c.stateMutex.Lock()
+		c.lastPong = time.Now()
+		c.lastActivity = c.lastPong
+		c.stateMutex.Unlock()
+		c.refreshReadDeadline(pongTimeout)
+		return nil
+	})
+
 	// Protocol-level ping handler
 	c.conn.SetPingHandler(func(appData string) error {
 		c.logger.Debug("Received protocol ping, sending protocol pong")
-		c.lastActivity = time.Now() // Update activity timestamp
+		c.touch() // Update activity timestamp
+		c.refreshReadDeadline(pongTimeout)
 		err := c.conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
 		if err != nil {
 			c.logger.Error(err, "Failed to send protocol pong")
@@ -114,67 +177,96 @@ func (c *Client) ReadPump(messageHandler MessageHandler) {
 	})
 
 	for {
-		_, messageBytes, err := c.conn.ReadMessage()
+		frameType, messageBytes, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.logger.Error(err, "Unexpected close error")
 			}
+			c.setDisconnectReason(readErrorReason(err))
 			break
 		}
 
-		// Update activity time and increment message count
-		c.lastActivity = time.Now()
-		c.messagesReceived++
-
-		messageBytes = bytes.TrimSpace(bytes.Replace(messageBytes, newline, space, -1))
+		// Update activity time and read deadline
+		c.touch()
+		c.refreshReadDeadline(pongTimeout)
 
-		// Parse the message
-		var message models.WebSocketMessage
-		if err := json.Unmarshal(messageBytes, &message); err != nil {
-			// If we can't unmarshal, create a simple message with the raw data
-			message = models.WebSocketMessage{
+		// Parse the frame, framed subprotocols may batch several messages
+		messages, err := c.codec.decode(frameType, messageBytes)
+		if err != nil && c.version >= protocol.Version2 {
+			c.messagesReceived.Add(1)
+			c.sendError(protocol.NewError(protocol.CodeMalformed, "Malformed message: %v", err), "")
+			continue
+		}
+		if err != nil {
+			// If we can't decode, create a simple message with the raw data
+			messages = []models.WebSocketMessage{{
 				Type:    "unknown",
-				Content: string(messageBytes),
+				Content: string(bytes.TrimSpace(bytes.Replace(messageBytes, newline, space, -1))),
 				ID:      uuid.New().String(),
 				Time:    time.Now(),
-			}
+			}}
 		}
 
-		// Log the incoming message (except ping messages)
-		if message.Type != "ping" {
-			c.logger.Debugf("Received %s message from client", message.Type)
-
-			// Log through the callback (except ping messages)
-			if c.hub != nil && c.hub.logMessageCallback != nil {
-				c.hub.logMessageCallback(message, "client", c.id)
-			}
+		for _, message := range messages {
+			c.messagesReceived.Add(1)
+			c.handleMessage(message, messageHandler)
 		}
+	}
+}
 
-		// Handle ping messages at application level
-		if message.Type == "ping" {
-			pongMessage := models.WebSocketMessage{
-				Type:    "pong",
-				Content: map[string]interface{}{"timestamp": time.Now().Unix()},
-				ID:      uuid.New().String(),
-				Time:    time.Now(),
-			}
+// handleMessage decodes the content of a message to its typed form, answers application
+// pings and passes other messages to the handler
+func (c *Client) handleMessage(message models.WebSocketMessage, messageHandler MessageHandler) {
+	// Log the incoming message (except ping messages)
+	if message.Type != "ping" {
+		c.logger.Debugf("Received %s message from client", message.Type)
 
-			c.send <- pongMessage
-			continue
+		// Log through the callback (except ping messages)
+		if c.hub != nil && c.hub.logMessageCallback != nil {
+			c.hub.logMessageCallback(message, "client", c.id)
+		}
+	}
+
+	// Version 2 clients may only send the message types of their hub. The unknown
+	// messages of version 1 clients are left to the handler.
+	if spec, ok := protocol.ClientMessage(string(c.hub.hubType), message.Type); ok {
+		content, err := spec.Decode(message.Content, c.version >= protocol.Version2)
+		if err != nil {
+			c.sendError(err, message.ID)
+			return
 		}
+		message.Content = content
+	} else if c.version >= protocol.Version2 {
+		c.sendError(protocol.NewError(protocol.CodeUnknownType, "The %s hub doesn't accept %s messages", c.hub.hubType, message.Type), message.ID)
+		return
+	}
 
-		// Process the message with the handler
-		if messageHandler != nil {
-			messageHandler(message, c)
+	// Handle ping messages at application level
+	if message.Type == "ping" {
+		pongMessage := models.WebSocketMessage{
+			Type:    "pong",
+			Content: protocol.Heartbeat{Timestamp: time.Now().Unix()},
+			ID:      uuid.New().String(),
+			Time:    time.Now(),
 		}
+
+		c.enqueue(pongMessage)
+		return
+	}
+
+	// Process the message with the handler
+	if messageHandler != nil {
+		messageHandler(message, c)
 	}
 }
 
 // WritePump pumps messages from the hub to the websocket connection
 func (c *Client) WritePump() {
 	heartbeatTicker := time.NewTicker(heartbeatPeriod)
+	pingTicker := time.NewTicker(c.hub.pingInterval)
 	defer func() {
 		heartbeatTicker.Stop()
+		pingTicker.Stop()
 		if err := c.conn.Close(); err != nil {
 			c.logger.Error(err, "Error closing WebSocket connection")
 		}
@@ -182,101 +274,209 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				c.logger.Error(err, "Failed to set write deadline")
-				return
-			}
-
-			if !ok {
-				if err := c.conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil {
-					c.logger.Error(err, "Failed to write close message")
-				}
+		case <-c.queue.ready:
+			if closed, code, reason := c.queue.closeStatus(); closed {
+				c.writeClose(code, reason)
 				return
 			}
 
-			// Increment sent message count and update last activity time
-			c.messagesSent++
-			c.lastActivity = time.Now()
-
-			messageBytes, err := json.Marshal(message)
-			if err != nil {
-				c.logger.Error(err, "Failed to marshal message")
-				continue
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			// Alerts are written first, batched into frames when the subprotocol allows it
+			if !c.writeMessages(c.queue.popAll()) {
+				c.setDisconnectReason(DisconnectWriteError)
 				return
 			}
 
-			if _, err := w.Write(messageBytes); err != nil {
-				c.logger.Error(err, "Failed to write message")
+		case <-pingTicker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.logger.Debugf("Failed to send protocol ping: %v", err)
+				c.setDisconnectReason(DisconnectWriteError)
 				return
 			}
 
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				nextMessage := <-c.send
-				
-				// Count each queued message separately
-				c.messagesSent++
-				
-				nextMessageBytes, err := json.Marshal(nextMessage)
-				if err != nil {
-					c.logger.Error(err, "Failed to marshal queued message")
-					continue
-				}
-
-				if _, err := w.Write(newline); err != nil {
-					c.logger.Error(err, "Failed to write newline")
-					return
-				}
-
-				if _, err := w.Write(nextMessageBytes); err != nil {
-					c.logger.Error(err, "Failed to write queued message")
-					return
-				}
-			}
+		case <-heartbeatTicker.C:
+			now := time.Now()
 
-			if err := w.Close(); err != nil {
+			// Close connections whose session or API key has expired
+			if !c.authInfo.ExpiresAt.IsZero() && now.After(c.authInfo.ExpiresAt) {
+				c.logger.Infof("Closing connection, credentials expired at %s", c.authInfo.ExpiresAt)
+				c.Close(CloseCredentialExpired, "credentials expired")
 				return
 			}
 
-		case <-heartbeatTicker.C:
 			c.logger.Debug("Sending heartbeat to client")
-			now := time.Now()
+			c.stateMutex.Lock()
 			c.lastHeartbeat = now
-			
+			c.stateMutex.Unlock()
+
 			heartbeat := models.WebSocketMessage{
 				Type:    "heartbeat",
-				Content: map[string]interface{}{"timestamp": now.Unix()},
+				Content: protocol.Heartbeat{Timestamp: now.Unix()},
 				ID:      uuid.New().String(),
 				Time:    now,
 			}
 
-			if err := c.conn.SetWriteDeadline(now.Add(writeWait)); err != nil {
-				c.logger.Error(err, "Failed to set write deadline for heartbeat")
+			if !c.writeFrame([]models.WebSocketMessage{heartbeat}) {
+				c.setDisconnectReason(DisconnectWriteError)
 				return
 			}
+		}
+	}
+}
 
-			// Marshal and send the heartbeat
-			heartbeatBytes, err := json.Marshal(heartbeat)
-			if err != nil {
-				c.logger.Error(err, "Failed to marshal heartbeat")
-				continue
-			}
+// Close sends a close frame with the given code and reason, then closes the connection.
+// The read pump then unregisters the client from its hub. Event streams are ended instead.
+func (c *Client) Close(code int, reason string) {
+	c.setDisconnectReason(disconnectReasonForCode(code))
+	if c.conn == nil {
+		c.endStream()
+		return
+	}
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait)); err != nil {
+		c.logger.Debugf("Failed to write close message: %v", err)
+	}
+	if err := c.conn.Close(); err != nil {
+		c.logger.Debugf("Failed to close connection: %v", err)
+	}
+}
 
-			// Count the heartbeat as a message sent
-			c.messagesSent++
-			c.lastActivity = now
+// writeMessages writes messages to the connection, one per frame or in batches of up to
+// maxBatchSize when the subprotocol frames batches. It returns false when the connection failed.
+func (c *Client) writeMessages(messages []models.WebSocketMessage) bool {
+	for len(messages) > 0 {
+		size := 1
+		if c.codec.batched() {
+			size = min(len(messages), maxBatchSize)
+		}
+		if !c.writeFrame(messages[:size]) {
+			return false
+		}
+		messages = messages[size:]
+	}
+	return true
+}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, heartbeatBytes); err != nil {
-				c.logger.Error(err, "Failed to send heartbeat")
-				return
-			}
+// writeFrame writes messages as a single frame. It returns false when the connection failed.
+func (c *Client) writeFrame(messages []models.WebSocketMessage) bool {
+	frameType, data, err := c.codec.encode(messages)
+	if err != nil {
+		c.logger.Error(err, "Failed to encode message")
+		return true
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		c.logger.Error(err, "Failed to set write deadline")
+		return false
+	}
+
+	// Compressing small frames costs more than it saves
+	c.conn.EnableWriteCompression(len(data) >= c.compressAbove)
+	if err := c.conn.WriteMessage(frameType, data); err != nil {
+		c.logger.Error(err, "Failed to write message")
+		return false
+	}
+
+	// Increment sent message count and update last activity time
+	c.messagesSent.Add(int64(len(messages)))
+	c.touch()
+	for _, message := range messages {
+		c.markDelivered(message)
+	}
+	return true
+}
+
+// refreshReadDeadline extends the time the client has to send its next pong or message
+func (c *Client) refreshReadDeadline(pongTimeout time.Duration) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(pongTimeout)); err != nil {
+		c.logger.Debugf("Failed to set read deadline: %v", err)
+	}
+}
+
+// setDisconnectReason records why the client left. Only the first reason is kept.
+func (c *Client) setDisconnectReason(reason string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	if c.disconnectReason == "" {
+		c.disconnectReason = reason
+	}
+}
+
+// markDisconnected records the disconnect time, defaulting the reason when none was set
+func (c *Client) markDisconnected() {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.disconnectedAt = time.Now()
+	if c.disconnectReason == "" {
+		c.disconnectReason = DisconnectServerClosed
+	}
+}
+
+// readErrorReason classifies the error that ended the read pump
+func readErrorReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return DisconnectClientClosed
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return DisconnectPongTimeout
+	}
+
+	return DisconnectReadError
+}
+
+// disconnectReasonForCode returns the disconnect reason of a server close code
+func disconnectReasonForCode(code int) string {
+	if reason, ok := closeCodeReasons[code]; ok {
+		return reason
+	}
+	return DisconnectServerClosed
+}
+
+// touch records activity on the connection
+func (c *Client) touch() {
+	c.stateMutex.Lock()
+	c.lastActivity = time.Now()
+	c.stateMutex.Unlock()
+}
+
+// writeClose writes a close frame after the send queue was closed. A zero code sends an empty close frame.
+func (c *Client) writeClose(code int, reason string) {
+	if code == 0 {
+		if err := c.conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil {
+			c.logger.Error(err, "Failed to write close message")
 		}
+		return
+	}
+
+	c.logger.Warnf("Closing connection: %s", reason)
+	c.setDisconnectReason(disconnectReasonForCode(code))
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait)); err != nil {
+		c.logger.Debugf("Failed to write close message: %v", err)
+	}
+}
+
+// enqueue queues a message for the write pump, applying the hub's slow consumer policy
+func (c *Client) enqueue(message models.WebSocketMessage) {
+	if err := c.queue.push(message); err == errSlowConsumer {
+		c.logger.Warnf("Disconnecting slow client from %s hub: %d messages queued", c.hub.hubType, c.queue.depth())
+	}
+}
+
+// QueueDepth returns the number of messages waiting to be written to the client
+func (c *Client) QueueDepth() int {
+	return c.queue.depth()
+}
+
+// markDelivered records the delivery of alert messages with the hub's delivery tracker
+func (c *Client) markDelivered(message models.WebSocketMessage) {
+	if c.hub == nil || c.hub.deliveries == nil {
+		return
+	}
+	if alertID := alertIDOf(message); alertID != "" {
+		c.hub.deliveries.MarkDelivered(alertID, c)
 	}
 }
 
@@ -287,14 +487,93 @@ func (c *Client) GetID() string {
 
 // GetMetadata returns a specific metadata value
 func (c *Client) GetMetadata(key string) string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
 	return c.metadata[key]
 }
 
 // SetMetadata sets a metadata value
 func (c *Client) SetMetadata(key, value string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
 	c.metadata[key] = value
 }
 
+// clientState is a consistent snapshot of a client's mutable state
+type clientState struct {
+	metadata         map[string]string
+	lastActivity     time.Time
+	lastHeartbeat    time.Time
+	lastPong         time.Time
+	disconnectReason string
+	disconnectedAt   time.Time
+}
+
+// state returns a snapshot of the client's mutable state
+func (c *Client) state() clientState {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	metadata := make(map[string]string, len(c.metadata))
+	for key, value := range c.metadata {
+		metadata[key] = value
+	}
+
+	return clientState{
+		metadata:         metadata,
+		lastActivity:     c.lastActivity,
+		lastHeartbeat:    c.lastHeartbeat,
+		lastPong:         c.lastPong,
+		disconnectReason: c.disconnectReason,
+		disconnectedAt:   c.disconnectedAt,
+	}
+}
+
+// detail describes the client for the admin connection endpoints
+func (c *Client) detail() models.ConnectionDetail {
+	state := c.state()
+
+	topics, stationFilter := c.Subscriptions()
+	topicNames := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		topicNames = append(topicNames, string(topic))
+	}
+
+	return models.ConnectionDetail{
+		ID:                c.id,
+		ConnectedAt:       c.connectedAt,
+		IsAuthenticated:   c.authInfo.Authenticated,
+		Role:              string(c.authInfo.Role),
+		Username:          c.authInfo.Username,
+		DeviceID:          c.authInfo.DeviceID,
+		Group:             c.group(),
+		Station:           c.station(),
+		Topics:            topicNames,
+		StationFilter:     stationFilter,
+		RemoteAddr:        c.remoteAddr,
+		LastActivity:      state.lastActivity,
+		MessagesSent:      int(c.messagesSent.Load()),
+		MessagesReceived:  int(c.messagesReceived.Load()),
+		QueueDepth:        c.QueueDepth(),
+		MessagesDropped:   c.queue.stats.dropped.Load(),
+		MessagesCoalesced: c.queue.stats.coalesced.Load(),
+		UserAgent:         c.userAgent,
+		Metadata:          state.metadata,
+		LastHeartbeatSent: timePtr(state.lastHeartbeat),
+		LastPongAt:        timePtr(state.lastPong),
+		DisconnectedAt:    timePtr(state.disconnectedAt),
+		DisconnectReason:  state.disconnectReason,
+	}
+}
+
+// timePtr returns nil for the zero time so it is left out of JSON
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 // SendMessage sends a message to this client
 func (c *Client) SendMessage(messageType string, content interface{}) {
 	message := models.WebSocketMessage{
@@ -315,5 +594,18 @@ func (c *Client) SendMessage(messageType string, content interface{}) {
 		}
 	}
 
-	c.send <- message
+	c.enqueue(message)
+}
+
+// sendError rejects a client message. Version 1 clients get the error message as a string,
+// later versions the code and the ID of the rejected message.
+func (c *Client) sendError(err *protocol.Error, refID string) {
+	if c.version < protocol.Version2 {
+		c.SendMessage("error", err.Message)
+		return
+	}
+
+	reply := *err
+	reply.RefID = refID
+	c.SendMessage("error", reply)
 }
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Version 1 subprotocols a client can request with Sec-WebSocket-Protocol. Clients that request
+// no subprotocol get one JSON message per text frame, as before subprotocols existed.
+// The version 2 subprotocols are defined by the protocol package.
+const (
+	// SubprotocolJSON frames every message as a JSON array of one or more messages
+	SubprotocolJSON = "alerting+json"
+	// SubprotocolMsgpack frames every message as a MessagePack array of one or more messages
+	SubprotocolMsgpack = "alerting+msgpack"
+)
+
+// subprotocols lists the supported subprotocols, most preferred first
+var subprotocols = []string{protocol.SubprotocolMsgpack, protocol.SubprotocolJSON, SubprotocolMsgpack, SubprotocolJSON}
+
+// maxBatchSize bounds how many queued messages are written in one frame
+const maxBatchSize = 64
+
+// codec encodes outgoing frames and decodes incoming frames for one subprotocol
+type codec interface {
+	// batched reports whether a frame can hold several messages
+	batched() bool
+	// encode builds a frame from messages. Unbatched codecs are given one message at a time.
+	encode(messages []models.WebSocketMessage) (frameType int, data []byte, err error)
+	// decode reads the messages in a frame
+	decode(frameType int, data []byte) ([]models.WebSocketMessage, error)
+}
+
+// negotiated returns the codec and protocol version of a negotiated subprotocol
+func negotiated(subprotocol string) (codec, int) {
+	switch subprotocol {
+	case protocol.SubprotocolMsgpack:
+		return msgpackCodec{}, protocol.Version2
+	case protocol.SubprotocolJSON:
+		return jsonCodec{}, protocol.Version2
+	case SubprotocolMsgpack:
+		return msgpackCodec{}, protocol.Version1
+	case SubprotocolJSON:
+		return jsonCodec{}, protocol.Version1
+	default:
+		return legacyCodec{}, protocol.Version1
+	}
+}
+
+// legacyCodec writes one JSON message per text frame
+type legacyCodec struct{}
+
+func (legacyCodec) batched() bool {
+	return false
+}
+
+func (legacyCodec) encode(messages []models.WebSocketMessage) (int, []byte, error) {
+	if len(messages) != 1 {
+		return 0, nil, fmt.Errorf("legacy frames hold exactly one message, got %d", len(messages))
+	}
+	data, err := json.Marshal(messages[0])
+	return websocket.TextMessage, data, err
+}
+
+func (legacyCodec) decode(frameType int, data []byte) ([]models.WebSocketMessage, error) {
+	data = bytes.TrimSpace(bytes.Replace(data, newline, space, -1))
+
+	var message models.WebSocketMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return []models.WebSocketMessage{message}, nil
+}
+
+// jsonCodec writes JSON arrays of messages in text frames. It also reads single messages.
+type jsonCodec struct{}
+
+func (jsonCodec) batched() bool {
+	return true
+}
+
+func (jsonCodec) encode(messages []models.WebSocketMessage) (int, []byte, error) {
+	data, err := json.Marshal(messages)
+	return websocket.TextMessage, data, err
+}
+
+func (jsonCodec) decode(frameType int, data []byte) ([]models.WebSocketMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		return legacyCodec{}.decode(frameType, data)
+	}
+
+	var messages []models.WebSocketMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// msgpackCodec writes MessagePack arrays of messages in binary frames. Messages have the same
+// structure as in JSON, so times are RFC 3339 strings. It also reads single messages.
+type msgpackCodec struct{}
+
+func (msgpackCodec) batched() bool {
+	return true
+}
+
+func (msgpackCodec) encode(messages []models.WebSocketMessage) (int, []byte, error) {
+	generic, err := toGeneric(messages)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := msgpack.Marshal(generic)
+	return websocket.BinaryMessage, data, err
+}
+
+func (msgpackCodec) decode(frameType int, data []byte) ([]models.WebSocketMessage, error) {
+	var decoded interface{}
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	// Decode through JSON so content takes the same shape as for JSON clients
+	raw, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, err
+	}
+	if _, single := decoded.(map[string]interface{}); single {
+		return legacyCodec{}.decode(frameType, raw)
+	}
+	return jsonCodec{}.decode(frameType, raw)
+}
+
+// toGeneric converts a value to the maps, slices and scalars of its JSON encoding,
+// keeping integers as integers
+func toGeneric(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return nativeNumbers(generic), nil
+}
+
+// nativeNumbers replaces the json.Number values of a decoded JSON value with int64 or float64
+func nativeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = nativeNumbers(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = nativeNumbers(item)
+		}
+		return value
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	default:
+		return v
+	}
+}
@@ -0,0 +1,153 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/protocol"
+	ws "github.com/user/alerting/server/internal/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// dialSubprotocol connects to the dashboard with a subprotocol and compression offered
+func dialSubprotocol(t *testing.T, server *testServer, subprotocol string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}, EnableCompression: true}
+	conn, resp, err := dialer.Dial(server.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect with %s: %v", subprotocol, err)
+	}
+	if conn.Subprotocol() != subprotocol {
+		t.Fatalf("Expected subprotocol %s, got %q", subprotocol, conn.Subprotocol())
+	}
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Errorf("Expected permessage-deflate to be negotiated, got %q", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+	return conn
+}
+
+// readBatch reads the next frame and decodes it as an array of messages
+func readBatch(t *testing.T, conn *websocket.Conn, frameType int, decode func([]byte, any) error) []map[string]interface{} {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	gotType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if gotType != frameType {
+		t.Fatalf("Expected frame type %d, got %d", frameType, gotType)
+	}
+
+	var batch []map[string]interface{}
+	if err := decode(data, &batch); err != nil {
+		t.Fatalf("Frame is not a batch of messages: %v", err)
+	}
+	return batch
+}
+
+// readFrames reads frames until count messages of the given type have arrived and returns the last
+func readFrames(t *testing.T, conn *websocket.Conn, frameType int, messageType string, count int, decode func([]byte, any) error) map[string]interface{} {
+	t.Helper()
+
+	for {
+		for _, message := range readBatch(t, conn, frameType, decode) {
+			if message["type"] != messageType {
+				continue
+			}
+			if count--; count == 0 {
+				return message
+			}
+		}
+	}
+}
+
+// TestSubprotocolFraming exchanges batched frames with MessagePack and JSON subprotocol clients
+func TestSubprotocolFraming(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+	server.handler.SetCompression(true, 0)
+
+	packed := dialSubprotocol(t, server, ws.SubprotocolMsgpack)
+	defer packed.Close()
+	framed := dialSubprotocol(t, server, ws.SubprotocolJSON)
+	defer framed.Close()
+	server.waitForClients(t, 2)
+
+	server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 20, "wind": 3.5})
+
+	weather := readFrames(t, packed, websocket.BinaryMessage, "weather_update", 1, msgpack.Unmarshal)
+	content, _ := weather["content"].(map[string]interface{})
+	if fmt.Sprint(content["temperature"]) != "20" || fmt.Sprint(content["wind"]) != "3.5" {
+		t.Errorf("Unexpected MessagePack content %v", content)
+	}
+	if _, ok := weather["time"].(string); !ok {
+		t.Errorf("Expected the time as a string, got %T", weather["time"])
+	}
+	readFrames(t, framed, websocket.TextMessage, "weather_update", 1, json.Unmarshal)
+
+	// Clients may send a single message or a batch
+	ping, err := msgpack.Marshal(map[string]interface{}{"type": "ping"})
+	if err != nil {
+		t.Fatalf("Failed to encode ping: %v", err)
+	}
+	if err := packed.WriteMessage(websocket.BinaryMessage, ping); err != nil {
+		t.Fatalf("Failed to send ping: %v", err)
+	}
+	readFrames(t, packed, websocket.BinaryMessage, "pong", 1, msgpack.Unmarshal)
+
+	if err := framed.WriteMessage(websocket.TextMessage, []byte(`[{"type":"ping"},{"type":"ping"}]`)); err != nil {
+		t.Fatalf("Failed to send pings: %v", err)
+	}
+	readFrames(t, framed, websocket.TextMessage, "pong", 2, json.Unmarshal)
+}
+
+// TestVersion2Errors answers invalid messages from a version 2 client with structured errors
+func TestVersion2Errors(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+	server.handler.SetCompression(true, 1024)
+
+	conn := dialSubprotocol(t, server, protocol.SubprotocolJSON)
+	defer conn.Close()
+	server.waitForClients(t, 1)
+
+	batch := `[{"type":"shout","id":"m1"},{"type":"resume","id":"m2","content":{"last_seq":"4"}},{"type":"ack","id":"m3","content":{"alert_id":"a","extra":1}}]`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(batch)); err != nil {
+		t.Fatalf("Failed to send messages: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatalf("Failed to send garbage: %v", err)
+	}
+
+	expected := []protocol.Error{
+		{Code: protocol.CodeUnknownType, RefID: "m1"},
+		{Code: protocol.CodeInvalidContent, Field: "last_seq", RefID: "m2"},
+		{Code: protocol.CodeInvalidContent, Field: "extra", RefID: "m3"},
+		{Code: protocol.CodeMalformed},
+	}
+	var received []protocol.Error
+	for len(received) < len(expected) {
+		for _, message := range readBatch(t, conn, websocket.TextMessage, json.Unmarshal) {
+			if message["type"] != "error" {
+				continue
+			}
+			content, _ := message["content"].(map[string]interface{})
+			code, _ := content["code"].(string)
+			field, _ := content["field"].(string)
+			refID, _ := content["ref_id"].(string)
+			received = append(received, protocol.Error{Code: code, Field: field, RefID: refID})
+		}
+	}
+
+	for i, want := range expected {
+		if received[i] != want {
+			t.Errorf("Error %d: expected %+v, got %+v", i, want, received[i])
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// commandAckTimeout is how long targets have to acknowledge a command
+const commandAckTimeout = 15 * time.Second
+
+// maxShowMessageLength bounds the text of show_message commands
+const maxShowMessageLength = 500
+
+// Command statuses reported back to the issuer
+const (
+	CommandStatusOK      = "ok"
+	CommandStatusError   = "error"
+	CommandStatusTimeout = "timeout"
+)
+
+// commandValidators check the arguments of each command type
+var commandValidators = map[string]func(args map[string]interface{}) error{
+	"refresh": noArgs,
+	"redirect": func(args map[string]interface{}) error {
+		target, ok := args["url"].(string)
+		if !ok || target == "" {
+			return fmt.Errorf("url is required")
+		}
+		if !validRedirect(target) {
+			return fmt.Errorf("url must be an absolute http(s) URL or a path")
+		}
+		return nil
+	},
+	"set_volume": func(args map[string]interface{}) error {
+		level, ok := args["level"].(float64)
+		if !ok || level < 0 || level > 100 || level != float64(int(level)) {
+			return fmt.Errorf("level must be a whole number from 0 to 100")
+		}
+		return nil
+	},
+	"mute": func(args map[string]interface{}) error {
+		if muted, ok := args["muted"]; ok {
+			if _, ok := muted.(bool); !ok {
+				return fmt.Errorf("muted must be a boolean")
+			}
+		}
+		return nil
+	},
+	"test_tone": func(args map[string]interface{}) error {
+		return optionalDuration(args, 1, 30)
+	},
+	"show_message": func(args map[string]interface{}) error {
+		text, ok := args["text"].(string)
+		if !ok || text == "" {
+			return fmt.Errorf("text is required")
+		}
+		if len(text) > maxShowMessageLength {
+			return fmt.Errorf("text must be at most %d characters", maxShowMessageLength)
+		}
+		return optionalDuration(args, 0, 3600)
+	},
+	"screen_on":     noArgs,
+	"screen_off":    noArgs,
+	"reload_config": noArgs,
+}
+
+// noArgs accepts commands that take no arguments
+func noArgs(map[string]interface{}) error {
+	return nil
+}
+
+// optionalDuration checks an optional duration_seconds argument is within bounds
+func optionalDuration(args map[string]interface{}, min, max float64) error {
+	value, ok := args["duration_seconds"]
+	if !ok {
+		return nil
+	}
+	seconds, ok := value.(float64)
+	if !ok || seconds < min || seconds > max {
+		return fmt.Errorf("duration_seconds must be from %g to %g", min, max)
+	}
+	return nil
+}
+
+// targetMatches reports whether a client is selected by a command target.
+// A client matches when it matches any of the target's fields; an empty target matches every client.
+func targetMatches(target models.CommandTarget, client *Client) bool {
+	if target.IsEmpty() {
+		return true
+	}
+	for _, id := range target.ClientIDs {
+		if id == client.id {
+			return true
+		}
+	}
+	if target.Station != "" && client.station() == target.Station {
+		return true
+	}
+	if target.Group != "" && client.group() == target.Group {
+		return true
+	}
+	return false
+}
+
+// CommandOutcome summarizes the acknowledgements of a command once every target has answered or timed out
+type CommandOutcome struct {
+	CommandID    string   `json:"command_id"`
+	Command      string   `json:"command"`
+	Targets      []string `json:"targets"`
+	Acknowledged int      `json:"acknowledged"`
+	Failed       int      `json:"failed"`
+	TimedOut     int      `json:"timed_out"`
+}
+
+// pendingCommand tracks the targets that haven't acknowledged a command yet
+type pendingCommand struct {
+	outcome  CommandOutcome
+	issuer   *Client                  // Admin connection that sent the command, nil for server commands
+	refID    string                   // ID of the issuer's command message
+	onDone   func(CommandOutcome)     // Called once every target answered or timed out, may be nil
+	waiting  map[string]*Client       // Targets by client ID
+	shared   bool                     // Also sent to the displays of the other instances
+	remote   map[string]commandTarget // Targets of other instances that haven't answered, shared commands only
+	answered map[string]bool          // Targets of other instances that answered, shared commands only
+	origin   string                   // Instance that issued a command relayed from the bus, empty for commands issued here
+	timer    *time.Timer
+}
+
+// waitsForTimeout reports whether the command stays pending until the acknowledgement timeout,
+// because targets on other instances may still be announced or the bus may deliver it again
+func (p *pendingCommand) waitsForTimeout() bool {
+	return p.shared || p.origin != ""
+}
+
+// commandRouter sends commands to targeted clients and routes their acknowledgements to the issuer
+type commandRouter struct {
+	hub      *Hub
+	pending  map[string]*pendingCommand
+	bus      EventBus // Carries commands to the other server instances, nil for a single instance
+	instance string   // Identifies this router on the bus
+	mutex    sync.Mutex
+}
+
+// newCommandRouter creates a router for the clients of a hub
+func newCommandRouter(hub *Hub) *commandRouter {
+	return &commandRouter{
+		hub:     hub,
+		pending: make(map[string]*pendingCommand),
+	}
+}
+
+// validRedirect reports whether a redirect target is an absolute http(s) URL with a host, or a
+// path on the display's own site. Scheme-relative URLs such as //host are rejected, and so are
+// backslashes and surrounding spaces, which browsers treat as slashes and strip.
+func validRedirect(target string) bool {
+	if strings.Contains(target, "\\") || strings.TrimSpace(target) != target {
+		return false
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return parsed.Host != ""
+	case "":
+		return parsed.Host == "" && !strings.HasPrefix(target, "//")
+	default:
+		return false
+	}
+}
+
+// ValidateCommand checks a command name and its arguments
+func ValidateCommand(command string, args map[string]interface{}) error {
+	validate, ok := commandValidators[command]
+	if !ok {
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err := validate(args); err != nil {
+		return fmt.Errorf("invalid %s command: %v", command, err)
+	}
+	return nil
+}
+
+// SendCommand sends a control command from the server to the targeted display clients.
+// onDone is called with the outcome once every target answered or timed out, unless no client matched.
+// When commands are shared, the returned outcome only lists the targets of this instance and
+// onDone is always called, once the acknowledgement timeout has passed.
+func (h *Handler) SendCommand(command string, args map[string]interface{}, target models.CommandTarget, onDone func(CommandOutcome)) (CommandOutcome, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	if err := ValidateCommand(command, args); err != nil {
+		return CommandOutcome{}, err
+	}
+
+	outcome := h.commands.send(nil, "", protocol.Command{Command: command, Args: args, Target: target}, onDone)
+	h.logger.Infof("Server sent %s command %s to %d clients", command, outcome.CommandID, len(outcome.Targets))
+	return outcome, nil
+}
+
+// send delivers a command to every matching client except the issuer, and through the bus
+// to the matching clients of the other instances. onDone is called with the outcome once every
+// target answered or timed out, unless nothing matched and the command isn't shared.
+func (r *commandRouter) send(issuer *Client, refID string, req protocol.Command, onDone func(CommandOutcome)) CommandOutcome {
+	commandID := uuid.New().String()
+
+	pending := &pendingCommand{
+		outcome: CommandOutcome{
+			CommandID: commandID,
+			Command:   req.Command,
+			Targets:   make([]string, 0),
+		},
+		issuer:  issuer,
+		refID:   refID,
+		onDone:  onDone,
+		waiting: make(map[string]*Client),
+		shared:  r.bus != nil,
+	}
+	if pending.shared {
+		pending.remote = make(map[string]commandTarget)
+		pending.answered = make(map[string]bool)
+	}
+
+	targets := r.matching(issuer, req.Target)
+	for _, client := range targets {
+		pending.waiting[client.id] = client
+		pending.outcome.Targets = append(pending.outcome.Targets, client.id)
+	}
+	outcome := pending.outcome
+	outcome.Targets = slices.Clone(outcome.Targets)
+
+	if len(targets) == 0 && !pending.shared {
+		return outcome
+	}
+
+	r.register(pending)
+	r.deliver(targets, commandID, req)
+
+	if pending.shared {
+		go r.publish("command", relayedCommand{
+			Origin:    r.instance,
+			CommandID: commandID,
+			Command:   req.Command,
+			Args:      req.Args,
+			Target:    req.Target,
+		})
+	}
+
+	return outcome
+}
+
+// matching returns the clients of this instance selected by a command target, except the issuer
+func (r *commandRouter) matching(issuer *Client, target models.CommandTarget) []*Client {
+	targets := make([]*Client, 0)
+	for _, client := range r.hub.GetClients() {
+		if client != issuer && targetMatches(target, client) {
+			targets = append(targets, client)
+		}
+	}
+	return targets
+}
+
+// register tracks a command until its targets answer or the acknowledgement timeout passes
+func (r *commandRouter) register(pending *pendingCommand) {
+	commandID := pending.outcome.CommandID
+
+	r.mutex.Lock()
+	r.pending[commandID] = pending
+	pending.timer = time.AfterFunc(commandAckTimeout, func() {
+		r.expire(commandID)
+	})
+	r.mutex.Unlock()
+}
+
+// deliver sends a command to its targets as a message of its own type, with the arguments
+// and command ID as content
+func (r *commandRouter) deliver(targets []*Client, commandID string, req protocol.Command) {
+	content := protocol.DisplayCommand{CommandID: commandID, Args: req.Args}
+	for _, client := range targets {
+		client.SendMessage(req.Command, content)
+	}
+}
+
+// acknowledge routes a display's acknowledgement to the client that issued the command
+func (r *commandRouter) acknowledge(client *Client, ack protocol.CommandAck) bool {
+	status := ack.Status
+	if status != CommandStatusError {
+		status = CommandStatusOK
+	}
+
+	r.mutex.Lock()
+	pending, ok := r.pending[ack.CommandID]
+	if ok {
+		_, ok = pending.waiting[client.id]
+	}
+	done := false
+	var outcome CommandOutcome
+	if ok {
+		delete(pending.waiting, client.id)
+		if status == CommandStatusOK {
+			pending.outcome.Acknowledged++
+		} else {
+			pending.outcome.Failed++
+		}
+		if len(pending.waiting) == 0 && !pending.waitsForTimeout() {
+			pending.timer.Stop()
+			delete(r.pending, ack.CommandID)
+			done = true
+			outcome = pending.outcome
+		}
+	}
+	r.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	result := commandResult(ack.CommandID, pending.outcome.Command, targetOf(client), status, ack.Error, ack.Result)
+	if pending.issuer != nil {
+		pending.issuer.SendMessage("command_result", result)
+	}
+	if pending.origin != "" {
+		go r.publish("command_result", relayedResult{Origin: pending.origin, Result: result})
+	}
+	if done && pending.onDone != nil {
+		pending.onDone(outcome)
+	}
+	return true
+}
+
+// expire reports every target that didn't acknowledge a command in time
+func (r *commandRouter) expire(commandID string) {
+	r.mutex.Lock()
+	pending, ok := r.pending[commandID]
+	delete(r.pending, commandID)
+	var outcome CommandOutcome
+	if ok {
+		pending.outcome.TimedOut += len(pending.waiting) + len(pending.remote)
+		outcome = pending.outcome
+	}
+	r.mutex.Unlock()
+
+	// The instance that issued a relayed command reports its timeouts
+	if !ok || pending.origin != "" {
+		return
+	}
+
+	if pending.issuer != nil {
+		for _, client := range pending.waiting {
+			pending.issuer.SendMessage("command_result",
+				commandResult(commandID, outcome.Command, targetOf(client), CommandStatusTimeout, "no acknowledgement received", nil))
+		}
+		for _, target := range pending.remote {
+			pending.issuer.SendMessage("command_result",
+				commandResult(commandID, outcome.Command, target, CommandStatusTimeout, "no acknowledgement received", nil))
+		}
+		if len(outcome.Targets) == 0 {
+			pending.issuer.sendError(protocol.NewError(protocol.CodeNoTargets, "No clients match the %s command target", outcome.Command), pending.refID)
+		}
+	}
+	if pending.onDone != nil {
+		pending.onDone(outcome)
+	}
+}
+
+// commandTarget identifies a client a command was sent to
+type commandTarget struct {
+	ClientID string `json:"client_id"`
+	Station  string `json:"station"`
+	Group    string `json:"group"`
+}
+
+// targetOf describes a client of this instance as a command target
+func targetOf(client *Client) commandTarget {
+	return commandTarget{ClientID: client.id, Station: client.station(), Group: client.group()}
+}
+
+// commandResult builds the content of a command_result message
+func commandResult(commandID, command string, target commandTarget, status, errMessage string, result interface{}) protocol.CommandResult {
+	return protocol.CommandResult{
+		CommandID: commandID,
+		Command:   command,
+		ClientID:  target.ClientID,
+		Station:   target.Station,
+		Group:     target.Group,
+		Status:    status,
+		Error:     errMessage,
+		Result:    result,
+	}
+}
+
+// handleCommand validates a command from an admin connection, sends it to its targets
+// and tells the issuer which clients it went to
+func (h *Handler) handleCommand(client *Client, refID string, req protocol.Command) {
+	if req.Args == nil {
+		req.Args = map[string]interface{}{}
+	}
+	if _, ok := commandValidators[req.Command]; !ok {
+		client.sendError(protocol.FieldError("command", "unknown command %q", req.Command), refID)
+		return
+	}
+	if err := ValidateCommand(req.Command, req.Args); err != nil {
+		client.sendError(protocol.FieldError("args", "%v", err), refID)
+		return
+	}
+
+	// Shared commands may match clients of other instances, a shared command without any
+	// target is reported once the acknowledgement timeout has passed
+	outcome := h.commands.send(client, refID, req, nil)
+	if len(outcome.Targets) == 0 && h.commands.bus == nil {
+		client.sendError(protocol.NewError(protocol.CodeNoTargets, "No clients match the %s command target", req.Command), refID)
+		return
+	}
+
+	h.logger.Infof("Client %s sent %s command %s to %d clients", client.id, req.Command, outcome.CommandID, len(outcome.Targets))
+	client.SendMessage("command_sent", protocol.CommandSent{
+		CommandID: outcome.CommandID,
+		Command:   req.Command,
+		Targets:   outcome.Targets,
+	})
+}
+
+// handleCommandAck routes a display's command acknowledgement to the issuer
+func (h *Handler) handleCommandAck(client *Client, ack protocol.CommandAck) {
+	if !h.commands.acknowledge(client, ack) {
+		h.logger.Debugf("Ignoring ack for unknown or expired command %s from client %s", ack.CommandID, client.id)
+	}
+}
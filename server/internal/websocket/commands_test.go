@@ -0,0 +1,200 @@
+package websocket_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// dialClient connects to the client control endpoint with the given query string
+func dialClient(t *testing.T, server *testServer, query string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.clientURL+query, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return conn
+}
+
+// stationTicket issues a ticket for the hub to a display paired with the station
+func stationTicket(t *testing.T, server *testServer, hub ws.HubType, station string) string {
+	t.Helper()
+
+	ticket, _, err := server.auth.IssueTicket(context.Background(), auth.AuthInfo{
+		Authenticated: true,
+		Method:        auth.AuthMethodDevice,
+		Role:          auth.RoleDisplay,
+		Station:       station,
+	}, string(hub), station)
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	return ticket
+}
+
+// readMessage reads the next message of the given type, skipping others
+func readMessage(t *testing.T, conn *websocket.Conn, messageType string) models.WebSocketMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message models.WebSocketMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read %s message: %v", messageType, err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// TestTargetedCommand sends a command to one station and routes the display's
+// acknowledgement back to the admin connection
+func TestTargetedCommand(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	ticket, _, err := server.auth.IssueTicket(context.Background(), auth.AuthInfo{Authenticated: true, Role: auth.RoleAdmin}, string(ws.HubTypeClient), "")
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	admin := dialClient(t, server, "?ticket="+ticket)
+	defer admin.Close()
+
+	target := dialClient(t, server, "?ticket="+stationTicket(t, server, ws.HubTypeClient, "51")+"&group=bay")
+	defer target.Close()
+	other := dialClient(t, server, "?ticket="+stationTicket(t, server, ws.HubTypeClient, "52"))
+	defer other.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.clientHub.ClientCount() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 clients, hub has %d", server.clientHub.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Invalid arguments are rejected before anything is sent
+	admin.WriteJSON(models.WebSocketMessage{
+		Type:    "command",
+		Content: map[string]interface{}{"command": "set_volume", "args": map[string]interface{}{"level": 150}},
+	})
+	readMessage(t, admin, "error")
+
+	admin.WriteJSON(models.WebSocketMessage{
+		Type: "command",
+		Content: map[string]interface{}{
+			"command": "set_volume",
+			"args":    map[string]interface{}{"level": 40},
+			"target":  map[string]interface{}{"group": "bay"},
+		},
+	})
+
+	sent := readMessage(t, admin, "command_sent").Content.(map[string]interface{})
+	if targets := sent["targets"].([]interface{}); len(targets) != 1 {
+		t.Fatalf("Expected 1 target, got %v", targets)
+	}
+
+	command := readMessage(t, target, "set_volume").Content.(map[string]interface{})
+	if command["level"] != float64(40) || command["command_id"] != sent["command_id"] {
+		t.Fatalf("Unexpected command content %v", command)
+	}
+
+	target.WriteJSON(models.WebSocketMessage{
+		Type:    "command_ack",
+		Content: map[string]interface{}{"command_id": command["command_id"], "status": "ok"},
+	})
+
+	result := readMessage(t, admin, "command_result").Content.(map[string]interface{})
+	if result["status"] != ws.CommandStatusOK || result["station"] != "51" || result["command_id"] != sent["command_id"] {
+		t.Errorf("Unexpected command result %v", result)
+	}
+
+	// The other display never receives the command
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var message models.WebSocketMessage
+	if err := other.ReadJSON(&message); err == nil && message.Type == "set_volume" {
+		t.Error("Untargeted display received the command")
+	}
+}
+
+// TestCommandRequiresPermission checks anonymous connections can't send commands
+func TestCommandRequiresPermission(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn := dialClient(t, server, "")
+	defer conn.Close()
+
+	conn.WriteJSON(models.WebSocketMessage{
+		Type:    "command",
+		Content: map[string]interface{}{"command": "refresh"},
+	})
+	readMessage(t, conn, "error")
+}
+
+// TestDisplayCommandsDescribed checks the protocol schema describes every command the router accepts
+func TestDisplayCommandsDescribed(t *testing.T) {
+	for _, command := range protocol.DisplayCommands {
+		if err := ws.ValidateCommand(command, map[string]interface{}{}); err != nil && strings.HasPrefix(err.Error(), "unknown command") {
+			t.Errorf("The schema describes %s, which the router doesn't accept", command)
+		}
+	}
+}
+
+// TestRedirectTargets accepts absolute http(s) URLs and paths, and nothing that leaves for another host or scheme
+func TestRedirectTargets(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://cad.example/board", valid: true},
+		{url: "http://10.0.0.5:8080/", valid: true},
+		{url: "/51/d", valid: true},
+		{url: "d?view=map", valid: true},
+		{url: "//evil.example/", valid: false},
+		{url: "///evil.example/", valid: false},
+		{url: "/\\evil.example/", valid: false},
+		{url: " //evil.example/", valid: false},
+		{url: "/\t/evil.example/", valid: false},
+		{url: "https:///board", valid: false},
+		{url: "javascript:alert(1)", valid: false},
+		{url: "JavaScript:alert(1)", valid: false},
+		{url: "data:text/html,hi", valid: false},
+		{url: "ftp://files.example/", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ws.ValidateCommand("redirect", map[string]interface{}{"url": tt.url})
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.url, tt.valid, err)
+		}
+	}
+}
+
+// TestLegacyRedirectValidated checks the older redirect message rejects the same targets as the command
+func TestLegacyRedirectValidated(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	ticket, _, err := server.auth.IssueTicket(context.Background(), auth.AuthInfo{Authenticated: true, Role: auth.RoleAdmin}, string(ws.HubTypeClient), "")
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	admin := dialClient(t, server, "?ticket="+ticket)
+	defer admin.Close()
+
+	admin.WriteJSON(models.WebSocketMessage{
+		Type:    "redirect",
+		Content: map[string]interface{}{"url": "//evil.example/"},
+	})
+	readMessage(t, admin, "error")
+}
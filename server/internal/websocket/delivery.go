@@ -0,0 +1,224 @@
+package websocket
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// maxTrackedAlerts bounds how many alerts keep delivery receipts in memory
+const maxTrackedAlerts = 200
+
+// AckTimeoutCallback is called when no display of a station acknowledged an alert in time
+type AckTimeoutCallback func(alertID, station string)
+
+// alertDelivery holds the receipts of a single alert
+type alertDelivery struct {
+	broadcastAt time.Time
+	receipts    map[string]*models.DeliveryReceipt // Keyed by client ID
+	stations    map[string]*models.StationAcknowledgement
+}
+
+// DeliveryTracker records which clients received and acknowledged each alert
+type DeliveryTracker struct {
+	alerts     map[string]*alertDelivery
+	order      []string // Alert IDs, oldest first
+	ackTimeout time.Duration
+	onTimeout  AckTimeoutCallback
+	mutex      sync.Mutex
+}
+
+// NewDeliveryTracker creates a tracker. A zero ack timeout disables acknowledgement warnings.
+func NewDeliveryTracker(ackTimeout time.Duration, onTimeout AckTimeoutCallback) *DeliveryTracker {
+	return &DeliveryTracker{
+		alerts:     make(map[string]*alertDelivery),
+		ackTimeout: ackTimeout,
+		onTimeout:  onTimeout,
+	}
+}
+
+// EnableDeliveryTracking records per-client delivery and acknowledgement of alerts on this hub
+func (h *Hub) EnableDeliveryTracking(ackTimeout time.Duration, onTimeout AckTimeoutCallback) {
+	h.deliveries = NewDeliveryTracker(ackTimeout, onTimeout)
+}
+
+// getOrCreate returns the delivery record of an alert. The caller must hold the mutex.
+func (t *DeliveryTracker) getOrCreate(alertID string) *alertDelivery {
+	if delivery, ok := t.alerts[alertID]; ok {
+		return delivery
+	}
+
+	delivery := &alertDelivery{
+		broadcastAt: time.Now(),
+		receipts:    make(map[string]*models.DeliveryReceipt),
+		stations:    make(map[string]*models.StationAcknowledgement),
+	}
+	t.alerts[alertID] = delivery
+	t.order = append(t.order, alertID)
+
+	// Forget the oldest alerts
+	for len(t.order) > maxTrackedAlerts {
+		delete(t.alerts, t.order[0])
+		t.order = t.order[1:]
+	}
+
+	return delivery
+}
+
+// receipt returns the receipt of a client for an alert. The caller must hold the mutex.
+func (d *alertDelivery) receipt(client *Client) *models.DeliveryReceipt {
+	if receipt, ok := d.receipts[client.id]; ok {
+		return receipt
+	}
+
+	receipt := &models.DeliveryReceipt{
+		ClientID:   client.id,
+		Station:    client.station(),
+		DeviceID:   client.authInfo.DeviceID,
+		RemoteAddr: client.remoteAddr,
+		UserAgent:  client.userAgent,
+	}
+	d.receipts[client.id] = receipt
+	return receipt
+}
+
+// Expect starts the acknowledgement timer for the stations an alert was sent to
+func (t *DeliveryTracker) Expect(alertID string, stations []string) {
+	t.mutex.Lock()
+	delivery := t.getOrCreate(alertID)
+	for _, station := range stations {
+		if _, ok := delivery.stations[station]; !ok {
+			delivery.stations[station] = &models.StationAcknowledgement{Station: station}
+		}
+	}
+	t.mutex.Unlock()
+
+	if t.ackTimeout <= 0 || len(stations) == 0 {
+		return
+	}
+
+	time.AfterFunc(t.ackTimeout, func() {
+		t.checkAcknowledged(alertID)
+	})
+}
+
+// checkAcknowledged warns about every expected station that has not acknowledged the alert
+func (t *DeliveryTracker) checkAcknowledged(alertID string) {
+	t.mutex.Lock()
+	delivery, ok := t.alerts[alertID]
+	missing := make([]string, 0)
+	if ok {
+		for station, ack := range delivery.stations {
+			if !ack.Acknowledged && !ack.TimedOut {
+				ack.TimedOut = true
+				missing = append(missing, station)
+			}
+		}
+	}
+	t.mutex.Unlock()
+
+	if t.onTimeout == nil {
+		return
+	}
+	for _, station := range missing {
+		t.onTimeout(alertID, station)
+	}
+}
+
+// MarkDelivered records that an alert was written to a client's connection
+func (t *DeliveryTracker) MarkDelivered(alertID string, client *Client) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	receipt := t.getOrCreate(alertID).receipt(client)
+	if receipt.DeliveredAt == nil {
+		receipt.DeliveredAt = &now
+	}
+}
+
+// MarkAcknowledged records that a client displayed an alert
+func (t *DeliveryTracker) MarkAcknowledged(alertID string, client *Client) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delivery, ok := t.alerts[alertID]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	receipt := delivery.receipt(client)
+	if receipt.AcknowledgedAt == nil {
+		receipt.AcknowledgedAt = &now
+	}
+
+	if ack, ok := delivery.stations[receipt.Station]; ok && !ack.Acknowledged {
+		ack.Acknowledged = true
+		ack.AcknowledgedAt = &now
+	}
+
+	return true
+}
+
+// Get returns a copy of the delivery receipts of an alert
+func (t *DeliveryTracker) Get(alertID string) (models.AlertDeliveries, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delivery, ok := t.alerts[alertID]
+	if !ok {
+		return models.AlertDeliveries{}, false
+	}
+
+	result := models.AlertDeliveries{
+		AlertID:     alertID,
+		BroadcastAt: delivery.broadcastAt,
+		Receipts:    make([]models.DeliveryReceipt, 0, len(delivery.receipts)),
+		Stations:    make([]models.StationAcknowledgement, 0, len(delivery.stations)),
+	}
+	for _, receipt := range delivery.receipts {
+		result.Receipts = append(result.Receipts, *receipt)
+	}
+	for _, ack := range delivery.stations {
+		result.Stations = append(result.Stations, *ack)
+	}
+
+	sort.Slice(result.Receipts, func(i, j int) bool {
+		return result.Receipts[i].Station+result.Receipts[i].ClientID < result.Receipts[j].Station+result.Receipts[j].ClientID
+	})
+	sort.Slice(result.Stations, func(i, j int) bool {
+		return result.Stations[i].Station < result.Stations[j].Station
+	})
+
+	return result, true
+}
+
+// alertIDOf returns the ID of the alert carried by a new_alert message
+func alertIDOf(message models.WebSocketMessage) string {
+	if message.Type != "new_alert" {
+		return ""
+	}
+	if alert, ok := message.Content.(*models.Alert); ok && alert != nil {
+		return alert.Alert.ID
+	}
+	return ""
+}
+
+// station returns the station the client displays, from its credentials or connection
+func (c *Client) station() string {
+	if c.authInfo.Station != "" {
+		return c.authInfo.Station
+	}
+	return c.GetMetadata("station")
+}
+
+// group returns the device group the client belongs to, from its credentials or connection
+func (c *Client) group() string {
+	if c.authInfo.DeviceGroup != "" {
+		return c.authInfo.DeviceGroup
+	}
+	return c.GetMetadata("group")
+}
@@ -1,22 +1,32 @@
 package websocket
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/user/alerting/server/internal/auth"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
 )
 
+// errLogsForbidden is returned when a ticket lacks the logs permission
+var errLogsForbidden = errors.New("forbidden: logs:read permission required")
+
 // Handler manages WebSocket connections
 type Handler struct {
-	dashboardHub *Hub
-	clientHub    *Hub
-	logsHub      *Hub
-	upgrader     websocket.Upgrader
-	auth         *auth.Authenticator
-	logger       *logging.Logger
+	dashboardHub  *Hub
+	clientHub     *Hub
+	logsHub       *Hub
+	upgrader      websocket.Upgrader
+	compressAbove int
+	auth          *auth.Authenticator
+	commands      *commandRouter
+	bulletins     BulletinSource // Active bulletins sent to dashboard clients on connect, nil when disabled
+	bus           EventBus       // Shares revocations with other server instances, nil for a single instance
+	logger        *logging.Logger
 }
 
 // NewHandler creates a new WebSocket handler
@@ -28,6 +38,7 @@ func NewHandler(dashboardHub, clientHub, logsHub *Hub, auth *auth.Authenticator,
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all connections for development
 		},
+		Subprotocols: subprotocols,
 	}
 
 	return &Handler{
@@ -36,24 +47,25 @@ func NewHandler(dashboardHub, clientHub, logsHub *Hub, auth *auth.Authenticator,
 		logsHub:      logsHub,
 		upgrader:     upgrader,
 		auth:         auth,
+		commands:     newCommandRouter(clientHub),
 		logger:       logger,
 	}
 }
 
+// SetCompression enables permessage-deflate for clients that offer it. Frames smaller
+// than threshold bytes are still written uncompressed.
+func (h *Handler) SetCompression(enabled bool, threshold int) {
+	h.upgrader.EnableCompression = enabled
+	h.compressAbove = threshold
+}
+
 // HandleDashboardConnection handles connections to the dashboard WebSocket endpoint
 // This combines alerts and weather data into a single WebSocket connection
 func (h *Handler) HandleDashboardConnection(w http.ResponseWriter, r *http.Request) {
-	// Check authentication
-	authInfo := h.auth.GetAuthInfo(r)
-	h.logger.Infof("Dashboard WebSocket connection authentication status: %v, password provided: %v",
-		authInfo.Authenticated, authInfo.Password != "")
-
-	// Note: Authentication check is commented out to allow public access with redacted data
-	// if !authInfo.Authenticated {
-	// 	http.Error(w, "Unauthorized", http.StatusUnauthorized)
-	// 	h.logger.Warn("Unauthorized attempt to connect to dashboard WebSocket")
-	// 	return
-	// }
+	// Check authentication, connections without a ticket get redacted data
+	authInfo, station, ticketErr := h.connectionAuth(r, HubTypeDashboard)
+	h.logger.Infof("Dashboard WebSocket connection authentication status: %v, method: %s, role: %s",
+		authInfo.Authenticated, authInfo.Method, authInfo.Role)
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
@@ -62,28 +74,25 @@ func (h *Handler) HandleDashboardConnection(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Create a new client with authentication status
-	client := NewClient(h.dashboardHub, conn, h.logger, authInfo.Authenticated)
-
-	// Add user agent to the client metadata
-	client.userAgent = r.UserAgent()
-	// Add remote address from the HTTP request
-	if r.RemoteAddr != "" {
-		client.remoteAddr = r.RemoteAddr
+	// Reject bad tickets after the upgrade so browsers can see the close code
+	if ticketErr != nil {
+		h.rejectConnection(conn, ticketErr)
+		return
 	}
 
-	station := r.URL.Query().Get("station")
+	// Create a new client with authentication status
+	client := h.newConnClient(h.dashboardHub, conn, r, authInfo)
+
 	if station != "" {
-		client.metadata["station"] = station
+		client.SetMetadata("station", station)
 	}
 
-	client.metadata["requestURI"] = r.RequestURI
-
 	h.logger.Infof("New dashboard WebSocket client created with ID %s, authentication status: %v",
-		client.id, client.isAuthenticated)
+		client.id, client.authInfo.Authenticated)
 
 	// Register client with hub
 	h.dashboardHub.Register(client)
+	h.sendBulletins(client)
 
 	// Start goroutines for reading and writing
 	go client.WritePump()
@@ -91,6 +100,15 @@ func (h *Handler) HandleDashboardConnection(w http.ResponseWriter, r *http.Reque
 		h.logger.Infof("Received message from dashboard client %s: %s", client.id, message.Type)
 		// Handle different message types
 		switch message.Type {
+		case "subscribe", "unsubscribe":
+			h.handleSubscription(client, message.Type, message.Content.(protocol.Subscription))
+
+		case "resume":
+			h.handleResume(client, message.Content.(protocol.Resume))
+
+		case "ack":
+			h.handleAck(client, message.Content.(protocol.Ack))
+
 		default:
 			// Echo other message types back to the client
 			client.SendMessage("echo", message.Content)
@@ -102,9 +120,9 @@ func (h *Handler) HandleDashboardConnection(w http.ResponseWriter, r *http.Reque
 // Such as page refreshes or redirects
 func (h *Handler) HandleClientConnection(w http.ResponseWriter, r *http.Request) {
 	// Check authentication for sending commands (but allow connections for listening)
-	authInfo := h.auth.GetAuthInfo(r)
-	h.logger.Infof("Client WebSocket connection authentication status: %v, password provided: %v",
-		authInfo.Authenticated, authInfo.Password != "")
+	authInfo, station, ticketErr := h.connectionAuth(r, HubTypeClient)
+	h.logger.Infof("Client WebSocket connection authentication status: %v, method: %s, role: %s",
+		authInfo.Authenticated, authInfo.Method, authInfo.Role)
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
@@ -113,14 +131,21 @@ func (h *Handler) HandleClientConnection(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Reject bad tickets after the upgrade so browsers can see the close code
+	if ticketErr != nil {
+		h.rejectConnection(conn, ticketErr)
+		return
+	}
+
 	// Create a new client with authentication status
-	client := NewClient(h.clientHub, conn, h.logger, authInfo.Authenticated)
+	client := h.newConnClient(h.clientHub, conn, r, authInfo)
 
-	// Add user agent to the client metadata
-	client.userAgent = r.UserAgent()
-	// Add remote address from the HTTP request
-	if r.RemoteAddr != "" {
-		client.remoteAddr = r.RemoteAddr
+	if station != "" {
+		client.SetMetadata("station", station)
+	}
+	// Paired devices take their group from the device record, others may name one
+	if group := r.URL.Query().Get("group"); group != "" && authInfo.DeviceGroup == "" {
+		client.SetMetadata("group", group)
 	}
 
 	h.logger.Infof("New client control WebSocket client created with ID %s, authentication status: %v",
@@ -136,28 +161,45 @@ func (h *Handler) HandleClientConnection(w http.ResponseWriter, r *http.Request)
 
 		// Handle different message types
 		switch message.Type {
+		case "command":
+			// Only clients with the client control permission can send commands
+			if !client.authInfo.Can(auth.PermClientControl) {
+				client.sendError(protocol.NewError(protocol.CodeUnauthorized, "Unauthorized: Authentication required to send commands"), message.ID)
+				h.logger.Warnf("Unauthorized attempt to send a command by client %s", client.id)
+				return
+			}
+			h.handleCommand(client, message.ID, message.Content.(protocol.Command))
+
+		case "command_ack":
+			h.handleCommandAck(client, message.Content.(protocol.CommandAck))
+
 		case "refresh":
-			// Only authenticated clients can trigger refresh
-			if !client.isAuthenticated {
-				client.SendMessage("error", "Unauthorized: Authentication required to send refresh command")
+			// Only clients with the client control permission can trigger refresh
+			if !client.authInfo.Can(auth.PermClientControl) {
+				client.sendError(protocol.NewError(protocol.CodeUnauthorized, "Unauthorized: Authentication required to send refresh command"), message.ID)
 				h.logger.Warnf("Unauthorized attempt to send refresh command by client %s", client.id)
 				return
 			}
 
 			// Broadcast refresh to all clients, including unauthenticated ones
-			h.clientHub.BroadcastEvent("refresh", nil)
+			h.clientHub.BroadcastEvent("refresh", protocol.DisplayCommand{})
 			h.logger.Infof("Refresh broadcast triggered by authenticated client %s", client.id)
 
 		case "redirect":
-			// Only authenticated clients can trigger redirect
-			if !client.isAuthenticated {
-				client.SendMessage("error", "Unauthorized: Authentication required to send redirect command")
+			// Only clients with the client control permission can trigger redirect
+			if !client.authInfo.Can(auth.PermClientControl) {
+				client.sendError(protocol.NewError(protocol.CodeUnauthorized, "Unauthorized: Authentication required to send redirect command"), message.ID)
 				h.logger.Warnf("Unauthorized attempt to send redirect command by client %s", client.id)
 				return
 			}
 
 			// Broadcast redirect to all clients, including unauthenticated ones
-			h.clientHub.BroadcastEvent("redirect", message.Content)
+			redirect := message.Content.(protocol.Redirect)
+			if !validRedirect(redirect.URL) {
+				client.sendError(protocol.FieldError("url", "url must be an absolute http(s) URL or a path"), message.ID)
+				return
+			}
+			h.clientHub.BroadcastEvent("redirect", protocol.DisplayCommand{Args: map[string]interface{}{"url": redirect.URL}})
 			h.logger.Infof("Redirect broadcast triggered by authenticated client %s", client.id)
 
 		default:
@@ -170,12 +212,7 @@ func (h *Handler) HandleClientConnection(w http.ResponseWriter, r *http.Request)
 // HandleLogsConnection handles connections to the logs WebSocket endpoint
 func (h *Handler) HandleLogsConnection(w http.ResponseWriter, r *http.Request) {
 	// Check authentication
-	authInfo := h.auth.GetAuthInfo(r)
-	if !authInfo.Authenticated {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		h.logger.Warn("Unauthorized attempt to connect to logs WebSocket")
-		return
-	}
+	authInfo, station, ticketErr := h.connectionAuth(r, HubTypeLogs)
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
@@ -184,18 +221,28 @@ func (h *Handler) HandleLogsConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject bad tickets after the upgrade so browsers can see the close code
+	if ticketErr != nil {
+		h.rejectConnection(conn, ticketErr)
+		return
+	}
+
+	// The logs hub requires a ticket with the logs permission
+	if !authInfo.Authenticated {
+		h.logger.Warn("Unauthorized attempt to connect to logs WebSocket")
+		h.rejectConnection(conn, auth.ErrTicketInvalid)
+		return
+	}
+	if !authInfo.Can(auth.PermLogsRead) {
+		h.logger.Warnf("Forbidden attempt to connect to logs WebSocket by %s", authInfo.Username)
+		h.rejectConnection(conn, errLogsForbidden)
+		return
+	}
+
 	// Create a new client with authentication status
-	client := NewClient(h.logsHub, conn, h.logger, authInfo.Authenticated)
-	station := r.URL.Query().Get("station")
+	client := h.newConnClient(h.logsHub, conn, r, authInfo)
 	if station != "" {
-		client.metadata["station"] = station
-	}
-	// Add user agent to the client metadata
-	client.metadata["requestURI"] = r.RequestURI
-	client.userAgent = r.UserAgent()
-	// Add remote address from the HTTP request
-	if r.RemoteAddr != "" {
-		client.remoteAddr = r.RemoteAddr
+		client.SetMetadata("station", station)
 	}
 
 	// Register client with hub
@@ -213,6 +260,154 @@ func (h *Handler) HandleLogsConnection(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleSubscription applies a subscribe or unsubscribe message and confirms the resulting subscriptions
+func (h *Handler) handleSubscription(client *Client, messageType string, req protocol.Subscription) {
+	topics := make([]Topic, 0, len(req.Topics))
+	for _, topic := range req.Topics {
+		topics = append(topics, Topic(topic))
+	}
+
+	if messageType == "subscribe" {
+		client.Subscribe(topics)
+	} else {
+		client.Unsubscribe(topics)
+	}
+
+	if req.Station != nil {
+		client.SetStationFilter(*req.Station)
+	}
+
+	subscribed, station := client.Subscriptions()
+	h.logger.Debugf("Client %s subscriptions: topics %v, station %q", client.id, subscribed, station)
+	names := make([]string, 0, len(subscribed))
+	for _, topic := range subscribed {
+		names = append(names, string(topic))
+	}
+	client.SendMessage("subscribed", protocol.Subscribed{Topics: names, Station: station})
+}
+
+// handleResume replays the events a reconnecting client missed
+func (h *Handler) handleResume(client *Client, req protocol.Resume) {
+	client.hub.Resume(client, req.Instance, req.LastSeq)
+}
+
+// handleAck records that a display showed an alert
+func (h *Handler) handleAck(client *Client, req protocol.Ack) {
+	if client.hub.deliveries == nil || !client.hub.deliveries.MarkAcknowledged(req.AlertID, client) {
+		h.logger.Debugf("Ignoring ack for untracked alert %s from client %s", req.AlertID, client.id)
+		return
+	}
+
+	h.logger.Infof("Client %s acknowledged alert %s", client.id, req.AlertID)
+}
+
+// HandleSchema serves the schema of the current protocol version, for generating typed clients
+func (h *Handler) HandleSchema(w http.ResponseWriter, r *http.Request) {
+	h.respondWithJSON(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    protocol.Schema(),
+	})
+}
+
+// GetAlertDeliveries returns which dashboard clients received and acknowledged an alert
+func (h *Handler) GetAlertDeliveries(alertID string) (models.AlertDeliveries, bool) {
+	return h.dashboardHub.GetAlertDeliveries(alertID)
+}
+
+// newConnClient creates a client for an upgraded connection, with the user agent and remote
+// address of the request and the encoding of the negotiated subprotocol
+func (h *Handler) newConnClient(hub *Hub, conn *websocket.Conn, r *http.Request, authInfo auth.AuthInfo) *Client {
+	client := NewClient(hub, conn, h.logger, authInfo)
+
+	// Add user agent to the client metadata
+	client.userAgent = r.UserAgent()
+	// Add remote address from the HTTP request
+	if r.RemoteAddr != "" {
+		client.remoteAddr = r.RemoteAddr
+	}
+
+	client.codec, client.version = negotiated(conn.Subprotocol())
+	client.compressAbove = h.compressAbove
+	if subprotocol := conn.Subprotocol(); subprotocol != "" {
+		client.SetMetadata("subprotocol", subprotocol)
+	}
+	return client
+}
+
+// connectionAuth resolves the ticket of a websocket request and the station it is bound to.
+// Requests without a ticket connect anonymously without a station, so they are never counted as
+// a station's display; any password or station in the URL is ignored.
+func (h *Handler) connectionAuth(r *http.Request, hubType HubType) (auth.AuthInfo, string, error) {
+	token := r.URL.Query().Get("ticket")
+	if token == "" {
+		return auth.AuthInfo{}, "", nil
+	}
+
+	ticket, err := h.auth.RedeemTicket(r.Context(), token, string(hubType))
+	if err != nil {
+		h.logger.Warnf("Rejected %s WebSocket ticket from %s: %v", hubType, r.RemoteAddr, err)
+		return auth.AuthInfo{}, "", err
+	}
+
+	return ticket.AuthInfo, ticket.Station, nil
+}
+
+// rejectConnection closes a freshly upgraded connection with a close code matching the error
+func (h *Handler) rejectConnection(conn *websocket.Conn, reason error) {
+	code := CloseTicketInvalid
+	if reason == auth.ErrTicketWrongHub || reason == errLogsForbidden {
+		code = CloseForbidden
+	}
+
+	message := websocket.FormatCloseMessage(code, reason.Error())
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait)); err != nil {
+		h.logger.Debugf("Failed to write close message: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		h.logger.Debugf("Failed to close connection: %v", err)
+	}
+}
+
+// CloseRevokedConnections closes every connection opened with the given session or API key,
+// on this instance and, through the event bus, on every other instance
+func (h *Handler) CloseRevokedConnections(credentialID string) {
+	if credentialID == "" {
+		return
+	}
+
+	h.closeRevoked(credentialID)
+	if h.bus != nil {
+		go h.publishRevocation(credentialID)
+	}
+}
+
+// closeRevoked closes the connections of this instance opened with the given credential
+func (h *Handler) closeRevoked(credentialID string) {
+	for _, hub := range []*Hub{h.dashboardHub, h.clientHub, h.logsHub} {
+		for _, client := range hub.GetClients() {
+			if client.authInfo.CredentialID() == credentialID {
+				h.logger.Infof("Closing %s client %s, credentials revoked", hub.hubType, client.id)
+				client.Close(CloseCredentialRevoked, "credentials revoked")
+			}
+		}
+	}
+}
+
+// GetDeviceConnectionCounts returns the number of open connections for each paired device ID
+func (h *Handler) GetDeviceConnectionCounts() map[string]int {
+	counts := make(map[string]int)
+
+	for _, hub := range []*Hub{h.dashboardHub, h.clientHub, h.logsHub} {
+		for _, client := range hub.GetClients() {
+			if client.authInfo.DeviceID != "" {
+				counts[client.authInfo.DeviceID]++
+			}
+		}
+	}
+
+	return counts
+}
+
 // GetConnectionCounts returns the connection counts for all hubs
 func (h *Handler) GetConnectionCounts() map[string]int {
 	counts := make(map[string]int)
@@ -243,6 +438,20 @@ func (h *Handler) GetClientConnectionDetails() []models.ConnectionDetail {
 	return h.getConnectionDetails(h.clientHub)
 }
 
+// GetRecentDisconnects returns the clients that most recently left a hub, newest first
+func (h *Handler) GetRecentDisconnects(hubType HubType) []models.ConnectionDetail {
+	switch hubType {
+	case HubTypeDashboard:
+		return h.dashboardHub.RecentDisconnects()
+	case HubTypeClient:
+		return h.clientHub.RecentDisconnects()
+	case HubTypeLogs:
+		return h.logsHub.RecentDisconnects()
+	default:
+		return []models.ConnectionDetail{}
+	}
+}
+
 // getConnectionDetails is a helper function to get detailed information about clients in a hub
 func (h *Handler) getConnectionDetails(hub *Hub) []models.ConnectionDetail {
 	if hub == nil {
@@ -255,27 +464,7 @@ func (h *Handler) getConnectionDetails(hub *Hub) []models.ConnectionDetail {
 
 	// Convert each client to a ConnectionDetail
 	for _, client := range clients {
-		lastHeartbeat := &client.lastHeartbeat
-
-		// If lastHeartbeat is zero time, don't include it
-		if client.lastHeartbeat.IsZero() {
-			lastHeartbeat = nil
-		}
-
-		detail := models.ConnectionDetail{
-			ID:                client.id,
-			ConnectedAt:       client.connectedAt,
-			IsAuthenticated:   client.isAuthenticated,
-			RemoteAddr:        client.remoteAddr,
-			LastActivity:      client.lastActivity,
-			MessagesSent:      client.messagesSent,
-			MessagesReceived:  client.messagesReceived,
-			UserAgent:         client.userAgent,
-			Metadata:          client.metadata,
-			LastHeartbeatSent: lastHeartbeat,
-		}
-
-		details = append(details, detail)
+		details = append(details, client.detail())
 	}
 
 	return details
@@ -4,7 +4,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/user/alerting/server/internal/auth"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
@@ -25,27 +24,48 @@ const (
 // LogMessageCallback is a function that logs websocket messages
 type LogMessageCallback func(message models.WebSocketMessage, source string, clientID string)
 
-// Hub maintains the set of active clients and broadcasts messages
+// Hub maintains the set of active clients and broadcasts messages.
+// The client set is only changed by Run and read under the mutex; broadcasts are
+// serialized so every client receives events in sequence order.
 type Hub struct {
 	clients            map[*Client]bool
-	broadcast          chan models.WebSocketMessage
 	register           chan *Client
 	unregister         chan *Client
 	mutex              sync.Mutex
+	broadcastMutex     sync.Mutex                   // Serializes numbering and fan-out of broadcast events
+	bus                EventBus                     // Carries broadcasts between server instances, nil for this instance only
+	outbox             chan models.WebSocketMessage // Delivered events waiting to be published to the bus
+	seen               seenEvents                   // Recently delivered event IDs, guarded by broadcastMutex
 	logMessageCallback LogMessageCallback
 	logger             *logging.Logger
 	hubType            HubType
+	stationPageGroups  map[string][]string       // Page groups paged for each station, used by station filters
+	replay             *replayBuffer             // Recent events for clients that resume, nil when disabled
+	deliveries         *DeliveryTracker          // Alert delivery and acknowledgement receipts, nil when disabled
+	sessions           *sessionRecorder          // Persists connection sessions, nil when disabled
+	slowConsumerPolicy SlowConsumerPolicy        // What to do when a client's send queue is full
+	queueStats         queueStats                // Dropped and coalesced messages across all clients
+	pingInterval       time.Duration             // How often clients are sent protocol pings
+	pongTimeout        time.Duration             // How long a client may stay silent before it is evicted
+	recent             []models.ConnectionDetail // Recently disconnected clients, oldest first
+	recentMutex        sync.Mutex
 }
 
+// maxRecentDisconnects bounds how many disconnected clients each hub remembers
+const maxRecentDisconnects = 100
+
 // NewHub creates a new hub instance
 func NewHub(hubType HubType, logger *logging.Logger) *Hub {
 	return &Hub{
-		broadcast:  make(chan models.WebSocketMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
 		logger:     logger,
 		hubType:    hubType,
+
+		slowConsumerPolicy: PolicyDropOldest,
+		pingInterval:       defaultPingInterval,
+		pongTimeout:        defaultPongTimeout,
 	}
 }
 
@@ -54,6 +74,24 @@ func (h *Hub) SetLogMessageCallback(callback LogMessageCallback) {
 	h.logMessageCallback = callback
 }
 
+// SetStationPageGroups sets the page groups that belong to each station
+func (h *Hub) SetStationPageGroups(stationPageGroups map[string][]string) {
+	h.stationPageGroups = stationPageGroups
+}
+
+// SetSlowConsumerPolicy sets what happens when a client's send queue is full.
+// It applies to clients that connect afterwards.
+func (h *Hub) SetSlowConsumerPolicy(policy SlowConsumerPolicy) {
+	h.slowConsumerPolicy = policy
+}
+
+// SetKeepalive sets the protocol ping interval and how long a client may stay silent.
+// It applies to clients that connect afterwards.
+func (h *Hub) SetKeepalive(pingInterval, pongTimeout time.Duration) {
+	h.pingInterval = pingInterval
+	h.pongTimeout = pongTimeout
+}
+
 // Run starts the hub and handles client operations
 func (h *Hub) Run() {
 	for {
@@ -63,25 +101,21 @@ func (h *Hub) Run() {
 			h.clients[client] = true
 			h.mutex.Unlock()
 			h.logger.Infof("Client %s registered with %s hub", client.id, h.hubType)
+			if h.sessions != nil {
+				h.sessions.started(client.detail())
+			}
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
-				h.logger.Infof("Client %s unregistered from %s hub", client.id, h.hubType)
-			}
-			h.mutex.Unlock()
-
-		case message := <-h.broadcast:
-			h.mutex.Lock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-					h.logger.Infof("Client %s removed due to send buffer full", client.id)
+				client.queue.close(0, "")
+				client.markDisconnected()
+				detail := client.detail()
+				h.rememberDisconnect(detail)
+				h.logger.Infof("Client %s unregistered from %s hub: %s", client.id, h.hubType, detail.DisconnectReason)
+				if h.sessions != nil {
+					h.sessions.ended(detail)
 				}
 			}
 			h.mutex.Unlock()
@@ -89,9 +123,32 @@ func (h *Hub) Run() {
 	}
 }
 
-// BroadcastEvent creates and sends a structured event message to all clients
-// It also handles redaction of sensitive information for unauthenticated clients
+// BroadcastEvent creates and sends a structured event message to all clients.
+// With an event bus, the event is delivered to local clients first and then published
+// in the background, so the hubs of the other server instances deliver it too.
 func (h *Hub) BroadcastEvent(eventType string, content any) {
+	event := newEvent(eventType, content)
+	h.deliver(event)
+	if h.bus != nil {
+		h.publish(event)
+	}
+}
+
+// deliver sends an event to the hub's clients, once per event ID.
+// It also handles redaction of sensitive information for unauthenticated clients
+func (h *Hub) deliver(event models.WebSocketMessage) {
+	h.broadcastMutex.Lock()
+	defer h.broadcastMutex.Unlock()
+
+	if h.markSeen(event.ID) {
+		return
+	}
+
+	// Clients that register during the fan-out receive the next event
+	clients := h.GetClients()
+	eventType := event.Type
+	content := event.Content
+
 	// Check if the content needs redaction based on event type
 	if content != nil && (eventType == "new_alert") {
 		// Handle both pointer and value types
@@ -111,11 +168,24 @@ func (h *Hub) BroadcastEvent(eventType string, content any) {
 				return
 			}
 		}
+		event.Content = alert
+
+		// Number the event and keep it for clients that resume after a disconnect
+		h.record(&event)
+
+		// Stations that were sent the alert are expected to acknowledge it
+		stations := make(map[string]bool)
+
 		// Handle each client individually
-		for c := range h.clients {
+		for _, c := range clients {
+			// Skip clients that unsubscribed from alerts or filter on another station
+			if !c.wants(TopicAlerts) || !c.wantsAlert(alert, h.stationPageGroups) {
+				continue
+			}
+
 			var clientContent *models.Alert
 
-			if !c.isAuthenticated {
+			if !c.authInfo.Can(auth.PermAlertsRead) {
 				// Create a deep copy for redaction
 				alertCopy := models.DeepCopyAlert(*alert)
 				clientContent = auth.RedactAlertData(&alertCopy)
@@ -125,10 +195,12 @@ func (h *Hub) BroadcastEvent(eventType string, content any) {
 
 			// Create individual message for this client
 			msg := models.WebSocketMessage{
-				Type:    eventType,
-				Content: clientContent,
-				ID:      uuid.New().String(),
-				Time:    time.Now(),
+				Type:     eventType,
+				Content:  clientContent,
+				ID:       event.ID,
+				Time:     event.Time,
+				Seq:      event.Seq,
+				Instance: event.Instance,
 			}
 
 			// Log the message if there's a callback
@@ -138,18 +210,35 @@ func (h *Hub) BroadcastEvent(eventType string, content any) {
 
 			// Send directly to this client
 			h.logger.Infof("Sending %s event to client %s", eventType, c.id)
-			c.send <- msg
+			c.enqueue(msg)
+
+			if station := c.station(); station != "" {
+				stations[station] = true
+			}
+		}
+
+		if h.deliveries != nil {
+			expected := make([]string, 0, len(stations))
+			for station := range stations {
+				expected = append(expected, station)
+			}
+			h.deliveries.Expect(alert.Alert.ID, expected)
 		}
 	} else {
-		// For other events that don't need redaction, we can still use broadcast
+		// Other events don't need redaction, so every client gets the same message
 		msgContent := content
 
+		// Number the event and keep it for clients that resume after a disconnect
+		h.record(&event)
+
 		// Create the message
 		msg := models.WebSocketMessage{
-			Type:    eventType,
-			Content: msgContent,
-			ID:      uuid.New().String(),
-			Time:    time.Now(),
+			Type:     eventType,
+			Content:  msgContent,
+			ID:       event.ID,
+			Time:     event.Time,
+			Seq:      event.Seq,
+			Instance: event.Instance,
 		}
 
 		// Log the message if there's a callback
@@ -157,9 +246,16 @@ func (h *Hub) BroadcastEvent(eventType string, content any) {
 			h.logMessageCallback(msg, "server-broadcast", "all")
 		}
 
-		// Broadcast to all clients
+		// Broadcast to all clients that subscribed to the topic
 		h.logger.Debugf("Broadcasting %s event to all clients on %s hub", eventType, h.hubType)
-		h.broadcast <- msg
+		topic := TopicForEvent(eventType)
+		bulletin, isBulletin := msgContent.(models.Bulletin)
+		for _, c := range clients {
+			// Bulletins only go to the stations they are shown at
+			if c.wants(topic) && (!isBulletin || c.wantsBulletin(bulletin)) {
+				c.enqueue(msg)
+			}
+		}
 	}
 }
 
@@ -180,6 +276,37 @@ func (h *Hub) Unregister(client *Client) {
 	h.unregister <- client
 }
 
+// rememberDisconnect keeps the details of a client that left
+func (h *Hub) rememberDisconnect(detail models.ConnectionDetail) {
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+
+	h.recent = append(h.recent, detail)
+	if len(h.recent) > maxRecentDisconnects {
+		h.recent = h.recent[len(h.recent)-maxRecentDisconnects:]
+	}
+}
+
+// RecentDisconnects returns the clients that most recently left, newest first
+func (h *Hub) RecentDisconnects() []models.ConnectionDetail {
+	h.recentMutex.Lock()
+	defer h.recentMutex.Unlock()
+
+	details := make([]models.ConnectionDetail, 0, len(h.recent))
+	for i := len(h.recent) - 1; i >= 0; i-- {
+		details = append(details, h.recent[i])
+	}
+	return details
+}
+
+// GetAlertDeliveries returns the delivery receipts of an alert
+func (h *Hub) GetAlertDeliveries(alertID string) (models.AlertDeliveries, bool) {
+	if h.deliveries == nil {
+		return models.AlertDeliveries{}, false
+	}
+	return h.deliveries.Get(alertID)
+}
+
 // GetType returns the hub type
 func (h *Hub) GetType() HubType {
 	return h.hubType
@@ -189,11 +316,31 @@ func (h *Hub) GetType() HubType {
 func (h *Hub) GetClients() []*Client {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
-	
+
 	clients := make([]*Client, 0, len(h.clients))
 	for client := range h.clients {
 		clients = append(clients, client)
 	}
-	
+
 	return clients
 }
+
+// ConnectedStations returns how many connected clients display each station
+func (h *Hub) ConnectedStations() map[string]int {
+	stations := make(map[string]int)
+	for _, client := range h.GetClients() {
+		if station := client.station(); station != "" {
+			stations[station]++
+		}
+	}
+	return stations
+}
+
+// SendToPermitted sends an event to the connected clients that have the permission
+func (h *Hub) SendToPermitted(eventType string, content any, permission auth.Permission) {
+	for _, client := range h.GetClients() {
+		if client.authInfo.Can(permission) {
+			client.SendMessage(eventType, content)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// testServer is a websocket handler with running hubs behind an httptest server
+type testServer struct {
+	dashboardHub *ws.Hub
+	clientHub    *ws.Hub
+	handler      *ws.Handler
+	auth         *auth.Authenticator
+	dashboardURL string
+	clientURL    string
+	eventsURL    string
+	close        func()
+}
+
+// newTestServer starts the hubs and serves the websocket endpoints.
+// The configure functions are applied to the dashboard hub before it starts.
+func newTestServer(t *testing.T, configure ...func(hub *ws.Hub)) *testServer {
+	t.Helper()
+
+	logger := logging.New("error", "websocket_race_test")
+	authenticator := auth.New(config.AuthConfig{TicketTTL: time.Minute}, nil, logger)
+
+	dashboardHub := ws.NewHub(ws.HubTypeDashboard, logger)
+	clientHub := ws.NewHub(ws.HubTypeClient, logger)
+	logsHub := ws.NewHub(ws.HubTypeLogs, logger)
+	for _, fn := range configure {
+		fn(dashboardHub)
+	}
+	go dashboardHub.Run()
+	go clientHub.Run()
+	go logsHub.Run()
+
+	handler := ws.NewHandler(dashboardHub, clientHub, logsHub, authenticator, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/dashboard", handler.HandleDashboardConnection)
+	router.HandleFunc("/ws/client", handler.HandleClientConnection)
+	router.HandleFunc("/events/dashboard", handler.HandleDashboardEvents)
+	server := httptest.NewServer(router)
+	baseURL := strings.Replace(server.URL, "http", "ws", 1)
+
+	return &testServer{
+		dashboardHub: dashboardHub,
+		clientHub:    clientHub,
+		handler:      handler,
+		auth:         authenticator,
+		dashboardURL: baseURL + "/ws/dashboard",
+		clientURL:    baseURL + "/ws/client",
+		eventsURL:    server.URL + "/events/dashboard",
+		close:        server.Close,
+	}
+}
+
+// waitForClients waits until the dashboard hub has the expected number of clients
+func (s *testServer) waitForClients(t *testing.T, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for s.dashboardHub.ClientCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients, hub has %d", expected, s.dashboardHub.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testAlert creates an alert with the given ID
+func testAlert(id string) models.Alert {
+	return models.Alert{
+		Agency: models.Agency{Name: "Test Agency", ID: 123, Timezone: "UTC"},
+		Alert: models.AlertDetails{
+			ID:          id,
+			Description: stringPtr("Race test alert"),
+			Status:      "new",
+		},
+	}
+}
+
+// TestHubRegisterUnregisterStorm connects and disconnects clients while events are broadcast
+// and connection details are read
+func TestHubRegisterUnregisterStorm(t *testing.T) {
+	const workers = 20
+	const connectionsPerWorker = 10
+
+	server := newTestServer(t)
+	defer server.close()
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+
+	// Broadcast alerts and weather updates for the whole storm
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.dashboardHub.BroadcastEvent("new_alert", testAlert(fmt.Sprintf("storm-%d", i)))
+			server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": i})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// Read connection details the way the admin endpoints do
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.handler.GetDashboardConnectionDetails()
+			server.handler.GetConnectionCounts()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var storm sync.WaitGroup
+	storm.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(worker int) {
+			defer storm.Done()
+			for i := 0; i < connectionsPerWorker; i++ {
+				conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+				if err != nil {
+					t.Errorf("Worker %d failed to connect: %v", worker, err)
+					return
+				}
+
+				// Subscribe half of the clients so topic filters change mid-broadcast
+				if i%2 == 0 {
+					subscribe := models.WebSocketMessage{
+						Type:    "subscribe",
+						Content: map[string]interface{}{"topics": []string{"alerts"}},
+					}
+					if err := conn.WriteJSON(subscribe); err != nil {
+						t.Errorf("Worker %d failed to subscribe: %v", worker, err)
+					}
+				}
+
+				conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+				conn.ReadMessage()
+				conn.Close()
+			}
+		}(w)
+	}
+	storm.Wait()
+
+	close(stop)
+	background.Wait()
+
+	// Every client unregisters once its connection is gone
+	server.waitForClients(t, 0)
+}
+
+// TestHubBroadcastStorm broadcasts from many goroutines and checks every client
+// receives every alert in sequence order
+func TestHubBroadcastStorm(t *testing.T) {
+	const numClients = 50
+	const broadcasters = 8
+	const alertsPerBroadcaster = 25
+	const totalAlerts = broadcasters * alertsPerBroadcaster
+
+	server := newTestServer(t)
+	defer server.close()
+
+	// Number events so the order clients see can be checked
+	if err := server.dashboardHub.EnableReplay(nil, "", 1000); err != nil {
+		t.Fatalf("Failed to enable replay: %v", err)
+	}
+
+	var readers sync.WaitGroup
+	results := make(chan error, numClients)
+	conns := make([]*websocket.Conn, 0, numClients)
+
+	for i := 0; i < numClients; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect client %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+
+		readers.Add(1)
+		go func(conn *websocket.Conn) {
+			defer readers.Done()
+
+			received := 0
+			lastSeq := int64(0)
+			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			for received < totalAlerts {
+				var message models.WebSocketMessage
+				if err := conn.ReadJSON(&message); err != nil {
+					results <- fmt.Errorf("received %d/%d alerts: %v", received, totalAlerts, err)
+					return
+				}
+				if message.Type != "new_alert" {
+					continue
+				}
+				if message.Seq <= lastSeq {
+					results <- fmt.Errorf("alert seq %d arrived after seq %d", message.Seq, lastSeq)
+					return
+				}
+				lastSeq = message.Seq
+				received++
+			}
+			results <- nil
+		}(conn)
+	}
+	server.waitForClients(t, numClients)
+
+	var broadcast sync.WaitGroup
+	broadcast.Add(broadcasters)
+	for b := 0; b < broadcasters; b++ {
+		go func(broadcaster int) {
+			defer broadcast.Done()
+			for i := 0; i < alertsPerBroadcaster; i++ {
+				server.dashboardHub.BroadcastEvent("new_alert", testAlert(fmt.Sprintf("alert-%d-%d", broadcaster, i)))
+			}
+		}(b)
+	}
+	broadcast.Wait()
+
+	readers.Wait()
+	close(results)
+	for err := range results {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	server.waitForClients(t, 0)
+}
+
+// TestBroadcastAfterDisconnect broadcasts while clients disconnect, which must not
+// panic on a closed client or block the hub
+func TestBroadcastAfterDisconnect(t *testing.T) {
+	const numClients = 20
+
+	server := newTestServer(t)
+	defer server.close()
+
+	conns := make([]*websocket.Conn, 0, numClients)
+	for i := 0; i < numClients; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect client %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	server.waitForClients(t, numClients)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			server.dashboardHub.BroadcastEvent("new_alert", testAlert(fmt.Sprintf("closing-%d", i)))
+			server.dashboardHub.BroadcastEvent("alert_deleted", map[string]string{"id": fmt.Sprintf("closing-%d", i)})
+		}
+	}()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Broadcasting blocked after clients disconnected")
+	}
+
+	server.waitForClients(t, 0)
+
+	// Broadcasting to an empty hub is a no-op
+	server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 1})
+}
+
+// TestConnectionDetailsSnapshot checks connection details are copies that callers may keep
+func TestConnectionDetailsSnapshot(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL+"?ticket="+stationTicket(t, server, ws.HubTypeDashboard, "51"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	server.waitForClients(t, 1)
+
+	details := server.handler.GetDashboardConnectionDetails()
+	if len(details) != 1 {
+		t.Fatalf("Expected 1 connection, got %d", len(details))
+	}
+
+	// Changing the returned metadata must not reach the client
+	details[0].Metadata["station"] = "changed"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 1})
+			server.handler.GetDashboardConnectionDetails()
+		}()
+	}
+	wg.Wait()
+
+	again := server.handler.GetDashboardConnectionDetails()
+	if len(again) != 1 {
+		t.Fatalf("Expected 1 connection, got %d", len(again))
+	}
+	if station := again[0].Metadata["station"]; station == "changed" {
+		t.Errorf("Connection details share metadata with the client")
+	}
+
+	payload, err := json.Marshal(again)
+	if err != nil {
+		t.Fatalf("Failed to marshal connection details: %v", err)
+	}
+	if len(payload) == 0 {
+		t.Error("Empty connection details")
+	}
+}
+
+// Helper to create string pointers
+func stringPtr(s string) *string {
+	return &s
+}
+
+// TestConnectionStation takes a connection's station from its ticket, never from the URL
+func TestConnectionStation(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	anonymous, _, err := websocket.DefaultDialer.Dial(server.dashboardURL+"?station=51", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer anonymous.Close()
+	display, _, err := websocket.DefaultDialer.Dial(server.dashboardURL+"?station=51&ticket="+stationTicket(t, server, ws.HubTypeDashboard, "52"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer display.Close()
+	server.waitForClients(t, 2)
+
+	stations := make(map[bool]string)
+	for _, detail := range server.handler.GetDashboardConnectionDetails() {
+		stations[detail.IsAuthenticated] = detail.Station
+	}
+	if stations[false] != "" {
+		t.Errorf("Expected no station for an anonymous connection, got %q", stations[false])
+	}
+	if stations[true] != "52" {
+		t.Errorf("Expected the ticket's station, got %q", stations[true])
+	}
+}
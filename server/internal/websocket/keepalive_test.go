@@ -0,0 +1,82 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// TestSilentClientIsEvicted checks a client that stops answering pings is disconnected
+// and listed with its disconnect reason
+func TestSilentClientIsEvicted(t *testing.T) {
+	server := newTestServer(t, func(hub *ws.Hub) {
+		hub.SetKeepalive(50*time.Millisecond, 200*time.Millisecond)
+	})
+	defer server.close()
+
+	// A client that never reads never answers the server's pings
+	silent, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer silent.Close()
+
+	// A client that reads answers pings through the default ping handler
+	alive, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	server.waitForClients(t, 2)
+	server.waitForClients(t, 1)
+
+	disconnects := server.handler.GetRecentDisconnects(ws.HubTypeDashboard)
+	if len(disconnects) != 1 {
+		t.Fatalf("Expected 1 recent disconnect, got %d", len(disconnects))
+	}
+	if reason := disconnects[0].DisconnectReason; reason != ws.DisconnectPongTimeout {
+		t.Errorf("Expected disconnect reason %q, got %q", ws.DisconnectPongTimeout, reason)
+	}
+	if disconnects[0].DisconnectedAt == nil {
+		t.Error("Expected the disconnect time to be set")
+	}
+
+	details := server.handler.GetDashboardConnectionDetails()
+	if len(details) != 1 || details[0].LastPongAt == nil {
+		t.Errorf("Expected the remaining client to have answered a ping, got %+v", details)
+	}
+}
+
+// TestClosedClientReason checks a client that closes the connection is listed as closed by the client
+func TestClosedClientReason(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.dashboardURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	server.waitForClients(t, 1)
+
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye")
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Failed to send close frame: %v", err)
+	}
+	conn.Close()
+	server.waitForClients(t, 0)
+
+	disconnects := server.handler.GetRecentDisconnects(ws.HubTypeDashboard)
+	if len(disconnects) != 1 || disconnects[0].DisconnectReason != ws.DisconnectClientClosed {
+		t.Errorf("Expected one disconnect closed by the client, got %+v", disconnects)
+	}
+}
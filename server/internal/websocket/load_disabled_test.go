@@ -0,0 +1,6 @@
+//go:build !load
+
+package websocket_test
+
+// loadEnabled reports whether the load test runs at full size
+const loadEnabled = false
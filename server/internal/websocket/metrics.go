@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"github.com/user/alerting/server/internal/metrics"
+)
+
+// RegisterMetrics exposes connection and send queue metrics of every hub
+func (h *Handler) RegisterMetrics(registry *metrics.Registry) {
+	hubs := []*Hub{h.dashboardHub, h.clientHub, h.logsHub}
+
+	// hubCounter collects a per-hub total from the hub's queue stats
+	hubCounter := func(value func(stats *queueStats) int64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			samples := make([]metrics.Sample, 0, len(hubs))
+			for _, hub := range hubs {
+				samples = append(samples, metrics.Sample{
+					Labels: metrics.Labels{"hub": string(hub.hubType)},
+					Value:  float64(value(&hub.queueStats)),
+				})
+			}
+			return samples
+		}
+	}
+
+	registry.GaugeFunc("alerting_ws_clients", "Connected websocket clients", func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0, len(hubs))
+		for _, hub := range hubs {
+			samples = append(samples, metrics.Sample{
+				Labels: metrics.Labels{"hub": string(hub.hubType)},
+				Value:  float64(hub.ClientCount()),
+			})
+		}
+		return samples
+	})
+
+	registry.GaugeFunc("alerting_ws_client_queue_depth", "Messages waiting to be written to each websocket client", func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0)
+		for _, hub := range hubs {
+			for _, client := range hub.GetClients() {
+				samples = append(samples, metrics.Sample{
+					Labels: metrics.Labels{
+						"hub":       string(hub.hubType),
+						"client_id": client.id,
+						"station":   client.station(),
+					},
+					Value: float64(client.QueueDepth()),
+				})
+			}
+		}
+		return samples
+	})
+
+	registry.CounterFunc("alerting_ws_messages_dropped_total", "Messages dropped because a client's send queue was full",
+		hubCounter(func(stats *queueStats) int64 { return stats.dropped.Load() }))
+	registry.CounterFunc("alerting_ws_messages_coalesced_total", "Queued messages replaced by a newer version of the same event",
+		hubCounter(func(stats *queueStats) int64 { return stats.coalesced.Load() }))
+	registry.CounterFunc("alerting_ws_slow_consumer_disconnects_total", "Clients disconnected because they couldn't keep up",
+		hubCounter(func(stats *queueStats) int64 { return stats.disconnected.Load() }))
+}
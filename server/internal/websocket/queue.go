@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// SlowConsumerPolicy decides what happens when a client's send queue is full
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest drops the oldest queued message to make room
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyCoalesce replaces queued events that a newer event supersedes, then drops the oldest
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+	// PolicyDisconnect closes the connection so the client reconnects and resumes
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// CloseSlowConsumer is sent when a client is disconnected because it can't keep up
+const CloseSlowConsumer = 4429
+
+var (
+	// errQueueClosed is returned when pushing to a queue that is already closed
+	errQueueClosed = errors.New("send queue closed")
+	// errSlowConsumer is returned when the push closed the queue because it was full
+	errSlowConsumer = errors.New("send queue full")
+)
+
+// queueStats counts dropped and coalesced messages and slow consumer disconnects
+type queueStats struct {
+	dropped      atomic.Int64
+	coalesced    atomic.Int64
+	disconnected atomic.Int64
+}
+
+// ParseSlowConsumerPolicy validates a policy name
+func ParseSlowConsumerPolicy(name string) (SlowConsumerPolicy, error) {
+	switch policy := SlowConsumerPolicy(name); policy {
+	case PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", name)
+	}
+}
+
+// coalescedEvents are events that only matter in their latest version
+var coalescedEvents = map[string]bool{
+	"weather_update": true,
+}
+
+// priorityEvents are written before any other queued message and are never dropped
+var priorityEvents = map[string]bool{
+	"new_alert": true,
+}
+
+// sendQueue is a client's outgoing message queue with a priority lane for alerts.
+// A full queue is handled according to the hub's slow consumer policy.
+type sendQueue struct {
+	priority    []models.WebSocketMessage
+	normal      []models.WebSocketMessage
+	size        int // Capacity of each lane
+	policy      SlowConsumerPolicy
+	ready       chan struct{} // Signalled when messages are queued or the queue closes
+	closed      bool
+	closeCode   int
+	closeReason string
+	stats       queueStats  // This queue's counts
+	hubStats    *queueStats // Totals across the hub's clients, may be nil
+	mutex       sync.Mutex
+}
+
+// newSendQueue creates a queue holding up to size messages per lane
+func newSendQueue(size int, policy SlowConsumerPolicy, hubStats *queueStats) *sendQueue {
+	if policy == "" {
+		policy = PolicyDropOldest
+	}
+	return &sendQueue{
+		priority: make([]models.WebSocketMessage, 0, size),
+		normal:   make([]models.WebSocketMessage, 0, size),
+		size:     size,
+		policy:   policy,
+		ready:    make(chan struct{}, 1),
+		hubStats: hubStats,
+	}
+}
+
+// push queues a message. It returns errSlowConsumer when the slow consumer
+// policy closed the queue instead, and errQueueClosed once the queue is closed.
+func (q *sendQueue) push(message models.WebSocketMessage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+
+	if priorityEvents[message.Type] {
+		// Alerts are never dropped; a client that can't take them must reconnect
+		if len(q.priority) >= q.size {
+			q.disconnectLocked()
+			return errSlowConsumer
+		}
+		q.priority = append(q.priority, message)
+		q.signal()
+		return nil
+	}
+
+	if q.policy == PolicyCoalesce && coalescedEvents[message.Type] {
+		// Remove the superseded event so the newer one keeps the sequence order
+		for i, queued := range q.normal {
+			if queued.Type == message.Type {
+				q.normal = append(q.normal[:i], q.normal[i+1:]...)
+				q.count(func(stats *queueStats) { stats.coalesced.Add(1) })
+				break
+			}
+		}
+	}
+
+	if len(q.normal) >= q.size {
+		if q.policy == PolicyDisconnect {
+			q.disconnectLocked()
+			return errSlowConsumer
+		}
+		q.normal = q.normal[1:]
+		q.count(func(stats *queueStats) { stats.dropped.Add(1) })
+	}
+
+	q.normal = append(q.normal, message)
+	q.signal()
+	return nil
+}
+
+// disconnectLocked closes the queue of a slow consumer. The caller must hold the mutex.
+func (q *sendQueue) disconnectLocked() {
+	q.count(func(stats *queueStats) { stats.disconnected.Add(1) })
+	q.closeLocked(CloseSlowConsumer, errSlowConsumer.Error())
+}
+
+// count updates this queue's stats and the hub totals
+func (q *sendQueue) count(update func(stats *queueStats)) {
+	update(&q.stats)
+	if q.hubStats != nil {
+		update(q.hubStats)
+	}
+}
+
+// popAll removes every queued message, alerts first
+func (q *sendQueue) popAll() []models.WebSocketMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	messages := make([]models.WebSocketMessage, 0, len(q.priority)+len(q.normal))
+	messages = append(messages, q.priority...)
+	messages = append(messages, q.normal...)
+	q.priority = q.priority[:0]
+	q.normal = q.normal[:0]
+	return messages
+}
+
+// close stops the queue. Messages already queued are discarded.
+func (q *sendQueue) close(code int, reason string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closeLocked(code, reason)
+}
+
+// closeLocked closes the queue. The caller must hold the mutex.
+func (q *sendQueue) closeLocked(code int, reason string) {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.closeCode = code
+	q.closeReason = reason
+	q.priority = nil
+	q.normal = nil
+	q.signal()
+}
+
+// closeStatus reports whether the queue is closed and the close code to send
+func (q *sendQueue) closeStatus() (bool, int, string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.closed, q.closeCode, q.closeReason
+}
+
+// depth returns the number of queued messages
+func (q *sendQueue) depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.priority) + len(q.normal)
+}
+
+// signal wakes the write pump without blocking. The caller must hold the mutex.
+func (q *sendQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
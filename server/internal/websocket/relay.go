@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// commandTopic is the event bus topic that carries targeted commands and their answers between instances
+const commandTopic = "commands"
+
+// relayedCommand is a command sent to the matching clients of every other instance
+type relayedCommand struct {
+	Origin    string                 `json:"origin"` // Instance that collects the command's outcome
+	CommandID string                 `json:"command_id"`
+	Command   string                 `json:"command"`
+	Args      map[string]interface{} `json:"args"`
+	Target    models.CommandTarget   `json:"target"`
+}
+
+// relayedTargets lists the clients of another instance that a command was sent to
+type relayedTargets struct {
+	Origin    string          `json:"origin"`
+	CommandID string          `json:"command_id"`
+	Command   string          `json:"command"`
+	Targets   []commandTarget `json:"targets"`
+}
+
+// relayedResult is the answer of a client of another instance
+type relayedResult struct {
+	Origin string                 `json:"origin"`
+	Result protocol.CommandResult `json:"result"`
+}
+
+// ShareCommands sends targeted commands, including scheduled ones, to the clients of every
+// server instance through the bus. The issuing instance collects the answers, so a shared
+// command's outcome is only complete once the acknowledgement timeout has passed.
+func (h *Handler) ShareCommands(bus EventBus) {
+	h.commands.bus = bus
+	h.commands.instance = uuid.New().String()
+	bus.Subscribe(commandTopic, h.commands.receive)
+}
+
+// CommandsShared reports whether commands also reach the clients of other instances,
+// in which case SendCommand can't tell yet whether any client matched
+func (h *Handler) CommandsShared() bool {
+	return h.commands.bus != nil
+}
+
+// publish sends a command message to the other instances
+func (r *commandRouter) publish(messageType string, content any) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := models.BusEvent{Hub: commandTopic, Message: newEvent(messageType, content)}
+	if err := r.bus.Publish(ctx, event); err != nil {
+		r.hub.logger.Error(err, "Failed to publish "+messageType+" to the other instances")
+	}
+}
+
+// receive handles a command message from the bus
+func (r *commandRouter) receive(event models.BusEvent) {
+	message := event.Message
+
+	var err error
+	switch message.Type {
+	case "command":
+		var command relayedCommand
+		if err = decodeRelayed(message.Content, &command); err == nil {
+			r.relay(command, message.Time)
+		}
+	case "command_targets":
+		var targets relayedTargets
+		if err = decodeRelayed(message.Content, &targets); err == nil {
+			r.addRemoteTargets(targets)
+		}
+	case "command_result":
+		var result relayedResult
+		if err = decodeRelayed(message.Content, &result); err == nil {
+			r.remoteResult(result)
+		}
+	}
+
+	if err != nil {
+		r.hub.logger.Warnf("Ignoring invalid %s message from the event bus: %v", message.Type, err)
+	}
+}
+
+// decodeRelayed decodes the content of a command message, which is raw JSON when it
+// arrived from another instance
+func decodeRelayed(content any, v any) error {
+	raw, ok := content.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(content); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// relay delivers a command issued on another instance to the matching clients of this one,
+// tells the issuing instance which clients it went to and relays their answers back.
+// Commands delivered again, or older than the acknowledgement timeout, are dropped.
+func (r *commandRouter) relay(command relayedCommand, sentAt time.Time) {
+	if command.Origin == r.instance || time.Since(sentAt) > commandAckTimeout {
+		return
+	}
+
+	r.mutex.Lock()
+	_, seen := r.pending[command.CommandID]
+	r.mutex.Unlock()
+	if seen {
+		return
+	}
+
+	targets := r.matching(nil, command.Target)
+	if len(targets) == 0 {
+		return
+	}
+
+	pending := &pendingCommand{
+		outcome: CommandOutcome{
+			CommandID: command.CommandID,
+			Command:   command.Command,
+			Targets:   make([]string, 0, len(targets)),
+		},
+		waiting: make(map[string]*Client),
+		origin:  command.Origin,
+	}
+	described := make([]commandTarget, 0, len(targets))
+	for _, client := range targets {
+		pending.waiting[client.id] = client
+		pending.outcome.Targets = append(pending.outcome.Targets, client.id)
+		described = append(described, targetOf(client))
+	}
+
+	r.register(pending)
+	r.deliver(targets, command.CommandID, protocol.Command{Command: command.Command, Args: command.Args})
+
+	go r.publish("command_targets", relayedTargets{
+		Origin:    command.Origin,
+		CommandID: command.CommandID,
+		Command:   command.Command,
+		Targets:   described,
+	})
+}
+
+// addRemoteTargets adds the clients of another instance to a command issued here,
+// and lists them to the issuer
+func (r *commandRouter) addRemoteTargets(targets relayedTargets) {
+	if targets.Origin != r.instance {
+		return
+	}
+
+	r.mutex.Lock()
+	pending, ok := r.pending[targets.CommandID]
+	added := make([]string, 0, len(targets.Targets))
+	if ok && pending.shared {
+		for _, target := range targets.Targets {
+			if _, known := pending.remote[target.ClientID]; known || pending.answered[target.ClientID] {
+				continue
+			}
+			pending.remote[target.ClientID] = target
+			pending.outcome.Targets = append(pending.outcome.Targets, target.ClientID)
+			added = append(added, target.ClientID)
+		}
+	}
+	r.mutex.Unlock()
+
+	if len(added) > 0 && pending.issuer != nil {
+		pending.issuer.SendMessage("command_sent", protocol.CommandSent{
+			CommandID: targets.CommandID,
+			Command:   targets.Command,
+			Targets:   added,
+		})
+	}
+}
+
+// remoteResult counts the answer of a client of another instance to a command issued here,
+// and routes it to the issuer. An answer that arrives before its target is listed adds the target.
+func (r *commandRouter) remoteResult(relayed relayedResult) {
+	if relayed.Origin != r.instance {
+		return
+	}
+	result := relayed.Result
+
+	r.mutex.Lock()
+	pending, ok := r.pending[result.CommandID]
+	ok = ok && pending.shared && !pending.answered[result.ClientID]
+	if ok {
+		if _, known := pending.remote[result.ClientID]; !known {
+			pending.outcome.Targets = append(pending.outcome.Targets, result.ClientID)
+		}
+		delete(pending.remote, result.ClientID)
+		pending.answered[result.ClientID] = true
+		if result.Status == CommandStatusOK {
+			pending.outcome.Acknowledged++
+		} else {
+			pending.outcome.Failed++
+		}
+	}
+	r.mutex.Unlock()
+
+	if ok && pending.issuer != nil {
+		pending.issuer.SendMessage("command_result", result)
+	}
+}
@@ -0,0 +1,239 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// maxReplayEvents is the largest gap replayed to a client; larger gaps require a full resync.
+// It stays below the send buffer so a replay can't overflow it.
+const maxReplayEvents = sendBufferSize / 2
+
+// replayRetention is how long stored events are kept. It also removes the events of retired instances.
+const replayRetention = 24 * time.Hour
+
+// ReplayStore persists broadcast events so the replay buffer survives restarts
+type ReplayStore interface {
+	SaveWebSocketEvent(ctx context.Context, hub string, message models.WebSocketMessage) error
+	GetRecentWebSocketEvents(ctx context.Context, hub, instance string, limit int) ([]models.WebSocketMessage, error)
+	DeleteWebSocketEventsBefore(ctx context.Context, hub, instance string, seq int64) error
+	DeleteWebSocketEventsOlderThan(ctx context.Context, before time.Time) (int, error)
+}
+
+// replayBuffer is a bounded, sequence ordered ring of the latest broadcast events of a hub
+type replayBuffer struct {
+	events   []models.WebSocketMessage
+	size     int
+	seq      int64
+	instance string // Server instance the sequence numbers belong to
+	store    ReplayStore
+	mutex    sync.Mutex
+}
+
+// EnableReplay numbers broadcast events and keeps the last size of them for clients that resume.
+// Sequence numbers are scoped to the instance, because every server instance delivers bus events
+// on its own and may miss or add some. Clients that resume with another instance's numbers resync.
+// When a store is given, events are persisted and the buffer is reloaded from it on startup.
+func (h *Hub) EnableReplay(store ReplayStore, instance string, size int) error {
+	if size <= 0 {
+		return nil
+	}
+
+	buffer := &replayBuffer{
+		events:   make([]models.WebSocketMessage, 0, size),
+		size:     size,
+		instance: instance,
+		store:    store,
+	}
+
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		events, err := store.GetRecentWebSocketEvents(ctx, string(h.hubType), instance, size)
+		if err != nil {
+			return fmt.Errorf("failed to load replay buffer: %w", err)
+		}
+
+		for _, event := range events {
+			event.Content = decodeReplayContent(event.Type, event.Content)
+			buffer.events = append(buffer.events, event)
+			buffer.seq = event.Seq
+		}
+		h.logger.Infof("Loaded %d replay events for %s hub of instance %s, last sequence %d", len(events), h.hubType, instance, buffer.seq)
+	}
+
+	h.replay = buffer
+	return nil
+}
+
+// decodeReplayContent turns stored JSON back into the types the hub broadcasts
+func decodeReplayContent(eventType string, content interface{}) interface{} {
+	raw, ok := content.(json.RawMessage)
+	if !ok {
+		return content
+	}
+
+	switch eventType {
+	case "new_alert":
+		var alert models.Alert
+		if err := json.Unmarshal(raw, &alert); err == nil {
+			return &alert
+		}
+	case "bulletin", "bulletin_expired":
+		var bulletin models.Bulletin
+		if err := json.Unmarshal(raw, &bulletin); err == nil {
+			return bulletin
+		}
+	}
+
+	return raw
+}
+
+// record assigns the next sequence number to a message and stores it in the buffer
+func (h *Hub) record(message *models.WebSocketMessage) {
+	if h.replay == nil {
+		return
+	}
+
+	b := h.replay
+	b.mutex.Lock()
+	b.seq++
+	message.Seq = b.seq
+	message.Instance = b.instance
+	b.events = append(b.events, *message)
+	if len(b.events) > b.size {
+		b.events = b.events[len(b.events)-b.size:]
+	}
+	oldest := b.events[0].Seq
+	b.mutex.Unlock()
+
+	if b.store == nil {
+		return
+	}
+
+	// Persist without holding up the broadcast
+	event := *message
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := b.store.SaveWebSocketEvent(ctx, string(h.hubType), event); err != nil {
+			h.logger.Error(err, "Failed to save replay event")
+			return
+		}
+		if event.Seq%int64(b.size) == 0 {
+			if err := b.store.DeleteWebSocketEventsBefore(ctx, string(h.hubType), b.instance, oldest); err != nil {
+				h.logger.Error(err, "Failed to prune replay events")
+			}
+			if _, err := b.store.DeleteWebSocketEventsOlderThan(ctx, time.Now().Add(-replayRetention)); err != nil {
+				h.logger.Error(err, "Failed to prune old replay events")
+			}
+		}
+	}()
+}
+
+// CurrentSeq returns the sequence number of the latest broadcast event
+func (h *Hub) CurrentSeq() int64 {
+	if h.replay == nil {
+		return 0
+	}
+
+	h.replay.mutex.Lock()
+	defer h.replay.mutex.Unlock()
+	return h.replay.seq
+}
+
+// Resume replays the events a client missed after lastSeq, or asks it to resync when
+// the gap is no longer in the buffer, is too large to replay, or was numbered by another instance.
+// An empty instance stands for this one, as sent by clients that predate instances.
+func (h *Hub) Resume(client *Client, instance string, lastSeq int64) {
+	if h.replay == nil {
+		client.SendMessage("resync_required", protocol.ResyncRequired{Reason: "replay is not enabled on this hub"})
+		return
+	}
+
+	// Hold back live broadcasts so replayed events arrive before newer ones
+	h.broadcastMutex.Lock()
+	defer h.broadcastMutex.Unlock()
+
+	b := h.replay
+	if instance != "" && instance != b.instance {
+		h.logger.Infof("Client %s must resync: last_seq %d is from instance %q, this is %q", client.id, lastSeq, instance, b.instance)
+		client.SendMessage("resync_required", protocol.ResyncRequired{
+			Reason:     "events were numbered by another server instance",
+			Instance:   b.instance,
+			LastSeq:    lastSeq,
+			CurrentSeq: h.CurrentSeq(),
+		})
+		return
+	}
+
+	b.mutex.Lock()
+	current := b.seq
+	oldest := int64(0)
+	if len(b.events) > 0 {
+		oldest = b.events[0].Seq
+	}
+	missed := make([]models.WebSocketMessage, 0)
+	for _, event := range b.events {
+		if event.Seq > lastSeq {
+			missed = append(missed, event)
+		}
+	}
+	b.mutex.Unlock()
+
+	// A last_seq ahead of the hub means the server restarted without its buffer
+	gapTooLarge := lastSeq > current ||
+		(lastSeq < current && (len(missed) == 0 || missed[0].Seq != lastSeq+1)) ||
+		len(missed) > maxReplayEvents
+	if gapTooLarge {
+		h.logger.Infof("Client %s must resync: last_seq %d, buffer %d-%d", client.id, lastSeq, oldest, current)
+		client.SendMessage("resync_required", protocol.ResyncRequired{
+			Instance:   b.instance,
+			LastSeq:    lastSeq,
+			OldestSeq:  oldest,
+			CurrentSeq: current,
+		})
+		return
+	}
+
+	replayed := 0
+	for _, event := range missed {
+		if !client.wants(TopicForEvent(event.Type)) {
+			continue
+		}
+
+		// Alerts are filtered and redacted for each client as in BroadcastEvent
+		if alert, ok := event.Content.(*models.Alert); ok {
+			if !client.wantsAlert(alert, h.stationPageGroups) {
+				continue
+			}
+			if !client.authInfo.Can(auth.PermAlertsRead) {
+				alertCopy := models.DeepCopyAlert(*alert)
+				event.Content = auth.RedactAlertData(&alertCopy)
+			}
+		}
+		if bulletin, ok := event.Content.(models.Bulletin); ok && !client.wantsBulletin(bulletin) {
+			continue
+		}
+
+		client.enqueue(event)
+		replayed++
+	}
+
+	h.logger.Infof("Replayed %d events to client %s from sequence %d to %d", replayed, client.id, lastSeq, current)
+	client.SendMessage("resumed", protocol.Resumed{
+		Instance:   b.instance,
+		LastSeq:    lastSeq,
+		CurrentSeq: current,
+		Replayed:   replayed,
+	})
+}
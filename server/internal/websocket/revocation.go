@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// revocationTopic is the event bus topic that carries revoked credentials between instances
+const revocationTopic = "revocations"
+
+// SetEventBus shares revoked credentials with the other server instances, so each of them
+// closes its own connections opened with a revoked session, API key or device
+func (h *Handler) SetEventBus(bus EventBus) {
+	h.bus = bus
+	bus.Subscribe(revocationTopic, h.receiveRevocation)
+}
+
+// publishRevocation tells the other instances that a credential was revoked
+func (h *Handler) publishRevocation(credentialID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := models.BusEvent{Hub: revocationTopic, Message: newEvent("credentials_revoked", credentialID)}
+	if err := h.bus.Publish(ctx, event); err != nil {
+		h.logger.Error(err, "Failed to publish credential revocation, only local connections were closed")
+	}
+}
+
+// receiveRevocation closes the local connections of a credential revoked on any instance.
+// Closing is idempotent, so events delivered more than once or back to this instance do no harm.
+func (h *Handler) receiveRevocation(event models.BusEvent) {
+	var credentialID string
+	switch content := event.Message.Content.(type) {
+	case string:
+		credentialID = content
+	case json.RawMessage:
+		if err := json.Unmarshal(content, &credentialID); err != nil {
+			h.logger.Warnf("Ignoring invalid credential revocation: %v", err)
+			return
+		}
+	}
+
+	if credentialID != "" {
+		h.closeRevoked(credentialID)
+	}
+}
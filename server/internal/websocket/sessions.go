@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+const (
+	// sessionTouchInterval is how often open sessions are marked as seen
+	sessionTouchInterval = time.Minute
+	// sessionStaleAfter is how long an open session may go unseen before it is closed,
+	// such as when the server that owned it stopped without closing it
+	sessionStaleAfter = 3 * sessionTouchInterval
+	// sessionQueueSize bounds the session events waiting to be written
+	sessionQueueSize = 1024
+)
+
+// DisconnectServerStopped is recorded for sessions left open by a server that stopped
+const DisconnectServerStopped = "server_stopped"
+
+// SessionStore persists connection sessions
+type SessionStore interface {
+	StartConnectionSession(ctx context.Context, hub string, detail models.ConnectionDetail) error
+	EndConnectionSession(ctx context.Context, hub string, detail models.ConnectionDetail) error
+	TouchConnectionSessions(ctx context.Context, ids []string) error
+	CloseStaleConnectionSessions(ctx context.Context, hub string, seenBefore time.Time, reason string) (int, error)
+}
+
+// sessionEvent is a connect or disconnect waiting to be written
+type sessionEvent struct {
+	ended  bool
+	detail models.ConnectionDetail
+}
+
+// sessionRecorder writes a hub's connection sessions in order from a single goroutine
+type sessionRecorder struct {
+	hub    *Hub
+	store  SessionStore
+	events chan sessionEvent
+}
+
+// EnableSessionHistory persists every connection of the hub as a session.
+// Sessions left open by a previous run are closed at the time they were last seen.
+func (h *Hub) EnableSessionHistory(store SessionStore) {
+	recorder := &sessionRecorder{
+		hub:    h,
+		store:  store,
+		events: make(chan sessionEvent, sessionQueueSize),
+	}
+	recorder.closeStale()
+	h.sessions = recorder
+	go recorder.run()
+}
+
+// started queues the start of a session without blocking the hub
+func (r *sessionRecorder) started(detail models.ConnectionDetail) {
+	r.queue(sessionEvent{detail: detail})
+}
+
+// ended queues the end of a session without blocking the hub
+func (r *sessionRecorder) ended(detail models.ConnectionDetail) {
+	r.queue(sessionEvent{ended: true, detail: detail})
+}
+
+// queue adds an event, dropping it if the writer has fallen too far behind
+func (r *sessionRecorder) queue(event sessionEvent) {
+	select {
+	case r.events <- event:
+	default:
+		r.hub.logger.Warnf("Session history queue of %s hub is full, dropping event for client %s", r.hub.hubType, event.detail.ID)
+	}
+}
+
+// run writes queued session events and periodically marks open sessions as seen
+func (r *sessionRecorder) run() {
+	ticker := time.NewTicker(sessionTouchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-r.events:
+			r.write(event)
+		case <-ticker.C:
+			r.touch()
+			r.closeStale()
+		}
+	}
+}
+
+// write stores one session event
+func (r *sessionRecorder) write(event sessionEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hub := string(r.hub.hubType)
+	var err error
+	if event.ended {
+		err = r.store.EndConnectionSession(ctx, hub, event.detail)
+	} else {
+		err = r.store.StartConnectionSession(ctx, hub, event.detail)
+	}
+	if err != nil {
+		r.hub.logger.Error(err, "Failed to record connection session")
+	}
+}
+
+// touch marks the sessions of connected clients as seen
+func (r *sessionRecorder) touch() {
+	clients := r.hub.GetClients()
+	ids := make([]string, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.store.TouchConnectionSessions(ctx, ids); err != nil {
+		r.hub.logger.Error(err, "Failed to update connection sessions")
+	}
+}
+
+// closeStale ends open sessions that no running server has seen recently
+func (r *sessionRecorder) closeStale() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := r.store.CloseStaleConnectionSessions(ctx, string(r.hub.hubType), time.Now().Add(-sessionStaleAfter), DisconnectServerStopped)
+	if err != nil {
+		r.hub.logger.Error(err, "Failed to close stale connection sessions")
+		return
+	}
+	if count > 0 {
+		r.hub.logger.Infof("Closed %d stale connection sessions of %s hub", count, r.hub.hubType)
+	}
+}
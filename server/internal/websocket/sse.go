@@ -0,0 +1,285 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/models"
+	"github.com/user/alerting/server/internal/protocol"
+)
+
+// sseRetry is how long browsers wait before reconnecting a dropped event stream
+const sseRetry = 5 * time.Second
+
+// HandleDashboardEvents streams the dashboard hub's events as server-sent events, for networks
+// that block websocket upgrades. The stream is a dashboard hub client, so alerts are filtered,
+// redacted and replayed exactly as they are for websocket clients.
+func (h *Handler) HandleDashboardEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	authInfo, station, err := h.streamAuth(r)
+	if err != nil {
+		code := http.StatusUnauthorized
+		if err == auth.ErrTicketWrongHub {
+			code = http.StatusForbidden
+		}
+		h.respondWithError(w, code, "Invalid ticket: "+err.Error())
+		return
+	}
+
+	var topics []Topic
+	if value := query.Get("topics"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			topic := Topic(strings.TrimSpace(name))
+			if !isValidTopic(topic) {
+				h.respondWithError(w, http.StatusBadRequest, "Unknown topic: "+string(topic))
+				return
+			}
+			topics = append(topics, topic)
+		}
+	}
+
+	// Browsers send the id of the last event they saw when they reconnect
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	instance, lastSeq, err := parseEventID(lastEventID)
+	if err != nil || lastSeq < 0 {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID: "+lastEventID)
+		return
+	}
+
+	// Events are written for as long as the client stays, so the server's write timeout can't apply
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Warnf("Failed to clear write deadline of event stream: %v", err)
+	}
+
+	client := newStreamClient(h.dashboardHub, r, h.logger, authInfo)
+	if station != "" {
+		client.SetMetadata("station", station)
+	}
+	if len(topics) > 0 {
+		client.Subscribe(topics)
+	}
+	if filter := query.Get("station_filter"); filter != "" {
+		client.SetStationFilter(filter)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		h.logger.Error(err, "Failed to flush event stream")
+		return
+	}
+
+	h.logger.Infof("New dashboard event stream client created with ID %s, authentication status: %v",
+		client.id, client.authInfo.Authenticated)
+
+	h.dashboardHub.Register(client)
+	h.sendBulletins(client)
+	if lastEventID != "" {
+		h.dashboardHub.Resume(client, instance, lastSeq)
+	}
+
+	client.streamEvents(w, rc, r.Context().Done())
+	h.dashboardHub.Unregister(client)
+}
+
+// streamAuth authenticates an event stream with a dashboard ticket, since EventSource can't
+// send headers, or with the credentials of the request. Without either, alerts are redacted
+// and the stream has no station. Paired devices are bound to their station, other credentials
+// may name one as they can for a ticket.
+func (h *Handler) streamAuth(r *http.Request) (auth.AuthInfo, string, error) {
+	if r.URL.Query().Get("ticket") != "" {
+		return h.connectionAuth(r, HubTypeDashboard)
+	}
+
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+	switch {
+	case authInfo.Station != "":
+		return authInfo, authInfo.Station, nil
+	case authInfo.Authenticated:
+		return authInfo, r.URL.Query().Get("station"), nil
+	default:
+		return authInfo, "", nil
+	}
+}
+
+// newStreamClient creates a hub client that is written to as a server-sent event stream
+func newStreamClient(hub *Hub, r *http.Request, logger *logging.Logger, authInfo auth.AuthInfo) *Client {
+	clientID := uuid.New().String()
+	now := time.Now()
+
+	return &Client{
+		hub:           hub,
+		queue:         newSendQueue(sendBufferSize, hub.slowConsumerPolicy, &hub.queueStats),
+		id:            clientID,
+		logger:        logger.WithField("client_id", clientID),
+		authInfo:      authInfo,
+		metadata:      map[string]string{"transport": "sse"},
+		connectedAt:   now,
+		lastActivity:  now,
+		remoteAddr:    r.RemoteAddr,
+		userAgent:     r.UserAgent(),
+		lastHeartbeat: now,
+		streamDone:    make(chan struct{}),
+	}
+}
+
+// endStream ends the event stream of the client
+func (c *Client) endStream() {
+	if c.streamDone == nil {
+		return
+	}
+	c.streamOnce.Do(func() {
+		close(c.streamDone)
+	})
+}
+
+// streamEvents writes the client's queued messages and heartbeats as server-sent events until
+// the request ends, the client is closed or writing fails
+func (c *Client) streamEvents(w io.Writer, rc *http.ResponseController, requestDone <-chan struct{}) {
+	heartbeatTicker := time.NewTicker(heartbeatPeriod)
+	defer heartbeatTicker.Stop()
+
+	for {
+		select {
+		case <-c.queue.ready:
+			if closed, code, reason := c.queue.closeStatus(); closed {
+				if code != 0 {
+					c.logger.Warnf("Closing event stream: %s", reason)
+					c.setDisconnectReason(disconnectReasonForCode(code))
+					c.writeEvent(w, rc, closeEvent(code, reason))
+				}
+				return
+			}
+
+			// Each message is written as its own event, alerts first
+			for _, message := range c.queue.popAll() {
+				if !c.writeEvent(w, rc, message) {
+					c.setDisconnectReason(DisconnectWriteError)
+					return
+				}
+				c.markDelivered(message)
+			}
+
+		case <-heartbeatTicker.C:
+			now := time.Now()
+
+			// Close streams whose session or API key has expired
+			if !c.authInfo.ExpiresAt.IsZero() && now.After(c.authInfo.ExpiresAt) {
+				c.logger.Infof("Closing event stream, credentials expired at %s", c.authInfo.ExpiresAt)
+				c.setDisconnectReason(DisconnectCredentialsExpired)
+				c.writeEvent(w, rc, closeEvent(CloseCredentialExpired, "credentials expired"))
+				return
+			}
+
+			c.stateMutex.Lock()
+			c.lastHeartbeat = now
+			c.stateMutex.Unlock()
+
+			heartbeat := models.WebSocketMessage{
+				Type:    "heartbeat",
+				Content: protocol.Heartbeat{Timestamp: now.Unix()},
+				ID:      uuid.New().String(),
+				Time:    now,
+			}
+			if !c.writeEvent(w, rc, heartbeat) {
+				c.setDisconnectReason(DisconnectWriteError)
+				return
+			}
+
+		case <-c.streamDone:
+			// Closed by the server, the reason is already set
+			return
+
+		case <-requestDone:
+			c.setDisconnectReason(DisconnectClientClosed)
+			return
+		}
+	}
+}
+
+// writeEvent writes a message as a server-sent event named after its type. Replayable
+// events carry their instance and sequence number as the event id. It returns false when writing failed.
+func (c *Client) writeEvent(w io.Writer, rc *http.ResponseController, message models.WebSocketMessage) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		c.logger.Error(err, "Failed to marshal message")
+		return true
+	}
+
+	var event bytes.Buffer
+	if message.Seq > 0 {
+		fmt.Fprintf(&event, "id: %s\n", eventID(message.Instance, message.Seq))
+	}
+	fmt.Fprintf(&event, "event: %s\ndata: %s\n\n", message.Type, data)
+
+	if err := rc.SetWriteDeadline(time.Now().Add(writeWait)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		c.logger.Debugf("Failed to set write deadline: %v", err)
+	}
+	if _, err := w.Write(event.Bytes()); err != nil {
+		c.logger.Debugf("Failed to write event: %v", err)
+		return false
+	}
+	if err := rc.Flush(); err != nil {
+		c.logger.Debugf("Failed to flush event: %v", err)
+		return false
+	}
+
+	// Increment sent message count and update last activity time
+	c.messagesSent.Add(1)
+	c.touch()
+	return true
+}
+
+// closeEvent tells a stream client why the server ended its stream
+func closeEvent(code int, reason string) models.WebSocketMessage {
+	return models.WebSocketMessage{
+		Type:    "close",
+		Content: protocol.Close{Code: code, Reason: reason},
+		ID:      uuid.New().String(),
+		Time:    time.Now(),
+	}
+}
+
+// eventID joins the instance that numbered an event and its sequence number into a stream event id
+func eventID(instance string, seq int64) string {
+	if instance == "" {
+		return strconv.FormatInt(seq, 10)
+	}
+	return instance + ":" + strconv.FormatInt(seq, 10)
+}
+
+// parseEventID splits a stream event id into the instance and sequence number.
+// An id without an instance resumes on the instance that receives it.
+func parseEventID(id string) (string, int64, error) {
+	if id == "" {
+		return "", 0, nil
+	}
+
+	instance, seq := "", id
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		instance, seq = id[:i], id[i+1:]
+	}
+
+	lastSeq, err := strconv.ParseInt(seq, 10, 64)
+	return instance, lastSeq, err
+}
@@ -0,0 +1,101 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/alerting/server/internal/models"
+	ws "github.com/user/alerting/server/internal/websocket"
+)
+
+// sseEvent is one parsed server-sent event
+type sseEvent struct {
+	id      string
+	event   string
+	message models.WebSocketMessage
+}
+
+// readEvent reads the next event with data, skipping retry lines
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "" && event.event != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.message); err != nil {
+				t.Fatalf("Invalid event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+// TestDashboardEventStream resumes a stream from Last-Event-ID with a topic filter and receives live events
+func TestDashboardEventStream(t *testing.T) {
+	server := newTestServer(t, func(hub *ws.Hub) {
+		if err := hub.EnableReplay(nil, "instance-a", 100); err != nil {
+			t.Fatalf("Failed to enable replay: %v", err)
+		}
+	})
+	defer server.close()
+
+	server.dashboardHub.BroadcastEvent("new_alert", testAlert("sse-1"))
+	server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 20})
+	server.dashboardHub.BroadcastEvent("new_alert", testAlert("sse-2"))
+
+	req, err := http.NewRequest("GET", server.eventsURL+"?topics=alerts", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "instance-a:1")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+
+	// The weather update is left out of the replay by the topic filter
+	missed := readEvent(t, reader)
+	if missed.event != "new_alert" || missed.id != "instance-a:3" {
+		t.Fatalf("Expected alert 3 to be replayed, got %+v", missed)
+	}
+	if resumed := readEvent(t, reader); resumed.event != "resumed" || resumed.id != "" {
+		t.Fatalf("Expected resumed without an id, got %+v", resumed)
+	}
+
+	server.waitForClients(t, 1)
+	server.dashboardHub.BroadcastEvent("weather_update", map[string]interface{}{"temperature": 21})
+	server.dashboardHub.BroadcastEvent("new_alert", testAlert("sse-3"))
+
+	live := readEvent(t, reader)
+	if live.event != "new_alert" || live.id != "instance-a:5" || live.message.Seq != 5 {
+		t.Fatalf("Expected live alert 5, got %+v", live)
+	}
+
+	// The stream is a dashboard hub client until it disconnects
+	resp.Body.Close()
+	server.waitForClients(t, 0)
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/models"
+)
+
+// ticketRequest is the body of POST /ws/ticket
+type ticketRequest struct {
+	Hub     string `json:"hub"`
+	Station string `json:"station"`
+}
+
+// HandleTicketRequest issues a single-use ticket for opening a websocket connection.
+// The ticket is passed as ?ticket= so passwords and tokens never appear in websocket URLs.
+func (h *Handler) HandleTicketRequest(w http.ResponseWriter, r *http.Request) {
+	// Get authentication info from context
+	authInfo, _ := auth.GetAuthInfoFromContext(r.Context())
+	if !authInfo.Authenticated {
+		h.respondWithError(w, http.StatusUnauthorized, "Unauthorized: Authentication required")
+		return
+	}
+
+	var req ticketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	switch HubType(req.Hub) {
+	case HubTypeDashboard, HubTypeClient:
+	case HubTypeLogs:
+		if !authInfo.Can(auth.PermLogsRead) {
+			h.respondWithError(w, http.StatusForbidden, "Forbidden: Missing permission "+string(auth.PermLogsRead))
+			return
+		}
+	default:
+		h.respondWithError(w, http.StatusBadRequest, "Invalid hub: "+req.Hub)
+		return
+	}
+
+	// Paired devices are bound to their station
+	if authInfo.Station != "" {
+		req.Station = authInfo.Station
+	}
+
+	token, ticket, err := h.auth.IssueTicket(r.Context(), authInfo, req.Hub, req.Station)
+	if err != nil {
+		h.logger.Error(err, "Failed to issue websocket ticket")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to issue ticket")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"ticket":     token,
+			"hub":        ticket.Hub,
+			"station":    ticket.Station,
+			"expires_at": ticket.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// respondWithError sends an error response
+func (h *Handler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, models.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// respondWithJSON sends a JSON response
+func (h *Handler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		h.logger.Error(err, "Failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(response); err != nil {
+		h.logger.Error(err, "Failed to write response")
+	}
+}
@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"strings"
+
+	"github.com/user/alerting/server/internal/models"
+)
+
+// Topic groups event types so clients can subscribe to only what they render
+type Topic string
+
+const (
+	// TopicAlerts carries new and deleted alerts
+	TopicAlerts Topic = "alerts"
+	// TopicWeather carries weather updates
+	TopicWeather Topic = "weather"
+	// TopicHydrants carries hydrant changes
+	TopicHydrants Topic = "hydrants"
+	// TopicSystem carries every other event and is always delivered
+	TopicSystem Topic = "system"
+)
+
+// eventTopics maps event types to their topic. Unknown event types belong to TopicSystem.
+var eventTopics = map[string]Topic{
+	"new_alert":        TopicAlerts,
+	"alert_deleted":    TopicAlerts,
+	"weather_update":   TopicWeather,
+	"hydrants_deleted": TopicHydrants,
+}
+
+// TopicForEvent returns the topic an event type is published on
+func TopicForEvent(eventType string) Topic {
+	if topic, ok := eventTopics[eventType]; ok {
+		return topic
+	}
+	return TopicSystem
+}
+
+// isValidTopic checks if clients can subscribe to the topic
+func isValidTopic(topic Topic) bool {
+	switch topic {
+	case TopicAlerts, TopicWeather, TopicHydrants, TopicSystem:
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribe adds topics to the client's subscriptions. A client that has never
+// subscribed receives every topic; its first subscribe narrows that to the given topics.
+func (c *Client) Subscribe(topics []Topic) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+
+	if c.topics == nil {
+		c.topics = make(map[Topic]bool)
+	}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+}
+
+// Unsubscribe removes topics from the client's subscriptions
+func (c *Client) Unsubscribe(topics []Topic) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+
+	if c.topics == nil {
+		// Unsubscribing from the default of everything leaves the other topics
+		c.topics = map[Topic]bool{
+			TopicAlerts:   true,
+			TopicWeather:  true,
+			TopicHydrants: true,
+		}
+	}
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+// SetStationFilter limits alerts to those paged to the station. An empty station removes the filter.
+func (c *Client) SetStationFilter(station string) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+	c.stationFilter = station
+}
+
+// Subscriptions returns the subscribed topics and the station filter
+func (c *Client) Subscriptions() ([]Topic, string) {
+	c.subMutex.RLock()
+	defer c.subMutex.RUnlock()
+
+	if c.topics == nil {
+		return []Topic{TopicAlerts, TopicWeather, TopicHydrants, TopicSystem}, c.stationFilter
+	}
+
+	topics := make([]Topic, 0, len(c.topics)+1)
+	for _, topic := range []Topic{TopicAlerts, TopicWeather, TopicHydrants} {
+		if c.topics[topic] {
+			topics = append(topics, topic)
+		}
+	}
+	return append(topics, TopicSystem), c.stationFilter
+}
+
+// wants checks if the client is subscribed to the topic
+func (c *Client) wants(topic Topic) bool {
+	if topic == TopicSystem {
+		return true
+	}
+
+	c.subMutex.RLock()
+	defer c.subMutex.RUnlock()
+	return c.topics == nil || c.topics[topic]
+}
+
+// wantsAlert checks if an alert passes the client's station filter
+func (c *Client) wantsAlert(alert *models.Alert, stationPageGroups map[string][]string) bool {
+	c.subMutex.RLock()
+	station := c.stationFilter
+	c.subMutex.RUnlock()
+
+	if station == "" || len(alert.Alert.PageGroups) == 0 {
+		return true
+	}
+
+	// Without a configured mapping the station name is matched against the page groups directly
+	groups, ok := stationPageGroups[station]
+	if !ok {
+		groups = []string{station}
+	}
+
+	for _, pageGroup := range alert.Alert.PageGroups {
+		for _, group := range groups {
+			if strings.EqualFold(pageGroup, group) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -12,16 +12,26 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/config"
 	"github.com/user/alerting/server/internal/logging"
 	"github.com/user/alerting/server/internal/models"
 	ws "github.com/user/alerting/server/internal/websocket"
 )
 
-// TestWebSocketLoad tests the WebSocket system under load with many connections
+// TestWebSocketLoad tests the WebSocket system under load with many connections.
+// The default run broadcasts 20 alerts to 200 connections, enough for the race detector to see
+// registration, broadcasts and reads overlap on every client. With -tags load it checks the hub
+// keeps up with 10000 connections, which depends on the machine.
 func TestWebSocketLoad(t *testing.T) {
 	// Config
-	const numConnections = 10000
-	const numAlerts = 100
+	numConnections, numAlerts := 200, 20
+	if loadEnabled {
+		numConnections, numAlerts = 10000, 100
+		if raceEnabled {
+			// The race detector slows every goroutine down, fewer connections keep the run short
+			numConnections = 1000
+		}
+	}
 	const connectionTimeout = 10 * time.Second
 	const messageTimeout = 30 * time.Second
 
@@ -29,7 +39,7 @@ func TestWebSocketLoad(t *testing.T) {
 	logger := logging.New("debug", "websocket_load_test")
 
 	// Create authentication service (no auth required for this test)
-	authenticator := auth.New("", logger)
+	authenticator := auth.New(config.AuthConfig{}, nil, logger)
 
 	// Create the hubs
 	dashboardHub := ws.NewHub(ws.HubTypeDashboard, logger)
@@ -190,7 +200,19 @@ func TestWebSocketLoad(t *testing.T) {
 
 	// Wait for all alerts to be processed
 	fmt.Println("Waiting for alerts to be processed...")
-	time.Sleep(5 * time.Second)
+	deadline := time.Now().Add(messageTimeout)
+	for time.Now().Before(deadline) {
+		received := 0
+		receivedAlertsLock.Lock()
+		for _, alerts := range receivedAlerts {
+			received += len(alerts)
+		}
+		receivedAlertsLock.Unlock()
+		if received == numConnections*numAlerts {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 
 	// Close all WebSocket connections
 	fmt.Println("Closing all WebSocket connections...")
@@ -248,8 +270,3 @@ func TestWebSocketLoad(t *testing.T) {
 		fmt.Println("✅ SUCCESS: All clients received all alerts")
 	}
 }
-
-// Helper to create string pointers
-func stringPtr(s string) *string {
-	return &s
-}
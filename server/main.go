@@ -14,15 +14,24 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/user/alerting/server/internal/active911"
 	"github.com/user/alerting/server/internal/api"
 	"github.com/user/alerting/server/internal/auth"
+	"github.com/user/alerting/server/internal/bulletin"
 	"github.com/user/alerting/server/internal/config"
+	"github.com/user/alerting/server/internal/eventbus"
+	"github.com/user/alerting/server/internal/ingest"
+	"github.com/user/alerting/server/internal/leader"
 	"github.com/user/alerting/server/internal/logging"
+	"github.com/user/alerting/server/internal/metrics"
 	"github.com/user/alerting/server/internal/middleware"
 	"github.com/user/alerting/server/internal/models"
 	"github.com/user/alerting/server/internal/notification"
+	"github.com/user/alerting/server/internal/scheduler"
 	"github.com/user/alerting/server/internal/storage"
+	"github.com/user/alerting/server/internal/watchdog"
 	"github.com/user/alerting/server/internal/weather"
+	"github.com/user/alerting/server/internal/webhook"
 	"github.com/user/alerting/server/internal/websocket"
 )
 
@@ -41,6 +50,9 @@ func main() {
 
 	// Setup logger
 	logger := logging.New(cfg.Logging.Level, cfg.Logging.Format)
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal(err, "Invalid configuration")
+	}
 	logger.Info("Config")
 	logger.Infof("AUTH: %v", cfg.Auth.APIPassword)
 	logger.Infof("HOST: %v", cfg.Database.Host)
@@ -92,13 +104,135 @@ func main() {
 		logger.Fatal(err, "Failed to ensure database schema")
 	}
 
+	// Initialize the user and session tables
+	if err := store.InitUserTables(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize user tables")
+		logger.Fatal(err, "Failed to initialize user tables")
+	}
+
+	// Initialize the API key table
+	if err := store.InitAPIKeyTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize API key table")
+		logger.Fatal(err, "Failed to initialize API key table")
+	}
+
+	// Initialize the device pairing tables
+	if err := store.InitDeviceTables(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize device tables")
+		logger.Fatal(err, "Failed to initialize device tables")
+	}
+
+	// Initialize the websocket ticket table, tickets are redeemed on any instance
+	if err := store.InitWebSocketTicketTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize websocket ticket table")
+		logger.Fatal(err, "Failed to initialize websocket ticket table")
+	}
+
 	// Create authenticator
-	authenticator := auth.New(cfg.Auth.APIPassword, logger)
+	authenticator := auth.New(cfg.Auth, store, logger)
+	if err := authenticator.EnsureBootstrapAdmin(context.Background(), cfg.Auth.AdminUsername, cfg.Auth.AdminPassword); err != nil {
+		notifyService.NotifyFatal(err, "Failed to create bootstrap admin user")
+		logger.Fatal(err, "Failed to create bootstrap admin user")
+	}
+
+	// Periodically remove expired login sessions and device pairings
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			authenticator.PruneExpiredSessions(context.Background())
+			authenticator.PruneExpiredPairings(context.Background())
+			<-ticker.C
+		}
+	}()
 
 	// Initialize websocket hubs
 	dashboardHub := websocket.NewHub(websocket.HubTypeDashboard, logger)
 	clientHub := websocket.NewHub(websocket.HubTypeClient, logger)
 	logsHub := websocket.NewHub(websocket.HubTypeLogs, logger)
+	dashboardHub.SetStationPageGroups(cfg.WebSocket.StationPageGroups)
+
+	// Decide what happens to clients that can't keep up with their send queue
+	slowConsumerPolicy, err := websocket.ParseSlowConsumerPolicy(cfg.WebSocket.SlowConsumerPolicy)
+	if err != nil {
+		logger.Fatal(err, "Invalid WS_SLOW_CONSUMER_POLICY")
+	}
+	// Displays must answer protocol pings, or they are disconnected after the pong timeout
+	if cfg.WebSocket.PingInterval <= 0 || cfg.WebSocket.PongTimeout <= cfg.WebSocket.PingInterval {
+		logger.Fatal(fmt.Errorf("ping interval %s, pong timeout %s", cfg.WebSocket.PingInterval, cfg.WebSocket.PongTimeout),
+			"WS_PONG_TIMEOUT must be longer than a positive WS_PING_INTERVAL")
+	}
+	for _, hub := range []*websocket.Hub{dashboardHub, clientHub, logsHub} {
+		hub.SetSlowConsumerPolicy(slowConsumerPolicy)
+		hub.SetKeepalive(cfg.WebSocket.PingInterval, cfg.WebSocket.PongTimeout)
+	}
+
+	// Keep recent dashboard events so reconnecting displays can replay what they missed
+	if err := store.InitWebSocketEventTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize websocket event table")
+		logger.Fatal(err, "Failed to initialize websocket event table")
+	}
+	if err := dashboardHub.EnableReplay(store, cfg.EventBus.Instance, cfg.WebSocket.ReplayBufferSize); err != nil {
+		notifyService.NotifyFatal(err, "Failed to load websocket replay buffer")
+		logger.Fatal(err, "Failed to load websocket replay buffer")
+	}
+
+	// Track alert deliveries and warn when a station's display doesn't acknowledge an alert
+	dashboardHub.EnableDeliveryTracking(cfg.WebSocket.AckTimeout, func(alertID, station string) {
+		notifyService.NotifyWarning(
+			fmt.Sprintf("Station %s did not acknowledge alert %s within %s", station, alertID, cfg.WebSocket.AckTimeout),
+			"Alert delivery")
+	})
+
+	// Persist connection sessions for the connection history and display uptime reports
+	if err := store.InitConnectionSessionTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize connection session table")
+		logger.Fatal(err, "Failed to initialize connection session table")
+	}
+	for _, hub := range []*websocket.Hub{dashboardHub, clientHub, logsHub} {
+		hub.EnableSessionHistory(store)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			count, err := store.DeleteConnectionSessionsBefore(context.Background(), time.Now().Add(-cfg.WebSocket.HistoryRetention))
+			if err != nil {
+				logger.Error(err, "Failed to prune connection sessions")
+			} else if count > 0 {
+				logger.Infof("Pruned %d connection sessions", count)
+			}
+			<-ticker.C
+		}
+	}()
+
+	// Share broadcasts with the other server instances
+	var eventBus websocket.EventBus
+	var postgresBus *eventbus.Postgres
+	switch cfg.EventBus.Driver {
+	case "local":
+		eventBus = eventbus.NewLocal()
+	case "postgres":
+		if err := store.InitBusEventTable(); err != nil {
+			notifyService.NotifyFatal(err, "Failed to initialize bus event table")
+			logger.Fatal(err, "Failed to initialize bus event table")
+		}
+		postgresBus, err = eventbus.NewPostgres(cfg.EventBus, cfg.Database.DSN, store, logger)
+		if err != nil {
+			notifyService.NotifyFatal(err, "Failed to start event bus")
+			logger.Fatal(err, "Failed to start event bus")
+		}
+		eventBus = postgresBus
+	default:
+		logger.Fatal(fmt.Errorf("unknown event bus %q", cfg.EventBus.Driver), "EVENT_BUS must be local or postgres")
+	}
+	// The logs hub stays local, each instance streams the log of the requests it handles
+	for _, hub := range []*websocket.Hub{dashboardHub, clientHub} {
+		hub.SetEventBus(eventBus)
+	}
+	if postgresBus != nil {
+		postgresBus.Start()
+	}
 
 	// Start the hubs
 	go dashboardHub.Run()
@@ -122,10 +256,28 @@ func main() {
 		logsHub.BroadcastEvent(eventType, data)
 	})
 
+	// Report auth lockouts on the logs hub
+	authenticator.SetEventEmitter(func(eventType string, data interface{}) {
+		logsHub.BroadcastEvent(eventType, data)
+	})
+
 	// Apply middleware to all routes
 	r.Use(middleware.CORS(cfg.Server.CorsAllowedOrigins))
 	r.Use(authenticator.Auth) // Authenticate API requests
 	r.Use(loggerMiddleware.Logging)
+	if cfg.RateLimit.Enabled {
+		rateLimiter := middleware.NewRateLimiter(middleware.DefaultRateLimitRules(cfg.RateLimit), authenticator.ClientIP, logger)
+		r.Use(rateLimiter.Limit)
+	}
+
+	// Verify the HMAC signature of alert ingestion when a secret is configured
+	if cfg.Signature.PreviousSecret != "" && cfg.Signature.Secret == "" {
+		logger.Fatal(fmt.Errorf("previous secret without a current one"), "INGEST_SIGNATURE_PREVIOUS_SECRET requires INGEST_SIGNATURE_SECRET")
+	}
+	signatureVerifier := middleware.NewSignatureVerifier(cfg.Signature, logger)
+	if signatureVerifier.Enabled() {
+		r.Use(signatureVerifier.Verify)
+	}
 
 	// Register API routes
 	// Initialize weather service
@@ -145,13 +297,87 @@ func main() {
 
 	// Initialize the WebSocket handler first so it can be passed to the API handler
 	wsHandler := websocket.NewHandler(dashboardHub, clientHub, logsHub, authenticator, logger)
+	wsHandler.SetCompression(cfg.WebSocket.Compression, cfg.WebSocket.CompressThreshold)
+
+	// Close websocket connections on every instance when their session or API key is revoked
+	wsHandler.SetEventBus(eventBus)
+	authenticator.SetRevokeCallback(wsHandler.CloseRevokedConnections)
+
+	// Send targeted and scheduled commands to the displays of every instance
+	if postgresBus != nil {
+		wsHandler.ShareCommands(postgresBus)
+	}
 	
+	// Initialize webhook delivery, alert events are forwarded to the subscribed URLs
+	if err := store.InitWebhookTables(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize webhook tables")
+		logger.Fatal(err, "Failed to initialize webhook tables")
+	}
+	webhookService := webhook.New(cfg.Webhook, store, logger)
+	if cfg.Webhook.Enabled {
+		webhookService.Start()
+	}
+	webhookHandler := api.NewWebhookHandler(store, webhookService, logger)
+
 	// Create the API handler with WebSocket handler reference
 	apiHandler := api.New(store, logger, func(eventType string, data any) {
 		// Broadcast API events to websocket clients
 		dashboardHub.BroadcastEvent(eventType, data)
+
+		// Queue deletions for webhook subscriptions, new alerts are queued once they are stored
+		if cfg.Webhook.Enabled && eventType == webhook.EventAlertDeleted {
+			webhookService.Publish(eventType, data)
+		}
 	}, wsHandler)
 
+	// Queue new alerts for webhook subscriptions once the database has them
+	publishStored := func(alert models.Alert) {
+		if cfg.Webhook.Enabled {
+			webhookService.Publish(webhook.EventNewAlert, alert)
+		}
+	}
+	apiHandler.SetAlertStoredCallback(publishStored)
+
+	// Deduplicate retried alert ingestion requests
+	if err := store.InitIngestKeyTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize ingest key table")
+		logger.Fatal(err, "Failed to initialize ingest key table")
+	}
+	apiHandler.SetDedupWindow(cfg.Ingest.DedupWindow)
+
+	// Decide whether alert payloads with fields of the wrong type are rejected or repaired
+	parseMode, err := active911.ParseMode(cfg.Ingest.ParseMode)
+	if err != nil {
+		logger.Fatal(err, "Invalid INGEST_PARSE_MODE")
+	}
+	apiHandler.SetParseMode(parseMode)
+
+	// Hold inbound alerts on disk until the database has them, so a database outage can't lose an alert
+	var ingestQueue *ingest.Queue
+	if cfg.Ingest.QueueDir != "" {
+		ingestQueue, err = ingest.Open(cfg.Ingest, store, logger)
+		if err != nil {
+			notifyService.NotifyFatal(err, "Failed to open ingest queue")
+			logger.Fatal(err, "Failed to open ingest queue")
+		}
+		ingestQueue.SetStoredCallback(publishStored)
+		ingestQueue.Start()
+		apiHandler.SetIngestQueue(ingestQueue)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			count, err := store.DeleteExpiredIngestKeys(context.Background(), time.Now())
+			if err != nil {
+				logger.Error(err, "Failed to prune ingest keys")
+			} else if count > 0 {
+				logger.Infof("Pruned %d ingest keys", count)
+			}
+			<-ticker.C
+		}
+	}()
+
 	// Initialize the hydrant handler
 	if err := store.InitHydrantTable(); err != nil {
 		notifyService.NotifyFatal(err, "Failed to initialize hydrant table")
@@ -160,16 +386,111 @@ func main() {
 	
 	hydrantHandler := api.NewHydrantHandler(store, logger, dashboardHub)
 
+	// Initialize the auth handler for login and user management
+	authHandler := api.NewAuthHandler(store, authenticator, logger)
+
+	// Initialize the API key handler for integrations
+	apiKeyHandler := api.NewAPIKeyHandler(store, authenticator, logger)
+
+	// Initialize the device handler for display pairing
+	deviceHandler := api.NewDeviceHandler(store, authenticator, wsHandler, logger)
+
+	// Initialize the connection history handler, stations with page groups are expected to have a display
+	stations := make([]string, 0, len(cfg.WebSocket.StationPageGroups))
+	for station := range cfg.WebSocket.StationPageGroups {
+		stations = append(stations, station)
+	}
+	connectionHistoryHandler := api.NewConnectionHistoryHandler(store, stations, logger)
+
+	// With several server instances, one of them announces bulletins, runs scheduled jobs and reports offline displays
+	var elector *leader.Elector
+	if postgresBus != nil {
+		elector = leader.New(store, cfg.EventBus.Channel+"_leader", logger)
+		elector.Start()
+	}
+
+	// Initialize the scheduler for recurring display commands
+	if err := store.InitScheduleTables(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize schedule tables")
+		logger.Fatal(err, "Failed to initialize schedule tables")
+	}
+	schedulerService, err := scheduler.NewService(cfg.Scheduler, store, wsHandler, logger)
+	if err != nil {
+		logger.Fatal(err, "Invalid scheduler configuration")
+	}
+	if elector != nil {
+		schedulerService.SetLeader(elector)
+	}
+	if cfg.Scheduler.Enabled {
+		schedulerService.Start()
+	}
+	scheduleHandler := api.NewScheduleHandler(store, schedulerService, logger)
+
+	// Initialize the bulletin service, dashboard clients get the active bulletins on connect
+	if err := store.InitBulletinTable(); err != nil {
+		notifyService.NotifyFatal(err, "Failed to initialize bulletin table")
+		logger.Fatal(err, "Failed to initialize bulletin table")
+	}
+	bulletinService := bulletin.New(store, dashboardHub.BroadcastEvent, logger)
+	if elector != nil {
+		bulletinService.SetLeader(elector)
+		bulletinService.SetEventBus(postgresBus)
+	}
+	bulletinService.Start()
+	wsHandler.SetBulletinSource(bulletinService)
+	bulletinHandler := api.NewBulletinHandler(store, bulletinService, logger)
+
+	// Warn when a watched station has had no dashboard display for the grace period
+	// Every instance's displays are counted from the connection sessions when there are several instances
+	var stationSource watchdog.StationSource = dashboardHub
+	if elector != nil {
+		stationSource = watchdog.NewSessionSource(store, logger)
+	}
+	displayWatchdog := watchdog.New(cfg.Watchdog, stationSource, notifyService, func(eventType string, data any) {
+		// Post watchdog events to admin clients
+		clientHub.SendToPermitted(eventType, data, auth.PermConnectionsRead)
+	}, logger, time.Now())
+	if elector != nil {
+		displayWatchdog.SetLeader(elector)
+	}
+	if displayWatchdog.Enabled() {
+		displayWatchdog.Start()
+	}
+
 	// Register routes
+	authHandler.RegisterRoutes(r)
+	apiKeyHandler.RegisterRoutes(r)
+	deviceHandler.RegisterRoutes(r)
+	scheduleHandler.RegisterRoutes(r)
+	bulletinHandler.RegisterRoutes(r)
+	webhookHandler.RegisterRoutes(r)
+	if ingestQueue != nil {
+		api.NewIngestHandler(ingestQueue, logger).RegisterRoutes(r)
+	}
+	connectionHistoryHandler.RegisterRoutes(r)
 	apiHandler.RegisterRoutes(r)
 	weatherHandler.RegisterRoutes(r)
 	hydrantHandler.RegisterRoutes(r)
 
 	// Register WebSocket handlers
+	r.HandleFunc("/ws/ticket", wsHandler.HandleTicketRequest).Methods("POST")
+	r.HandleFunc("/ws/schema", wsHandler.HandleSchema).Methods("GET")
 	r.HandleFunc("/ws/dashboard", wsHandler.HandleDashboardConnection)
 	r.HandleFunc("/ws/client", wsHandler.HandleClientConnection)
 	r.HandleFunc("/ws/logs", wsHandler.HandleLogsConnection)
 
+	// Stream dashboard events as server-sent events where websockets are blocked
+	r.HandleFunc("/events/dashboard", wsHandler.HandleDashboardEvents).Methods("GET")
+
+	// Expose websocket queue and ingestion metrics
+	metricsRegistry := metrics.NewRegistry()
+	wsHandler.RegisterMetrics(metricsRegistry)
+	signatureVerifier.RegisterMetrics(metricsRegistry)
+	if ingestQueue != nil {
+		ingestQueue.RegisterMetrics(metricsRegistry)
+	}
+	r.HandleFunc("/metrics", auth.Require(auth.PermConnectionsRead, metricsRegistry.ServeHTTP)).Methods("GET")
+
 	// Create a logger callback that can use the notifier
 	logMessageCallback := func(message models.WebSocketMessage, source, clientID string) {
 		// Create a log entry
@@ -254,12 +575,50 @@ func main() {
 	logger.Info("Stopping weather service...")
 	weatherService.Stop()
 
+	// Stop the scheduler gracefully
+	if cfg.Scheduler.Enabled {
+		logger.Info("Stopping scheduler...")
+		schedulerService.Stop()
+	}
+
+	// Stop the bulletin service
+	logger.Info("Stopping bulletin service...")
+	bulletinService.Stop()
+
+	// Stop webhook delivery, undelivered events are sent after restart
+	if cfg.Webhook.Enabled {
+		logger.Info("Stopping webhook delivery...")
+		webhookService.Stop()
+	}
+
+	// Stop the display watchdog
+	if displayWatchdog.Enabled() {
+		logger.Info("Stopping display watchdog...")
+		displayWatchdog.Stop()
+	}
+
 	// Shutdown server
 	if err := srv.Shutdown(ctx); err != nil {
 		notifyService.NotifyFatal(err, "Server forced to shutdown")
 		logger.Fatal(err, "Server forced to shutdown")
 	}
 
+	// Stop the ingest queue once no more alerts arrive, alerts not yet stored are kept on disk
+	if ingestQueue != nil {
+		logger.Info("Stopping ingest queue...")
+		ingestQueue.Stop()
+	}
+
+	// Hand leadership to another instance
+	if elector != nil {
+		elector.Stop()
+	}
+
+	// Stop the event bus once no more requests are broadcasting
+	if postgresBus != nil {
+		postgresBus.Stop()
+	}
+
 	logger.Info("Server exited properly")
 }
 